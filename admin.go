@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// setProviderEnabled takes a provider in or out of rotation, returns false if the provider is unknown
+func (r *Router) setProviderEnabled(providerName string, enabled bool) bool {
+	r.ProvidersMu.Lock()
+	defer r.ProvidersMu.Unlock()
+
+	provider, exists := r.Providers[providerName]
+	if !exists {
+		return false
+	}
+
+	provider.Enabled = enabled
+	return true
+}
+
+// HandleAdminEnableProvider puts a provider back into rotation and refreshes the models
+func (r *Router) HandleAdminEnableProvider(w http.ResponseWriter, req *http.Request) {
+	r.handleAdminProviderToggle(w, req, true)
+}
+
+// HandleAdminDisableProvider takes a provider out of rotation and refreshes the models
+func (r *Router) HandleAdminDisableProvider(w http.ResponseWriter, req *http.Request) {
+	r.handleAdminProviderToggle(w, req, false)
+}
+
+func (r *Router) handleAdminProviderToggle(w http.ResponseWriter, req *http.Request, enabled bool) {
+	providerName := req.PathValue("name")
+	if !r.setProviderEnabled(providerName, enabled) {
+		writeOpenAIError(w, http.StatusNotFound, fmt.Sprintf("Provider '%s' not found", providerName), "invalid_request_error", "provider_not_found")
+		return
+	}
+	r.logger.Info("provider toggled by admin", "provider", providerName, "enabled", enabled)
+
+	if err := r.RefreshModels(withoutModelCache(req.Context())); err != nil {
+		r.logger.WithError(err).Error("failed to refresh models after provider toggle", "provider", providerName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, map[string]interface{}{
+		"provider": providerName,
+		"enabled":  enabled,
+	}); err != nil {
+		r.logger.WithError(err).Error("failed to write admin response")
+	}
+}
+
+// HandleAdminRefresh refreshes the models from all providers and returns the number available, with the
+// providers whose models could not be fetched
+func (r *Router) HandleAdminRefresh(w http.ResponseWriter, req *http.Request) {
+	result := map[string]interface{}{}
+	if err := r.RefreshModels(withoutModelCache(req.Context())); err != nil {
+		var refreshErr *ModelRefreshError
+		if !errors.As(err, &refreshErr) {
+			writeOpenAIError(w, http.StatusInternalServerError, fmt.Sprintf("Model refresh failed: %v", err), "server_error", "refresh_failed")
+			return
+		}
+
+		failed := make(map[string]string, len(refreshErr.Providers))
+		for providerName, fetchErr := range refreshErr.Providers {
+			failed[providerName] = fetchErr.Error()
+		}
+		result["errors"] = failed
+	}
+
+	r.ModelMapMu.RLock()
+	result["models"] = len(r.ModelMap)
+	r.ModelMapMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, result); err != nil {
+		r.logger.WithError(err).Error("failed to write admin response")
+	}
+}
+
+// HandleAdminPreviewModels returns the models a refresh would find without applying them
+func (r *Router) HandleAdminPreviewModels(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, r.PreviewModels(req.Context())); err != nil {
+		r.logger.WithError(err).Error("failed to write admin response")
+	}
+}
+
+// HandleAdminReloadTools re-scans the tools and returns the tools now available to MCP clients
+func (r *Router) HandleAdminReloadTools(w http.ResponseWriter, req *http.Request) {
+	if r.mcpServer == nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "MCP server not available", "server_error", "mcp_unavailable")
+		return
+	}
+
+	tools, err := r.mcpServer.ReloadTools(req.Context())
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, fmt.Sprintf("Tool reload failed: %v", err), "server_error", "reload_failed")
+		return
+	}
+	r.logger.Info("tools reloaded by admin", "tools", len(tools))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, map[string]interface{}{
+		"tools": tools,
+	}); err != nil {
+		r.logger.WithError(err).Error("failed to write admin response")
+	}
+}
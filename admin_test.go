@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestAdminProviderToggle tests that a disabled provider is taken out of routing until it is enabled again
+func TestAdminProviderToggle(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"chat-model"}, nil, &callsA)
+	serverB := newChatServer(t, []string{"chat-model", "only-b"}, nil, &callsB)
+
+	config := &Config{
+		Server: ServerConfig{Token: "server-token", AdminToken: "admin-token"},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	admin := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The server token is not accepted once an admin token is set
+	if w := admin("/admin/providers/b/disable", "server-token"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 with the server token, got %d", w.Code)
+	}
+	if w := admin("/admin/providers/missing/disable", "admin-token"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an unknown provider, got %d", w.Code)
+	}
+
+	if w := admin("/admin/providers/b/disable", "admin-token"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+			Model:    "chat-model",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+		}); err != nil {
+			t.Fatalf("CreateChatCompletion failed: %v", err)
+		}
+	}
+	if atomic.LoadInt64(&callsB) != 0 {
+		t.Errorf("Expected no requests routed to the disabled provider, got %d", callsB)
+	}
+	if _, err := router.GetProviderForModel("only-b"); err == nil {
+		t.Error("Expected models only served by the disabled provider to be unavailable")
+	}
+
+	if w := admin("/admin/providers/b/enable", "admin-token"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	provider, err := router.GetProviderForModel("only-b")
+	if err != nil || provider != "b" {
+		t.Errorf("Expected the re-enabled provider to serve its models, got %q, %v", provider, err)
+	}
+}
+
+// TestAdminUsesServerToken tests that the admin endpoints fall back to the server token
+func TestAdminUsesServerToken(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+	config := &Config{
+		Server: ServerConfig{Token: "server-token"},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/providers/a/disable", strings.NewReader("")))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a token, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/providers/a/disable", nil)
+	req.Header.Set("Authorization", "Bearer server-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with the server token, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestAdminRefresh tests that the refresh endpoint picks up models added upstream and returns the count
+func TestAdminRefresh(t *testing.T) {
+	var listed atomic.Int64
+	listed.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		data := []Model{}
+		for i := int64(0); i < listed.Load(); i++ {
+			data = append(data, Model{ID: fmt.Sprintf("model-%d", i), Object: "model"})
+		}
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: data})
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Server: ServerConfig{AdminToken: "admin-token"},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	listed.Store(3)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/refresh", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without the admin token, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/refresh", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result struct {
+		Models int `json:"models"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Models != 3 {
+		t.Errorf("Expected 3 models after the refresh, got %d", result.Models)
+	}
+	if _, err := router.GetProviderForModel("model-2"); err != nil {
+		t.Errorf("Expected the new model to be routable: %v", err)
+	}
+}
+
+// TestRefreshModelsPartialFailure tests that a refresh reports the providers whose models could not be fetched,
+// while the models of the others are still refreshed
+func TestRefreshModelsPartialFailure(t *testing.T) {
+	var calls int64
+	serverA := newChatServer(t, []string{"model-a"}, nil, &calls)
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer serverB.Close()
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	err = router.RefreshModels(context.Background())
+	var refreshErr *ModelRefreshError
+	if !errors.As(err, &refreshErr) {
+		t.Fatalf("Expected a ModelRefreshError, got %v", err)
+	}
+	if len(refreshErr.Providers) != 1 || refreshErr.Providers["b"] == nil {
+		t.Errorf("Expected only provider b to have failed, got %v", refreshErr.Providers)
+	}
+	if !strings.Contains(err.Error(), "b: ") || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the error summary to list provider b, got %q", err.Error())
+	}
+	if _, err := router.GetProviderForModel("model-a"); err != nil {
+		t.Errorf("Expected the models of the working provider to be refreshed: %v", err)
+	}
+
+	// The admin endpoint reports the failure alongside the refreshed models, b is re-enabled so it is fetched again
+	router.EnableProvider("b")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/refresh", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result struct {
+		Models int               `json:"models"`
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Models != 1 || len(result.Errors) != 1 || !strings.Contains(result.Errors["b"], "503") {
+		t.Errorf("Expected 1 model and an error for b, got %+v", result)
+	}
+}
+
+// TestPreviewModels tests that a preview reports the models a refresh would find without changing the live map
+func TestPreviewModels(t *testing.T) {
+	var fetched atomic.Bool
+	serverA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		model := "old-model"
+		if fetched.Swap(true) {
+			model = "new-model"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: model, Object: "model"}, {ID: "shared-model", Object: "model"}}})
+	}))
+	defer serverA.Close()
+
+	var failing atomic.Bool
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: "shared-model", Object: "model"}}})
+	}))
+	defer serverB.Close()
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	failing.Store(true)
+
+	req := httptest.NewRequest("GET", "/admin/models/preview", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var preview ModelPreview
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("Failed to decode preview: %v", err)
+	}
+
+	if len(preview.Models) != 2 || fmt.Sprint(preview.Models["new-model"]) != "[a]" || fmt.Sprint(preview.Models["shared-model"]) != "[a]" {
+		t.Errorf("Expected new-model and shared-model on a, got %v", preview.Models)
+	}
+	if !strings.Contains(preview.Errors["b"], "503") || len(preview.Errors) != 1 {
+		t.Errorf("Expected a fetch error for b, got %v", preview.Errors)
+	}
+
+	// The live map and provider health are unchanged
+	router.ModelMapMu.RLock()
+	_, hasOld := router.ModelMap["old-model"]
+	_, hasNew := router.ModelMap["new-model"]
+	shared := len(router.ModelMap["shared-model"])
+	router.ModelMapMu.RUnlock()
+	if !hasOld || hasNew || shared != 2 {
+		t.Errorf("Expected the live model map to be unchanged, got %v", router.ModelMap)
+	}
+
+	router.ProvidersMu.RLock()
+	healthy := router.Providers["b"].Healthy
+	router.ProvidersMu.RUnlock()
+	if !healthy {
+		t.Error("Expected provider b to remain healthy after a preview")
+	}
+}
+
+// TestAdminReloadTools tests that a tool added on disk is returned by a reload and listed to MCP clients
+func TestAdminReloadTools(t *testing.T) {
+	toolsPath := t.TempDir()
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{ToolsPath: toolsPath},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	toolDir := filepath.Join(toolsPath, "new_tool")
+	os.MkdirAll(toolDir, 0755)
+	os.WriteFile(filepath.Join(toolDir, "tool.toml"), []byte(`
+name = "new_tool"
+description = "Tool added while running"
+script = "script.py"
+`), 0644)
+	os.WriteFile(filepath.Join(toolDir, "script.py"), []byte("print('new')"), 0644)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/tools/reload", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var reloaded struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&reloaded); err != nil {
+		t.Fatalf("Failed to decode reload response: %v", err)
+	}
+	var names []string
+	for _, tool := range reloaded.Tools {
+		names = append(names, tool.Name)
+	}
+	if !slices.Contains(names, "new_tool") || !slices.Contains(names, "execute_code") {
+		t.Errorf("Expected new_tool and execute_code in the reloaded tools, got %v", names)
+	}
+
+	var listResponse struct {
+		Result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+		} `json:"result"`
+	}
+	postMCP(t, router.mcpServer, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}, &listResponse)
+
+	listed := false
+	for _, tool := range listResponse.Result.Tools {
+		listed = listed || tool.Name == "new_tool"
+	}
+	if !listed {
+		t.Errorf("Expected new_tool in tools/list, got %v", listResponse.Result.Tools)
+	}
+}
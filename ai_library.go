@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"slices"
+	"unicode/utf8"
 
 	"github.com/paularlott/mcp"
 	"github.com/paularlott/mcp/openai"
@@ -18,19 +20,51 @@ type RouterInterface interface {
 // AILibrary provides AI completion and tool calling capabilities
 type AILibrary struct {
 	router *Router
+	ctx    context.Context // context the library's requests are made within, carrying any model allowlists
 }
 
 // NewAILibrary creates a new AI library instance
 func NewAILibrary(router *Router) *AILibrary {
 	return &AILibrary{
 		router: router,
+		ctx:    context.Background(),
 	}
 }
 
+// modelAllowlistKey carries the model allowlists of the script tools a context is running within
+type modelAllowlistKey struct{}
+
+// withModelAllowlist restricts the models callable within ctx to models, on top of any allowlist already set, so a
+// script can't reach other models through the tools it calls. Any model may be called when models is empty.
+func withModelAllowlist(ctx context.Context, models []string) context.Context {
+	if len(models) == 0 {
+		return ctx
+	}
+	allowlists, _ := ctx.Value(modelAllowlistKey{}).([][]string)
+	return context.WithValue(ctx, modelAllowlistKey{}, append(slices.Clip(allowlists), models))
+}
+
+// checkModel returns an error if the model isn't in every allowlist the library is running within
+func (ai *AILibrary) checkModel(model string) error {
+	allowlists, _ := ai.ctx.Value(modelAllowlistKey{}).([][]string)
+	for _, models := range allowlists {
+		if !slices.ContainsFunc(models, func(allowed string) bool {
+			return ai.router.normalizeModelID(allowed) == ai.router.normalizeModelID(model)
+		}) {
+			return fmt.Errorf("model %s is not allowed for this tool", model)
+		}
+	}
+	return nil
+}
+
 // GetLibrary returns the scriptling library object for AI operations
 func (ai *AILibrary) GetLibrary() *object.Library {
 	return object.NewLibraryBuilder("ai", "AI completion and tool calling capabilities").
 		FunctionWithHelp("completion", func(model string, messages []map[string]string) (string, error) {
+			if err := ai.checkModel(model); err != nil {
+				return "", err
+			}
+
 			// Convert messages to our format
 			var msgs []Message
 			for _, msg := range messages {
@@ -46,7 +80,7 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 			}
 
 			// Get completion with automatic tool calling
-			resp, err := ai.CreateChatCompletionWithTools(context.Background(), req)
+			resp, err := ai.CreateChatCompletionWithTools(ai.ctx, req)
 			if err != nil {
 				return "", err
 			}
@@ -62,12 +96,16 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 			return "", nil
 		}, "completion(model, messages) - Create a chat completion with automatic tool calling").
 		FunctionWithHelp("embedding", func(model string, input interface{}) ([][]float64, error) {
+			if err := ai.checkModel(model); err != nil {
+				return nil, err
+			}
+
 			req := &EmbeddingRequest{
 				Model: model,
 				Input: input,
 			}
 
-			resp, err := ai.router.CreateEmbedding(context.Background(), req)
+			resp, err := ai.router.CreateEmbedding(ai.ctx, req)
 			if err != nil {
 				return nil, err
 			}
@@ -85,6 +123,9 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 			if ai.router.responsesService == nil {
 				return "", fmt.Errorf("responses service not available")
 			}
+			if err := ai.checkModel(model); err != nil {
+				return "", err
+			}
 
 			// Build the request
 			req := &openai.CreateResponseRequest{
@@ -107,7 +148,7 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 			}
 
 			// Create the response
-			resp, err := ai.router.responsesService.CreateResponse(context.Background(), req, nil)
+			resp, err := ai.router.responsesService.CreateResponse(ai.ctx, req, nil)
 			if err != nil {
 				return "", err
 			}
@@ -120,7 +161,7 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 				return nil, fmt.Errorf("responses service not available")
 			}
 
-			resp, err := ai.router.responsesService.GetResponse(context.Background(), id)
+			resp, err := ai.router.responsesService.GetResponse(ai.ctx, id)
 			if err != nil {
 				return nil, err
 			}
@@ -161,7 +202,7 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 				return fmt.Errorf("responses service not available")
 			}
 
-			return ai.router.responsesService.DeleteResponse(context.Background(), id)
+			return ai.router.responsesService.DeleteResponse(ai.ctx, id)
 		}, "response_delete(id) - Delete a response by ID").
 		FunctionWithHelp("response_cancel", func(id string) (string, error) {
 			// Check if responses service is available
@@ -169,7 +210,7 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 				return "", fmt.Errorf("responses service not available")
 			}
 
-			resp, err := ai.router.responsesService.CancelResponse(context.Background(), id)
+			resp, err := ai.router.responsesService.CancelResponse(ai.ctx, id)
 			if err != nil {
 				return "", err
 			}
@@ -179,96 +220,84 @@ func (ai *AILibrary) GetLibrary() *object.Library {
 		Build()
 }
 
-// CreateChatCompletionWithTools creates a chat completion with automatic tool calling
+// CreateChatCompletionWithTools creates a chat completion with automatic tool calling. Each turn is routed like any
+// other completion and the MCP server's tools are offered alongside the request's own, a call to one of the
+// request's tools ends the loop so the caller can run it.
 func (ai *AILibrary) CreateChatCompletionWithTools(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
-	// Convert our types to openai types
-	openaiReq := openai.ChatCompletionRequest{
-		Model:    req.Model,
-		Messages: convertMessagesToOpenAI(req.Messages),
-		Stream:   req.Stream,
-	}
+	turn := *req
+	turn.Stream = false
+	turn.Messages = slices.Clone(req.Messages)
+	turn.Tools = slices.Clone(req.Tools)
 
-	// Create openai client with MCP server integration
-	var mcpServer openai.MCPServer
+	mcpTools := make(map[string]bool)
 	if ai.router.mcpServer != nil {
-		mcpServer = &openai.MCPServerFuncs{
-			ListToolsFunc: func() []mcp.MCPTool {
-				return ai.router.mcpServer.server.ListTools()
-			},
-			CallToolFunc: func(ctx context.Context, name string, args map[string]any) (*mcp.ToolResponse, error) {
-				return ai.router.mcpServer.server.CallTool(ctx, name, args)
-			},
+		for _, tool := range openai.MCPToolsToOpenAI(ai.router.mcpServer.listTools()) {
+			mcpTools[tool.Function.Name] = true
+			if !slices.ContainsFunc(req.Tools, func(t openai.Tool) bool { return t.Function.Name == tool.Function.Name }) {
+				turn.Tools = append(turn.Tools, tool)
+			}
 		}
 	}
 
-	// Find a provider to use (use first available)
-	var baseURL, apiKey string
-	for _, provider := range ai.router.Providers {
-		if provider.Enabled && provider.Healthy {
-			baseURL = provider.BaseURL
-			apiKey = provider.Token
-			break
+	for range openai.MAX_TOOL_CALL_ITERATIONS {
+		resp, err := ai.router.CreateChatCompletion(ctx, &turn)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 || len(resp.Choices[0].Message.ToolCalls) == 0 {
+			return resp, nil
 		}
-	}
 
-	client, err := openai.New(openai.Config{
-		BaseURL:     baseURL,
-		APIKey:      apiKey,
-		LocalServer: mcpServer,
-	})
-	if err != nil {
-		return nil, err
-	}
+		toolCalls := resp.Choices[0].Message.ToolCalls
+		if slices.ContainsFunc(toolCalls, func(call openai.ToolCall) bool { return !mcpTools[call.Function.Name] }) {
+			return resp, nil
+		}
 
-	// Use the openai client for completion with tool calling
-	openaiResp, err := client.ChatCompletion(ctx, openaiReq)
-	if err != nil {
-		return nil, err
+		results, _ := openai.ExecuteToolCalls(toolCalls, func(name string, args map[string]any) (string, error) {
+			response, err := ai.router.mcpServer.callTool(ctx, name, args)
+			if err != nil {
+				return "", err
+			}
+			return openai.ExtractToolResult(truncateToolResult(response, ai.maxToolResultSize()))
+		}, false)
+		turn.Messages = append(turn.Messages, openai.BuildAssistantToolCallMessage(resp.Choices[0].Message.GetContentAsString(), toolCalls))
+		turn.Messages = append(turn.Messages, results...)
 	}
 
-	// Convert back to our types
-	return convertOpenAIResponseToOurs(openaiResp), nil
+	return nil, openai.NewMaxToolIterationsError(openai.MAX_TOOL_CALL_ITERATIONS)
 }
 
-// Helper functions to convert between types
-func convertMessagesToOpenAI(messages []Message) []openai.Message {
-	result := make([]openai.Message, len(messages))
-	for i, msg := range messages {
-		result[i] = openai.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
+// maxToolResultSize returns the configured max tool result size, 0 when results aren't limited
+func (ai *AILibrary) maxToolResultSize() int {
+	if ai.router.config != nil {
+		return ai.router.config.MCP.MaxToolResultSize
 	}
-	return result
+	return 0
 }
 
-func convertOpenAIResponseToOurs(resp *openai.ChatCompletionResponse) *ChatCompletionResponse {
-	result := &ChatCompletionResponse{
-		ID:      resp.ID,
-		Object:  resp.Object,
-		Created: resp.Created,
-		Model:   resp.Model,
-		Choices: make([]Choice, len(resp.Choices)),
+// truncateToolResult limits the size of a tool result before it is added to the conversation, so a tool
+// returning a huge payload can't exceed the model's context. Oversized results are cut with a marker, a size of
+// 0 or less leaves the result unchanged.
+func truncateToolResult(response *mcp.ToolResponse, maxSize int) *mcp.ToolResponse {
+	if maxSize <= 0 {
+		return response
 	}
-
-	for i, choice := range resp.Choices {
-		result.Choices[i] = Choice{
-			Index: choice.Index,
-			Message: Message{
-				Role:    choice.Message.Role,
-				Content: choice.Message.GetContentAsString(),
-			},
-			FinishReason: choice.FinishReason,
-		}
+	result, err := openai.ExtractToolResult(response)
+	if err != nil || len(result) <= maxSize {
+		return response
 	}
 
-	if resp.Usage != nil {
-		result.Usage = &Usage{
-			PromptTokens:     resp.Usage.PromptTokens,
-			CompletionTokens: resp.Usage.CompletionTokens,
-			TotalTokens:      resp.Usage.TotalTokens,
-		}
-	}
+	truncated := truncateUTF8(result, maxSize)
+	return mcp.NewToolResponseText(fmt.Sprintf("%s\n\n[tool result truncated, showing %d of %d bytes]", truncated, len(truncated), len(result)))
+}
 
-	return result
+// truncateUTF8 returns s cut to at most maxSize bytes on a rune boundary
+func truncateUTF8(s string, maxSize int) string {
+	if len(s) <= maxSize {
+		return s
+	}
+	for maxSize > 0 && !utf8.RuneStart(s[maxSize]) {
+		maxSize--
+	}
+	return s[:maxSize]
 }
\ No newline at end of file
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/paularlott/mcp"
+)
+
+// TestToolResultTruncated tests that an oversized tool result is truncated before being added to the conversation
+func TestToolResultTruncated(t *testing.T) {
+	var toolMessage string
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// Request the tool on the first turn, then answer once the result has been added
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != "tool" {
+			json.NewEncoder(w).Encode(ChatCompletionResponse{
+				ID:    "chatcmpl-test",
+				Model: "chat-model",
+				Choices: []Choice{{
+					Message: Message{
+						Role: "assistant",
+						ToolCalls: []ToolCall{{
+							ID:       "call_1",
+							Type:     "function",
+							Function: ToolCallFunction{Name: "big_tool", Arguments: map[string]any{}},
+						}},
+					},
+					FinishReason: "tool_calls",
+				}},
+			})
+			return
+		}
+
+		toolMessage = last.GetContentAsString()
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Model:   "chat-model",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}},
+		})
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+		MCP: MCPConfig{MaxToolResultSize: 100},
+	}
+
+	router := newTestRouter(t, config)
+
+	router.mcpServer.server.RegisterTool(
+		mcp.NewTool("big_tool", "Returns a large result"),
+		func(ctx context.Context, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+			return mcp.NewToolResponseText(strings.Repeat("x", 10000)), nil
+		},
+	)
+
+	ai := NewAILibrary(router)
+	resp, err := ai.CreateChatCompletionWithTools(context.Background(), &ChatCompletionRequest{
+		Model:    "chat-model",
+		Messages: []Message{{Role: "user", Content: "call the tool"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionWithTools failed: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "done" {
+		t.Errorf("Expected final answer 'done', got %v", resp.Choices[0].Message.Content)
+	}
+
+	if !strings.HasPrefix(toolMessage, strings.Repeat("x", 100)+"\n") || strings.Contains(toolMessage, strings.Repeat("x", 101)) {
+		t.Errorf("Expected tool result truncated to 100 bytes, got %d bytes", len(toolMessage))
+	}
+	if !strings.Contains(toolMessage, "truncated") {
+		t.Errorf("Expected truncation marker in tool result, got %q", toolMessage)
+	}
+}
+
+// TestToolResultNotTruncatedWhenUnlimited tests that a tool result is left unchanged when no size limit is set
+func TestToolResultNotTruncatedWhenUnlimited(t *testing.T) {
+	response := mcp.NewToolResponseText(strings.Repeat("x", 100000))
+	if got := truncateToolResult(response, 0); got != response {
+		t.Errorf("Expected tool result unchanged without a size limit")
+	}
+}
+
+// TestResponseExecutesTools tests that an emulated response requesting tools runs the tool calling loop
+func TestResponseExecutesTools(t *testing.T) {
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// Request the tool on the first turn, then answer using its result
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != "tool" {
+			json.NewEncoder(w).Encode(ChatCompletionResponse{
+				ID:    "chatcmpl-test",
+				Model: "chat-model",
+				Choices: []Choice{{
+					Message: Message{
+						Role: "assistant",
+						ToolCalls: []ToolCall{{
+							ID:       "call_1",
+							Type:     "function",
+							Function: ToolCallFunction{Name: "weather", Arguments: map[string]any{}},
+						}},
+					},
+					FinishReason: "tool_calls",
+				}},
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Model:   "chat-model",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "The forecast is " + last.GetContentAsString()}, FinishReason: "stop"}},
+		})
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	toolCalled := false
+	router.mcpServer.server.RegisterTool(
+		mcp.NewTool("weather", "Returns the weather forecast"),
+		func(ctx context.Context, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+			toolCalled = true
+			return mcp.NewToolResponseText("sunny"), nil
+		},
+	)
+
+	resp, err := router.responsesService.CreateResponse(context.Background(), &CreateResponseRequest{
+		Model: "chat-model",
+		Input: []any{"what's the weather?"},
+		Tools: []Tool{{Type: "function", Function: ToolFunction{Name: "weather"}}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+
+	if !toolCalled {
+		t.Error("Expected the tool to be executed")
+	}
+	if resp.Status != "completed" || len(resp.Output) != 1 {
+		t.Fatalf("Expected a completed response with output, got %+v", resp)
+	}
+	output, _ := json.Marshal(resp.Output)
+	if !strings.Contains(string(output), "The forecast is sunny") {
+		t.Errorf("Expected the tool result in the output, got %s", output)
+	}
+}
+
+// TestToolCompletionRouting tests that tool calling completions are routed to a provider of the model, offer the
+// request's tools alongside the MCP server's, and return calls to the request's tools to the caller
+func TestToolCompletionRouting(t *testing.T) {
+	other := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no completion from the provider without the model, got %s", r.URL.Path)
+		http.Error(w, "wrong provider", http.StatusInternalServerError)
+	}, "other-model")
+
+	var offered []string
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, tool := range req.Tools {
+			offered = append(offered, tool.Function.Name)
+		}
+
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:    "chatcmpl-test",
+			Model: "chat-model",
+			Choices: []Choice{{
+				Message: Message{
+					Role: "assistant",
+					ToolCalls: []ToolCall{{
+						ID:       "call_1",
+						Type:     "function",
+						Function: ToolCallFunction{Name: "lookup", Arguments: map[string]any{"key": "a"}},
+					}},
+				},
+				FinishReason: "tool_calls",
+			}},
+		})
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: other.URL, Enabled: true},
+			{Name: "b", BaseURL: server.URL, Enabled: true},
+		},
+	}
+	router := newTestRouter(t, config)
+	router.mcpServer.server.RegisterTool(
+		mcp.NewTool("weather", "Returns the weather forecast"),
+		func(ctx context.Context, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+			return mcp.NewToolResponseText("sunny"), nil
+		},
+	)
+
+	ctx := WithRouteContext(context.Background())
+	resp, err := router.responsesService.CreateResponse(ctx, &CreateResponseRequest{
+		Model: "chat-model",
+		Input: []any{"look up a"},
+		Tools: []Tool{{Type: "function", Function: ToolFunction{Name: "lookup"}}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+
+	if !slices.Contains(offered, "lookup") || !slices.Contains(offered, "weather") {
+		t.Errorf("Expected the request's and the MCP server's tools to be offered, got %v", offered)
+	}
+	output, _ := json.Marshal(resp.Output)
+	if !strings.Contains(string(output), `"type":"function_call"`) || !strings.Contains(string(output), `"call_id":"call_1"`) {
+		t.Errorf("Expected the call to lookup to be returned, got %s", output)
+	}
+	if provider := ProviderFromContext(ctx); provider != "b" {
+		t.Errorf("Expected the completion to be routed to provider b, got %q", provider)
+	}
+}
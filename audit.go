@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/paularlott/llmrouter/internal/storage"
+)
+
+// auditIDHeader returns the ID of the audit record captured for a completion
+const auditIDHeader = "X-LLMRouter-Audit-ID"
+
+// defaultAuditTTLDays is how long audit records are kept when not configured
+const defaultAuditTTLDays = 30
+
+// newAuditStorage opens the audit storage, returning nil when auditing is disabled
+func newAuditStorage(config *AuditConfig) (storage.AuditStorage, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.StoragePath == "" {
+		return nil, fmt.Errorf("audit storage_path is required")
+	}
+
+	ttlDays := defaultAuditTTLDays
+	if config.TTLDays > 0 {
+		ttlDays = config.TTLDays
+	}
+	return storage.NewAuditStorage(storage.BackendBadger, storage.BackendOptions{
+		Path: config.StoragePath,
+		TTL:  time.Duration(ttlDays) * 24 * time.Hour,
+	})
+}
+
+// auditKey is the context key for the audit record being captured for a request
+type auditKey struct{}
+
+// auditRequest is a completion request awaiting its audit record
+type auditRequest struct {
+	id        string
+	createdAt time.Time
+	body      json.RawMessage
+}
+
+// withAudit returns a context that captures the completion for auditing, the context is returned unchanged when
+// auditing is disabled
+func (r *Router) withAudit(ctx context.Context, body []byte) context.Context {
+	if r.audit == nil {
+		return ctx
+	}
+
+	audit := &auditRequest{id: storage.GenerateAuditID(), createdAt: time.Now(), body: body}
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// auditing returns true if the completion for the request is being captured
+func auditing(ctx context.Context) bool {
+	_, ok := ctx.Value(auditKey{}).(*auditRequest)
+	return ok
+}
+
+// recordAudit stores the audit record for a completed request, if it is being captured, returning the record ID
+// or an empty string when nothing was stored
+func (r *Router) recordAudit(ctx context.Context, route completionRoute, response any, usage *Usage) string {
+	audit, ok := ctx.Value(auditKey{}).(*auditRequest)
+	if !ok {
+		return ""
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to encode audit response", "audit_id", audit.id)
+		return ""
+	}
+
+	record := &storage.AuditRecord{
+		ID:        audit.id,
+		CreatedAt: audit.createdAt,
+		Provider:  route.provider,
+		Model:     route.model,
+		Request:   audit.body,
+		Response:  responseJSON,
+		Tags:      requestTags(ctx),
+	}
+	if usage != nil {
+		record.Usage = storage.AuditUsage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+		}
+	}
+
+	// Store even if the client has gone away, the completion still happened
+	if err := r.audit.Store(context.WithoutCancel(ctx), record); err != nil {
+		r.logger.WithError(err).Error("failed to store audit record", "audit_id", audit.id)
+		return ""
+	}
+	return audit.id
+}
+
+// HandleAdminGetAudit returns a captured audit record by ID
+func (r *Router) HandleAdminGetAudit(w http.ResponseWriter, req *http.Request) {
+	if r.audit == nil {
+		writeOpenAIError(w, http.StatusNotFound, "Auditing is not enabled", "invalid_request_error", "audit_disabled")
+		return
+	}
+
+	id := req.PathValue("id")
+	record, err := r.audit.Get(req.Context(), id)
+	if err != nil {
+		writeOpenAIError(w, http.StatusNotFound, fmt.Sprintf("Audit record '%s' not found", id), "invalid_request_error", "audit_record_not_found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, record); err != nil {
+		r.logger.WithError(err).Error("failed to write audit record")
+	}
+}
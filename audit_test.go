@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paularlott/llmrouter/internal/storage"
+)
+
+// auditID returns the audit record ID sent to the client, from the header or the trailer of a stream
+func auditID(w *httptest.ResponseRecorder) string {
+	if id := w.Header().Get(auditIDHeader); id != "" {
+		return id
+	}
+	return w.Result().Trailer.Get(auditIDHeader)
+}
+
+// TestAuditRecord tests that completions are captured and can be fetched by the audit ID returned to the client
+func TestAuditRecord(t *testing.T) {
+	config := &Config{
+		Audit: AuditConfig{Enabled: true, StoragePath: t.TempDir()},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	router.Providers["a"].Client = &MockClient{Models: []string{"audit-model"}}
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	for _, stream := range []bool{false, true} {
+		body := `{"model":"audit-model","messages":[{"role":"user","content":"hello"}]}`
+		if stream {
+			body = `{"model":"audit-model","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Stream %v: expected 200, got %d: %s", stream, w.Code, w.Body.String())
+		}
+
+		id := auditID(w)
+		if id == "" {
+			t.Fatalf("Stream %v: expected an audit ID header", stream)
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/audit/"+id, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Stream %v: expected 200 fetching the audit record, got %d: %s", stream, w.Code, w.Body.String())
+		}
+
+		var record storage.AuditRecord
+		if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+			t.Fatalf("Stream %v: failed to decode audit record: %v", stream, err)
+		}
+		if record.ID != id || record.Provider != "a" || record.Model != "audit-model" {
+			t.Errorf("Stream %v: expected record %s from a/audit-model, got %s from %s/%s", stream, id, record.ID, record.Provider, record.Model)
+		}
+		if string(record.Request) != body {
+			t.Errorf("Stream %v: expected the request body to be captured, got %s", stream, record.Request)
+		}
+		if !strings.Contains(string(record.Response), "reply from audit-model") {
+			t.Errorf("Stream %v: expected the response content to be captured, got %s", stream, record.Response)
+		}
+		if record.Usage.TotalTokens == 0 || record.CreatedAt.IsZero() {
+			t.Errorf("Stream %v: expected usage and a timestamp, got %+v", stream, record)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/audit/audit_missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown audit ID, got %d", w.Code)
+	}
+}
+
+// TestAuditRecordTags tests that tags from the request metadata and the tags header are captured in the audit
+// record, the header taking precedence and metadata values that aren't strings being ignored
+func TestAuditRecordTags(t *testing.T) {
+	config := &Config{
+		Audit: AuditConfig{Enabled: true, StoragePath: t.TempDir()},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	router.Providers["a"].Client = &MockClient{Models: []string{"audit-model"}}
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"audit-model","stream":%v,"metadata":{"team":"search","env":"dev","priority":1},"messages":[{"role":"user","content":"hello"}]}`, stream)
+		httpReq := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		httpReq.Header.Set(tagsHeader, "env=prod, user = alice")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Stream %v: expected 200, got %d: %s", stream, w.Code, w.Body.String())
+		}
+
+		record, err := router.audit.Get(context.Background(), auditID(w))
+		if err != nil {
+			t.Fatalf("Stream %v: failed to get audit record: %v", stream, err)
+		}
+		expected := map[string]string{"team": "search", "env": "prod", "user": "alice"}
+		if !maps.Equal(record.Tags, expected) {
+			t.Errorf("Stream %v: expected tags %v, got %v", stream, expected, record.Tags)
+		}
+	}
+}
+
+// TestAuditIDOnlyForRecords tests that no audit ID is returned for a completion that failed and was not recorded
+func TestAuditIDOnlyForRecords(t *testing.T) {
+	config := &Config{
+		Audit: AuditConfig{Enabled: true, StoragePath: t.TempDir()},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	client := &MockClient{Models: []string{"audit-model"}}
+	router.Providers["a"].Client = client
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+	client.Err = errors.New("upstream unavailable")
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"audit-model","stream":%v,"messages":[{"role":"user","content":"hello"}]}`, stream)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		if w.Code == http.StatusOK {
+			t.Fatalf("Stream %v: expected the completion to fail", stream)
+		}
+		if id := auditID(w); id != "" {
+			t.Errorf("Stream %v: expected no audit ID for a failed completion, got %s", stream, id)
+		}
+	}
+}
@@ -44,6 +44,11 @@ var ServerCmd = &cli.Command{
 			Usage:      "Bearer token for API authentication",
 			ConfigPath: []string{"server.token"},
 		},
+		&cli.StringFlag{
+			Name:       "responses-backend",
+			Usage:      "Storage backend for responses (memory|badger|sqlite)",
+			ConfigPath: []string{"responses.backend"},
+		},
 		&cli.StringFlag{
 			Name:       "responses-db",
 			Usage:      "Path for persistent storage of responses",
@@ -55,6 +60,41 @@ var ServerCmd = &cli.Command{
 			ConfigPath:   []string{"responses.ttl_days"},
 			DefaultValue: 30,
 		},
+		&cli.IntFlag{
+			Name:         "responses-max-retries",
+			Usage:        "Retries of a failed response completion",
+			ConfigPath:   []string{"responses.max_retries"},
+			DefaultValue: 2,
+		},
+		&cli.IntFlag{
+			Name:         "responses-retry-backoff",
+			Usage:        "Delay in milliseconds before retrying a failed response completion",
+			ConfigPath:   []string{"responses.retry_backoff_ms"},
+			DefaultValue: 1000,
+		},
+		&cli.IntFlag{
+			Name:         "responses-max-concurrent",
+			Usage:        "Maximum number of background responses processed at once",
+			ConfigPath:   []string{"responses.max_concurrent"},
+			DefaultValue: 16,
+		},
+		&cli.IntFlag{
+			Name:         "responses-max-queued",
+			Usage:        "Maximum number of background responses waiting to be processed",
+			ConfigPath:   []string{"responses.max_queued"},
+			DefaultValue: 1000,
+		},
+		&cli.IntFlag{
+			Name:         "responses-poll-interval",
+			Usage:        "Seconds clients should wait before polling a background response (Retry-After)",
+			ConfigPath:   []string{"responses.poll_interval"},
+			DefaultValue: 2,
+		},
+		&cli.BoolFlag{
+			Name:       "stats",
+			Usage:      "Log each provider's requests, errors and tokens when the server stops",
+			ConfigPath: []string{"logging.shutdown_stats"},
+		},
 	},
 	Run: func(ctx context.Context, cmd *cli.Command) error {
 		return server.RunServer(ctx, cmd)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// deprecationHeader warns clients that the model they requested is deprecated
+const deprecationHeader = "X-LLMRouter-Deprecation"
+
+// applyModelDeprecation warns the client and logs when the requested model is deprecated, returning the model to
+// route to: the configured replacement, keeping any pool prefix, or the requested model when it has none
+func (r *Router) applyModelDeprecation(w http.ResponseWriter, model string) string {
+	replacement, deprecated := r.deprecatedModel(model)
+	if !deprecated {
+		return model
+	}
+
+	if replacement == "" {
+		w.Header().Set(deprecationHeader, fmt.Sprintf("model %s is deprecated", model))
+		r.logger.Warn("deprecated model requested", "model", model)
+		return model
+	}
+
+	_, bareModel := r.splitPoolModel(model)
+	routed := model[:len(model)-len(bareModel)] + replacement
+	w.Header().Set(deprecationHeader, fmt.Sprintf("model %s is deprecated, served by %s", model, routed))
+	r.logger.Warn("deprecated model requested", "model", model, "replacement", routed)
+	return routed
+}
+
+// deprecatedModel returns true if the model, without any pool prefix, is deprecated, with its replacement if one
+// is configured. Models with a replacement are deprecated without also being listed.
+func (r *Router) deprecatedModel(model string) (string, bool) {
+	_, bareModel := r.splitPoolModel(model)
+	normalized := r.normalizeModelID(bareModel)
+
+	for deprecated, replacement := range r.config.DeprecatedModels.Replacements {
+		if r.normalizeModelID(deprecated) == normalized {
+			return replacement, true
+		}
+	}
+	for _, deprecated := range r.config.DeprecatedModels.Models {
+		if r.normalizeModelID(deprecated) == normalized {
+			return "", true
+		}
+	}
+	return "", false
+}
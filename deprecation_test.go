@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestModelDeprecationHeader tests that requests for deprecated models are served with a deprecation warning,
+// routed to the replacement when one is configured
+func TestModelDeprecationHeader(t *testing.T) {
+	clients := map[string]*MockClient{
+		"a": {Models: []string{"old-model", "current-model", "new-model"}},
+	}
+	router := newMockRouter(t, clients)
+	router.config.DeprecatedModels = DeprecatedModelsConfig{
+		Models:       []string{"old-model"},
+		Replacements: map[string]string{"retired-model": "new-model"},
+	}
+
+	tests := []struct {
+		model       string
+		deprecation string
+		routedTo    string
+	}{
+		{"current-model", "", "current-model"},
+		{"old-model", "model old-model is deprecated", "old-model"},
+		{"retired-model", "model retired-model is deprecated, served by new-model", "new-model"},
+	}
+	for _, tt := range tests {
+		body := `{"model":"` + tt.model + `","messages":[{"role":"user","content":"hi"}]}`
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.model, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get(deprecationHeader); got != tt.deprecation {
+			t.Errorf("%s: expected deprecation header %q, got %q", tt.model, tt.deprecation, got)
+		}
+		requests := clients["a"].Requests()
+		if routed := requests[len(requests)-1]; routed != tt.routedTo {
+			t.Errorf("%s: expected the request to be routed to %s, got %s", tt.model, tt.routedTo, routed)
+		}
+	}
+}
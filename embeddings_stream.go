@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ndjsonContentType in the Accept header streams embeddings as one JSON line per input as each batch completes
+const ndjsonContentType = "application/x-ndjson"
+
+// embeddingStreamBatchSize is the number of inputs sent upstream in each request when streaming embeddings
+const embeddingStreamBatchSize = 32
+
+// wantsNDJSON returns true if the client accepts an NDJSON stream
+func wantsNDJSON(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), ndjsonContentType)
+}
+
+// embeddingBatches splits an embedding input into batches of at most size inputs, a single string or token array is one batch
+func embeddingBatches(input interface{}, size int) []interface{} {
+	inputs, ok := input.([]interface{})
+	if !ok || len(inputs) == 0 {
+		return []interface{}{input}
+	}
+
+	// An array of numbers is a single tokenized input
+	if _, isToken := inputs[0].(float64); isToken {
+		return []interface{}{input}
+	}
+
+	batches := make([]interface{}, 0, (len(inputs)+size-1)/size)
+	for start := 0; start < len(inputs); start += size {
+		end := min(start+size, len(inputs))
+		batches = append(batches, inputs[start:end])
+	}
+	return batches
+}
+
+// streamEmbeddings sends the inputs upstream in batches and writes each embedding as an NDJSON line as its
+// batch completes, indexes are across the whole request. An error before any output is returned as a normal
+// error response, after that it is written as a final error line.
+func (r *Router) streamEmbeddings(ctx context.Context, w http.ResponseWriter, embeddingReq *EmbeddingRequest) {
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	offset := 0
+	for i, batch := range embeddingBatches(embeddingReq.Input, embeddingStreamBatchSize) {
+		batchReq := *embeddingReq
+		batchReq.Input = batch
+
+		resp, err := r.CreateEmbedding(ctx, &batchReq)
+		if err != nil {
+			r.logger.WithError(err).Error("embedding request failed", "batch", i, "stream", true)
+
+			if i == 0 {
+				if errors.Is(err, errProviderOverride) {
+					writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "provider_not_available")
+				} else if errors.Is(err, ErrModelNotFound) {
+					writeOpenAIError(w, http.StatusNotFound, err.Error(), "invalid_request_error", "model_not_found")
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			encoder.Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message": fmt.Sprintf("embedding batch %d failed: %v", i, err),
+					"type":    "server_error",
+				},
+			})
+			return
+		}
+
+		if i == 0 {
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+		}
+
+		// Providers return a batch in input order but index it from zero, number it within the whole request
+		sort.Slice(resp.Data, func(a, b int) bool {
+			return resp.Data[a].Index < resp.Data[b].Index
+		})
+		for _, embedding := range resp.Data {
+			embedding.Index += offset
+			if err := encoder.Encode(embedding); err != nil {
+				r.logger.WithError(err).Error("failed to write embedding")
+				return
+			}
+		}
+		offset += len(resp.Data)
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestEmbeddingsNDJSONStream tests that embeddings are streamed as NDJSON lines in input order across batches
+func TestEmbeddingsNDJSONStream(t *testing.T) {
+	var mu sync.Mutex
+	var batchSizes []int
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		batchSizes = append(batchSizes, len(req.Input))
+		mu.Unlock()
+
+		// Each vector is the number of its input, indexed within the batch
+		data := make([]Embedding, len(req.Input))
+		for i, input := range req.Input {
+			n, _ := strconv.Atoi(strings.TrimPrefix(input, "input-"))
+			data[i] = Embedding{Object: "embedding", Index: i, Embedding: []float64{float64(n)}}
+		}
+		json.NewEncoder(w).Encode(EmbeddingResponse{Object: "list", Model: "embed-model", Data: data})
+	}, "embed-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	const inputs = 70
+	input := make([]string, inputs)
+	for i := range input {
+		input[i] = fmt.Sprintf("input-%d", i)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"model": "embed-model", "input": input})
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", bytes.NewReader(body))
+	req.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %q", ct)
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var embedding Embedding
+		if err := json.Unmarshal(scanner.Bytes(), &embedding); err != nil {
+			t.Fatalf("Line %d is not an embedding: %s", lines, scanner.Text())
+		}
+		if embedding.Index != lines || len(embedding.Embedding) != 1 || embedding.Embedding[0] != float64(lines) {
+			t.Errorf("Line %d: expected index and vector %d, got %+v", lines, lines, embedding)
+		}
+		lines++
+	}
+	if lines != inputs {
+		t.Errorf("Expected %d lines, got %d", inputs, lines)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(batchSizes) != "[32 32 6]" {
+		t.Errorf("Expected upstream batches of [32 32 6], got %v", batchSizes)
+	}
+}
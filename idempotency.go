@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+// idempotencyHeader lets a client retry a chat completion without it being sent to the provider again
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader marks a response returned from the idempotency cache
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// defaultIdempotencyTTL is how long a completed response is returned for a repeated idempotency key
+const defaultIdempotencyTTL = 10 * time.Minute
+
+// errIdempotencyKeyReused is returned when a key is sent again with a different request body
+var errIdempotencyKeyReused = errors.New("idempotency key has already been used for a different request")
+
+// idempotencyRequest identifies a request sent with an idempotency key
+type idempotencyRequest struct {
+	key  string   // client scoped key
+	hash [32]byte // hash of the request body
+}
+
+// newIdempotencyRequest scopes the key to the client's credentials so clients can't see each other's responses
+func newIdempotencyRequest(key, authorization string, body []byte) *idempotencyRequest {
+	return &idempotencyRequest{
+		key:  authorization + "\x00" + key,
+		hash: sha256.Sum256(body),
+	}
+}
+
+// idempotentResult is a chat completion in progress or completed for an idempotency key
+type idempotentResult struct {
+	hash    [32]byte
+	done    chan struct{} // closed when the completion finishes
+	result  *chatCompletionResult
+	err     error
+	expires time.Time // zero while in progress
+}
+
+// idempotencyCache shares chat completion results between requests with the same idempotency key
+type idempotencyCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	results  map[string]*idempotentResult
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	c := &idempotencyCache{
+		ttl:     ttl,
+		results: make(map[string]*idempotentResult),
+		stop:    make(chan struct{}),
+	}
+	go c.sweep()
+	return c
+}
+
+// sweep periodically drops expired results so keys that are never repeated don't accumulate, until the cache is closed
+func (c *idempotencyCache) sweep() {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired(time.Now())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// removeExpired drops the completed results that expired before now
+func (c *idempotencyCache) removeExpired(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, result := range c.results {
+		if !result.expires.IsZero() && now.After(result.expires) {
+			delete(c.results, key)
+		}
+	}
+}
+
+// close stops the background sweep of expired results
+func (c *idempotencyCache) close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// do runs fn once per key, requests repeating a key wait for and return the first request's result.
+// Failures are not kept so the request can be retried. Returns true if the result was replayed.
+func (c *idempotencyCache) do(ctx context.Context, req *idempotencyRequest, fn func() (*chatCompletionResult, error)) (*chatCompletionResult, bool, error) {
+	c.mu.Lock()
+
+	// An expired result that hasn't been swept yet is replaced by running fn again
+	if result, exists := c.results[req.key]; exists && (result.expires.IsZero() || time.Now().Before(result.expires)) {
+		c.mu.Unlock()
+
+		if result.hash != req.hash {
+			return nil, false, errIdempotencyKeyReused
+		}
+
+		select {
+		case <-result.done:
+			return result.result, true, result.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	result := &idempotentResult{hash: req.hash, done: make(chan struct{})}
+	c.results[req.key] = result
+	c.mu.Unlock()
+
+	result.result, result.err = fn()
+
+	c.mu.Lock()
+	if result.err != nil {
+		delete(c.results, req.key)
+	} else {
+		result.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	close(result.done)
+
+	return result.result, false, result.err
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestIdempotencyKey tests that requests repeating an idempotency key are only sent to the provider once
+func TestIdempotencyKey(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	send := func(key, content string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model":"chat-model","messages":[{"role":"user","content":"`+content+`"}]}`))
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("key-1", "hi")
+	second := send("key-1", "hi")
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for both requests, got %d and %d", first.Code, second.Code)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the provider to be called once, got %d", calls)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("Expected the same response for a repeated key, got %s and %s", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Expected only the repeated request to be marked as replayed")
+	}
+
+	if w := send("key-1", "something else"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 when a key is reused for a different request, got %d", w.Code)
+	}
+
+	if w := send("key-2", "hi"); w.Code != http.StatusOK || calls != 2 {
+		t.Errorf("Expected a new key to call the provider, got %d with %d calls", w.Code, calls)
+	}
+}
+
+// TestIdempotencyCacheInFlight tests that a repeated key waits for the request in progress rather than running again
+func TestIdempotencyCacheInFlight(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	defer cache.close()
+	req := newIdempotencyRequest("key", "Bearer token", []byte("body"))
+
+	var calls int64
+	release := make(chan struct{})
+	complete := func() (*chatCompletionResult, error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return &chatCompletionResult{resp: &ChatCompletionResponse{ID: "chatcmpl-1"}}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*chatCompletionResult, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = cache.do(context.Background(), req, complete)
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected one completion for concurrent requests, got %d", calls)
+	}
+	for i, result := range results {
+		if result == nil || result.resp.ID != "chatcmpl-1" {
+			t.Errorf("Expected request %d to get the shared response, got %+v", i, result)
+		}
+	}
+
+	// Another client using the same key gets its own result
+	other := newIdempotencyRequest("key", "Bearer other", []byte("body"))
+	if _, replayed, _ := cache.do(context.Background(), other, complete); replayed || calls != 2 {
+		t.Errorf("Expected keys to be scoped to the client, replayed %v with %d calls", replayed, calls)
+	}
+}
+
+// TestIdempotencyCacheExpiry tests that expired results are not replayed and are removed by the sweep
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	defer cache.close()
+
+	var calls int64
+	complete := func() (*chatCompletionResult, error) {
+		atomic.AddInt64(&calls, 1)
+		return &chatCompletionResult{resp: &ChatCompletionResponse{ID: "chatcmpl-1"}}, nil
+	}
+
+	req := newIdempotencyRequest("key", "Bearer token", []byte("body"))
+	cache.do(context.Background(), req, complete)
+	cache.do(context.Background(), newIdempotencyRequest("other", "Bearer token", []byte("body")), complete)
+	if _, replayed, _ := cache.do(context.Background(), req, complete); !replayed || calls != 2 {
+		t.Fatalf("Expected the result to be replayed within the TTL, replayed %v with %d calls", replayed, calls)
+	}
+
+	// Sweeping within the TTL keeps the results
+	cache.removeExpired(time.Now())
+	if len(cache.results) != 2 {
+		t.Fatalf("Expected 2 results within the TTL, got %d", len(cache.results))
+	}
+
+	// An expired result runs the request again even before it is swept
+	cache.mu.Lock()
+	cache.results[req.key].expires = time.Now().Add(-time.Second)
+	cache.mu.Unlock()
+	if _, replayed, _ := cache.do(context.Background(), req, complete); replayed || calls != 3 {
+		t.Errorf("Expected an expired result to run again, replayed %v with %d calls", replayed, calls)
+	}
+
+	cache.removeExpired(time.Now().Add(2 * time.Minute))
+	if len(cache.results) != 0 {
+		t.Errorf("Expected expired results to be swept, got %d", len(cache.results))
+	}
+}
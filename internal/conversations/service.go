@@ -16,24 +16,18 @@ type Service struct {
 }
 
 func NewService(config *types.ConversationsConfig) (*Service, error) {
-	var store storage.ConversationStorage
-	var err error
-
-	if config.StoragePath == "" {
-		// Use memory storage when no storage path specified
-		store = storage.NewMemoryConversationStorage()
-	} else {
-		storagePath := config.StoragePath
-
-		ttl := time.Duration(config.TTLDays) * 24 * time.Hour
-		if config.TTLDays == 0 {
-			ttl = 30 * 24 * time.Hour // Default 30 days
-		}
+	ttl := time.Duration(config.TTLDays) * 24 * time.Hour
+	if config.TTLDays == 0 {
+		ttl = 30 * 24 * time.Hour // Default 30 days
+	}
 
-		store, err = storage.NewBadgerConversationStorage(storagePath, ttl)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create badger storage: %w", err)
-		}
+	store, err := storage.NewConversationStorage(storage.ResolveBackend(config.Backend, config.StoragePath), storage.BackendOptions{
+		Path:       config.StoragePath,
+		TTL:        ttl,
+		SlidingTTL: config.SlidingTTL,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &Service{
@@ -46,23 +40,11 @@ func (s *Service) CreateConversation(ctx context.Context, req *openai.CreateConv
 	conversationID := storage.GenerateConversationID()
 	now := time.Now()
 
-	// Initialize items with IDs and status
-	items := make([]openai.ConversationItem, len(req.Items))
-	for i, item := range req.Items {
-		if item.ID == "" {
-			item.ID = storage.GenerateMessageID()
-		}
-		if item.Status == "" {
-			item.Status = "completed"
-		}
-		items[i] = item
-	}
-
 	storedConversation := &storage.StoredConversation{
 		ID:        conversationID,
 		CreatedAt: now,
 		Metadata:  req.Metadata,
-		Items:     items,
+		Items:     newItems(storedItems(req.Items), now),
 	}
 
 	if err := s.storage.Store(ctx, storedConversation); err != nil {
@@ -140,29 +122,27 @@ func (s *Service) ListItems(ctx context.Context, conversationID string, after st
 }
 
 func (s *Service) CreateItems(ctx context.Context, conversationID string, req *openai.CreateItemsRequest, include []string) (*openai.ConversationItemListResponse, error) {
+	return s.AddItems(ctx, conversationID, storedItems(req.Items), include)
+}
+
+// AddItems adds items to a conversation, items without a created_at are created now
+func (s *Service) AddItems(ctx context.Context, conversationID string, stored []storage.StoredItem, include []string) (*openai.ConversationItemListResponse, error) {
 	// Validate conversation exists
 	_, err := s.storage.Get(ctx, conversationID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Initialize items with IDs and status
-	items := make([]openai.ConversationItem, len(req.Items))
-	for i, item := range req.Items {
-		if item.ID == "" {
-			item.ID = storage.GenerateMessageID()
-		}
-		if item.Status == "" {
-			item.Status = "completed"
-		}
-		items[i] = item
-	}
-
-	if err := s.storage.AddItems(ctx, conversationID, items); err != nil {
+	stored = newItems(stored, time.Now())
+	if err := s.storage.AddItems(ctx, conversationID, stored); err != nil {
 		return nil, fmt.Errorf("failed to add items: %w", err)
 	}
 
 	// Return the created items
+	items := make([]openai.ConversationItem, len(stored))
+	for i, item := range stored {
+		items[i] = item.ConversationItem
+	}
 	response := &openai.ConversationItemListResponse{
 		Object:  "list",
 		Data:    items,
@@ -177,6 +157,33 @@ func (s *Service) CreateItems(ctx context.Context, conversationID string, req *o
 	return response, nil
 }
 
+// storedItems returns items to be stored with no created_at set
+func storedItems(items []openai.ConversationItem) []storage.StoredItem {
+	stored := make([]storage.StoredItem, len(items))
+	for i, item := range items {
+		stored[i] = storage.StoredItem{ConversationItem: item}
+	}
+	return stored
+}
+
+// newItems initializes items being added with IDs and status, and created at now unless already set
+func newItems(items []storage.StoredItem, now time.Time) []storage.StoredItem {
+	initialized := make([]storage.StoredItem, len(items))
+	for i, item := range items {
+		if item.ID == "" {
+			item.ID = storage.GenerateMessageID()
+		}
+		if item.Status == "" {
+			item.Status = "completed"
+		}
+		if item.CreatedAt == 0 {
+			item.CreatedAt = now.Unix()
+		}
+		initialized[i] = item
+	}
+	return initialized
+}
+
 func (s *Service) GetItem(ctx context.Context, conversationID string, itemID string, include []string) (*openai.ConversationItem, error) {
 	item, err := s.storage.GetItem(ctx, conversationID, itemID)
 	if err != nil {
@@ -0,0 +1,56 @@
+package conversations
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/paularlott/llmrouter/internal/storage"
+	"github.com/paularlott/llmrouter/internal/types"
+)
+
+func TestNewServiceBackendSelection(t *testing.T) {
+	tests := []struct {
+		name   string
+		config types.ConversationsConfig
+		check  func(storage.ConversationStorage) bool
+	}{
+		{"default without path", types.ConversationsConfig{}, isMemory},
+		{"default with path", types.ConversationsConfig{StoragePath: filepath.Join(t.TempDir(), "default")}, isBadger},
+		{"memory", types.ConversationsConfig{Backend: "memory", StoragePath: filepath.Join(t.TempDir(), "unused")}, isMemory},
+		{"badger", types.ConversationsConfig{Backend: "badger", StoragePath: filepath.Join(t.TempDir(), "badger")}, isBadger},
+		{"sqlite", types.ConversationsConfig{Backend: "sqlite", StoragePath: filepath.Join(t.TempDir(), "llmrouter.db")}, isSQLite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, err := NewService(&tt.config)
+			if err != nil {
+				t.Fatalf("NewService failed: %v", err)
+			}
+			defer service.Close()
+
+			if !tt.check(service.storage) {
+				t.Errorf("unexpected storage type %T", service.storage)
+			}
+		})
+	}
+
+	if _, err := NewService(&types.ConversationsConfig{Backend: "unknown"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func isMemory(s storage.ConversationStorage) bool {
+	_, ok := s.(*storage.MemoryConversationStorage)
+	return ok
+}
+
+func isBadger(s storage.ConversationStorage) bool {
+	_, ok := s.(*storage.BadgerConversationStorage)
+	return ok
+}
+
+func isSQLite(s storage.ConversationStorage) bool {
+	_, ok := s.(*storage.SQLiteConversationStorage)
+	return ok
+}
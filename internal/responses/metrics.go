@@ -0,0 +1,35 @@
+package responses
+
+import "sync/atomic"
+
+// Metrics is a snapshot of the responses handled by the service since it started
+type Metrics struct {
+	Pending    int64 // created and waiting to be processed
+	InProgress int64 // being processed
+	Completed  int64 // processed successfully
+	Failed     int64 // processing failed after any retries
+	Cancelled  int64 // cancelled by a client
+	QueueDepth int64 // background responses waiting for a free worker
+}
+
+// serviceMetrics are the counters behind Metrics
+type serviceMetrics struct {
+	pending    atomic.Int64
+	inProgress atomic.Int64
+	completed  atomic.Int64
+	failed     atomic.Int64
+	cancelled  atomic.Int64
+	queued     atomic.Int64
+}
+
+// Metrics returns the current response counts
+func (s *Service) Metrics() Metrics {
+	return Metrics{
+		Pending:    s.metrics.pending.Load(),
+		InProgress: s.metrics.inProgress.Load(),
+		Completed:  s.metrics.completed.Load(),
+		Failed:     s.metrics.failed.Load(),
+		Cancelled:  s.metrics.cancelled.Load(),
+		QueueDepth: s.metrics.queued.Load(),
+	}
+}
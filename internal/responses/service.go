@@ -2,20 +2,71 @@ package responses
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/paularlott/llmrouter/internal/storage"
 	"github.com/paularlott/llmrouter/internal/types"
 	"github.com/paularlott/llmrouter/log"
+	"github.com/paularlott/logger"
 	"github.com/paularlott/mcp/openai"
 )
 
+// defaultRetryBackoff is the delay before the first retry of a failed completion
+const defaultRetryBackoff = time.Second
+
+// closeTimeout is how long Close waits for background responses to finish before cancelling them, and again for
+// them to stop before closing storage
+const closeTimeout = 30 * time.Second
+
+// defaultMaxConcurrent is the number of background responses processed at once when not configured
+const defaultMaxConcurrent = 16
+
+// defaultMaxQueued is the number of background responses waiting for a worker when not configured, further
+// responses are rejected with ErrBusy
+const defaultMaxQueued = 1000
+
 type Service struct {
-	storage storage.ResponseStorage
-	config  *types.ResponsesConfig
-	router  ChatCompletionRouter
+	storage       storage.ResponseStorage
+	config        *types.ResponsesConfig
+	router        ChatCompletionRouter
+	conversations ConversationStore       // optional, receives the items of responses attached to a conversation
+	queue         chan backgroundResponse // background responses waiting for one of the workers
+	metrics       serviceMetrics
+	statusMu      sync.Mutex     // serializes status changes, so a cancellation isn't overwritten by processing
+	processing    sync.WaitGroup // background responses not yet finished
+	closeMu       sync.Mutex     // guards closed, so no background response is queued once Close is waiting
+	closed        bool
+	ctx           context.Context // background responses are processed within it, cancelled when Close times out
+	cancel        context.CancelFunc
+	closeTimeout  time.Duration
+	logger        logger.Logger
+}
+
+// ConversationStore is the conversations service used to record responses attached to a conversation
+type ConversationStore interface {
+	GetConversation(ctx context.Context, id string) (*openai.Conversation, error)
+	CreateItems(ctx context.Context, conversationID string, req *openai.CreateItemsRequest, include []string) (*openai.ConversationItemListResponse, error)
+}
+
+type conversationKey struct{}
+
+type tagsKey struct{}
+
+// WithConversation returns a context that attaches the response created with it to a conversation,
+// the response input and output are appended to the conversation once the response completes
+func WithConversation(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, conversationID)
+}
+
+// WithTags returns a context that attaches the tags to the stored record of the response created with it
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, tagsKey{}, tags)
 }
 
 // ChatCompletionRouter interface for processing chat completions
@@ -23,38 +74,127 @@ type ChatCompletionRouter interface {
 	CreateChatCompletion(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error)
 }
 
+// ToolCompletionRouter is implemented by routers that can execute tool calls during a chat completion
+type ToolCompletionRouter interface {
+	CreateChatCompletionWithTools(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error)
+}
+
 func NewService(config *types.ResponsesConfig, router ChatCompletionRouter) (*Service, error) {
-	var store storage.ResponseStorage
-	var err error
-
-	if config.StoragePath == "" {
-		// Use memory storage when no storage path specified
-		store = storage.NewMemoryStorage()
-	} else {
-		storagePath := config.StoragePath
-
-		ttl := time.Duration(config.TTLDays) * 24 * time.Hour
-		if config.TTLDays == 0 {
-			ttl = 30 * 24 * time.Hour // Default 30 days
-		}
+	ttl := time.Duration(config.TTLDays) * 24 * time.Hour
+	if config.TTLDays == 0 {
+		ttl = 30 * 24 * time.Hour // Default 30 days
+	}
+
+	store, err := storage.NewResponseStorage(storage.ResolveBackend(config.Backend, config.StoragePath), storage.BackendOptions{
+		Path: config.StoragePath,
+		TTL:  ttl,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	maxConcurrent := config.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrent
+	}
+	maxQueued := config.MaxQueued
+	if maxQueued <= 0 {
+		maxQueued = defaultMaxQueued
+	}
+
+	service := &Service{
+		storage:      store,
+		config:       config,
+		router:       router,
+		queue:        make(chan backgroundResponse, maxQueued),
+		closeTimeout: closeTimeout,
+		logger:       log.GetLogger(),
+	}
+	service.ctx, service.cancel = context.WithCancel(context.Background())
+	for range maxConcurrent {
+		go service.worker()
+	}
+	return service, nil
+}
+
+// backgroundResponse is a background response queued for processing
+type backgroundResponse struct {
+	id             string
+	req            *openai.CreateResponseRequest
+	completionFunc CompletionFunc
+}
 
-		store, err = storage.NewBadgerStorage(storagePath, ttl)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create badger storage: %w", err)
+// worker processes queued background responses until the queue is closed, those still queued when the service
+// closes are abandoned
+func (s *Service) worker() {
+	for job := range s.queue {
+		s.metrics.queued.Add(-1)
+		if s.isClosed() {
+			s.abandonResponse(job.id)
+		} else {
+			s.processResponse(s.ctx, job.id, job.req, job.completionFunc)
 		}
+		s.processing.Done()
 	}
+}
 
-	return &Service{
-		storage: store,
-		config:  config,
-		router:  router,
-	}, nil
+// enqueue queues a background response for the workers, failing with ErrBusy when the queue is full or ErrClosed
+// once the service is closing
+func (s *Service) enqueue(job backgroundResponse) error {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.processing.Add(1)
+	s.metrics.queued.Add(1)
+	select {
+	case s.queue <- job:
+		return nil
+	default:
+		s.metrics.queued.Add(-1)
+		s.processing.Done()
+		return ErrBusy
+	}
+}
+
+// isClosed reports if Close has been called
+func (s *Service) isClosed() bool {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	return s.closed
+}
+
+// SetLogger sets the logger the service writes to, in place of the shared logger
+func (s *Service) SetLogger(logger logger.Logger) {
+	s.logger = logger
+}
+
+// SetConversations sets the conversations service responses can be attached to
+func (s *Service) SetConversations(conversations ConversationStore) {
+	s.conversations = conversations
 }
 
 // CompletionFunc is a function that creates a chat completion
 type CompletionFunc func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error)
 
 func (s *Service) CreateResponse(ctx context.Context, req *openai.CreateResponseRequest, completionFunc CompletionFunc) (*openai.ResponseObject, error) {
+	if _, err := inputMessages(req.Input); err != nil {
+		return nil, err
+	}
+
+	// Check the conversation exists before accepting the response, on either path
+	if conversationID, _ := ctx.Value(conversationKey{}).(string); conversationID != "" {
+		if s.conversations == nil {
+			return nil, ErrConversationsUnavailable
+		}
+		if _, err := s.conversations.GetConversation(ctx, conversationID); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+		}
+	}
+
 	// Check if the model's provider supports native responses
 	if providerName, err := s.getProviderForModel(req.Model); err == nil {
 		if provider := s.getProvider(providerName); provider != nil && provider.GetNativeResponses() {
@@ -69,8 +209,17 @@ func (s *Service) CreateResponse(ctx context.Context, req *openai.CreateResponse
 
 // createEmulatedResponse handles the existing emulation logic
 func (s *Service) createEmulatedResponse(ctx context.Context, req *openai.CreateResponseRequest, completionFunc CompletionFunc) (*openai.ResponseObject, error) {
+	// Responses not stored are only kept while they are processed, background responses are fetched later so must be
+	store := req.Store == nil || *req.Store
+	if !store && req.Background {
+		return nil, fmt.Errorf("%w: background responses must be stored, store=false requires background=false", ErrInvalidInput)
+	}
+
+	conversationID, _ := ctx.Value(conversationKey{}).(string)
+
 	responseID := storage.GenerateResponseID()
 	now := time.Now()
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
 
 	storedResponse := &storage.StoredResponse{
 		ID:        responseID,
@@ -84,25 +233,34 @@ func (s *Service) createEmulatedResponse(ctx context.Context, req *openai.Create
 			"modalities":   req.Modalities,
 			"tools":        req.Tools,
 			"metadata":     req.Metadata,
+			"conversation": conversationID,
 		},
 		Response: map[string]interface{}{},
 		Metadata: storage.ResponseMetadata{
 			Model:     req.Model,
 			CreatedAt: now,
 			UpdatedAt: now,
+			Tags:      tags,
 		},
 	}
 
 	if err := s.storage.Store(ctx, storedResponse); err != nil {
 		return nil, fmt.Errorf("failed to store response: %w", err)
 	}
+	s.metrics.pending.Add(1)
 
 	// Check if background processing is requested
 	background := req.Background
 
 	if background {
-		// Process the response asynchronously
-		go s.processResponse(context.Background(), responseID, req, completionFunc)
+		// Process the response asynchronously, it stays pending until a worker is free
+		if err := s.enqueue(backgroundResponse{id: responseID, req: req, completionFunc: completionFunc}); err != nil {
+			s.metrics.pending.Add(-1)
+			if deleteErr := s.storage.Delete(ctx, responseID); deleteErr != nil {
+				s.logger.Error("failed to delete rejected response", "response_id", responseID, "error", deleteErr)
+			}
+			return nil, err
+		}
 
 		// Create response object with pending status
 		responseObj := &openai.ResponseObject{
@@ -134,7 +292,13 @@ func (s *Service) createEmulatedResponse(ctx context.Context, req *openai.Create
 	s.processResponse(ctx, responseID, req, completionFunc)
 
 	// Retrieve the completed response
-	return s.GetResponse(ctx, responseID)
+	response, err := s.GetResponse(ctx, responseID)
+	if !store {
+		if deleteErr := s.storage.Delete(ctx, responseID); deleteErr != nil {
+			s.logger.Error("failed to delete unstored response", "response_id", responseID, "error", deleteErr)
+		}
+	}
+	return response, err
 }
 
 func (s *Service) GetResponse(ctx context.Context, id string) (*openai.ResponseObject, error) {
@@ -211,25 +375,117 @@ func (s *Service) ListResponses(ctx context.Context, filter storage.ResponseFilt
 }
 
 func (s *Service) DeleteResponse(ctx context.Context, id string) error {
-	return s.storage.Delete(ctx, id)
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	stored, err := s.storage.Get(ctx, id)
+	if err != nil {
+		return s.storage.Delete(ctx, id)
+	}
+	if err := s.storage.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.leaveStatus(stored.Status)
+	return nil
 }
 
+// CancelResponse cancels a response that is pending or in progress, responses that have finished are returned
+// unchanged
 func (s *Service) CancelResponse(ctx context.Context, id string) (*openai.ResponseObject, error) {
-	if err := s.storage.UpdateStatus(ctx, id, storage.StatusCancelled); err != nil {
+	s.statusMu.Lock()
+	stored, err := s.storage.Get(ctx, id)
+	if err != nil {
+		s.statusMu.Unlock()
 		return nil, err
 	}
+	if stored.Status == storage.StatusPending || stored.Status == storage.StatusInProgress {
+		if err := s.storage.UpdateStatus(ctx, id, storage.StatusCancelled); err != nil {
+			s.statusMu.Unlock()
+			return nil, err
+		}
+		s.leaveStatus(stored.Status)
+		s.metrics.cancelled.Add(1)
+	}
+	s.statusMu.Unlock()
 
 	return s.GetResponse(ctx, id)
 }
 
+// leaveStatus updates the gauges for a response moving out of a status
+func (s *Service) leaveStatus(status storage.ResponseStatus) {
+	switch status {
+	case storage.StatusPending:
+		s.metrics.pending.Add(-1)
+	case storage.StatusInProgress:
+		s.metrics.inProgress.Add(-1)
+	}
+}
+
 func (s *Service) CompactResponses(ctx context.Context) error {
 	return s.storage.RunGC()
 }
 
+// Close stops queued background responses from starting and waits for those in progress to finish. After a timeout
+// those still in progress are cancelled and waited for again, up to the timeout, before the storage is closed.
 func (s *Service) Close() error {
+	s.closeMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.closeMu.Unlock()
+
+	if !s.waitProcessing() {
+		s.logger.Warn("timed out waiting for background responses to finish, cancelling them", "timeout", s.closeTimeout)
+		s.cancel()
+		if !s.waitProcessing() {
+			s.logger.Warn("timed out waiting for cancelled background responses to stop", "timeout", s.closeTimeout)
+		}
+	}
+	s.cancel()
+
 	return s.storage.Close()
 }
 
+// waitProcessing waits up to the close timeout for the background responses to finish, reporting if they did
+func (s *Service) waitProcessing() bool {
+	done := make(chan struct{})
+	go func() {
+		s.processing.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(s.closeTimeout):
+		return false
+	}
+}
+
+// abandonResponse marks a queued response as failed because the service closed before it started
+func (s *Service) abandonResponse(responseID string) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	ctx := context.Background()
+	stored, err := s.storage.Get(ctx, responseID)
+	if err != nil || stored.Status != storage.StatusPending {
+		return
+	}
+
+	stored.Status = storage.StatusError
+	stored.UpdatedAt = time.Now()
+	stored.Response = map[string]interface{}{
+		"error": "server shut down before the response was processed",
+	}
+	if err := s.storage.Store(ctx, stored); err != nil {
+		s.logger.Error("failed to store abandoned response", "response_id", responseID, "error", err)
+	}
+	s.metrics.pending.Add(-1)
+	s.metrics.failed.Add(1)
+}
+
 // StoreCompletionResponse stores a completed chat completion response
 func (s *Service) StoreCompletionResponse(ctx context.Context, responseID string, chatResp *openai.ChatCompletionResponse, provider string) error {
 	stored, err := s.storage.Get(ctx, responseID)
@@ -249,10 +505,52 @@ func (s *Service) StoreCompletionResponse(ctx context.Context, responseID string
 	return s.storage.Store(ctx, stored)
 }
 
+// startResponse moves a pending response to in_progress, reporting false when it was cancelled or deleted while
+// waiting
+func (s *Service) startResponse(ctx context.Context, responseID string) bool {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	stored, err := s.storage.Get(ctx, responseID)
+	if err != nil || stored.Status != storage.StatusPending {
+		return false
+	}
+	if err := s.storage.UpdateStatus(ctx, responseID, storage.StatusInProgress); err != nil {
+		s.logger.Error("failed to update response status to in_progress", "response_id", responseID, "error", err)
+		return false
+	}
+	s.metrics.pending.Add(-1)
+	s.metrics.inProgress.Add(1)
+	return true
+}
+
+// finishResponse stores the outcome of processing an in_progress response, returning the stored response or nil
+// when the response was cancelled or deleted while in progress and the outcome is discarded
+func (s *Service) finishResponse(ctx context.Context, responseID string, outcome func(*storage.StoredResponse)) *storage.StoredResponse {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	// The outcome is stored even when processing was cancelled, such as by Close timing out
+	ctx = context.WithoutCancel(ctx)
+
+	stored, err := s.storage.Get(ctx, responseID)
+	if err != nil || stored.Status != storage.StatusInProgress {
+		return nil
+	}
+	s.metrics.inProgress.Add(-1)
+
+	outcome(stored)
+	stored.UpdatedAt = time.Now()
+	stored.Metadata.UpdatedAt = stored.UpdatedAt
+	if err := s.storage.Store(ctx, stored); err != nil {
+		s.logger.Error("failed to store response", "response_id", responseID, "status", stored.Status, "error", err)
+	}
+	return stored
+}
+
 // processResponse processes a stored response through the LLM
 func (s *Service) processResponse(ctx context.Context, responseID string, req *openai.CreateResponseRequest, completionFunc CompletionFunc) {
-	// Update status to in_progress
-	if err := s.storage.UpdateStatus(ctx, responseID, storage.StatusInProgress); err != nil {
+	if !s.startResponse(ctx, responseID) {
 		return
 	}
 
@@ -263,16 +561,10 @@ func (s *Service) processResponse(ctx context.Context, responseID string, req *o
 	if req.PreviousResponseID != "" {
 		prevResponse, err := s.storage.Get(ctx, req.PreviousResponseID)
 		if err == nil {
-			// Extract previous input as user message
+			// Extract previous input as messages
 			if prevInput, ok := prevResponse.Request["input"].([]interface{}); ok {
-				for _, inp := range prevInput {
-					if inputStr, ok := inp.(string); ok {
-						messages = append(messages, openai.Message{
-							Role:    "user",
-							Content: inputStr,
-						})
-					}
-				}
+				prevMessages, _ := inputMessages(prevInput)
+				messages = append(messages, prevMessages...)
 			}
 			// Extract previous output as assistant message
 			if prevOutput, ok := prevResponse.Response["output"]; ok {
@@ -296,105 +588,212 @@ func (s *Service) processResponse(ctx context.Context, responseID string, req *o
 		})
 	}
 
-	// Convert input to user messages
-	for _, input := range req.Input {
-		// Handle string input
-		if inputStr, ok := input.(string); ok {
-			messages = append(messages, openai.Message{
-				Role:    "user",
-				Content: inputStr,
-			})
-			continue
+	// Convert input to messages, the input was validated when the response was created
+	inputStart := len(messages)
+	input, _ := inputMessages(req.Input)
+	messages = append(messages, input...)
+
+	// Convert to chat completion request
+	chatReq := &openai.ChatCompletionRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Tools:    req.Tools,
+	}
+
+	chatResp, attempts, err := s.completeWithRetry(ctx, responseID, chatReq, completionFunc)
+	if err != nil {
+		s.logger.Error("response processing failed", "response_id", responseID, "attempts", attempts, "error", err)
+		if s.finishResponse(ctx, responseID, func(stored *storage.StoredResponse) {
+			stored.Status = storage.StatusError
+			stored.Response = map[string]interface{}{
+				"error":    err.Error(),
+				"attempts": attempts,
+			}
+		}) != nil {
+			s.metrics.failed.Add(1)
+		}
+		return
+	}
+
+	stored := s.finishResponse(ctx, responseID, func(stored *storage.StoredResponse) {
+		stored.Status = storage.StatusCompleted
+		stored.Response = map[string]interface{}{
+			"output": chatResp,
+			"usage":  chatResp.Usage,
+		}
+	})
+	if stored == nil {
+		return
+	}
+	s.metrics.completed.Add(1)
+
+	if conversationID, _ := stored.Request["conversation"].(string); conversationID != "" {
+		if err := s.addToConversation(ctx, conversationID, messages[inputStart:], chatResp); err != nil {
+			s.logger.Error("failed to add response to conversation", "response_id", responseID, "conversation_id", conversationID, "error", err)
+		}
+	}
+}
+
+// addToConversation appends a response's input messages and output to a conversation
+func (s *Service) addToConversation(ctx context.Context, conversationID string, input []openai.Message, chatResp *openai.ChatCompletionResponse) error {
+	if s.conversations == nil {
+		return fmt.Errorf("conversations service not available")
+	}
+
+	var items []openai.ConversationItem
+	for _, msg := range input {
+		items = append(items, openai.ConversationItem{
+			Type:    "message",
+			Role:    msg.Role,
+			Content: []openai.ContentPart{{Type: "input_text", Text: msg.GetContentAsString()}},
+		})
+	}
+	for _, choice := range chatResp.Choices {
+		items = append(items, openai.ConversationItem{
+			Type:    "message",
+			Role:    choice.Message.Role,
+			Content: []openai.ContentPart{{Type: "output_text", Text: choice.Message.GetContentAsString()}},
+		})
+	}
+
+	_, err := s.conversations.CreateItems(ctx, conversationID, &openai.CreateItemsRequest{Items: items}, nil)
+	return err
+}
+
+// completeWithRetry runs the chat completion, retrying transient failures with exponential backoff,
+// it returns the number of attempts made
+func (s *Service) completeWithRetry(ctx context.Context, responseID string, chatReq *openai.ChatCompletionRequest, completionFunc CompletionFunc) (*openai.ChatCompletionResponse, int, error) {
+	backoff := time.Duration(s.config.RetryBackoffMs) * time.Millisecond
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		chatResp, err := s.complete(ctx, chatReq, completionFunc)
+
+		if err == nil || attempt > s.config.MaxRetries || !isTransientError(err) {
+			return chatResp, attempt, err
 		}
 
-		// Handle message object input (from N8N)
-		if inputMap, ok := input.(map[string]interface{}); ok {
-			msg := openai.Message{}
+		s.logger.Warn("response completion failed, retrying", "response_id", responseID, "attempt", attempt, "backoff", backoff, "error", err)
 
-			// Extract role
-			if role, ok := inputMap["role"].(string); ok {
-				msg.Role = role
-			} else {
-				msg.Role = "user" // Default to user if not specified
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// ErrConversationNotFound is returned when a response is attached to a conversation that doesn't exist
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ErrConversationsUnavailable is returned when a response is attached to a conversation but conversations are disabled
+var ErrConversationsUnavailable = errors.New("conversations service not available")
+
+// ErrClosed is returned when a background response is created once the service is closing
+var ErrClosed = errors.New("responses service closed")
+
+// ErrBusy is returned when a background response is created while the queue of those waiting for a worker is full
+var ErrBusy = errors.New("too many background responses queued")
+
+// ErrInvalidInput is returned when a response's input contains an item that can't be converted to a message
+var ErrInvalidInput = errors.New("invalid input")
+
+// inputRoles are the roles accepted for message objects in a response's input
+var inputRoles = map[string]bool{"user": true, "assistant": true, "system": true, "developer": true}
+
+// inputMessages converts a response's input to chat messages, strings become user messages and
+// objects carry a role (default user) and content as a string or an array of parts. Parts other than
+// text, such as images, and items without text content, such as tool calls, are skipped.
+func inputMessages(input []any) ([]openai.Message, error) {
+	messages := make([]openai.Message, 0, len(input))
+	for i, item := range input {
+		switch v := item.(type) {
+		case string:
+			messages = append(messages, openai.Message{Role: "user", Content: v})
+
+		case map[string]interface{}:
+			msg := openai.Message{Role: "user"}
+			if role, ok := v["role"]; ok {
+				roleStr, _ := role.(string)
+				if !inputRoles[roleStr] {
+					return nil, fmt.Errorf("%w: input[%d] has unsupported role %v", ErrInvalidInput, i, role)
+				}
+				msg.Role = roleStr
 			}
 
-			// Extract content - can be string or array
-			if contentStr, ok := inputMap["content"].(string); ok {
-				msg.Content = contentStr
-			} else if contentArray, ok := inputMap["content"].([]interface{}); ok {
-				// Handle content as array of content parts
+			switch content := v["content"].(type) {
+			case string:
+				msg.Content = content
+			case []interface{}:
 				var textParts []string
-				for _, part := range contentArray {
-					if partMap, ok := part.(map[string]interface{}); ok {
-						if text, ok := partMap["text"].(string); ok {
-							textParts = append(textParts, text)
-						}
+				for _, part := range content {
+					partMap, _ := part.(map[string]interface{})
+					if text, ok := partMap["text"].(string); ok {
+						textParts = append(textParts, text)
 					}
 				}
-				if len(textParts) > 0 {
-					msg.Content = strings.Join(textParts, "\n")
+				if len(textParts) == 0 {
+					continue
 				}
+				msg.Content = strings.Join(textParts, "\n")
+			default:
+				continue
 			}
 
-			if msg.Content != "" {
-				messages = append(messages, msg)
-			}
+			messages = append(messages, msg)
+
+		default:
+			return nil, fmt.Errorf("%w: input[%d] must be a string or a message object, got %T", ErrInvalidInput, i, item)
 		}
 	}
 
-	// Convert to chat completion request
-	chatReq := &openai.ChatCompletionRequest{
-		Model:    req.Model,
-		Messages: messages,
-		Tools:    req.Tools,
+	return messages, nil
+}
+
+// RequestMessages returns the messages a request adds to the conversation sent to the model, its instructions
+// as a system message followed by its input
+func RequestMessages(req *openai.CreateResponseRequest) ([]openai.Message, error) {
+	input, err := inputMessages(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	if req.Instructions == "" {
+		return input, nil
 	}
+	return append([]openai.Message{{Role: "system", Content: req.Instructions}}, input...), nil
+}
 
-	// Process through the provided completion function or fallback to router
-	var chatResp *openai.ChatCompletionResponse
-	var err error
+// complete runs a single chat completion through the provided completion function or falls back to
+// the router, requests with tools use the router's tool calling so the tools are executed
+func (s *Service) complete(ctx context.Context, chatReq *openai.ChatCompletionRequest, completionFunc CompletionFunc) (*openai.ChatCompletionResponse, error) {
 	if completionFunc != nil {
-		chatResp, err = completionFunc(ctx, chatReq)
-	} else {
-		chatResp, err = s.router.CreateChatCompletion(ctx, chatReq)
+		return completionFunc(ctx, chatReq)
 	}
-	if err != nil {
-		// Store error message
-		stored, getErr := s.storage.Get(ctx, responseID)
-		if getErr == nil {
-			stored.Status = storage.StatusError
-			stored.UpdatedAt = time.Now()
-			stored.Response = map[string]interface{}{
-				"error": err.Error(),
-			}
-			if storeErr := s.storage.Store(ctx, stored); storeErr != nil {
-				log.Error("failed to store error response", "error", storeErr)
-			}
-		} else {
-			// Fallback to just updating status
-			if updateErr := s.storage.UpdateStatus(ctx, responseID, storage.StatusError); updateErr != nil {
-				log.Error("failed to update response status to error", "error", updateErr)
-			}
+
+	if len(chatReq.Tools) > 0 {
+		if router, ok := s.router.(ToolCompletionRouter); ok {
+			return router.CreateChatCompletionWithTools(ctx, chatReq)
 		}
-		return
 	}
 
-	// Store the completed response
-	stored, err := s.storage.Get(ctx, responseID)
-	if err != nil {
-		return
-	}
+	return s.router.CreateChatCompletion(ctx, chatReq)
+}
 
-	stored.Status = storage.StatusCompleted
-	stored.UpdatedAt = time.Now()
-	stored.Response = map[string]interface{}{
-		"output": chatResp,
-		"usage":  chatResp.Usage,
+// isTransientError reports whether a failed completion may succeed if retried, cancellations
+// and client errors other than timeouts and rate limits are permanent
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
 	}
-	stored.Metadata.UpdatedAt = stored.UpdatedAt
 
-	if storeErr := s.storage.Store(ctx, stored); storeErr != nil {
-		log.Error("failed to store completed response", "error", storeErr)
+	var statusErr *types.UpstreamStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 {
+		return statusErr.StatusCode == http.StatusRequestTimeout || statusErr.StatusCode == http.StatusTooManyRequests
 	}
+	return true
 }
 
 // convertChatCompletionToOutput converts a ChatCompletionResponse to Response API output format
@@ -420,7 +819,22 @@ func (s *Service) convertChatCompletionToOutput(chatResp *openai.ChatCompletionR
 		}
 
 		message["content"] = content
-		output = append(output, message)
+		if len(choice.Message.ToolCalls) == 0 || choice.Message.GetContentAsString() != "" {
+			output = append(output, message)
+		}
+
+		// Calls to the request's own tools are returned for the client to run
+		for _, call := range choice.Message.ToolCalls {
+			arguments, _ := json.Marshal(call.Function.Arguments)
+			output = append(output, map[string]interface{}{
+				"type":      "function_call",
+				"id":        fmt.Sprintf("fc_%s", storage.GenerateResponseID()[5:]),
+				"call_id":   call.ID,
+				"name":      call.Function.Name,
+				"arguments": string(arguments),
+				"status":    "completed",
+			})
+		}
 	}
 
 	return output
@@ -450,6 +864,6 @@ func (s *Service) getProvider(name string) ProviderInterface {
 // createNativeResponse delegates to provider's native responses API
 func (s *Service) createNativeResponse(ctx context.Context, req *openai.CreateResponseRequest, provider ProviderInterface) (*openai.ResponseObject, error) {
 	// TODO: Implement native provider delegation
-	// For now, fallback to emulation
+	// For now, fallback to emulation, which also appends to an attached conversation
 	return s.createEmulatedResponse(ctx, req, nil)
 }
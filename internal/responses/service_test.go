@@ -0,0 +1,543 @@
+package responses
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paularlott/llmrouter/internal/storage"
+	"github.com/paularlott/llmrouter/internal/types"
+	"github.com/paularlott/mcp/openai"
+)
+
+func TestNewServiceBackendSelection(t *testing.T) {
+	tests := []struct {
+		name   string
+		config types.ResponsesConfig
+		check  func(storage.ResponseStorage) bool
+	}{
+		{"default without path", types.ResponsesConfig{}, isMemory},
+		{"default with path", types.ResponsesConfig{StoragePath: filepath.Join(t.TempDir(), "default")}, isBadger},
+		{"memory", types.ResponsesConfig{Backend: "memory", StoragePath: filepath.Join(t.TempDir(), "unused")}, isMemory},
+		{"badger", types.ResponsesConfig{Backend: "badger", StoragePath: filepath.Join(t.TempDir(), "badger")}, isBadger},
+		{"sqlite", types.ResponsesConfig{Backend: "sqlite", StoragePath: filepath.Join(t.TempDir(), "llmrouter.db")}, isSQLite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, err := NewService(&tt.config, nil)
+			if err != nil {
+				t.Fatalf("NewService failed: %v", err)
+			}
+			defer service.Close()
+
+			if !tt.check(service.storage) {
+				t.Errorf("unexpected storage type %T", service.storage)
+			}
+		})
+	}
+
+	if _, err := NewService(&types.ResponsesConfig{Backend: "unknown"}, nil); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+	if _, err := NewService(&types.ResponsesConfig{Backend: "badger"}, nil); err == nil {
+		t.Error("expected an error for badger without a storage path")
+	}
+}
+
+func isMemory(s storage.ResponseStorage) bool {
+	_, ok := s.(*storage.MemoryStorage)
+	return ok
+}
+
+func isBadger(s storage.ResponseStorage) bool {
+	_, ok := s.(*storage.BadgerStorage)
+	return ok
+}
+
+func isSQLite(s storage.ResponseStorage) bool {
+	_, ok := s.(*storage.SQLiteStorage)
+	return ok
+}
+
+func TestProcessResponseRetriesTransientFailures(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{MaxRetries: 2, RetryBackoffMs: 1}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	calls := 0
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		calls++
+		if calls <= 2 {
+			return nil, &types.UpstreamStatusError{StatusCode: 503, Message: "overloaded"}
+		}
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "hello"}}},
+		}, nil
+	}
+
+	response, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}}, completion)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+	if response.Status != string(storage.StatusCompleted) || len(response.Output) != 1 {
+		t.Errorf("Expected a completed response with output, got %+v", response)
+	}
+}
+
+func TestProcessResponseRecordsFailure(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{MaxRetries: 2, RetryBackoffMs: 1}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	// Client errors fail the same way every time so are not retried
+	calls := 0
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		calls++
+		return nil, &types.UpstreamStatusError{StatusCode: 400, Message: "invalid model"}
+	}
+
+	response, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}}, completion)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls)
+	}
+	if response.Status != string(storage.StatusError) || response.Error == nil || !strings.Contains(response.Error.Message, "invalid model") {
+		t.Errorf("Expected the failure reason on the response, got %+v", response)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{&types.UpstreamStatusError{StatusCode: 500}, true},
+		{&types.UpstreamStatusError{StatusCode: 503}, true},
+		{&types.UpstreamStatusError{StatusCode: 408}, true},
+		{&types.UpstreamStatusError{StatusCode: 429}, true},
+		{&types.UpstreamStatusError{StatusCode: 400}, false},
+		{&types.UpstreamStatusError{StatusCode: 404}, false},
+		{fmt.Errorf("all providers failed: %w", &types.UpstreamStatusError{StatusCode: 401}), false},
+		{errors.New("connection refused"), true},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := isTransientError(tt.err); got != tt.transient {
+			t.Errorf("isTransientError(%v) = %v, expected %v", tt.err, got, tt.transient)
+		}
+	}
+}
+
+func TestBackgroundResponsesBoundedConcurrency(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{MaxConcurrent: 2}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	const total = 10
+	var active, peak int32
+	var wg sync.WaitGroup
+	wg.Add(total)
+
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		defer wg.Done()
+
+		current := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			max := atomic.LoadInt32(&peak)
+			if current <= max || atomic.CompareAndSwapInt32(&peak, max, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	for i := 0; i < total; i++ {
+		response, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+		if err != nil {
+			t.Fatalf("CreateResponse failed: %v", err)
+		}
+		if response.Status != string(storage.StatusPending) {
+			t.Errorf("Expected a pending response, got %s", response.Status)
+		}
+	}
+
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("Expected at most 2 responses processed at once, got %d", peak)
+	}
+	if peak < 2 {
+		t.Errorf("Expected responses to be processed in parallel, peak was %d", peak)
+	}
+}
+
+func TestResponseMixedInputMessages(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	var received []openai.Message
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		received = req.Messages
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	input := []any{
+		"first question",
+		map[string]interface{}{"role": "assistant", "content": "first answer"},
+		map[string]interface{}{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "input_text", "text": "second"},
+			map[string]interface{}{"type": "input_text", "text": "question"},
+		}},
+		map[string]interface{}{"content": "no role"},
+		map[string]interface{}{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "input_image", "image_url": "https://example.com/cat.png"},
+			map[string]interface{}{"type": "input_text", "text": "describe this"},
+		}},
+		map[string]interface{}{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "input_image", "image_url": "https://example.com/dog.png"},
+		}},
+		map[string]interface{}{"type": "function_call", "name": "lookup", "arguments": "{}"},
+	}
+	if _, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: input}, completion); err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+
+	expected := []openai.Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second\nquestion"},
+		{Role: "user", Content: "no role"},
+		{Role: "user", Content: "describe this"},
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("Expected %d messages, got %+v", len(expected), received)
+	}
+	for i, msg := range expected {
+		if received[i].Role != msg.Role || received[i].GetContentAsString() != msg.Content {
+			t.Errorf("message %d: expected %s %q, got %s %q", i, msg.Role, msg.Content, received[i].Role, received[i].GetContentAsString())
+		}
+	}
+
+	// Malformed items are rejected
+	for _, invalid := range [][]any{
+		{42},
+		{map[string]interface{}{"role": "robot", "content": "hi"}},
+	} {
+		_, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: invalid}, completion)
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for %v, got %v", invalid, err)
+		}
+	}
+}
+
+func TestCloseWaitsForBackgroundResponses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "responses")
+	service, err := NewService(&types.ResponsesConfig{Backend: "badger", StoragePath: path, MaxConcurrent: 1}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+
+	started := make(chan struct{})
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	ctx := context.Background()
+	slow, err := service.CreateResponse(ctx, &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	<-started
+
+	// Queued behind the slow response, so it won't have started when the service closes
+	queued, err := service.CreateResponse(ctx, &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The in-flight response was written before the storage closed
+	store, err := storage.NewBadgerStorage(path, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer store.Close()
+
+	stored, err := store.Get(ctx, slow.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.Status != storage.StatusCompleted {
+		t.Errorf("Expected the in-flight response to complete, got %s", stored.Status)
+	}
+
+	stored, err = store.Get(ctx, queued.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.Status != storage.StatusError {
+		t.Errorf("Expected the queued response to be abandoned, got %s", stored.Status)
+	}
+}
+
+func TestResponseStoreFalse(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	store := false
+	resp, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Store: &store}, completion)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	if resp.Status != string(storage.StatusCompleted) || len(resp.Output) == 0 {
+		t.Errorf("Expected the completed response to be returned inline, got %+v", resp)
+	}
+	if _, err := service.GetResponse(context.Background(), resp.ID); err == nil {
+		t.Error("Expected a response with store=false not to be retrievable")
+	}
+
+	// Background responses are polled for, so can't be left unstored
+	_, err = service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Store: &store, Background: true}, completion)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a background response with store=false, got %v", err)
+	}
+}
+
+func TestBackgroundResponsesQueueFull(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{MaxConcurrent: 1, MaxQueued: 1}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		started <- struct{}{}
+		<-release
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	ctx := context.Background()
+	create := func() (*openai.ResponseObject, error) {
+		return service.CreateResponse(ctx, &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+	}
+
+	// One response is taken by the worker and one waits in the queue, filling it
+	if _, err := create(); err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	<-started
+	if _, err := create(); err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+
+	if _, err := create(); !errors.Is(err, ErrBusy) {
+		t.Errorf("Expected ErrBusy with the queue full, got %v", err)
+	}
+	if metrics := service.Metrics(); metrics.Pending != 1 || metrics.QueueDepth != 1 {
+		t.Errorf("Expected the rejected response not to be counted, got %+v", metrics)
+	}
+	listed, err := service.ListResponses(ctx, storage.ResponseFilter{})
+	if err != nil || len(listed.Data) != 2 {
+		t.Errorf("Expected the rejected response not to be stored, got %v: %v", listed, err)
+	}
+
+	close(release)
+	<-started
+}
+
+func TestCancelResponse(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{MaxConcurrent: 1}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer service.Close()
+
+	var calls atomic.Int32
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		calls.Add(1)
+		started <- struct{}{}
+		<-release
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	ctx := context.Background()
+	create := func() *openai.ResponseObject {
+		response, err := service.CreateResponse(ctx, &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+		if err != nil {
+			t.Fatalf("CreateResponse failed: %v", err)
+		}
+		return response
+	}
+
+	inProgress := create()
+	<-started
+	pending := create()
+
+	for _, response := range []*openai.ResponseObject{inProgress, pending} {
+		cancelled, err := service.CancelResponse(ctx, response.ID)
+		if err != nil {
+			t.Fatalf("CancelResponse failed: %v", err)
+		}
+		if cancelled.Status != string(storage.StatusCancelled) {
+			t.Errorf("Expected a cancelled response, got %s", cancelled.Status)
+		}
+	}
+	if metrics := service.Metrics(); metrics.Pending != 0 || metrics.InProgress != 0 || metrics.Cancelled != 2 {
+		t.Errorf("Expected the cancelled responses to leave the pending and in progress gauges, got %+v", metrics)
+	}
+
+	// The in progress completion finishing doesn't overwrite its cancellation, and the pending one never starts
+	close(release)
+	service.processing.Wait()
+	for _, response := range []*openai.ResponseObject{inProgress, pending} {
+		stored, err := service.GetResponse(ctx, response.ID)
+		if err != nil || stored.Status != string(storage.StatusCancelled) {
+			t.Errorf("Expected the response to stay cancelled, got %+v: %v", stored, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected only the in progress response to be completed, got %d completions", calls.Load())
+	}
+	if metrics := service.Metrics(); metrics.Completed != 0 || metrics.InProgress != 0 {
+		t.Errorf("Expected the cancelled response not to be counted as completed, got %+v", metrics)
+	}
+
+	// A response that has finished isn't cancelled
+	finished, err := service.CreateResponse(ctx, &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}}, func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		return &openai.ChatCompletionResponse{Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	if response, err := service.CancelResponse(ctx, finished.ID); err != nil || response.Status != string(storage.StatusCompleted) {
+		t.Errorf("Expected the completed response to be left completed, got %+v: %v", response, err)
+	}
+	if metrics := service.Metrics(); metrics.Cancelled != 2 || metrics.Completed != 1 {
+		t.Errorf("Expected the completed response not to be counted as cancelled, got %+v", metrics)
+	}
+}
+
+func TestCloseCancelsBackgroundResponsesAfterTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "responses")
+	service, err := NewService(&types.ResponsesConfig{Backend: "badger", StoragePath: path}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	service.closeTimeout = 50 * time.Millisecond
+
+	started := make(chan struct{})
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx := context.Background()
+	stuck, err := service.CreateResponse(ctx, &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+	if err != nil {
+		t.Fatalf("CreateResponse failed: %v", err)
+	}
+	<-started
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The cancelled response recorded its failure before the storage closed
+	store, err := storage.NewBadgerStorage(path, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer store.Close()
+
+	stored, err := store.Get(ctx, stuck.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.Status != storage.StatusError {
+		t.Errorf("Expected the cancelled response to be marked as failed, got %s", stored.Status)
+	}
+}
+
+func TestCreateResponseWhileClosing(t *testing.T) {
+	service, err := NewService(&types.ResponsesConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+
+	completion := func(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "ok"}}},
+		}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				_, err := service.CreateResponse(context.Background(), &openai.CreateResponseRequest{Model: "test", Input: []any{"hi"}, Background: true}, completion)
+				if err != nil && !errors.Is(err, ErrClosed) {
+					t.Errorf("Expected the response to be queued or rejected as closed, got %v", err)
+				}
+			}
+		}()
+	}
+
+	if err := service.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	wg.Wait()
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -26,8 +27,9 @@ func RunServer(ctx context.Context, cmd *cli.Command) error {
 			Token: cmd.GetString("token"),
 		},
 		Logging: types.LoggingConfig{
-			Level:  cmd.GetString("log-level"),
-			Format: cmd.GetString("log-format"),
+			Level:         cmd.GetString("log-level"),
+			Format:        cmd.GetString("log-format"),
+			ShutdownStats: cmd.GetBool("stats"),
 		},
 		Providers: []types.ProviderConfig{},
 		MCP: types.MCPConfig{
@@ -38,8 +40,15 @@ func RunServer(ctx context.Context, cmd *cli.Command) error {
 			LibrariesPath: cmd.GetString("libs-path"),
 		},
 		Responses: types.ResponsesConfig{
+			Backend:     cmd.GetString("responses-backend"),
 			StoragePath: cmd.GetString("responses-db"),
 			TTLDays:     cmd.GetInt("responses-ttl"),
+
+			MaxRetries:     cmd.GetInt("responses-max-retries"),
+			RetryBackoffMs: cmd.GetInt("responses-retry-backoff"),
+			MaxConcurrent:  cmd.GetInt("responses-max-concurrent"),
+			MaxQueued:      cmd.GetInt("responses-max-queued"),
+			PollInterval:   cmd.GetInt("responses-poll-interval"),
 		},
 	}
 
@@ -61,36 +70,19 @@ func RunServer(ctx context.Context, cmd *cli.Command) error {
 
 	// Load providers from config file if available
 	if cmd.ConfigFile != nil {
-		typedConfig := cli.NewTypedConfigFile(cmd.ConfigFile)
-		providers := typedConfig.GetObjectSlice("providers")
-		for _, providerConfig := range providers {
-			provider := types.ProviderConfig{
-				Name:      providerConfig.GetString("name"),
-				BaseURL:   strings.TrimSuffix(providerConfig.GetString("base_url"), "/"),
-				Token:     providerConfig.GetString("token"),
-				Enabled:   providerConfig.GetBool("enabled"),
-				Models:    providerConfig.GetStringSlice("models"),
-				Allowlist: providerConfig.GetStringSlice("allowlist"),
-				Denylist:  providerConfig.GetStringSlice("denylist"),
-			}
-			config.Providers = append(config.Providers, provider)
+		if err := loadConfigFile(config, cli.NewTypedConfigFile(cmd.ConfigFile)); err != nil {
+			logger.Error("failed to load config file", "error", err)
+			return err
 		}
+	}
 
-		// Load MCP config
-		mcpConfig := typedConfig.GetObject("mcp")
-		if mcpConfig != nil {
-			remoteServers := mcpConfig.GetObjectSlice("remote_servers")
-			for _, serverConfig := range remoteServers {
-				server := types.MCPRemoteServerConfig{
-					Namespace:      serverConfig.GetString("namespace"),
-					URL:            strings.TrimSuffix(serverConfig.GetString("url"), "/"),
-					Token:          serverConfig.GetString("token"),
-					ToolVisibility: serverConfig.GetString("tool_visibility"),
-				}
-				config.MCP.RemoteServers = append(config.MCP.RemoteServers, server)
-			}
-		}
+	// Resolve environment variable references in the server token
+	serverToken, err := expandEnvVars(config.Server.Token)
+	if err != nil {
+		logger.Error("failed to resolve server token", "error", err)
+		return err
 	}
+	config.Server.Token = serverToken
 
 	logger.Info("loaded providers from config", "count", len(config.Providers))
 
@@ -105,8 +97,12 @@ func RunServer(ctx context.Context, cmd *cli.Command) error {
 	router.StartBackgroundTasks()
 	defer router.StopBackgroundTasks()
 
-	// Initial model refresh
-	if err := router.RefreshModels(ctx); err != nil {
+	// Initial model refresh, bounded so a slow provider doesn't hold up serving
+	startupRefreshTimeout := defaultStartupRefreshTimeout
+	if config.Server.StartupRefreshTimeout > 0 {
+		startupRefreshTimeout = time.Duration(config.Server.StartupRefreshTimeout) * time.Second
+	}
+	if err := refreshModelsWithTimeout(ctx, router, startupRefreshTimeout); err != nil {
 		logger.Warn("initial model refresh failed", "error", err)
 	}
 
@@ -135,6 +131,269 @@ func RunServer(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// defaultStartupRefreshTimeout is how long the server waits for the model refresh at startup
+const defaultStartupRefreshTimeout = 30 * time.Second
+
+// refreshModelsWithTimeout runs a model refresh, returning an error once the timeout passes even if a provider
+// is still being fetched. Fetches still running are cancelled, the health check retries providers that failed.
+func refreshModelsWithTimeout(ctx context.Context, router Router, timeout time.Duration) error {
+	refreshCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- router.RefreshModels(refreshCtx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-refreshCtx.Done():
+		return fmt.Errorf("model refresh did not complete within %s", timeout)
+	}
+}
+
+// loadConfigFile reads the providers and MCP settings from the config file
+func loadConfigFile(config *types.Config, typedConfig cli.ConfigFileTyped) error {
+	providers := typedConfig.GetObjectSlice("providers")
+	for _, providerConfig := range providers {
+		name := providerConfig.GetString("name")
+
+		token, err := expandEnvVars(providerConfig.GetString("token"))
+		if err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+
+		provider := types.ProviderConfig{
+			Name:               name,
+			BaseURL:            strings.TrimSuffix(providerConfig.GetString("base_url"), "/"),
+			Token:              token,
+			TokenFile:          providerConfig.GetString("token_file"),
+			Organization:       providerConfig.GetString("organization"),
+			Project:            providerConfig.GetString("project"),
+			UserAgent:          providerConfig.GetString("user_agent"),
+			ClientCertFile:     providerConfig.GetString("client_cert_file"),
+			ClientKeyFile:      providerConfig.GetString("client_key_file"),
+			CAFile:             providerConfig.GetString("ca_file"),
+			InsecureSkipVerify: providerConfig.GetBool("insecure_skip_verify"),
+			Proxy:              providerConfig.GetString("proxy"),
+			Enabled:            providerConfig.GetBool("enabled"),
+			Models:             providerConfig.GetStringSlice("models"),
+			ModelsSource:       providerConfig.GetString("models_source"),
+			Allowlist:          providerConfig.GetStringSlice("allowlist"),
+			Denylist:           providerConfig.GetStringSlice("denylist"),
+		}
+		config.Providers = append(config.Providers, provider)
+	}
+
+	// Load MCP config
+	mcpConfig := typedConfig.GetObject("mcp")
+	if mcpConfig != nil {
+		config.MCP.Instructions = mcpConfig.GetString("instructions")
+		config.MCP.MaxToolResultSize = mcpConfig.GetInt("max_tool_result_size")
+		config.MCP.HTTPGetAllowedDomains = mcpConfig.GetStringSlice("http_get_allowed_domains")
+		config.MCP.HTTPGetMaxBytes = mcpConfig.GetInt("http_get_max_bytes")
+		config.MCP.AuditTools = mcpConfig.GetBool("audit_tools")
+		config.MCP.MaxConcurrentTools = mcpConfig.GetInt("max_concurrent_tools")
+
+		remoteServers := mcpConfig.GetObjectSlice("remote_servers")
+		for _, serverConfig := range remoteServers {
+			server := types.MCPRemoteServerConfig{
+				Namespace:      serverConfig.GetString("namespace"),
+				URL:            strings.TrimSuffix(serverConfig.GetString("url"), "/"),
+				Token:          serverConfig.GetString("token"),
+				ToolVisibility: serverConfig.GetString("tool_visibility"),
+			}
+			config.MCP.RemoteServers = append(config.MCP.RemoteServers, server)
+		}
+	}
+
+	// Load provider pools
+	for _, poolConfig := range typedConfig.GetObjectSlice("pools") {
+		config.Pools = append(config.Pools, types.PoolConfig{
+			Name:      poolConfig.GetString("name"),
+			Providers: poolConfig.GetStringSlice("providers"),
+			Strategy:  poolConfig.GetString("strategy"),
+		})
+	}
+
+	config.Server.RateLimit = typedConfig.GetInt("server.rate_limit")
+	redisURL, err := expandEnvVars(typedConfig.GetString("server.redis_url"))
+	if err != nil {
+		return fmt.Errorf("server.redis_url: %w", err)
+	}
+	config.Server.RedisURL = redisURL
+
+	adminToken, err := expandEnvVars(typedConfig.GetString("server.admin_token"))
+	if err != nil {
+		return fmt.Errorf("server.admin_token: %w", err)
+	}
+	config.Server.AdminToken = adminToken
+	config.Server.ProviderHeaders = typedConfig.GetBool("server.provider_headers")
+	config.Server.ProviderOverride = typedConfig.GetBool("server.provider_override")
+	config.Server.ValidateResponseSchema = typedConfig.GetBool("server.validate_response_schema")
+	config.Server.IdempotencyTTL = typedConfig.GetInt("server.idempotency_ttl")
+	config.Server.PassthroughProvider = typedConfig.GetString("server.passthrough_provider")
+	config.Server.StartupRefreshTimeout = typedConfig.GetInt("server.startup_refresh_timeout")
+	config.Server.MaxMessages = typedConfig.GetInt("server.max_messages")
+	config.Server.MaxPromptChars = typedConfig.GetInt("server.max_prompt_chars")
+
+	config.Conversations = types.ConversationsConfig{
+		Backend:     typedConfig.GetString("conversations.backend"),
+		StoragePath: typedConfig.GetString("conversations.storage_path"),
+		TTLDays:     typedConfig.GetInt("conversations.ttl_days"),
+		SlidingTTL:  typedConfig.GetBool("conversations.sliding_ttl"),
+	}
+
+	config.Audit = types.AuditConfig{
+		Enabled:     typedConfig.GetBool("audit.enabled"),
+		StoragePath: typedConfig.GetString("audit.storage_path"),
+		TTLDays:     typedConfig.GetInt("audit.ttl_days"),
+	}
+
+	config.Logging.RedactFields = typedConfig.GetStringSlice("logging.redact_fields")
+	config.Health.EmptyModelsThreshold = typedConfig.GetInt("health.empty_models_threshold")
+	config.Health.TCPProbeTimeout = typedConfig.GetInt("health.tcp_probe_timeout")
+	config.Health.DisableEmptyProviders = typedConfig.GetBool("health.disable_empty_providers")
+	config.Health.ConnectionErrorPatterns = typedConfig.GetStringSlice("health.connection_error_patterns")
+	config.Health.KeepLastProvider = typedConfig.GetBool("health.keep_last_provider")
+	config.Health.CompletionCheck = typedConfig.GetBool("health.completion_check")
+	config.Health.CompletionCheckModel = typedConfig.GetString("health.completion_check_model")
+	config.Health.CompletionCheckPrompt = typedConfig.GetString("health.completion_check_prompt")
+	config.Scriptling.DisabledTools = typedConfig.GetStringSlice("scriptling.disabled_tools")
+	config.Streaming.PassthroughOnly = typedConfig.GetBool("streaming.passthrough_only")
+	config.Streaming.AggregateToolCalls = typedConfig.GetBool("streaming.aggregate_tool_calls")
+
+	config.SessionAffinity = types.SessionAffinityConfig{
+		Enabled:     typedConfig.GetBool("session_affinity.enabled"),
+		TTL:         typedConfig.GetInt("session_affinity.ttl"),
+		MaxSessions: typedConfig.GetInt("session_affinity.max_sessions"),
+	}
+	config.ModelCache.TTL = typedConfig.GetInt("model_cache.ttl")
+	config.ModelIDs.CaseInsensitive = typedConfig.GetBool("model_ids.case_insensitive")
+
+	// Load embedding model classification
+	config.EmbeddingModels = types.EmbeddingModelsConfig{
+		Patterns: typedConfig.GetStringSlice("embedding_models.patterns"),
+		Models:   typedConfig.GetStringSlice("embedding_models.models"),
+	}
+
+	// Load deprecated models, replacements are read as a raw map as model IDs often contain dots
+	config.DeprecatedModels.Models = typedConfig.GetStringSlice("deprecated_models.models")
+	replacements, err := modelStringTable(typedConfig, "deprecated_models", "replacements")
+	if err != nil {
+		return err
+	}
+	config.DeprecatedModels.Replacements = replacements
+
+	// Load the system prompt, per-model prompts are read as a raw map as model IDs often contain dots
+	config.SystemPrompt.Content = typedConfig.GetString("system_prompt.content")
+	config.SystemPrompt.Always = typedConfig.GetBool("system_prompt.always")
+	systemPrompts, err := modelStringTable(typedConfig, "system_prompt", "models")
+	if err != nil {
+		return err
+	}
+	config.SystemPrompt.Models = systemPrompts
+
+	// Load optional model metadata, read as a raw map as model IDs often contain dots
+	if models, ok := typedConfig.GetValue("models"); ok {
+		modelsMap, ok := models.(map[string]any)
+		if !ok {
+			return fmt.Errorf("models must be a table of model IDs")
+		}
+
+		config.Models = make(map[string]types.ModelMetadata, len(modelsMap))
+		for modelID, value := range modelsMap {
+			fields, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("models.%s must be a table", modelID)
+			}
+
+			metadata := types.ModelMetadata{
+				ContextLength:   configInt(fields["context_length"]),
+				MaxOutputTokens: configInt(fields["max_output_tokens"]),
+
+				EmbeddingDimensions: configInt(fields["embedding_dimensions"]),
+			}
+			if supportsTools, ok := fields["supports_tools"].(bool); ok {
+				metadata.SupportsTools = &supportsTools
+			}
+			if supportsVision, ok := fields["supports_vision"].(bool); ok {
+				metadata.SupportsVision = &supportsVision
+			}
+			config.Models[modelID] = metadata
+		}
+	}
+
+	return nil
+}
+
+// modelStringTable reads the table of strings keyed by model ID at section.key, returning nil when it isn't set
+func modelStringTable(typedConfig cli.ConfigFileTyped, section, key string) (map[string]string, error) {
+	value, ok := typedConfig.GetValue(section)
+	if !ok {
+		return nil, nil
+	}
+	sectionMap, _ := value.(map[string]any)
+	table, ok := sectionMap[key]
+	if !ok {
+		return nil, nil
+	}
+
+	tableMap, ok := table.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s must be a table of model IDs", section, key)
+	}
+
+	values := make(map[string]string, len(tableMap))
+	for modelID, entry := range tableMap {
+		str, ok := entry.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s.%s.%s must be a string", section, key, modelID)
+		}
+		values[modelID] = str
+	}
+	return values, nil
+}
+
+// configInt converts a numeric value read from the config file to an int
+func configInt(value any) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// envVarPattern matches ${VAR_NAME} references in config values
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvVars replaces ${VAR_NAME} references with values from the environment.
+// An error is returned if a referenced variable is not set.
+func expandEnvVars(value string) (string, error) {
+	var missing []string
+	expanded := envVarPattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := envVarPattern.FindStringSubmatch(match)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return envValue
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable not set: %s", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
+
 // Router interface - will be implemented by the router package
 type Router interface {
 	StartBackgroundTasks()
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/paularlott/cli"
+	"github.com/paularlott/llmrouter/internal/types"
+)
+
+// TestLoadConfigFileExpandsEnvTokens tests that ${VAR} references in provider tokens are resolved
+func TestLoadConfigFileExpandsEnvTokens(t *testing.T) {
+	t.Setenv("LLMROUTER_TEST_TOKEN", "secret-from-env")
+
+	typedConfig := cli.NewTypedConfigObjectWithData(map[string]any{
+		"providers": []any{
+			map[string]any{
+				"name":     "openai",
+				"base_url": "https://api.example.com/v1/",
+				"token":    "${LLMROUTER_TEST_TOKEN}",
+				"enabled":  true,
+			},
+		},
+	})
+
+	config := &types.Config{}
+	if err := loadConfigFile(config, typedConfig); err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+
+	if len(config.Providers) != 1 {
+		t.Fatalf("Expected 1 provider, got %d", len(config.Providers))
+	}
+	if config.Providers[0].Token != "secret-from-env" {
+		t.Errorf("Expected token to be resolved from environment, got '%s'", config.Providers[0].Token)
+	}
+}
+
+// TestLoadConfigFileMissingEnvToken tests that an unset variable is reported as an error
+func TestLoadConfigFileMissingEnvToken(t *testing.T) {
+	typedConfig := cli.NewTypedConfigObjectWithData(map[string]any{
+		"providers": []any{
+			map[string]any{
+				"name":    "openai",
+				"token":   "${LLMROUTER_TEST_UNSET_TOKEN}",
+				"enabled": true,
+			},
+		},
+	})
+
+	config := &types.Config{}
+	if err := loadConfigFile(config, typedConfig); err == nil {
+		t.Error("Expected error for unset environment variable")
+	}
+}
+
+// TestExpandEnvVars tests substitution of environment variables in config values
+func TestExpandEnvVars(t *testing.T) {
+	t.Setenv("LLMROUTER_TEST_PREFIX", "sk")
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", ""},
+		{"plain-token", "plain-token"},
+		{"${LLMROUTER_TEST_PREFIX}-1234", "sk-1234"},
+		{"$LLMROUTER_TEST_PREFIX", "$LLMROUTER_TEST_PREFIX"},
+	}
+
+	for _, tt := range tests {
+		result, err := expandEnvVars(tt.value)
+		if err != nil {
+			t.Errorf("expandEnvVars(%q) returned error: %v", tt.value, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expandEnvVars(%q) = %q, expected %q", tt.value, result, tt.expected)
+		}
+	}
+}
+
+// TestLoadConfigFileModelMetadata tests that [models.<id>] blocks are loaded, including IDs containing dots
+func TestLoadConfigFileModelMetadata(t *testing.T) {
+	typedConfig := cli.NewTypedConfigObjectWithData(map[string]any{
+		"models": map[string]any{
+			"gpt-4.1": map[string]any{
+				"context_length":    int64(1047576),
+				"max_output_tokens": int64(32768),
+				"supports_tools":    true,
+				"supports_vision":   false,
+			},
+		},
+	})
+
+	config := &types.Config{}
+	if err := loadConfigFile(config, typedConfig); err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+
+	metadata, exists := config.Models["gpt-4.1"]
+	if !exists {
+		t.Fatalf("Expected metadata for gpt-4.1, got %v", config.Models)
+	}
+	if metadata.ContextLength != 1047576 || metadata.MaxOutputTokens != 32768 {
+		t.Errorf("Unexpected limits: %+v", metadata)
+	}
+	if metadata.SupportsTools == nil || !*metadata.SupportsTools {
+		t.Error("Expected supports_tools to be true")
+	}
+	if metadata.SupportsVision == nil || *metadata.SupportsVision {
+		t.Error("Expected supports_vision to be false")
+	}
+}
+
+func TestLoadConfigFileDeprecatedModels(t *testing.T) {
+	typedConfig := cli.NewTypedConfigObjectWithData(map[string]any{
+		"deprecated_models": map[string]any{
+			"models":       []any{"gpt-3.5-turbo"},
+			"replacements": map[string]any{"gpt-4.0": "gpt-4.1"},
+		},
+	})
+
+	config := &types.Config{}
+	if err := loadConfigFile(config, typedConfig); err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+
+	if len(config.DeprecatedModels.Models) != 1 || config.DeprecatedModels.Models[0] != "gpt-3.5-turbo" {
+		t.Errorf("Expected gpt-3.5-turbo to be deprecated, got %v", config.DeprecatedModels.Models)
+	}
+	if replacement := config.DeprecatedModels.Replacements["gpt-4.0"]; replacement != "gpt-4.1" {
+		t.Errorf("Expected gpt-4.0 to be replaced by gpt-4.1, got %v", config.DeprecatedModels.Replacements)
+	}
+}
+
+func TestLoadConfigFileSystemPrompt(t *testing.T) {
+	typedConfig := cli.NewTypedConfigObjectWithData(map[string]any{
+		"system_prompt": map[string]any{
+			"content": "Be safe.",
+			"always":  true,
+			"models":  map[string]any{"gpt-4.1": "Be safe and concise."},
+		},
+	})
+
+	config := &types.Config{}
+	if err := loadConfigFile(config, typedConfig); err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+
+	if config.SystemPrompt.Content != "Be safe." || !config.SystemPrompt.Always {
+		t.Errorf("Unexpected system prompt: %+v", config.SystemPrompt)
+	}
+	if prompt := config.SystemPrompt.Models["gpt-4.1"]; prompt != "Be safe and concise." {
+		t.Errorf("Expected the gpt-4.1 system prompt, got %v", config.SystemPrompt.Models)
+	}
+
+	typedConfig = cli.NewTypedConfigObjectWithData(map[string]any{
+		"system_prompt": map[string]any{"models": map[string]any{"gpt-4.1": 1}},
+	})
+	if err := loadConfigFile(&types.Config{}, typedConfig); err == nil {
+		t.Error("Expected an error for a system prompt that isn't a string")
+	}
+}
+
+// slowRouter is a Router whose model refresh takes refreshDelay, as when a provider is slow to respond
+type slowRouter struct {
+	refreshDelay time.Duration
+}
+
+func (r *slowRouter) StartBackgroundTasks()                              {}
+func (r *slowRouter) StopBackgroundTasks()                               {}
+func (r *slowRouter) Shutdown()                                          {}
+func (r *slowRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {}
+
+func (r *slowRouter) RefreshModels(ctx context.Context) error {
+	time.Sleep(r.refreshDelay)
+	return nil
+}
+
+// TestRefreshModelsWithTimeout tests that the startup refresh gives up on a slow provider after the timeout
+func TestRefreshModelsWithTimeout(t *testing.T) {
+	start := time.Now()
+	err := refreshModelsWithTimeout(context.Background(), &slowRouter{refreshDelay: 5 * time.Second}, 50*time.Millisecond)
+	if err == nil {
+		t.Error("Expected an error when the refresh overruns the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the refresh to return after the timeout, took %s", elapsed)
+	}
+
+	if err := refreshModelsWithTimeout(context.Background(), &slowRouter{}, time.Second); err != nil {
+		t.Errorf("Expected a fast refresh to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+// AuditRecord is a completion captured for auditing
+type AuditRecord struct {
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model"`    // model ID sent to the provider
+	Request   json.RawMessage   `json:"request"`  // request body as sent by the client
+	Response  json.RawMessage   `json:"response"` // response as returned to the client, assembled from the chunks when streamed
+	Usage     AuditUsage        `json:"usage"`
+	Tags      map[string]string `json:"tags,omitempty"` // tags attached by the client via metadata or header
+}
+
+// AuditUsage is the token usage of an audited completion
+type AuditUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// AuditStorage stores audit records
+type AuditStorage interface {
+	Store(ctx context.Context, record *AuditRecord) error
+	Get(ctx context.Context, id string) (*AuditRecord, error)
+	RunGC() error
+	Close() error
+}
+
+// GenerateAuditID generates an audit record ID
+func GenerateAuditID() string {
+	return "audit_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// auditGCInterval is how often the space held by expired audit records is reclaimed
+const auditGCInterval = time.Hour
+
+// BadgerAuditStorage implements AuditStorage using Badger
+type BadgerAuditStorage struct {
+	db       *badger.DB
+	ttl      time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewBadgerAuditStorage creates a Badger-based audit storage, records expire after ttl (0 keeps them forever)
+func NewBadgerAuditStorage(path string, ttl time.Duration) (*BadgerAuditStorage, error) {
+	db, err := openBadger(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BadgerAuditStorage{
+		db:   db,
+		ttl:  ttl,
+		stop: make(chan struct{}),
+	}
+	go s.gc()
+	return s, nil
+}
+
+// gc periodically reclaims the space held by expired records until the storage is closed, records are written
+// once and expire so without it the value log only grows
+func (s *BadgerAuditStorage) gc() {
+	ticker := time.NewTicker(auditGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.RunGC()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// RunGC reclaims the space held by expired records
+func (s *BadgerAuditStorage) RunGC() error {
+	return runBadgerGC(s.db)
+}
+
+func (s *BadgerAuditStorage) Store(ctx context.Context, record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry([]byte("audit:"+record.ID), data)
+		if s.ttl > 0 {
+			entry = entry.WithTTL(s.ttl)
+		}
+		return txn.SetEntry(entry)
+	})
+}
+
+func (s *BadgerAuditStorage) Get(ctx context.Context, id string) (*AuditRecord, error) {
+	var record AuditRecord
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("audit:" + id))
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &record)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, fmt.Errorf("audit record not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit record: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *BadgerAuditStorage) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	return s.db.Close()
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// TestAuditBackend tests that audit storage created through the backend registry stores records and can reclaim
+// value log space
+func TestAuditBackend(t *testing.T) {
+	if _, err := NewAuditStorage(BackendBadger, BackendOptions{}); err == nil {
+		t.Error("Expected an error without a storage path")
+	}
+	if _, err := NewAuditStorage("unknown", BackendOptions{Path: t.TempDir()}); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+
+	s, err := NewAuditStorage(BackendBadger, BackendOptions{Path: t.TempDir(), TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewAuditStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	record := &AuditRecord{ID: GenerateAuditID(), CreatedAt: time.Now(), Provider: "p1", Model: "m1"}
+	if err := s.Store(ctx, record); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	got, err := s.Get(ctx, record.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Provider != "p1" || got.Model != "m1" {
+		t.Errorf("Expected the stored record, got %+v", got)
+	}
+
+	if err := s.RunGC(); err != nil && !errors.Is(err, badger.ErrNoRewrite) {
+		t.Errorf("RunGC failed: %v", err)
+	}
+}
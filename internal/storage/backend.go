@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Built-in storage backends
+const (
+	BackendMemory = "memory"
+	BackendBadger = "badger"
+)
+
+// BackendOptions are the settings passed to a storage backend factory
+type BackendOptions struct {
+	Path       string        // location of the store, ignored by backends that don't persist
+	TTL        time.Duration // how long stored data is kept
+	SlidingTTL bool          // restart the TTL when stored data is read as well as when it is written
+}
+
+// ResponseStorageFactory creates a response storage backend
+type ResponseStorageFactory func(opts BackendOptions) (ResponseStorage, error)
+
+// ConversationStorageFactory creates a conversation storage backend
+type ConversationStorageFactory func(opts BackendOptions) (ConversationStorage, error)
+
+// AuditStorageFactory creates an audit storage backend
+type AuditStorageFactory func(opts BackendOptions) (AuditStorage, error)
+
+var (
+	backendsMu           sync.RWMutex
+	responseBackends     = make(map[string]ResponseStorageFactory)
+	conversationBackends = make(map[string]ConversationStorageFactory)
+	auditBackends        = make(map[string]AuditStorageFactory)
+)
+
+func init() {
+	RegisterResponseBackend(BackendMemory, func(opts BackendOptions) (ResponseStorage, error) {
+		return NewMemoryStorage(opts.TTL), nil
+	})
+	RegisterResponseBackend(BackendBadger, func(opts BackendOptions) (ResponseStorage, error) {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("storage_path is required")
+		}
+		return NewBadgerStorage(opts.Path, opts.TTL)
+	})
+
+	RegisterConversationBackend(BackendMemory, func(opts BackendOptions) (ConversationStorage, error) {
+		return NewMemoryConversationStorage(), nil
+	})
+	RegisterConversationBackend(BackendBadger, func(opts BackendOptions) (ConversationStorage, error) {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("storage_path is required")
+		}
+		store, err := NewBadgerConversationStorage(opts.Path, opts.TTL)
+		if err != nil {
+			return nil, err
+		}
+		store.SetSlidingTTL(opts.SlidingTTL)
+		return store, nil
+	})
+
+	RegisterAuditBackend(BackendBadger, func(opts BackendOptions) (AuditStorage, error) {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("storage_path is required")
+		}
+		return NewBadgerAuditStorage(opts.Path, opts.TTL)
+	})
+}
+
+// RegisterResponseBackend makes a response storage backend available by name
+func RegisterResponseBackend(name string, factory ResponseStorageFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	responseBackends[strings.ToLower(name)] = factory
+}
+
+// RegisterConversationBackend makes a conversation storage backend available by name
+func RegisterConversationBackend(name string, factory ConversationStorageFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	conversationBackends[strings.ToLower(name)] = factory
+}
+
+// RegisterAuditBackend makes an audit storage backend available by name
+func RegisterAuditBackend(name string, factory AuditStorageFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	auditBackends[strings.ToLower(name)] = factory
+}
+
+// ResolveBackend returns the backend to use, when none is configured badger is used
+// if a storage path is set and memory otherwise
+func ResolveBackend(backend, path string) string {
+	if backend != "" {
+		return strings.ToLower(backend)
+	}
+	if path != "" {
+		return BackendBadger
+	}
+	return BackendMemory
+}
+
+// NewResponseStorage creates response storage using the named backend
+func NewResponseStorage(backend string, opts BackendOptions) (ResponseStorage, error) {
+	backendsMu.RLock()
+	factory, ok := responseBackends[backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q, available: %s", backend, backendNames(responseBackends))
+	}
+
+	store, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s storage: %w", backend, err)
+	}
+	return store, nil
+}
+
+// NewConversationStorage creates conversation storage using the named backend
+func NewConversationStorage(backend string, opts BackendOptions) (ConversationStorage, error) {
+	backendsMu.RLock()
+	factory, ok := conversationBackends[backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q, available: %s", backend, backendNames(conversationBackends))
+	}
+
+	store, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s storage: %w", backend, err)
+	}
+	return store, nil
+}
+
+// NewAuditStorage creates audit storage using the named backend
+func NewAuditStorage(backend string, opts BackendOptions) (AuditStorage, error) {
+	backendsMu.RLock()
+	factory, ok := auditBackends[backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q, available: %s", backend, backendNames(auditBackends))
+	}
+
+	store, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s storage: %w", backend, err)
+	}
+	return store, nil
+}
+
+// backendNames lists the registered backend names for error messages
+func backendNames[T any](backends map[string]T) string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -15,12 +15,20 @@ type BadgerStorage struct {
 	ttl time.Duration
 }
 
-func NewBadgerStorage(path string, ttl time.Duration) (*BadgerStorage, error) {
-	opts := badger.DefaultOptions(path).WithLogger(nil) // Disable badger logging
-	db, err := badger.Open(opts)
+// openBadger opens the Badger database at path with logging disabled
+func openBadger(path string) (*badger.DB, error) {
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open badger db: %w", err)
 	}
+	return db, nil
+}
+
+func NewBadgerStorage(path string, ttl time.Duration) (*BadgerStorage, error) {
+	db, err := openBadger(path)
+	if err != nil {
+		return nil, err
+	}
 
 	return &BadgerStorage{
 		db:  db,
@@ -29,6 +37,7 @@ func NewBadgerStorage(path string, ttl time.Duration) (*BadgerStorage, error) {
 }
 
 func (s *BadgerStorage) Store(ctx context.Context, response *StoredResponse) error {
+	response.Version = currentResponseVersion()
 	data, err := json.Marshal(response)
 	if err != nil {
 		return fmt.Errorf("failed to marshal response: %w", err)
@@ -44,7 +53,7 @@ func (s *BadgerStorage) Store(ctx context.Context, response *StoredResponse) err
 }
 
 func (s *BadgerStorage) Get(ctx context.Context, id string) (*StoredResponse, error) {
-	var response StoredResponse
+	var response *StoredResponse
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte("response:" + id))
@@ -52,8 +61,9 @@ func (s *BadgerStorage) Get(ctx context.Context, id string) (*StoredResponse, er
 			return err
 		}
 
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &response)
+		return item.Value(func(val []byte) (err error) {
+			response, err = decodeResponse(val)
+			return err
 		})
 	})
 
@@ -64,7 +74,7 @@ func (s *BadgerStorage) Get(ctx context.Context, id string) (*StoredResponse, er
 		return nil, fmt.Errorf("failed to get response: %w", err)
 	}
 
-	return &response, nil
+	return response, nil
 }
 
 func (s *BadgerStorage) List(ctx context.Context, filter ResponseFilter) ([]StoredResponse, error) {
@@ -80,11 +90,11 @@ func (s *BadgerStorage) List(ctx context.Context, filter ResponseFilter) ([]Stor
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 			item := it.Item()
 			err := item.Value(func(val []byte) error {
-				var response StoredResponse
-				if err := json.Unmarshal(val, &response); err != nil {
+				response, err := decodeResponse(val)
+				if err != nil {
 					return err
 				}
-				responses = append(responses, response)
+				responses = append(responses, *response)
 				return nil
 			})
 			if err != nil {
@@ -119,9 +129,10 @@ func (s *BadgerStorage) UpdateStatus(ctx context.Context, id string, status Resp
 			return err
 		}
 
-		var response StoredResponse
-		err = item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &response)
+		var response *StoredResponse
+		err = item.Value(func(val []byte) (err error) {
+			response, err = decodeResponse(val)
+			return err
 		})
 		if err != nil {
 			return err
@@ -144,7 +155,12 @@ func (s *BadgerStorage) UpdateStatus(ctx context.Context, id string, status Resp
 }
 
 func (s *BadgerStorage) RunGC() error {
-	return s.db.RunValueLogGC(0.5)
+	return runBadgerGC(s.db)
+}
+
+// runBadgerGC reclaims value log space held by deleted and expired entries
+func runBadgerGC(db *badger.DB) error {
+	return db.RunValueLogGC(0.5)
 }
 
 func (s *BadgerStorage) Close() error {
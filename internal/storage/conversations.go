@@ -1,9 +1,14 @@
 package storage
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -12,10 +17,17 @@ import (
 
 // StoredConversation represents a conversation stored in the database
 type StoredConversation struct {
+	Version   int `json:"version,omitempty"` // record format version, see conversationMigrations
 	ID        string
 	CreatedAt time.Time
 	Metadata  map[string]interface{}
-	Items     []openai.ConversationItem
+	Items     []StoredItem
+}
+
+// StoredItem is a conversation item with the time it was created
+type StoredItem struct {
+	openai.ConversationItem
+	CreatedAt int64 `json:"created_at,omitempty"` // Unix seconds, items are listed in this order
 }
 
 // ConversationStorage defines the interface for conversation storage
@@ -26,18 +38,93 @@ type ConversationStorage interface {
 	Update(ctx context.Context, id string, metadata map[string]interface{}) error
 
 	// Item operations
-	AddItems(ctx context.Context, conversationID string, items []openai.ConversationItem) error
+	AddItems(ctx context.Context, conversationID string, items []StoredItem) error
 	GetItems(ctx context.Context, conversationID string, after string, limit int, order string) ([]openai.ConversationItem, bool, error)
 	GetItem(ctx context.Context, conversationID string, itemID string) (*openai.ConversationItem, error)
 	DeleteItem(ctx context.Context, conversationID string, itemID string) error
+	SearchItems(ctx context.Context, conversationID string, query string) ([]openai.ConversationItem, error)
 
 	Close() error
 }
 
+// searchItems returns the items whose text content contains the query, ignoring case
+func searchItems(items []StoredItem, query string) []openai.ConversationItem {
+	query = strings.ToLower(query)
+
+	matches := []openai.ConversationItem{}
+	for _, item := range items {
+		for _, part := range item.Content {
+			if part.Text != "" && strings.Contains(strings.ToLower(part.Text), query) {
+				matches = append(matches, item.ConversationItem)
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+// listItems returns a page of items in chronological order, "asc" or "desc", items created at the same time
+// keep the order they were added in. Returns true if there are more items after the page.
+func listItems(stored []StoredItem, after string, limit int, order string) ([]openai.ConversationItem, bool) {
+	sorted := slices.Clone(stored)
+	slices.SortStableFunc(sorted, func(a, b StoredItem) int {
+		return cmp.Compare(a.CreatedAt, b.CreatedAt)
+	})
+	if order != "asc" {
+		// Default is desc
+		slices.Reverse(sorted)
+	}
+
+	items := make([]openai.ConversationItem, len(sorted))
+	for i, item := range sorted {
+		items[i] = item.ConversationItem
+	}
+
+	// Handle pagination with 'after'
+	startIdx := 0
+	if after != "" {
+		for i, item := range items {
+			if item.ID == after {
+				startIdx = i + 1
+				break
+			}
+		}
+	}
+
+	// Apply limit
+	if limit <= 0 {
+		limit = 20 // Default
+	}
+
+	endIdx := startIdx + limit
+	hasMore := endIdx < len(items)
+	if endIdx > len(items) {
+		endIdx = len(items)
+	}
+
+	if startIdx >= len(items) {
+		return []openai.ConversationItem{}, false
+	}
+
+	return items[startIdx:endIdx], hasMore
+}
+
+// findItem returns the item with the ID, or nil if the conversation doesn't have it
+func findItem(items []StoredItem, itemID string) *openai.ConversationItem {
+	for _, item := range items {
+		if item.ID == itemID {
+			return &item.ConversationItem
+		}
+	}
+	return nil
+}
+
 // BadgerConversationStorage implements ConversationStorage using Badger
 type BadgerConversationStorage struct {
-	db  *badger.DB
-	ttl time.Duration
+	db         *badger.DB
+	ttl        time.Duration
+	slidingTTL bool
 }
 
 // NewBadgerConversationStorage creates a new Badger-based conversation storage
@@ -58,9 +145,15 @@ func NewBadgerConversationStorage(path string, ttl time.Duration) (*BadgerConver
 	return storage, nil
 }
 
+// SetSlidingTTL restarts a conversation's TTL when its items are read, writes always restart it
+func (s *BadgerConversationStorage) SetSlidingTTL(enabled bool) {
+	s.slidingTTL = enabled
+}
+
 func (s *BadgerConversationStorage) Store(ctx context.Context, conversation *StoredConversation) error {
 	key := []byte("conv:" + conversation.ID)
 
+	conversation.Version = currentConversationVersion()
 	data, err := json.Marshal(conversation)
 	if err != nil {
 		return fmt.Errorf("failed to marshal conversation: %w", err)
@@ -77,7 +170,7 @@ func (s *BadgerConversationStorage) Store(ctx context.Context, conversation *Sto
 
 func (s *BadgerConversationStorage) Get(ctx context.Context, id string) (*StoredConversation, error) {
 	key := []byte("conv:" + id)
-	var conversation StoredConversation
+	var conversation *StoredConversation
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
@@ -88,8 +181,9 @@ func (s *BadgerConversationStorage) Get(ctx context.Context, id string) (*Stored
 			return err
 		}
 
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &conversation)
+		return item.Value(func(val []byte) (err error) {
+			conversation, err = decodeConversation(val)
+			return err
 		})
 	})
 
@@ -97,7 +191,29 @@ func (s *BadgerConversationStorage) Get(ctx context.Context, id string) (*Stored
 		return nil, err
 	}
 
-	return &conversation, nil
+	return conversation, nil
+}
+
+// touch restarts the TTL of a conversation by rewriting it unchanged, Badger has no way to update only the expiry.
+// A conflict means another write to the conversation committed first, which restarted the TTL itself.
+func (s *BadgerConversationStorage) touch(id string) error {
+	key := []byte("conv:" + id)
+
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		data, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(key, data).WithTTL(s.ttl))
+	})
+	if errors.Is(err, badger.ErrConflict) {
+		return nil
+	}
+	return err
 }
 
 func (s *BadgerConversationStorage) Delete(ctx context.Context, id string) error {
@@ -118,7 +234,7 @@ func (s *BadgerConversationStorage) Update(ctx context.Context, id string, metad
 	return s.Store(ctx, conversation)
 }
 
-func (s *BadgerConversationStorage) AddItems(ctx context.Context, conversationID string, items []openai.ConversationItem) error {
+func (s *BadgerConversationStorage) AddItems(ctx context.Context, conversationID string, items []StoredItem) error {
 	conversation, err := s.Get(ctx, conversationID)
 	if err != nil {
 		return err
@@ -133,46 +249,14 @@ func (s *BadgerConversationStorage) GetItems(ctx context.Context, conversationID
 	if err != nil {
 		return nil, false, err
 	}
-
-	items := conversation.Items
-
-	// Handle order
-	if order == "asc" {
-		// Items are already in ascending order (as added)
-	} else {
-		// Default is desc - reverse the items
-		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
-			items[i], items[j] = items[j], items[i]
+	if s.slidingTTL && s.ttl > 0 {
+		if err := s.touch(conversationID); err != nil {
+			return nil, false, fmt.Errorf("failed to refresh conversation expiry: %w", err)
 		}
 	}
 
-	// Handle pagination with 'after'
-	startIdx := 0
-	if after != "" {
-		for i, item := range items {
-			if item.ID == after {
-				startIdx = i + 1
-				break
-			}
-		}
-	}
-
-	// Apply limit
-	if limit <= 0 {
-		limit = 20 // Default
-	}
-
-	endIdx := startIdx + limit
-	hasMore := endIdx < len(items)
-	if endIdx > len(items) {
-		endIdx = len(items)
-	}
-
-	if startIdx >= len(items) {
-		return []openai.ConversationItem{}, false, nil
-	}
-
-	return items[startIdx:endIdx], hasMore, nil
+	items, hasMore := listItems(conversation.Items, after, limit, order)
+	return items, hasMore, nil
 }
 
 func (s *BadgerConversationStorage) GetItem(ctx context.Context, conversationID string, itemID string) (*openai.ConversationItem, error) {
@@ -181,12 +265,9 @@ func (s *BadgerConversationStorage) GetItem(ctx context.Context, conversationID
 		return nil, err
 	}
 
-	for _, item := range conversation.Items {
-		if item.ID == itemID {
-			return &item, nil
-		}
+	if item := findItem(conversation.Items, itemID); item != nil {
+		return item, nil
 	}
-
 	return nil, fmt.Errorf("item not found")
 }
 
@@ -197,7 +278,7 @@ func (s *BadgerConversationStorage) DeleteItem(ctx context.Context, conversation
 	}
 
 	// Find and remove the item
-	newItems := make([]openai.ConversationItem, 0, len(conversation.Items))
+	newItems := make([]StoredItem, 0, len(conversation.Items))
 	found := false
 	for _, item := range conversation.Items {
 		if item.ID != itemID {
@@ -215,12 +296,22 @@ func (s *BadgerConversationStorage) DeleteItem(ctx context.Context, conversation
 	return s.Store(ctx, conversation)
 }
 
+func (s *BadgerConversationStorage) SearchItems(ctx context.Context, conversationID string, query string) ([]openai.ConversationItem, error) {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchItems(conversation.Items, query), nil
+}
+
 func (s *BadgerConversationStorage) Close() error {
 	return s.db.Close()
 }
 
 // MemoryConversationStorage implements ConversationStorage using in-memory storage
 type MemoryConversationStorage struct {
+	mu            sync.RWMutex
 	conversations map[string]*StoredConversation
 }
 
@@ -231,42 +322,70 @@ func NewMemoryConversationStorage() *MemoryConversationStorage {
 	}
 }
 
+// copyConversation returns a copy of a conversation so callers never share the stored instance
+func copyConversation(conversation *StoredConversation) *StoredConversation {
+	c := *conversation
+	c.Items = append([]StoredItem(nil), conversation.Items...)
+	return &c
+}
+
 func (s *MemoryConversationStorage) Store(ctx context.Context, conversation *StoredConversation) error {
-	s.conversations[conversation.ID] = conversation
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conversations[conversation.ID] = copyConversation(conversation)
 	return nil
 }
 
 func (s *MemoryConversationStorage) Get(ctx context.Context, id string) (*StoredConversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	conversation, ok := s.conversations[id]
 	if !ok {
 		return nil, fmt.Errorf("conversation not found")
 	}
-	return conversation, nil
+	return copyConversation(conversation), nil
 }
 
 func (s *MemoryConversationStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	delete(s.conversations, id)
 	return nil
 }
 
-func (s *MemoryConversationStorage) Update(ctx context.Context, id string, metadata map[string]interface{}) error {
-	conversation, err := s.Get(ctx, id)
-	if err != nil {
-		return err
-	}
+// modify applies fn to a stored conversation while holding the write lock
+func (s *MemoryConversationStorage) modify(id string, fn func(conversation *StoredConversation) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	conversation.Metadata = metadata
-	return s.Store(ctx, conversation)
-}
+	conversation, ok := s.conversations[id]
+	if !ok {
+		return fmt.Errorf("conversation not found")
+	}
 
-func (s *MemoryConversationStorage) AddItems(ctx context.Context, conversationID string, items []openai.ConversationItem) error {
-	conversation, err := s.Get(ctx, conversationID)
-	if err != nil {
+	updated := copyConversation(conversation)
+	if err := fn(updated); err != nil {
 		return err
 	}
+	s.conversations[id] = updated
+	return nil
+}
 
-	conversation.Items = append(conversation.Items, items...)
-	return s.Store(ctx, conversation)
+func (s *MemoryConversationStorage) Update(ctx context.Context, id string, metadata map[string]interface{}) error {
+	return s.modify(id, func(conversation *StoredConversation) error {
+		conversation.Metadata = metadata
+		return nil
+	})
+}
+
+func (s *MemoryConversationStorage) AddItems(ctx context.Context, conversationID string, items []StoredItem) error {
+	return s.modify(conversationID, func(conversation *StoredConversation) error {
+		conversation.Items = append(conversation.Items, items...)
+		return nil
+	})
 }
 
 func (s *MemoryConversationStorage) GetItems(ctx context.Context, conversationID string, after string, limit int, order string) ([]openai.ConversationItem, bool, error) {
@@ -275,47 +394,8 @@ func (s *MemoryConversationStorage) GetItems(ctx context.Context, conversationID
 		return nil, false, err
 	}
 
-	items := conversation.Items
-
-	// Handle order
-	if order == "asc" {
-		// Items are already in ascending order
-	} else {
-		// Default is desc - reverse the items
-		reversed := make([]openai.ConversationItem, len(items))
-		for i, item := range items {
-			reversed[len(items)-1-i] = item
-		}
-		items = reversed
-	}
-
-	// Handle pagination with 'after'
-	startIdx := 0
-	if after != "" {
-		for i, item := range items {
-			if item.ID == after {
-				startIdx = i + 1
-				break
-			}
-		}
-	}
-
-	// Apply limit
-	if limit <= 0 {
-		limit = 20 // Default
-	}
-
-	endIdx := startIdx + limit
-	hasMore := endIdx < len(items)
-	if endIdx > len(items) {
-		endIdx = len(items)
-	}
-
-	if startIdx >= len(items) {
-		return []openai.ConversationItem{}, false, nil
-	}
-
-	return items[startIdx:endIdx], hasMore, nil
+	items, hasMore := listItems(conversation.Items, after, limit, order)
+	return items, hasMore, nil
 }
 
 func (s *MemoryConversationStorage) GetItem(ctx context.Context, conversationID string, itemID string) (*openai.ConversationItem, error) {
@@ -324,38 +404,41 @@ func (s *MemoryConversationStorage) GetItem(ctx context.Context, conversationID
 		return nil, err
 	}
 
-	for _, item := range conversation.Items {
-		if item.ID == itemID {
-			return &item, nil
-		}
+	if item := findItem(conversation.Items, itemID); item != nil {
+		return item, nil
 	}
-
 	return nil, fmt.Errorf("item not found")
 }
 
 func (s *MemoryConversationStorage) DeleteItem(ctx context.Context, conversationID string, itemID string) error {
-	conversation, err := s.Get(ctx, conversationID)
-	if err != nil {
-		return err
-	}
+	return s.modify(conversationID, func(conversation *StoredConversation) error {
+		// Find and remove the item
+		newItems := make([]StoredItem, 0, len(conversation.Items))
+		found := false
+		for _, item := range conversation.Items {
+			if item.ID != itemID {
+				newItems = append(newItems, item)
+			} else {
+				found = true
+			}
+		}
 
-	// Find and remove the item
-	newItems := make([]openai.ConversationItem, 0, len(conversation.Items))
-	found := false
-	for _, item := range conversation.Items {
-		if item.ID != itemID {
-			newItems = append(newItems, item)
-		} else {
-			found = true
+		if !found {
+			return fmt.Errorf("item not found")
 		}
-	}
 
-	if !found {
-		return fmt.Errorf("item not found")
+		conversation.Items = newItems
+		return nil
+	})
+}
+
+func (s *MemoryConversationStorage) SearchItems(ctx context.Context, conversationID string, query string) ([]openai.ConversationItem, error) {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return nil, err
 	}
 
-	conversation.Items = newItems
-	return s.Store(ctx, conversation)
+	return searchItems(conversation.Items, query), nil
 }
 
 func (s *MemoryConversationStorage) Close() error {
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/paularlott/mcp/openai"
+)
+
+// testSearchItems checks SearchItems against a conversation storage backend
+func testSearchItems(t *testing.T, s ConversationStorage) {
+	t.Helper()
+	ctx := context.Background()
+
+	conversation := &StoredConversation{ID: GenerateConversationID()}
+	if err := s.Store(ctx, conversation); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	items := []StoredItem{
+		{ConversationItem: openai.ConversationItem{ID: "msg_1", Type: "message", Role: "user", Content: []openai.ContentPart{{Type: "input_text", Text: "My favourite colour is Blue"}}}},
+		{ConversationItem: openai.ConversationItem{ID: "msg_2", Type: "message", Role: "assistant", Content: []openai.ContentPart{{Type: "output_text", Text: "Noted."}}}},
+		{ConversationItem: openai.ConversationItem{ID: "msg_3", Type: "message", Role: "user", Content: []openai.ContentPart{{Type: "input_text", Text: "What about the sky?"}, {Type: "input_text", Text: "It is blue too"}}}},
+	}
+	if err := s.AddItems(ctx, conversation.ID, items); err != nil {
+		t.Fatalf("AddItems failed: %v", err)
+	}
+
+	matches, err := s.SearchItems(ctx, conversation.ID, "BLUE")
+	if err != nil {
+		t.Fatalf("SearchItems failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != "msg_1" || matches[1].ID != "msg_3" {
+		t.Errorf("Expected msg_1 and msg_3 to match, got %+v", matches)
+	}
+
+	matches, err = s.SearchItems(ctx, conversation.ID, "green")
+	if err != nil {
+		t.Fatalf("SearchItems failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, got %+v", matches)
+	}
+
+	if _, err := s.SearchItems(ctx, "conv_missing", "blue"); err == nil {
+		t.Errorf("Expected error for unknown conversation")
+	}
+}
+
+// TestMemoryConversationSearchItems tests item search in the memory backend
+func TestMemoryConversationSearchItems(t *testing.T) {
+	testSearchItems(t, NewMemoryConversationStorage())
+}
+
+// TestBadgerConversationSearchItems tests item search in the Badger backend
+func TestBadgerConversationSearchItems(t *testing.T) {
+	s, err := NewBadgerConversationStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewBadgerConversationStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	testSearchItems(t, s)
+}
+
+// TestBadgerConversationSlidingTTL tests that reading the items of a conversation extends its expiry only when
+// the sliding TTL is enabled
+func TestBadgerConversationSlidingTTL(t *testing.T) {
+	ctx := context.Background()
+
+	expiresAt := func(s *BadgerConversationStorage, id string) uint64 {
+		t.Helper()
+		var expires uint64
+		if err := s.db.View(func(txn *badger.Txn) error {
+			item, err := txn.Get([]byte("conv:" + id))
+			if err != nil {
+				return err
+			}
+			expires = item.ExpiresAt()
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to read conversation expiry: %v", err)
+		}
+		return expires
+	}
+
+	stores := map[bool]*BadgerConversationStorage{}
+	expiries := map[bool]uint64{}
+	conversation := &StoredConversation{ID: GenerateConversationID()}
+	for _, sliding := range []bool{false, true} {
+		s, err := NewBadgerConversationStorage(t.TempDir(), time.Hour)
+		if err != nil {
+			t.Fatalf("NewBadgerConversationStorage failed: %v", err)
+		}
+		defer s.Close()
+		s.SetSlidingTTL(sliding)
+
+		if err := s.Store(ctx, conversation); err != nil {
+			t.Fatalf("Store failed: %v", err)
+		}
+		stores[sliding] = s
+		expiries[sliding] = expiresAt(s, conversation.ID)
+	}
+
+	// Badger expiry has a resolution of a second
+	time.Sleep(1100 * time.Millisecond)
+
+	for sliding, s := range stores {
+		if _, _, err := s.GetItems(ctx, conversation.ID, "", 0, "asc"); err != nil {
+			t.Fatalf("GetItems failed: %v", err)
+		}
+
+		expires := expiresAt(s, conversation.ID)
+		if sliding && expires <= expiries[sliding] {
+			t.Errorf("Expected reading the items to extend the expiry, was %d now %d", expiries[sliding], expires)
+		}
+		if !sliding && expires != expiries[sliding] {
+			t.Errorf("Expected the expiry to be unchanged without a sliding TTL, was %d now %d", expiries[sliding], expires)
+		}
+	}
+}
+
+// TestBadgerConversationSlidingTTLConcurrentWrites tests that reading the items of a conversation being written to
+// doesn't fail when refreshing its expiry conflicts with the write
+func TestBadgerConversationSlidingTTLConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewBadgerConversationStorage(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewBadgerConversationStorage failed: %v", err)
+	}
+	defer s.Close()
+	s.SetSlidingTTL(true)
+
+	conversation := &StoredConversation{ID: GenerateConversationID()}
+	if err := s.Store(ctx, conversation); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := s.Store(ctx, conversation); err != nil {
+					t.Errorf("Store failed: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, _, err := s.GetItems(ctx, conversation.ID, "", 0, "asc"); err != nil {
+					t.Errorf("GetItems failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestConversationItemOrder tests that items are listed by creation time whatever order they were added in, with
+// items created at the same time in the order they were added
+func TestConversationItemOrder(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryConversationStorage()
+
+	conversation := &StoredConversation{ID: GenerateConversationID()}
+	if err := s.Store(ctx, conversation); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	item := func(id string, createdAt int64) StoredItem {
+		return StoredItem{ConversationItem: openai.ConversationItem{ID: id, Type: "message"}, CreatedAt: createdAt}
+	}
+	if err := s.AddItems(ctx, conversation.ID, []StoredItem{item("msg_3", 300), item("msg_1", 100)}); err != nil {
+		t.Fatalf("AddItems failed: %v", err)
+	}
+	if err := s.AddItems(ctx, conversation.ID, []StoredItem{item("msg_2a", 200), item("msg_2b", 200)}); err != nil {
+		t.Fatalf("AddItems failed: %v", err)
+	}
+
+	ids := func(items []openai.ConversationItem) []string {
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	items, _, err := s.GetItems(ctx, conversation.ID, "", 0, "asc")
+	if err != nil {
+		t.Fatalf("GetItems failed: %v", err)
+	}
+	if got := ids(items); !slices.Equal(got, []string{"msg_1", "msg_2a", "msg_2b", "msg_3"}) {
+		t.Errorf("Expected chronological order, got %v", got)
+	}
+
+	items, hasMore, err := s.GetItems(ctx, conversation.ID, "msg_3", 2, "desc")
+	if err != nil {
+		t.Fatalf("GetItems failed: %v", err)
+	}
+	if got := ids(items); !slices.Equal(got, []string{"msg_2b", "msg_2a"}) || !hasMore {
+		t.Errorf("Expected the page after msg_3 in reverse chronological order with more to come, got %v (more %v)", got, hasMore)
+	}
+}
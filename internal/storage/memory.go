@@ -3,37 +3,106 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// maxMemorySweepInterval caps how long expired responses can linger in memory
+const maxMemorySweepInterval = time.Hour
+
+// memoryEntry is a stored response with its expiry time
+type memoryEntry struct {
+	response  *StoredResponse
+	expiresAt time.Time // zero when the response never expires
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
 // In-memory implementation
 type MemoryStorage struct {
-	responses map[string]*StoredResponse
+	mu        sync.RWMutex
+	responses map[string]*memoryEntry
+	ttl       time.Duration
+	stop      chan struct{}
+	stopOnce  sync.Once
 }
 
-func NewMemoryStorage() *MemoryStorage {
-	return &MemoryStorage{
-		responses: make(map[string]*StoredResponse),
+// NewMemoryStorage creates a memory storage, responses are evicted once older than ttl (0 keeps them forever)
+func NewMemoryStorage(ttl time.Duration) *MemoryStorage {
+	s := &MemoryStorage{
+		responses: make(map[string]*memoryEntry),
+		ttl:       ttl,
+		stop:      make(chan struct{}),
+	}
+
+	if ttl > 0 {
+		go s.sweep()
+	}
+
+	return s
+}
+
+// sweep periodically removes expired responses until the storage is closed
+func (s *MemoryStorage) sweep() {
+	interval := s.ttl
+	if interval > maxMemorySweepInterval {
+		interval = maxMemorySweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.RunGC()
+		case <-s.stop:
+			return
+		}
 	}
 }
 
 func (s *MemoryStorage) Store(ctx context.Context, response *StoredResponse) error {
-	s.responses[response.ID] = response
+	// Keep a copy so callers modifying their response don't race with readers
+	stored := *response
+	entry := &memoryEntry{response: &stored}
+	if s.ttl > 0 {
+		entry.expiresAt = time.Now().Add(s.ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[response.ID] = entry
 	return nil
 }
 
 func (s *MemoryStorage) Get(ctx context.Context, id string) (*StoredResponse, error) {
-	response, exists := s.responses[id]
-	if !exists {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, exists := s.responses[id]
+	if !exists || entry.expired(time.Now()) {
 		return nil, fmt.Errorf("response not found")
 	}
-	return response, nil
+
+	response := *entry.response
+	return &response, nil
 }
 
 func (s *MemoryStorage) List(ctx context.Context, filter ResponseFilter) ([]StoredResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
 	var responses []StoredResponse
-	for _, response := range s.responses {
-		responses = append(responses, *response)
+	for _, entry := range s.responses {
+		if entry.expired(now) {
+			continue
+		}
+		responses = append(responses, *entry.response)
 		if filter.Limit > 0 && len(responses) >= filter.Limit {
 			break
 		}
@@ -42,24 +111,44 @@ func (s *MemoryStorage) List(ctx context.Context, filter ResponseFilter) ([]Stor
 }
 
 func (s *MemoryStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	delete(s.responses, id)
 	return nil
 }
 
 func (s *MemoryStorage) UpdateStatus(ctx context.Context, id string, status ResponseStatus) error {
-	response, exists := s.responses[id]
-	if !exists {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.responses[id]
+	if !exists || entry.expired(time.Now()) {
 		return fmt.Errorf("response not found")
 	}
+	// Replace rather than modify the response as readers may hold the previous copy
+	response := *entry.response
 	response.Status = status
 	response.UpdatedAt = time.Now()
+	entry.response = &response
 	return nil
 }
 
+// RunGC removes expired responses
 func (s *MemoryStorage) RunGC() error {
-	return nil // No-op for memory storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range s.responses {
+		if entry.expired(now) {
+			delete(s.responses, id)
+		}
+	}
+	return nil
 }
 
 func (s *MemoryStorage) Close() error {
-	return nil // No-op for memory storage
-}
\ No newline at end of file
+	s.stopOnce.Do(func() { close(s.stop) })
+	return nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paularlott/mcp/openai"
+)
+
+// TestMemoryStorageExpiry tests that responses older than the TTL are evicted
+func TestMemoryStorageExpiry(t *testing.T) {
+	s := NewMemoryStorage(50 * time.Millisecond)
+	defer s.Close()
+
+	ctx := context.Background()
+	response := &StoredResponse{ID: GenerateResponseID(), Status: StatusCompleted, CreatedAt: time.Now()}
+	if err := s.Store(ctx, response); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	if _, err := s.Get(ctx, response.ID); err != nil {
+		t.Fatalf("Expected response before expiry, got %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if _, err := s.Get(ctx, response.ID); err == nil {
+		t.Errorf("Expected response to be expired")
+	}
+
+	// The background sweep removes the entry from memory
+	s.mu.RLock()
+	remaining := len(s.responses)
+	s.mu.RUnlock()
+	if remaining != 0 {
+		t.Errorf("Expected expired response to be evicted, %d remaining", remaining)
+	}
+}
+
+// TestMemoryStorageConcurrentAccess stores and reads responses and conversations concurrently,
+// run with -race to detect unsynchronized access
+func TestMemoryStorageConcurrentAccess(t *testing.T) {
+	responses := NewMemoryStorage(time.Hour)
+	defer responses.Close()
+	conversations := NewMemoryConversationStorage()
+
+	ctx := context.Background()
+	conversation := &StoredConversation{ID: GenerateConversationID()}
+	if err := conversations.Store(ctx, conversation); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			response := &StoredResponse{ID: GenerateResponseID(), Status: StatusPending, CreatedAt: time.Now()}
+			if err := responses.Store(ctx, response); err != nil {
+				t.Errorf("Store failed: %v", err)
+				return
+			}
+			if err := responses.UpdateStatus(ctx, response.ID, StatusCompleted); err != nil {
+				t.Errorf("UpdateStatus failed: %v", err)
+			}
+			if stored, err := responses.Get(ctx, response.ID); err != nil {
+				t.Errorf("Get failed: %v", err)
+			} else {
+				_ = stored.Status
+			}
+			if _, err := responses.List(ctx, ResponseFilter{}); err != nil {
+				t.Errorf("List failed: %v", err)
+			}
+			responses.RunGC()
+
+			item := StoredItem{ConversationItem: openai.ConversationItem{ID: GenerateMessageID(), Type: "message", Role: "user"}}
+			if err := conversations.AddItems(ctx, conversation.ID, []StoredItem{item}); err != nil {
+				t.Errorf("AddItems failed: %v", err)
+			}
+			if _, _, err := conversations.GetItems(ctx, conversation.ID, "", 100, "desc"); err != nil {
+				t.Errorf("GetItems failed: %v", err)
+			}
+			if err := conversations.Update(ctx, conversation.ID, map[string]interface{}{"writer": item.ID}); err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := responses.List(ctx, ResponseFilter{})
+	if err != nil || len(stored) != 20 {
+		t.Errorf("Expected 20 responses, got %d (err %v)", len(stored), err)
+	}
+	items, _, err := conversations.GetItems(ctx, conversation.ID, "", 100, "asc")
+	if err != nil || len(items) != 20 {
+		t.Errorf("Expected 20 conversation items, got %d (err %v)", len(items), err)
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// migration upgrades a raw stored record by one version
+type migration func(record map[string]any) error
+
+// responseMigrations and conversationMigrations upgrade persisted records on read, the entry
+// at index i upgrades a record from version i+1 to i+2. Records written before versioning
+// was added have no version and are treated as version 1. Append a migration whenever a
+// change to StoredResponse or StoredConversation needs existing records rewriting.
+var (
+	responseMigrations     []migration
+	conversationMigrations []migration
+)
+
+// currentResponseVersion is the version written with new responses
+func currentResponseVersion() int {
+	return len(responseMigrations) + 1
+}
+
+// currentConversationVersion is the version written with new conversations
+func currentConversationVersion() int {
+	return len(conversationMigrations) + 1
+}
+
+// decodeResponse unmarshals a stored response, migrating it from older versions
+func decodeResponse(data []byte) (*StoredResponse, error) {
+	data, err := migrateRecord(data, responseMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate response: %w", err)
+	}
+
+	var response StoredResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// decodeConversation unmarshals a stored conversation, migrating it from older versions
+func decodeConversation(data []byte) (*StoredConversation, error) {
+	data, err := migrateRecord(data, conversationMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate conversation: %w", err)
+	}
+
+	var conversation StoredConversation
+	if err := json.Unmarshal(data, &conversation); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// migrateRecord applies the migrations a record hasn't yet had, records already at
+// the current version are returned unchanged
+func migrateRecord(data []byte, migrations []migration) ([]byte, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	version := max(header.Version, 1)
+	current := len(migrations) + 1
+	if version == current {
+		return data, nil
+	}
+	if version > current {
+		return nil, fmt.Errorf("record version %d is newer than supported version %d", version, current)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	for v := version; v < current; v++ {
+		if err := migrations[v-1](record); err != nil {
+			return nil, fmt.Errorf("version %d to %d: %w", v, v+1, err)
+		}
+	}
+	record["version"] = current
+
+	return json.Marshal(record)
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// TestResponseMigration tests that a v1 response is upgraded on read by a v2 migration
+func TestResponseMigration(t *testing.T) {
+	saved := responseMigrations
+	defer func() { responseMigrations = saved }()
+
+	// v2 records the provider in the metadata, v1 records predate it
+	responseMigrations = []migration{
+		func(record map[string]any) error {
+			metadata, _ := record["metadata"].(map[string]any)
+			if metadata == nil {
+				metadata = map[string]any{}
+				record["metadata"] = metadata
+			}
+			metadata["provider"] = "legacy"
+			return nil
+		},
+	}
+
+	s, err := NewBadgerStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewBadgerStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	v1 := `{"id":"resp_v1","status":"completed","metadata":{"model":"gpt-4"}}`
+	err = s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("response:resp_v1"), []byte(v1))
+	})
+	if err != nil {
+		t.Fatalf("failed to write v1 record: %v", err)
+	}
+
+	ctx := context.Background()
+	response, err := s.Get(ctx, "resp_v1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if response.Version != 2 {
+		t.Errorf("Expected version 2, got %d", response.Version)
+	}
+	if response.Metadata.Provider != "legacy" || response.Metadata.Model != "gpt-4" {
+		t.Errorf("Expected migrated metadata, got %+v", response.Metadata)
+	}
+
+	// New records are written at the current version and read back unchanged
+	current := &StoredResponse{ID: "resp_v2", Status: StatusCompleted, Metadata: ResponseMetadata{Provider: "openai"}}
+	if err := s.Store(ctx, current); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	response, err = s.Get(ctx, "resp_v2")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if response.Version != 2 || response.Metadata.Provider != "openai" {
+		t.Errorf("Expected current record unchanged, got %+v", response)
+	}
+}
+
+// TestConversationMigration tests that a v1 conversation is upgraded on read by a v2 migration
+func TestConversationMigration(t *testing.T) {
+	saved := conversationMigrations
+	defer func() { conversationMigrations = saved }()
+
+	conversationMigrations = []migration{
+		func(record map[string]any) error {
+			if record["Metadata"] == nil {
+				record["Metadata"] = map[string]any{"migrated": true}
+			}
+			return nil
+		},
+	}
+
+	s, err := NewSQLiteConversationStorage(filepath.Join(t.TempDir(), "conversations.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteConversationStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	v1 := `{"ID":"conv_v1","Items":[{"id":"msg_1","type":"message","role":"user"}]}`
+	_, err = s.store.db.Exec(`INSERT INTO conversations (id, data, created_at, expires_at) VALUES (?, ?, ?, 0)`,
+		"conv_v1", v1, time.Now().UnixNano())
+	if err != nil {
+		t.Fatalf("failed to write v1 record: %v", err)
+	}
+
+	conversation, err := s.Get(context.Background(), "conv_v1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if conversation.Version != 2 || conversation.Metadata["migrated"] != true {
+		t.Errorf("Expected migrated conversation, got %+v", conversation)
+	}
+	if len(conversation.Items) != 1 || conversation.Items[0].ID != "msg_1" {
+		t.Errorf("Expected items to survive migration, got %+v", conversation.Items)
+	}
+}
+
+// TestMigrationRejectsNewerVersion tests that records from a newer release are not silently misread
+func TestMigrationRejectsNewerVersion(t *testing.T) {
+	if _, err := decodeResponse([]byte(`{"version":99,"id":"resp_future"}`)); err == nil {
+		t.Error("Expected an error for a record newer than the supported version")
+	}
+}
@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paularlott/mcp/openai"
+	_ "modernc.org/sqlite"
+)
+
+// BackendSQLite stores responses or conversations in a single SQLite database file
+const BackendSQLite = "sqlite"
+
+// maxSQLiteSweepInterval caps how long expired rows can linger in the database
+const maxSQLiteSweepInterval = time.Hour
+
+func init() {
+	RegisterResponseBackend(BackendSQLite, func(opts BackendOptions) (ResponseStorage, error) {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("storage_path is required")
+		}
+		return NewSQLiteStorage(opts.Path, opts.TTL)
+	})
+	RegisterConversationBackend(BackendSQLite, func(opts BackendOptions) (ConversationStorage, error) {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("storage_path is required")
+		}
+		store, err := NewSQLiteConversationStorage(opts.Path, opts.TTL)
+		if err != nil {
+			return nil, err
+		}
+		store.SetSlidingTTL(opts.SlidingTTL)
+		return store, nil
+	})
+}
+
+// sqliteStore is a table of JSON documents keyed by ID with an optional expiry, shared by
+// the response and conversation storage
+type sqliteStore struct {
+	db       *sql.DB
+	table    string
+	ttl      time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func openSQLiteStore(path string, table string, ttl time.Duration) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db: %w", err)
+	}
+
+	// SQLite allows a single writer, serialize access rather than fail with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	schema := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		id         TEXT PRIMARY KEY,
+		data       TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+
+	s := &sqliteStore{
+		db:    db,
+		table: table,
+		ttl:   ttl,
+		stop:  make(chan struct{}),
+	}
+
+	if ttl > 0 {
+		go s.sweep()
+	}
+
+	return s, nil
+}
+
+// sweep periodically removes expired rows until the store is closed
+func (s *sqliteStore) sweep() {
+	interval := s.ttl
+	if interval > maxSQLiteSweepInterval {
+		interval = maxSQLiteSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// expiresAt returns the expiry for a row written now, 0 when rows never expire
+func (s *sqliteStore) expiresAt() int64 {
+	if s.ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(s.ttl).UnixNano()
+}
+
+// put writes a document, refreshing its expiry like the Badger backend does
+func (s *sqliteStore) put(ctx context.Context, id string, createdAt time.Time, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO `+s.table+` (id, data, created_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at`,
+		id, string(data), createdAt.UnixNano(), s.expiresAt())
+	return err
+}
+
+// get reads a live document, returning nil when it is missing or expired
+func (s *sqliteStore) get(ctx context.Context, id string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT data FROM `+s.table+` WHERE id = ? AND (expires_at = 0 OR expires_at > ?)`,
+		id, time.Now().UnixNano()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
+
+// touch restarts the expiry of a live document
+func (s *sqliteStore) touch(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE `+s.table+` SET expires_at = ? WHERE id = ? AND expires_at != 0`,
+		s.expiresAt(), id)
+	return err
+}
+
+func (s *sqliteStore) delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqliteStore) deleteExpired() error {
+	_, err := s.db.Exec(`DELETE FROM `+s.table+` WHERE expires_at != 0 AND expires_at <= ?`, time.Now().UnixNano())
+	return err
+}
+
+func (s *sqliteStore) close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return s.db.Close()
+}
+
+// SQLiteStorage implements ResponseStorage using a SQLite database file
+type SQLiteStorage struct {
+	store *sqliteStore
+}
+
+func NewSQLiteStorage(path string, ttl time.Duration) (*SQLiteStorage, error) {
+	store, err := openSQLiteStore(path, "responses", ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStorage{store: store}, nil
+}
+
+func (s *SQLiteStorage) Store(ctx context.Context, response *StoredResponse) error {
+	response.Version = currentResponseVersion()
+	if err := s.store.put(ctx, response.ID, response.CreatedAt, response); err != nil {
+		return fmt.Errorf("failed to store response: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) Get(ctx context.Context, id string) (*StoredResponse, error) {
+	data, err := s.store.get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response: %w", err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("response not found")
+	}
+
+	response, err := decodeResponse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response: %w", err)
+	}
+	return response, nil
+}
+
+func (s *SQLiteStorage) List(ctx context.Context, filter ResponseFilter) ([]StoredResponse, error) {
+	query := `SELECT data FROM responses WHERE (expires_at = 0 OR expires_at > ?) ORDER BY created_at`
+	if filter.Order == "desc" {
+		query += ` DESC`
+	}
+	args := []any{time.Now().UnixNano()}
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list responses: %w", err)
+	}
+	defer rows.Close()
+
+	var responses []StoredResponse
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to list responses: %w", err)
+		}
+
+		response, err := decodeResponse(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list responses: %w", err)
+		}
+		responses = append(responses, *response)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list responses: %w", err)
+	}
+
+	return responses, nil
+}
+
+func (s *SQLiteStorage) Delete(ctx context.Context, id string) error {
+	return s.store.delete(ctx, id)
+}
+
+func (s *SQLiteStorage) UpdateStatus(ctx context.Context, id string, status ResponseStatus) error {
+	response, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	response.Status = status
+	response.UpdatedAt = time.Now()
+	return s.Store(ctx, response)
+}
+
+// RunGC removes expired responses
+func (s *SQLiteStorage) RunGC() error {
+	return s.store.deleteExpired()
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.store.close()
+}
+
+// SQLiteConversationStorage implements ConversationStorage using a SQLite database file
+type SQLiteConversationStorage struct {
+	store      *sqliteStore
+	slidingTTL bool
+}
+
+// NewSQLiteConversationStorage creates a new SQLite-based conversation storage
+func NewSQLiteConversationStorage(path string, ttl time.Duration) (*SQLiteConversationStorage, error) {
+	store, err := openSQLiteStore(path, "conversations", ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteConversationStorage{store: store}, nil
+}
+
+// SetSlidingTTL restarts a conversation's TTL when its items are read, writes always restart it
+func (s *SQLiteConversationStorage) SetSlidingTTL(enabled bool) {
+	s.slidingTTL = enabled
+}
+
+func (s *SQLiteConversationStorage) Store(ctx context.Context, conversation *StoredConversation) error {
+	conversation.Version = currentConversationVersion()
+	if err := s.store.put(ctx, conversation.ID, conversation.CreatedAt, conversation); err != nil {
+		return fmt.Errorf("failed to store conversation: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteConversationStorage) Get(ctx context.Context, id string) (*StoredConversation, error) {
+	data, err := s.store.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("conversation not found")
+	}
+	return decodeConversation(data)
+}
+
+func (s *SQLiteConversationStorage) Delete(ctx context.Context, id string) error {
+	return s.store.delete(ctx, id)
+}
+
+func (s *SQLiteConversationStorage) Update(ctx context.Context, id string, metadata map[string]interface{}) error {
+	conversation, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	conversation.Metadata = metadata
+	return s.Store(ctx, conversation)
+}
+
+func (s *SQLiteConversationStorage) AddItems(ctx context.Context, conversationID string, items []StoredItem) error {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+
+	conversation.Items = append(conversation.Items, items...)
+	return s.Store(ctx, conversation)
+}
+
+func (s *SQLiteConversationStorage) GetItems(ctx context.Context, conversationID string, after string, limit int, order string) ([]openai.ConversationItem, bool, error) {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.slidingTTL {
+		if err := s.store.touch(ctx, conversationID); err != nil {
+			return nil, false, fmt.Errorf("failed to refresh conversation expiry: %w", err)
+		}
+	}
+
+	items, hasMore := listItems(conversation.Items, after, limit, order)
+	return items, hasMore, nil
+}
+
+func (s *SQLiteConversationStorage) GetItem(ctx context.Context, conversationID string, itemID string) (*openai.ConversationItem, error) {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if item := findItem(conversation.Items, itemID); item != nil {
+		return item, nil
+	}
+	return nil, fmt.Errorf("item not found")
+}
+
+func (s *SQLiteConversationStorage) DeleteItem(ctx context.Context, conversationID string, itemID string) error {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+
+	// Find and remove the item
+	newItems := make([]StoredItem, 0, len(conversation.Items))
+	found := false
+	for _, item := range conversation.Items {
+		if item.ID != itemID {
+			newItems = append(newItems, item)
+		} else {
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("item not found")
+	}
+
+	conversation.Items = newItems
+	return s.Store(ctx, conversation)
+}
+
+func (s *SQLiteConversationStorage) SearchItems(ctx context.Context, conversationID string, query string) ([]openai.ConversationItem, error) {
+	conversation, err := s.Get(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchItems(conversation.Items, query), nil
+}
+
+// RunGC removes expired conversations
+func (s *SQLiteConversationStorage) RunGC() error {
+	return s.store.deleteExpired()
+}
+
+func (s *SQLiteConversationStorage) Close() error {
+	return s.store.close()
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSQLiteConversationSearchItems tests item search in the SQLite backend
+func TestSQLiteConversationSearchItems(t *testing.T) {
+	s, err := NewSQLiteConversationStorage(filepath.Join(t.TempDir(), "conversations.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteConversationStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	testSearchItems(t, s)
+}
+
+// TestSQLiteStorageExpiry tests that responses older than the TTL are hidden and then removed
+func TestSQLiteStorageExpiry(t *testing.T) {
+	s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "responses.db"), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	response := &StoredResponse{ID: GenerateResponseID(), Status: StatusPending, CreatedAt: time.Now()}
+	if err := s.Store(ctx, response); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	if err := s.UpdateStatus(ctx, response.ID, StatusCompleted); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	stored, err := s.Get(ctx, response.ID)
+	if err != nil {
+		t.Fatalf("Expected response before expiry, got %v", err)
+	}
+	if stored.Status != StatusCompleted {
+		t.Errorf("Expected status %s, got %s", StatusCompleted, stored.Status)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if _, err := s.Get(ctx, response.ID); err == nil {
+		t.Errorf("Expected response to be expired")
+	}
+	if responses, err := s.List(ctx, ResponseFilter{}); err != nil || len(responses) != 0 {
+		t.Errorf("Expected no listed responses, got %d (err %v)", len(responses), err)
+	}
+
+	if err := s.RunGC(); err != nil {
+		t.Fatalf("RunGC failed: %v", err)
+	}
+	var remaining int
+	if err := s.store.db.QueryRow(`SELECT COUNT(*) FROM responses`).Scan(&remaining); err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("Expected expired response to be removed, %d remaining", remaining)
+	}
+}
+
+// TestSQLiteConversationSlidingTTL tests that reading the items of a conversation keeps it alive past its TTL
+// when the sliding TTL is enabled
+func TestSQLiteConversationSlidingTTL(t *testing.T) {
+	s, err := NewSQLiteConversationStorage(filepath.Join(t.TempDir(), "conversations.db"), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewSQLiteConversationStorage failed: %v", err)
+	}
+	defer s.Close()
+	s.SetSlidingTTL(true)
+
+	ctx := context.Background()
+	conversation := &StoredConversation{ID: GenerateConversationID(), CreatedAt: time.Now()}
+	if err := s.Store(ctx, conversation); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(120 * time.Millisecond)
+		if _, _, err := s.GetItems(ctx, conversation.ID, "", 0, "asc"); err != nil {
+			t.Fatalf("Expected the conversation to be kept alive by reads, got %v", err)
+		}
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if _, err := s.Get(ctx, conversation.ID); err == nil {
+		t.Error("Expected the conversation to expire once it is no longer read")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 // Storage-specific types
 type StoredResponse struct {
+	Version   int                    `json:"version,omitempty"` // record format version, see responseMigrations
 	ID        string                 `json:"id"`
 	CreatedAt time.Time              `json:"created_at"`
 	UpdatedAt time.Time              `json:"updated_at"`
@@ -30,10 +31,11 @@ const (
 )
 
 type ResponseMetadata struct {
-	Provider  string    `json:"provider"`
-	Model     string    `json:"model"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Tags      map[string]string `json:"tags,omitempty"`
 }
 
 type ResponseFilter struct {
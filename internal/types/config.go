@@ -3,39 +3,149 @@ package types
 // Configuration types
 
 type Config struct {
-	Server        ServerConfig        `json:"server"`
-	Logging       LoggingConfig       `json:"logging"`
-	Providers     []ProviderConfig    `json:"providers"`
-	MCP           MCPConfig           `json:"mcp"`
-	Scriptling    ScriptlingConfig    `json:"scriptling"`
-	Responses     ResponsesConfig     `json:"responses"`
-	Conversations ConversationsConfig `json:"conversations"`
+	Server           ServerConfig             `json:"server"`
+	Logging          LoggingConfig            `json:"logging"`
+	Providers        []ProviderConfig         `json:"providers"`
+	MCP              MCPConfig                `json:"mcp"`
+	Scriptling       ScriptlingConfig         `json:"scriptling"`
+	Responses        ResponsesConfig          `json:"responses"`
+	Conversations    ConversationsConfig      `json:"conversations"`
+	Audit            AuditConfig              `json:"audit"`
+	Models           map[string]ModelMetadata `json:"models,omitempty"` // Optional metadata keyed by model ID
+	EmbeddingModels  EmbeddingModelsConfig    `json:"embedding_models"`
+	DeprecatedModels DeprecatedModelsConfig   `json:"deprecated_models"`
+	SystemPrompt     SystemPromptConfig       `json:"system_prompt"`
+	Pools            []PoolConfig             `json:"pools,omitempty"`
+	ModelIDs         ModelIDsConfig           `json:"model_ids"`
+	Health           HealthConfig             `json:"health"`
+	Streaming        StreamingConfig          `json:"streaming"`
+	SessionAffinity  SessionAffinityConfig    `json:"session_affinity"`
+	ModelCache       ModelCacheConfig         `json:"model_cache"`
+}
+
+// ModelCacheConfig reuses each provider's model list for a short time so successive refreshes don't refetch it
+type ModelCacheConfig struct {
+	TTL int `json:"ttl,omitempty"` // Seconds a provider's model list is reused, 0 disables the cache
+}
+
+// SessionAffinityConfig routes requests sharing an X-Session-ID header to the same provider
+type SessionAffinityConfig struct {
+	Enabled     bool `json:"enabled,omitempty"`
+	TTL         int  `json:"ttl,omitempty"`          // Seconds a session is remembered after its last request, uses the default when 0
+	MaxSessions int  `json:"max_sessions,omitempty"` // Sessions remembered before the stalest are forgotten, uses the default when 0
+}
+
+// StreamingConfig controls how streaming chat completions are proxied
+type StreamingConfig struct {
+	PassthroughOnly    bool `json:"passthrough_only,omitempty"`     // Copy streams unchanged without counting tokens or injecting usage
+	AggregateToolCalls bool `json:"aggregate_tool_calls,omitempty"` // Rebuild streamed tool calls from their fragments and log them when the stream ends
+}
+
+// HealthConfig controls how providers that are reachable but not useful are handled
+type HealthConfig struct {
+	EmptyModelsThreshold    int      `json:"empty_models_threshold,omitempty"`    // Consecutive refreshes with no models before a provider is flagged, uses the default when 0
+	DisableEmptyProviders   bool     `json:"disable_empty_providers,omitempty"`   // Disable flagged providers until they report models again
+	ConnectionErrorPatterns []string `json:"connection_error_patterns,omitempty"` // Extra error substrings, matched case-insensitively, that disable a provider like a connection error
+	KeepLastProvider        bool     `json:"keep_last_provider,omitempty"`        // Don't disable a provider on errors when it is the only provider of a model
+	TCPProbeTimeout         int      `json:"tcp_probe_timeout,omitempty"`         // Seconds to wait for a TCP connection to a disabled provider before its HTTP health check, 0 disables the probe
+	CompletionCheck         bool     `json:"completion_check,omitempty"`          // Send a canary completion before re-enabling a disabled provider, as listing models doesn't prove it can complete
+	CompletionCheckModel    string   `json:"completion_check_model,omitempty"`    // Model for the canary completion, the check is skipped for providers that don't list it, the first chat model listed is used when empty
+	CompletionCheckPrompt   string   `json:"completion_check_prompt,omitempty"`   // Prompt for the canary completion, uses the default when empty
 }
 
 type ServerConfig struct {
-	Host  string `json:"host"`
-	Port  int    `json:"port"`
-	Token string `json:"token,omitempty"`
+	Host                   string `json:"host"`
+	Port                   int    `json:"port"`
+	Token                  string `json:"token,omitempty"`
+	AdminToken             string `json:"admin_token,omitempty"`              // Bearer token for the admin endpoints, uses Token when empty
+	RateLimit              int    `json:"rate_limit,omitempty"`               // Requests per minute per client, 0 disables rate limiting
+	RedisURL               string `json:"redis_url,omitempty"`                // Share rate limit counters between instances via Redis
+	ProviderHeaders        bool   `json:"provider_headers,omitempty"`         // Add X-LLMRouter-Provider and X-LLMRouter-Model headers to completions
+	ProviderOverride       bool   `json:"provider_override,omitempty"`        // Let clients pin a request to a provider with the X-LLMRouter-Provider header
+	IdempotencyTTL         int    `json:"idempotency_ttl,omitempty"`          // Seconds a chat completion is returned for a repeated Idempotency-Key, uses the default when 0
+	ValidateResponseSchema bool   `json:"validate_response_schema,omitempty"` // Retry a non-streaming completion once if it doesn't match its json_schema response_format
+	PassthroughProvider    string `json:"passthrough_provider,omitempty"`     // Provider unhandled /v1 requests are proxied to, disabled when empty
+	StartupRefreshTimeout  int    `json:"startup_refresh_timeout,omitempty"`  // Seconds to wait for the model refresh at startup before serving, uses the default when 0
+	MaxMessages            int    `json:"max_messages,omitempty"`             // Messages allowed in a chat completion or response request, 0 for no limit
+	MaxPromptChars         int    `json:"max_prompt_chars,omitempty"`         // Characters of message text allowed in a chat completion or response request, 0 for no limit
 }
 
 type LoggingConfig struct {
-	Level  string `json:"level"`
-	Format string `json:"format"`
+	Level         string   `json:"level"`
+	Format        string   `json:"format"`
+	RedactFields  []string `json:"redact_fields,omitempty"`  // Additional field names whose values are redacted from logs
+	ShutdownStats bool     `json:"shutdown_stats,omitempty"` // Log each provider's requests, errors and tokens when the server stops
 }
 
 type ProviderConfig struct {
-	Name            string   `json:"name"`
-	BaseURL         string   `json:"base_url"`
-	Token           string   `json:"token"`
-	Enabled         bool     `json:"enabled"`
-	Models          []string `json:"models,omitempty"`
-	Allowlist       []string `json:"allowlist,omitempty"`
-	Denylist        []string `json:"denylist,omitempty"`
-	NativeResponses bool     `json:"native_responses,omitempty"`
+	Name               string   `json:"name"`
+	BaseURL            string   `json:"base_url"`
+	Token              string   `json:"token"`
+	TokenFile          string   `json:"token_file,omitempty"`           // Read token from file, takes precedence over Token
+	Organization       string   `json:"organization,omitempty"`         // Sent as the OpenAI-Organization header
+	Project            string   `json:"project,omitempty"`              // Sent as the OpenAI-Project header
+	UserAgent          string   `json:"user_agent,omitempty"`           // User-Agent sent to the provider, uses the default when empty
+	ClientCertFile     string   `json:"client_cert_file,omitempty"`     // Client certificate presented to providers behind mutual TLS
+	ClientKeyFile      string   `json:"client_key_file,omitempty"`      // Private key of the client certificate
+	CAFile             string   `json:"ca_file,omitempty"`              // CA certificates trusted for the provider, in place of the system roots
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"` // Skip verifying the provider's certificate, for self-signed development servers only
+	Proxy              string   `json:"proxy,omitempty"`                // Proxy URL for requests to the provider, uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY when empty
+	Enabled            bool     `json:"enabled"`
+	Models             []string `json:"models,omitempty"`
+	ModelsSource       string   `json:"models_source,omitempty"` // Where to list models from in place of /models, e.g. file:///etc/llmrouter/models.json
+	Allowlist          []string `json:"allowlist,omitempty"`
+	Denylist           []string `json:"denylist,omitempty"`
+	NativeResponses    bool     `json:"native_responses,omitempty"`
+}
+
+// ModelMetadata describes a model's limits and capabilities, reported by the models endpoint
+type ModelMetadata struct {
+	ContextLength       int   `json:"context_length,omitempty"`
+	MaxOutputTokens     int   `json:"max_output_tokens,omitempty"`
+	SupportsTools       *bool `json:"supports_tools,omitempty"`
+	SupportsVision      *bool `json:"supports_vision,omitempty"`
+	EmbeddingDimensions int   `json:"embedding_dimensions,omitempty"` // Expected embedding size, responses of any other size are rejected
+}
+
+// EmbeddingModelsConfig classifies models as embedding-only so they are rejected for chat completions
+type EmbeddingModelsConfig struct {
+	Patterns []string `json:"patterns,omitempty"` // Glob patterns matched against model IDs, e.g. "*embed*"
+	Models   []string `json:"models,omitempty"`   // Explicit model IDs
+}
+
+// DeprecatedModelsConfig lists models being phased out, requests for them are served with a deprecation warning
+type DeprecatedModelsConfig struct {
+	Models       []string          `json:"models,omitempty"`       // Deprecated model IDs, still routed as requested
+	Replacements map[string]string `json:"replacements,omitempty"` // Deprecated model ID -> model requests are routed to instead
+}
+
+// SystemPromptConfig prepends a system message to chat completions, e.g. to enforce safety instructions
+type SystemPromptConfig struct {
+	Content string            `json:"content,omitempty"` // System message for every model without its own
+	Models  map[string]string `json:"models,omitempty"`  // Model ID -> system message, in place of Content
+	Always  bool              `json:"always,omitempty"`  // Prepend even when the client sent its own system message
+}
+
+// PoolConfig groups providers into a named pool with its own routing strategy
+type PoolConfig struct {
+	Name      string   `json:"name"`
+	Providers []string `json:"providers"`
+	Strategy  string   `json:"strategy,omitempty"` // "least_active" (default), "round_robin" or "priority"
+}
+
+// ModelIDsConfig controls how model IDs reported by providers are normalized
+type ModelIDsConfig struct {
+	CaseInsensitive bool `json:"case_insensitive,omitempty"` // Case-fold model IDs so providers reporting "GPT-4" and "gpt-4" share one model
 }
 
 type MCPConfig struct {
-	RemoteServers []MCPRemoteServerConfig `json:"remote_servers,omitempty"` // Remote MCP server connections
+	Instructions          string                  `json:"instructions,omitempty"`             // Instructions reported to MCP clients, uses the default when empty
+	RemoteServers         []MCPRemoteServerConfig `json:"remote_servers,omitempty"`           // Remote MCP server connections
+	MaxToolResultSize     int                     `json:"max_tool_result_size,omitempty"`     // Max bytes of a tool result added to a conversation, no limit when 0
+	HTTPGetAllowedDomains []string                `json:"http_get_allowed_domains,omitempty"` // Domains, and their subdomains, the http_get tool can fetch from, the tool is not registered when empty
+	HTTPGetMaxBytes       int                     `json:"http_get_max_bytes,omitempty"`       // Max bytes of a body fetched by http_get, uses the default when 0
+	AuditTools            bool                    `json:"audit_tools,omitempty"`              // Log each tool execution with its arguments, caller, duration and truncated result
+	MaxConcurrentTools    int                     `json:"max_concurrent_tools,omitempty"`     // Script tool executions at once, calls over the limit are rejected, unlimited when 0
 }
 
 type MCPRemoteServerConfig struct {
@@ -46,16 +156,32 @@ type MCPRemoteServerConfig struct {
 }
 
 type ScriptlingConfig struct {
-	ToolsPath     string `json:"tools_path,omitempty"`
-	LibrariesPath string `json:"libraries_path,omitempty"`
+	ToolsPath     string   `json:"tools_path,omitempty"`
+	LibrariesPath string   `json:"libraries_path,omitempty"`
+	DisabledTools []string `json:"disabled_tools,omitempty"` // Tools not offered to MCP clients, including execute_code, tool_search and execute_tool
 }
 
 type ResponsesConfig struct {
-	StoragePath string `json:"storage_path,omitempty"`
-	TTLDays     int    `json:"ttl_days,omitempty"`
+	Backend        string `json:"backend,omitempty"` // memory, badger or sqlite; defaults to badger when storage_path is set
+	StoragePath    string `json:"storage_path,omitempty"`
+	TTLDays        int    `json:"ttl_days,omitempty"`
+	MaxRetries     int    `json:"max_retries,omitempty"`      // Retries of a failed completion before the response is marked as an error
+	RetryBackoffMs int    `json:"retry_backoff_ms,omitempty"` // Delay before the first retry, doubled for each further retry
+	MaxConcurrent  int    `json:"max_concurrent,omitempty"`   // Background responses processed at once
+	MaxQueued      int    `json:"max_queued,omitempty"`       // Background responses waiting for a worker, further responses are rejected
+	PollInterval   int    `json:"poll_interval,omitempty"`    // Seconds clients are told to wait before polling a background response
 }
 
 type ConversationsConfig struct {
+	Backend     string `json:"backend,omitempty"` // memory, badger or sqlite; defaults to badger when storage_path is set
 	StoragePath string `json:"storage_path,omitempty"`
 	TTLDays     int    `json:"ttl_days,omitempty"`
+	SlidingTTL  bool   `json:"sliding_ttl,omitempty"` // Restart a conversation's TTL when its items are read, not only when it is written
+}
+
+// AuditConfig captures the request and response of each chat completion for compliance
+type AuditConfig struct {
+	Enabled     bool   `json:"enabled,omitempty"`
+	StoragePath string `json:"storage_path,omitempty"` // Badger database directory, required when enabled
+	TTLDays     int    `json:"ttl_days,omitempty"`     // Days records are kept, defaults to 30
 }
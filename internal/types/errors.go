@@ -0,0 +1,13 @@
+package types
+
+import "fmt"
+
+// UpstreamStatusError is returned when a provider responds with a non-success HTTP status
+type UpstreamStatusError struct {
+	StatusCode int
+	Message    string // the error body returned by the provider
+}
+
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+}
@@ -19,13 +19,25 @@ var configFile = "config.toml"
 
 // Type aliases for compatibility
 type (
-	Config                = types.Config
-	ServerConfig          = types.ServerConfig
-	LoggingConfig         = types.LoggingConfig
-	ProviderConfig        = types.ProviderConfig
-	MCPConfig             = types.MCPConfig
-	MCPRemoteServerConfig = types.MCPRemoteServerConfig
-	ScriptlingConfig      = types.ScriptlingConfig
+	Config                 = types.Config
+	ServerConfig           = types.ServerConfig
+	LoggingConfig          = types.LoggingConfig
+	ProviderConfig         = types.ProviderConfig
+	MCPConfig              = types.MCPConfig
+	MCPRemoteServerConfig  = types.MCPRemoteServerConfig
+	ScriptlingConfig       = types.ScriptlingConfig
+	ModelMetadata          = types.ModelMetadata
+	EmbeddingModelsConfig  = types.EmbeddingModelsConfig
+	DeprecatedModelsConfig = types.DeprecatedModelsConfig
+	SystemPromptConfig     = types.SystemPromptConfig
+	PoolConfig             = types.PoolConfig
+	ModelIDsConfig         = types.ModelIDsConfig
+	HealthConfig           = types.HealthConfig
+	StreamingConfig        = types.StreamingConfig
+	SessionAffinityConfig  = types.SessionAffinityConfig
+	ModelCacheConfig       = types.ModelCacheConfig
+	AuditConfig            = types.AuditConfig
+	UpstreamStatusError    = types.UpstreamStatusError
 )
 
 func main() {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/paularlott/mcp"
+)
+
+// bufferedResponseWriter captures a response so it can be inspected before being written to the client
+type bufferedResponseWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{
+		header:     make(http.Header),
+		statusCode: http.StatusOK,
+	}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// readBatchRequest reads the request body and returns the individual requests if it is a JSON-RPC batch.
+// The body is restored so that non-batch requests can be handled as normal, bodies over maxRequestBodySize are
+// rejected with an *http.MaxBytesError.
+func readBatchRequest(r *http.Request) ([]json.RawMessage, bool, error) {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return nil, false, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxRequestBodySize))
+	r.Body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, false, nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(trimmed, &batch); err != nil {
+		return nil, true, err
+	}
+
+	return batch, true, nil
+}
+
+// handleBatch dispatches each request in a JSON-RPC batch to the MCP server and writes an array of the responses.
+// Notifications (requests without an id) produce no entry in the response array.
+func (m *MCPServer) handleBatch(w http.ResponseWriter, r *http.Request, batch []json.RawMessage) {
+	if len(batch) == 0 {
+		writeJSONRPCError(w, nil, mcp.ErrorCodeInvalidRequest, "Invalid Request", "empty batch")
+		return
+	}
+
+	responses := make([]json.RawMessage, 0, len(batch))
+	for _, item := range batch {
+		var envelope map[string]json.RawMessage
+		if err := json.Unmarshal(item, &envelope); err != nil {
+			responses = append(responses, jsonRPCError(nil, mcp.ErrorCodeInvalidRequest, "Invalid Request", err.Error()))
+			continue
+		}
+		rawID, hasID := envelope["id"]
+		var id any
+		json.Unmarshal(rawID, &id)
+
+		subReq := r.Clone(r.Context())
+		subReq.Body = io.NopCloser(bytes.NewReader(item))
+		subReq.ContentLength = int64(len(item))
+
+		sw := newBufferedResponseWriter()
+		m.dispatch(sw, subReq)
+
+		if !hasID {
+			continue
+		}
+
+		result := bytes.TrimSpace(sw.body.Bytes())
+		if !json.Valid(result) {
+			// Transport level errors are written as plain text, wrap them as JSON-RPC errors
+			responses = append(responses, jsonRPCError(id, mcp.ErrorCodeInvalidRequest, strings.TrimSpace(string(result)), nil))
+			continue
+		}
+		responses = append(responses, json.RawMessage(result))
+	}
+
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		m.logger.WithError(err).Error("failed to write MCP batch response")
+	}
+}
+
+// jsonRPCResult builds a JSON-RPC 2.0 success response
+func jsonRPCResult(id any, result any) json.RawMessage {
+	resp, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+	return resp
+}
+
+// jsonRPCError builds a JSON-RPC 2.0 error response
+func jsonRPCError(id any, code int, message string, data any) json.RawMessage {
+	errObj := map[string]any{
+		"code":    code,
+		"message": message,
+	}
+	if data != nil {
+		errObj["data"] = data
+	}
+
+	resp, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   errObj,
+	})
+	return resp
+}
+
+// writeJSONRPCError writes a single JSON-RPC 2.0 error response
+func writeJSONRPCError(w http.ResponseWriter, id any, code int, message string, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonRPCError(id, code, message, data))
+}
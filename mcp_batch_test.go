@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMCPBatchToolCalls tests that a JSON-RPC batch of tool calls returns an array of results
+func TestMCPBatchToolCalls(t *testing.T) {
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: t.TempDir(),
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	batch := []map[string]interface{}{
+		{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params": map[string]interface{}{
+				"name":      "execute_code",
+				"arguments": map[string]interface{}{"code": "print('first')"},
+			},
+		},
+		{
+			"jsonrpc": "2.0",
+			"id":      2,
+			"method":  "tools/call",
+			"params": map[string]interface{}{
+				"name":      "execute_code",
+				"arguments": map[string]interface{}{"code": "print('second')"},
+			},
+		},
+	}
+	body, _ := json.Marshal(batch)
+
+	req := httptest.NewRequest("POST", "/mcp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("MCP-Protocol-Version", "2025-03-26")
+	w := httptest.NewRecorder()
+
+	mcpServer.HandleRequest(w, req)
+
+	var responses []struct {
+		ID     int `json:"id"`
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+		Error interface{} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&responses); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses, got %d", len(responses))
+	}
+
+	expected := map[int]string{1: "first", 2: "second"}
+	for _, resp := range responses {
+		if resp.Error != nil {
+			t.Errorf("Request %d returned error: %v", resp.ID, resp.Error)
+			continue
+		}
+		if len(resp.Result.Content) == 0 || !strings.Contains(resp.Result.Content[0].Text, expected[resp.ID]) {
+			t.Errorf("Expected result for request %d to contain %q, got %+v", resp.ID, expected[resp.ID], resp.Result.Content)
+		}
+	}
+}
+
+// TestMCPBatchEmpty tests that an empty batch is rejected
+func TestMCPBatchEmpty(t *testing.T) {
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: t.TempDir(),
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader("[]"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	mcpServer.HandleRequest(w, req)
+
+	var response struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error.Code != -32600 {
+		t.Errorf("Expected invalid request error code -32600, got %d", response.Error.Code)
+	}
+}
+
+// TestMCPRequestBodyLimit tests that MCP request bodies over the size limit are rejected with a 413
+func TestMCPRequestBodyLimit(t *testing.T) {
+	mcpServer, err := NewMCPServer(&Config{Scriptling: ScriptlingConfig{ToolsPath: t.TempDir()}}, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	body := "[" + strings.Repeat(" ", maxRequestBodySize) + "]"
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	mcpServer.HandleRequest(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized body, got %d: %s", w.Code, w.Body.String())
+	}
+}
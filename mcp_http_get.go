@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/paularlott/mcp"
+)
+
+// Defaults for the http_get tool
+const (
+	defaultHTTPGetMaxBytes = 1024 * 1024
+	httpGetTimeout         = 30 * time.Second
+)
+
+// httpGetTool fetches URLs from an allowlist of domains, web access for deployments that don't trust scripts with
+// the full requests library
+type httpGetTool struct {
+	allowedDomains []string
+	maxBytes       int
+	client         *http.Client
+}
+
+// newHTTPGetTool creates the http_get tool, returning nil when no domains are allowed
+func newHTTPGetTool(config *MCPConfig) *httpGetTool {
+	if len(config.HTTPGetAllowedDomains) == 0 {
+		return nil
+	}
+
+	tool := &httpGetTool{maxBytes: defaultHTTPGetMaxBytes}
+	for _, domain := range config.HTTPGetAllowedDomains {
+		tool.allowedDomains = append(tool.allowedDomains, strings.ToLower(strings.TrimPrefix(domain, ".")))
+	}
+	if config.HTTPGetMaxBytes > 0 {
+		tool.maxBytes = config.HTTPGetMaxBytes
+	}
+
+	// Redirects are followed only within the allowlist
+	tool.client = &http.Client{
+		Timeout: httpGetTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return tool.checkURL(req.URL)
+		},
+	}
+	return tool
+}
+
+// allowed returns true if the host is an allowed domain or a subdomain of one
+func (t *httpGetTool) allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range t.allowedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkURL returns an error if the URL may not be fetched
+func (t *httpGetTool) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q, only http and https can be fetched", u.Scheme)
+	}
+	if !t.allowed(u.Hostname()) {
+		return fmt.Errorf("domain %s is not in the allowed domains", u.Hostname())
+	}
+	return nil
+}
+
+// fetch returns the body of the URL, failing if it is larger than the size limit
+func (t *httpGetTool) fetch(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	if err := t.checkURL(u); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("failed to fetch %s: status %d", u, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.maxBytes)+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", u, err)
+	}
+	if len(body) > t.maxBytes {
+		return "", fmt.Errorf("response from %s is larger than %d bytes", u, t.maxBytes)
+	}
+	return string(body), nil
+}
+
+// registerHTTPGetTool registers the http_get tool when domains are allowed for it
+func (m *MCPServer) registerHTTPGetTool() {
+	tool := newHTTPGetTool(&m.config.MCP)
+	if tool == nil {
+		return
+	}
+	if m.toolDisabled("http_get") {
+		m.logger.Info("http_get tool disabled")
+		return
+	}
+
+	m.server.RegisterTool(
+		mcp.NewTool("http_get", "Fetch a URL with an HTTP GET request and return the response body. Only URLs on allowed domains can be fetched: "+strings.Join(tool.allowedDomains, ", "),
+			mcp.String("url", "The http or https URL to fetch", mcp.Required()),
+		),
+		func(ctx context.Context, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+			rawURL, ok := req.Args()["url"].(string)
+			if !ok {
+				return nil, fmt.Errorf("url parameter is required and must be a string")
+			}
+			body, err := tool.fetch(ctx, rawURL)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewToolResponseText(body), nil
+		},
+	)
+
+	m.logger.Info("registered http_get tool", "allowed_domains", tool.allowedDomains)
+}
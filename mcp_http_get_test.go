@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHTTPGetTool tests that http_get returns the body of URLs on allowed domains and rejects other domains and
+// bodies over the size limit
+func TestHTTPGetTool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			w.Write([]byte(strings.Repeat("x", 64)))
+			return
+		}
+		w.Write([]byte("fetched page"))
+	}))
+	defer server.Close()
+
+	config := &Config{
+		MCP: MCPConfig{
+			HTTPGetAllowedDomains: []string{"127.0.0.1"},
+			HTTPGetMaxBytes:       32,
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	call := func(url string) string {
+		t.Helper()
+		var resp map[string]interface{}
+		postMCP(t, mcpServer, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": "http_get", "arguments": map[string]interface{}{"url": url}},
+		}, &resp)
+		body, _ := json.Marshal(resp)
+		return string(body)
+	}
+
+	if body := call(server.URL + "/page"); !strings.Contains(body, "fetched page") {
+		t.Errorf("Expected the allowed domain's body, got %s", body)
+	}
+
+	deniedURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/page"
+	if body := call(deniedURL); strings.Contains(body, "fetched page") || !strings.Contains(body, "not in the allowed domains") {
+		t.Errorf("Expected a domain outside the allowlist to be rejected, got %s", body)
+	}
+
+	if body := call(server.URL + "/large"); strings.Contains(body, "xxxx") || !strings.Contains(body, "larger than 32 bytes") {
+		t.Errorf("Expected a body over the size limit to be rejected, got %s", body)
+	}
+
+	// Without allowed domains the tool isn't offered
+	mcpServer, err = NewMCPServer(&Config{}, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+	if body := call(server.URL + "/page"); strings.Contains(body, "fetched page") {
+		t.Errorf("Expected http_get to be unavailable without allowed domains, got %s", body)
+	}
+}
@@ -14,6 +14,7 @@ import (
 // MCPLibrary provides MCP-related functions for Scriptling
 type MCPLibrary struct {
 	mcpServer *MCPServer
+	ctx       context.Context        // context the tools are called within
 	result    *string                // Pointer to store return result
 	args      map[string]interface{} // Arguments passed to the tool
 }
@@ -22,6 +23,7 @@ type MCPLibrary struct {
 func NewMCPLibrary(mcpServer *MCPServer) *MCPLibrary {
 	return &MCPLibrary{
 		mcpServer: mcpServer,
+		ctx:       context.Background(),
 		result:    nil,
 		args:      make(map[string]interface{}),
 	}
@@ -90,7 +92,7 @@ func (m *MCPLibrary) GetLibrary() *object.Library {
 				return []map[string]string{}
 			}
 
-			tools := m.mcpServer.server.ListTools()
+			tools := m.mcpServer.listTools()
 			result := make([]map[string]string, len(tools))
 
 			for i, tool := range tools {
@@ -108,7 +110,7 @@ func (m *MCPLibrary) GetLibrary() *object.Library {
 			}
 
 			// Call the tool directly via MCP server
-			resp, err := m.mcpServer.server.CallTool(context.Background(), toolName, toolArgs)
+			resp, err := m.mcpServer.callTool(m.ctx, toolName, toolArgs)
 			if err != nil {
 				return nil, fmt.Errorf("tool call failed: %v", err)
 			}
@@ -127,7 +129,7 @@ func (m *MCPLibrary) GetLibrary() *object.Library {
 				"query": query,
 			}
 
-			resp, err := m.mcpServer.server.CallTool(context.Background(), "tool_search", searchArgs)
+			resp, err := m.mcpServer.callTool(m.ctx, "tool_search", searchArgs)
 			if err != nil {
 				return nil, fmt.Errorf("tool search failed: %v", err)
 			}
@@ -146,7 +148,7 @@ func (m *MCPLibrary) GetLibrary() *object.Library {
 				"arguments": arguments,
 			}
 
-			resp, err := m.mcpServer.server.CallTool(context.Background(), "execute_tool", executeArgs)
+			resp, err := m.mcpServer.callTool(m.ctx, "execute_tool", executeArgs)
 			if err != nil {
 				return nil, fmt.Errorf("tool execution failed: %v", err)
 			}
@@ -160,7 +162,7 @@ func (m *MCPLibrary) GetLibrary() *object.Library {
 			}
 
 			// Use the execute_code MCP tool
-			resp, err := m.mcpServer.server.CallTool(context.Background(), "execute_code", map[string]interface{}{
+			resp, err := m.mcpServer.callTool(m.ctx, "execute_code", map[string]interface{}{
 				"code": code,
 			})
 			if err != nil {
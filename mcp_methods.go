@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/paularlott/mcp"
+)
+
+// MCPMethodHandler handles a custom JSON-RPC method, the returned value is sent as the result
+type MCPMethodHandler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// MCPMethodError is returned by a method handler to send a specific JSON-RPC error,
+// any other error is reported as an internal error
+type MCPMethodError struct {
+	Code    int
+	Message string
+	Data    any
+}
+
+func (e *MCPMethodError) Error() string {
+	return e.Message
+}
+
+// RegisterMethod adds a JSON-RPC method to the MCP server. Registered methods take precedence over
+// the built-in methods, so they can also be used to replace them.
+func (m *MCPServer) RegisterMethod(name string, handler MCPMethodHandler) {
+	m.methodsMu.Lock()
+	defer m.methodsMu.Unlock()
+
+	if m.methods == nil {
+		m.methods = make(map[string]MCPMethodHandler)
+	}
+	m.methods[name] = handler
+}
+
+// customMethod returns the handler registered for a method
+func (m *MCPServer) customMethod(name string) (MCPMethodHandler, bool) {
+	m.methodsMu.RLock()
+	defer m.methodsMu.RUnlock()
+
+	handler, exists := m.methods[name]
+	return handler, exists
+}
+
+// handleCustomMethod calls a registered method handler and writes its result,
+// notifications (requests without an id) are acknowledged without a body
+func (m *MCPServer) handleCustomMethod(w http.ResponseWriter, r *http.Request, handler MCPMethodHandler, id any, params json.RawMessage) {
+	result, err := handler(r.Context(), params)
+
+	if id == nil {
+		if err != nil {
+			m.logger.WithError(err).Warn("custom MCP notification failed")
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err != nil {
+		var methodErr *MCPMethodError
+		if errors.As(err, &methodErr) {
+			writeJSONRPCError(w, id, methodErr.Code, methodErr.Message, methodErr.Data)
+		} else {
+			writeJSONRPCError(w, id, mcp.ErrorCodeInternalError, "Internal error", err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonRPCResult(id, result))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMCPRegisterMethod tests calling custom JSON-RPC methods over HTTP
+func TestMCPRegisterMethod(t *testing.T) {
+	router, err := NewRouter(&Config{}, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	router.mcpServer.RegisterMethod("ping", func(ctx context.Context, params json.RawMessage) (any, error) {
+		return map[string]any{"pong": true}, nil
+	})
+	router.mcpServer.RegisterMethod("custom/echo", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var args struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(params, &args); err != nil || args.Text == "" {
+			return nil, &MCPMethodError{Code: -32602, Message: "text is required"}
+		}
+		return map[string]any{"text": args.Text}, nil
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	call := func(body string) map[string]any {
+		t.Helper()
+		req, _ := http.NewRequest("POST", server.URL+"/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var result map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	resp := call(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if result, _ := resp["result"].(map[string]any); result["pong"] != true {
+		t.Errorf("Expected custom ping result, got %v", resp)
+	}
+
+	resp = call(`{"jsonrpc":"2.0","id":2,"method":"custom/echo","params":{"text":"hello"}}`)
+	if result, _ := resp["result"].(map[string]any); result["text"] != "hello" {
+		t.Errorf("Expected echoed text, got %v", resp)
+	}
+
+	resp = call(`{"jsonrpc":"2.0","id":3,"method":"custom/echo","params":{}}`)
+	if errObj, _ := resp["error"].(map[string]any); errObj["code"] != float64(-32602) {
+		t.Errorf("Expected -32602 error, got %v", resp)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paularlott/mcp"
+)
+
+// promptArgumentPattern matches {{argument}} placeholders in a prompt template
+var promptArgumentPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// promptConfig holds parsed prompt.toml configuration
+type promptConfig struct {
+	Name        string                    `toml:"name"`
+	Description string                    `toml:"description"`
+	Template    string                    `toml:"template"`
+	Arguments   map[string]promptArgument `toml:"arguments"`
+}
+
+// promptArgument defines a prompt argument from prompt.toml
+type promptArgument struct {
+	Description string `toml:"description"`
+	Required    bool   `toml:"required"`
+}
+
+// mcpPrompt is a prompt entry returned by prompts/list
+type mcpPrompt struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Arguments   []mcpPromptArgument `json:"arguments,omitempty"`
+}
+
+// mcpPromptArgument describes a prompt argument returned by prompts/list
+type mcpPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// mcpPromptMessage is a message in a rendered prompt
+type mcpPromptMessage struct {
+	Role    string          `json:"role"`
+	Content mcp.ToolContent `json:"content"`
+}
+
+// scanPrompts scans the tools directory for prompt.toml files and returns the prompt templates by name
+func (m *MCPServer) scanPrompts() (map[string]*promptConfig, error) {
+	prompts := make(map[string]*promptConfig)
+
+	if m.toolsPath == "" {
+		return prompts, nil
+	}
+
+	if _, err := os.Stat(m.toolsPath); os.IsNotExist(err) {
+		return prompts, nil
+	}
+
+	err := filepath.Walk(m.toolsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() || info.Name() != "prompt.toml" {
+			return nil
+		}
+
+		var cfg promptConfig
+		if _, err := toml.DecodeFile(path, &cfg); err != nil {
+			m.logger.Warn("failed to parse prompt.toml", "path", path, "error", err)
+			return nil
+		}
+
+		if cfg.Name == "" {
+			cfg.Name = filepath.Base(filepath.Dir(path))
+		}
+
+		if cfg.Template == "" {
+			m.logger.Warn("prompt missing template field", "prompt", cfg.Name)
+			return nil
+		}
+
+		prompts[cfg.Name] = &cfg
+		return nil
+	})
+
+	return prompts, err
+}
+
+// ListPrompts returns the prompt templates declared in the tools directory, sorted by name
+func (m *MCPServer) ListPrompts() ([]mcpPrompt, error) {
+	prompts, err := m.scanPrompts()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]mcpPrompt, 0, len(prompts))
+	for _, cfg := range prompts {
+		prompt := mcpPrompt{
+			Name:        cfg.Name,
+			Description: cfg.Description,
+		}
+		for name, arg := range cfg.Arguments {
+			prompt.Arguments = append(prompt.Arguments, mcpPromptArgument{
+				Name:        name,
+				Description: arg.Description,
+				Required:    arg.Required,
+			})
+		}
+		sort.Slice(prompt.Arguments, func(i, j int) bool {
+			return prompt.Arguments[i].Name < prompt.Arguments[j].Name
+		})
+		result = append(result, prompt)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// GetPrompt renders the named prompt template with the given arguments
+func (m *MCPServer) GetPrompt(name string, args map[string]string) (*promptConfig, string, error) {
+	prompts, err := m.scanPrompts()
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, exists := prompts[name]
+	if !exists {
+		return nil, "", fmt.Errorf("prompt not found: %s", name)
+	}
+
+	for argName, arg := range cfg.Arguments {
+		if _, ok := args[argName]; arg.Required && !ok {
+			return nil, "", fmt.Errorf("missing required argument: %s", argName)
+		}
+	}
+
+	// Unknown and omitted optional arguments are replaced with an empty string
+	text := promptArgumentPattern.ReplaceAllStringFunc(cfg.Template, func(match string) string {
+		return args[promptArgumentPattern.FindStringSubmatch(match)[1]]
+	})
+
+	return cfg, text, nil
+}
+
+// handlePromptsList handles the MCP prompts/list method
+func (m *MCPServer) handlePromptsList(w http.ResponseWriter, id any) {
+	prompts, err := m.ListPrompts()
+	if err != nil {
+		writeJSONRPCError(w, id, mcp.ErrorCodeInternalError, "Internal error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonRPCResult(id, map[string]any{"prompts": prompts}))
+}
+
+// handlePromptsGet handles the MCP prompts/get method
+func (m *MCPServer) handlePromptsGet(w http.ResponseWriter, id any, rawParams json.RawMessage) {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil || params.Name == "" {
+		writeJSONRPCError(w, id, mcp.ErrorCodeInvalidParams, "Invalid params", "name is required")
+		return
+	}
+
+	cfg, text, err := m.GetPrompt(params.Name, params.Arguments)
+	if err != nil {
+		writeJSONRPCError(w, id, mcp.ErrorCodeInvalidParams, "Invalid params", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonRPCResult(id, map[string]any{
+		"description": cfg.Description,
+		"messages": []mcpPromptMessage{
+			{Role: "user", Content: mcp.ToolContent{Type: "text", Text: text}},
+		},
+	}))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMCPPrompts tests that prompt templates can be listed and rendered with arguments
+func TestMCPPrompts(t *testing.T) {
+	tempDir := t.TempDir()
+
+	promptDir := filepath.Join(tempDir, "code_review")
+	os.MkdirAll(promptDir, 0755)
+	promptTOML := []byte(`
+description = "Review a piece of code"
+template = "Review this {{language}} code:\n{{ code }}"
+
+[arguments.language]
+description = "Programming language"
+required = true
+
+[arguments.code]
+description = "Code to review"
+required = true
+`)
+	os.WriteFile(filepath.Join(promptDir, "prompt.toml"), promptTOML, 0644)
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: tempDir,
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	// List prompts
+	var listResp struct {
+		Result struct {
+			Prompts []mcpPrompt `json:"prompts"`
+		} `json:"result"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "prompts/list",
+	}, &listResp)
+
+	if len(listResp.Result.Prompts) != 1 {
+		t.Fatalf("Expected 1 prompt, got %d", len(listResp.Result.Prompts))
+	}
+	prompt := listResp.Result.Prompts[0]
+	if prompt.Name != "code_review" {
+		t.Errorf("Expected prompt name from directory 'code_review', got '%s'", prompt.Name)
+	}
+	if len(prompt.Arguments) != 2 || !prompt.Arguments[0].Required {
+		t.Errorf("Expected 2 required arguments, got %+v", prompt.Arguments)
+	}
+
+	// Render the prompt
+	var getResp struct {
+		Result struct {
+			Messages []mcpPromptMessage `json:"messages"`
+		} `json:"result"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "prompts/get",
+		"params": map[string]interface{}{
+			"name":      "code_review",
+			"arguments": map[string]string{"language": "Go", "code": "x := 1"},
+		},
+	}, &getResp)
+
+	if len(getResp.Result.Messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(getResp.Result.Messages))
+	}
+	if text := getResp.Result.Messages[0].Content.Text; text != "Review this Go code:\nx := 1" {
+		t.Errorf("Unexpected rendered prompt: %q", text)
+	}
+
+	// Missing required arguments are rejected
+	var errResp struct {
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      3,
+		"method":  "prompts/get",
+		"params": map[string]interface{}{
+			"name":      "code_review",
+			"arguments": map[string]string{"language": "Go"},
+		},
+	}, &errResp)
+	if errResp.Error == nil {
+		t.Error("Expected error for missing required argument")
+	}
+}
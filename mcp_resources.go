@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paularlott/mcp"
+)
+
+const (
+	toolResourceScheme        = "tool://"
+	errorCodeResourceNotFound = -32002 // MCP error code for an unknown resource
+)
+
+// toolResource defines a resource declared in tool.toml, the content comes from either a static file
+// or the output of a script, both relative to the tool directory
+type toolResource struct {
+	Name        string `toml:"name"`
+	Description string `toml:"description"`
+	MimeType    string `toml:"mime_type"`
+	File        string `toml:"file"`
+	Script      string `toml:"script"`
+}
+
+// mcpResource is a resource entry returned by resources/list
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// toolResourceURI returns the URI for a resource declared by a tool
+func toolResourceURI(toolName, resourceName string) string {
+	return toolResourceScheme + toolName + "/" + resourceName
+}
+
+// scanAllTools returns all tool configurations regardless of visibility
+func (m *MCPServer) scanAllTools() (map[string]*toolConfig, error) {
+	provider := &ScriptToolProvider{mcpServer: m}
+	return provider.scanTools()
+}
+
+// ListResources returns the resources declared by all tools, sorted by URI
+func (m *MCPServer) ListResources() ([]mcpResource, error) {
+	tools, err := m.scanAllTools()
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]mcpResource, 0)
+	for _, cfg := range tools {
+		for _, res := range cfg.Resources {
+			if res.Name == "" {
+				m.logger.Warn("tool resource missing name", "tool", cfg.Name)
+				continue
+			}
+			resources = append(resources, mcpResource{
+				URI:         toolResourceURI(cfg.Name, res.Name),
+				Name:        res.Name,
+				Description: res.Description,
+				MimeType:    res.MimeType,
+			})
+		}
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].URI < resources[j].URI
+	})
+
+	return resources, nil
+}
+
+// ReadResource returns the content of a tool resource
+func (m *MCPServer) ReadResource(uri string) (*mcp.ResourceContent, error) {
+	toolName, resourceName, ok := strings.Cut(strings.TrimPrefix(uri, toolResourceScheme), "/")
+	if !ok || !strings.HasPrefix(uri, toolResourceScheme) {
+		return nil, fmt.Errorf("invalid resource URI: %s", uri)
+	}
+
+	tools, err := m.scanAllTools()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, exists := tools[toolName]
+	if !exists {
+		return nil, fmt.Errorf("resource not found: %s", uri)
+	}
+
+	for _, res := range cfg.Resources {
+		if res.Name != resourceName {
+			continue
+		}
+
+		var text string
+		switch {
+		case res.File != "":
+			content, err := os.ReadFile(filepath.Join(cfg.dir, res.File))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read resource %s: %w", uri, err)
+			}
+			text = string(content)
+		case res.Script != "":
+			response, err := m.executeScriptToolFromPath(context.Background(), filepath.Join(cfg.dir, res.Script), mcp.NewToolRequest(map[string]interface{}{}), cfg.Models)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate resource %s: %w", uri, err)
+			}
+			var sb strings.Builder
+			for _, content := range response.Content {
+				sb.WriteString(content.Text)
+			}
+			text = sb.String()
+		default:
+			return nil, fmt.Errorf("resource %s has no file or script", uri)
+		}
+
+		return &mcp.ResourceContent{
+			URI:      uri,
+			MimeType: res.MimeType,
+			Text:     text,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("resource not found: %s", uri)
+}
+
+// handleResourcesList handles the MCP resources/list method
+func (m *MCPServer) handleResourcesList(w http.ResponseWriter, id any) {
+	resources, err := m.ListResources()
+	if err != nil {
+		writeJSONRPCError(w, id, mcp.ErrorCodeInternalError, "Internal error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonRPCResult(id, map[string]any{"resources": resources}))
+}
+
+// handleResourcesRead handles the MCP resources/read method
+func (m *MCPServer) handleResourcesRead(w http.ResponseWriter, id any, rawParams json.RawMessage) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil || params.URI == "" {
+		writeJSONRPCError(w, id, mcp.ErrorCodeInvalidParams, "Invalid params", "uri is required")
+		return
+	}
+
+	content, err := m.ReadResource(params.URI)
+	if err != nil {
+		writeJSONRPCError(w, id, errorCodeResourceNotFound, "Resource not found", map[string]any{
+			"uri":     params.URI,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonRPCResult(id, mcp.ResourceResponse{Contents: []mcp.ResourceContent{*content}}))
+}
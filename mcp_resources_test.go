@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// postMCP sends a JSON-RPC request to the MCP server and decodes the response
+func postMCP(t *testing.T, mcpServer *MCPServer, request map[string]interface{}, response interface{}) {
+	t.Helper()
+
+	body, _ := json.Marshal(request)
+	req := httptest.NewRequest("POST", "/mcp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("MCP-Protocol-Version", "2025-03-26")
+	w := httptest.NewRecorder()
+
+	mcpServer.HandleRequest(w, req)
+
+	if err := json.NewDecoder(w.Body).Decode(response); err != nil {
+		t.Fatalf("Failed to decode %v response: %v", request["method"], err)
+	}
+}
+
+// TestMCPToolResources tests that resources declared in tool.toml can be listed and read
+func TestMCPToolResources(t *testing.T) {
+	tempDir := t.TempDir()
+
+	toolDir := filepath.Join(tempDir, "docs_tool")
+	os.MkdirAll(toolDir, 0755)
+	toolTOML := []byte(`
+name = "docs_tool"
+description = "Tool with documentation"
+script = "script.py"
+
+[[resources]]
+name = "usage"
+description = "How to use the tool"
+mime_type = "text/markdown"
+file = "usage.md"
+
+[[resources]]
+name = "generated"
+description = "Generated content"
+script = "generate.py"
+`)
+	os.WriteFile(filepath.Join(toolDir, "tool.toml"), toolTOML, 0644)
+	os.WriteFile(filepath.Join(toolDir, "script.py"), []byte("import llmr.mcp\ndef main():\n    llmr.mcp.return_string('ok')\n"), 0644)
+	os.WriteFile(filepath.Join(toolDir, "usage.md"), []byte("# Usage\nCall the tool."), 0644)
+	os.WriteFile(filepath.Join(toolDir, "generate.py"), []byte("import llmr.mcp\nllmr.mcp.return_string('generated content')\n"), 0644)
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: tempDir,
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	// Initialize advertises the resources capability
+	var initResp struct {
+		Result struct {
+			Capabilities map[string]interface{} `json:"capabilities"`
+		} `json:"result"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"method":  "initialize",
+		"params": map[string]interface{}{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]interface{}{},
+			"clientInfo":      map[string]interface{}{"name": "test-client", "version": "1.0.0"},
+		},
+	}, &initResp)
+	if _, ok := initResp.Result.Capabilities["resources"]; !ok {
+		t.Errorf("Expected resources capability, got %v", initResp.Result.Capabilities)
+	}
+
+	// List resources
+	var listResp struct {
+		Result struct {
+			Resources []mcpResource `json:"resources"`
+		} `json:"result"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "resources/list",
+	}, &listResp)
+
+	if len(listResp.Result.Resources) != 2 {
+		t.Fatalf("Expected 2 resources, got %d", len(listResp.Result.Resources))
+	}
+	if listResp.Result.Resources[1].URI != "tool://docs_tool/usage" {
+		t.Errorf("Expected URI 'tool://docs_tool/usage', got '%s'", listResp.Result.Resources[1].URI)
+	}
+
+	// Read the static resource
+	var readResp struct {
+		Result struct {
+			Contents []struct {
+				URI      string `json:"uri"`
+				MimeType string `json:"mimeType"`
+				Text     string `json:"text"`
+			} `json:"contents"`
+		} `json:"result"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "resources/read",
+		"params":  map[string]interface{}{"uri": "tool://docs_tool/usage"},
+	}, &readResp)
+
+	if len(readResp.Result.Contents) != 1 {
+		t.Fatalf("Expected 1 content entry, got %d", len(readResp.Result.Contents))
+	}
+	if readResp.Result.Contents[0].Text != "# Usage\nCall the tool." {
+		t.Errorf("Unexpected resource text: %q", readResp.Result.Contents[0].Text)
+	}
+	if readResp.Result.Contents[0].MimeType != "text/markdown" {
+		t.Errorf("Expected mime type 'text/markdown', got '%s'", readResp.Result.Contents[0].MimeType)
+	}
+
+	// Read the generated resource
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      3,
+		"method":  "resources/read",
+		"params":  map[string]interface{}{"uri": "tool://docs_tool/generated"},
+	}, &readResp)
+
+	if len(readResp.Result.Contents) != 1 || readResp.Result.Contents[0].Text != "generated content" {
+		t.Errorf("Unexpected generated resource: %+v", readResp.Result.Contents)
+	}
+
+	// Unknown resources return an error
+	var errResp struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      4,
+		"method":  "resources/read",
+		"params":  map[string]interface{}{"uri": "tool://docs_tool/missing"},
+	}, &errResp)
+	if errResp.Error.Code != errorCodeResourceNotFound {
+		t.Errorf("Expected error code %d, got %d", errorCodeResourceNotFound, errResp.Error.Code)
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/BurntSushi/toml"
-	"github.com/paularlott/llmrouter/log"
 	"github.com/paularlott/mcp"
 	"github.com/paularlott/scriptling"
 	"github.com/paularlott/scriptling/extlibs"
@@ -33,14 +39,19 @@ type toolConfig struct {
 	Keywords    []string                 `toml:"keywords"`
 	Script      string                   `toml:"script"`
 	Visibility  string                   `toml:"visibility"` // "native" (default) or "ondemand"
+	Models      []string                 `toml:"models"`     // models the script may call with llmr.ai, any model when empty
 	Parameters  map[string]toolParameter `toml:"parameters"`
+	Resources   []toolResource           `toml:"resources"`
+	dir         string                   // directory containing tool.toml
 }
 
 // toolParameter defines a tool parameter from tool.toml
 type toolParameter struct {
-	Type        string `toml:"type"`
-	Description string `toml:"description"`
-	Required    bool   `toml:"required"`
+	Type        string                   `toml:"type"`
+	Description string                   `toml:"description"`
+	Required    bool                     `toml:"required"`
+	Default     interface{}              `toml:"default"`    // passed to the script when an optional parameter is omitted
+	Properties  map[string]toolParameter `toml:"properties"` // fields of an object parameter
 }
 
 // NewNativeScriptToolProvider creates a provider that returns only native-visibility tools
@@ -97,6 +108,11 @@ func (p *ScriptToolProvider) scanTools() (map[string]*toolConfig, error) {
 		if cfg.Name == "" {
 			cfg.Name = toolName
 		}
+		cfg.dir = toolDir
+
+		if p.mcpServer.toolDisabled(cfg.Name) {
+			return nil
+		}
 
 		if cfg.Script == "" {
 			p.mcpServer.logger.Warn("tool missing script field", "tool", cfg.Name)
@@ -139,6 +155,7 @@ func (p *ScriptToolProvider) GetTools(ctx context.Context) ([]mcp.MCPTool, error
 		params := buildParameters(cfg.Parameters)
 		toolBuilder := mcp.NewTool(cfg.Name, cfg.Description, params...)
 		schema := toolBuilder.BuildSchema()
+		addSchemaDefaults(schema, cfg.Parameters)
 
 		mcpTools = append(mcpTools, mcp.MCPTool{
 			Name:        cfg.Name,
@@ -202,7 +219,12 @@ func (p *ScriptToolProvider) ExecuteTool(ctx context.Context, name string, param
 		return nil, mcp.ErrUnknownTool
 	}
 
-	response, err := p.mcpServer.executeScriptToolFromPath(scriptPath, mcp.NewToolRequest(params))
+	if err := validateToolArguments(cfg.Parameters, params); err != nil {
+		return nil, fmt.Errorf("invalid arguments for tool %s: %w", name, err)
+	}
+	params = applyParameterDefaults(cfg.Parameters, params)
+
+	response, err := p.mcpServer.executeScriptToolFromPath(ctx, scriptPath, mcp.NewToolRequest(params), cfg.Models)
 	if err != nil {
 		return nil, err
 	}
@@ -211,6 +233,13 @@ func (p *ScriptToolProvider) ExecuteTool(ctx context.Context, name string, param
 
 var _ mcp.ToolProvider = (*ScriptToolProvider)(nil)
 
+// errorCodeToolsBusy is the MCP error code for a tool call rejected by the concurrency limit, the equivalent of a 429
+const errorCodeToolsBusy = -32001
+
+// defaultMCPInstructions is reported to MCP clients when no instructions are configured
+const defaultMCPInstructions = `This server provides AI completion with tool calling support and Scriptling execution capabilities.
+Use execute_code for custom Scriptling/Python code execution.`
+
 // MCPServer wraps the MCP server functionality
 type MCPServer struct {
 	server        *mcp.Server
@@ -220,40 +249,130 @@ type MCPServer struct {
 	router        *Router
 	toolsPath     string
 	librariesPath string
+
+	methodsMu sync.RWMutex
+	methods   map[string]MCPMethodHandler // custom JSON-RPC methods added with RegisterMethod
+
+	toolSlots chan struct{} // limits concurrent script executions, nil when unlimited
 }
 
 // buildParameters converts tool parameters to mcp.Parameter slice
 func buildParameters(params map[string]toolParameter) []mcp.Parameter {
 	var result []mcp.Parameter
 	for paramName, param := range params {
-		switch param.Type {
-		case "string":
+		result = append(result, buildParameter(paramName, param))
+	}
+	return result
+}
+
+// buildParameter converts a tool.toml parameter to an MCP parameter, object parameters include their fields
+func buildParameter(paramName string, param toolParameter) mcp.Parameter {
+	var options []mcp.Option
+	if param.Required {
+		options = append(options, mcp.Required())
+	}
+
+	switch param.Type {
+	case "number":
+		return mcp.Number(paramName, param.Description, options...)
+	case "boolean":
+		return mcp.Boolean(paramName, param.Description, options...)
+	case "object":
+		var propertiesAndOptions []interface{}
+		for _, property := range buildParameters(param.Properties) {
+			propertiesAndOptions = append(propertiesAndOptions, property)
+		}
+		for _, option := range options {
+			propertiesAndOptions = append(propertiesAndOptions, option)
+		}
+		return mcp.Object(paramName, param.Description, propertiesAndOptions...)
+	default:
+		return mcp.String(paramName, param.Description, options...)
+	}
+}
+
+// addSchemaDefaults adds the default of each parameter that has one to the tool's input schema
+func addSchemaDefaults(schema map[string]interface{}, params map[string]toolParameter) {
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for paramName, param := range params {
+		property, ok := properties[paramName].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if param.Default != nil {
+			property["default"] = param.Default
+		}
+		addSchemaDefaults(property, param.Properties)
+	}
+}
+
+// applyParameterDefaults returns the arguments with the default of each omitted parameter added
+func applyParameterDefaults(params map[string]toolParameter, args map[string]interface{}) map[string]interface{} {
+	withDefaults := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		withDefaults[key] = value
+	}
+	for paramName, param := range params {
+		value, exists := withDefaults[paramName]
+		if !exists && param.Default != nil {
+			withDefaults[paramName] = param.Default
+		} else if fields, ok := value.(map[string]interface{}); ok && len(param.Properties) > 0 {
+			withDefaults[paramName] = applyParameterDefaults(param.Properties, fields)
+		}
+	}
+	return withDefaults
+}
+
+// validateToolArguments checks that each required parameter is present and each supplied parameter has its declared type
+func validateToolArguments(params map[string]toolParameter, args map[string]interface{}) error {
+	names := slices.Sorted(maps.Keys(params))
+	for _, paramName := range names {
+		param := params[paramName]
+		value, exists := args[paramName]
+		if !exists || value == nil {
 			if param.Required {
-				result = append(result, mcp.String(paramName, param.Description, mcp.Required()))
-			} else {
-				result = append(result, mcp.String(paramName, param.Description))
+				return fmt.Errorf("missing required parameter %s", paramName)
 			}
+			continue
+		}
+
+		var valid bool
+		switch param.Type {
 		case "number":
-			if param.Required {
-				result = append(result, mcp.Number(paramName, param.Description, mcp.Required()))
-			} else {
-				result = append(result, mcp.Number(paramName, param.Description))
+			switch value.(type) {
+			case float64, float32, int, int32, int64:
+				valid = true
 			}
 		case "boolean":
-			if param.Required {
-				result = append(result, mcp.Boolean(paramName, param.Description, mcp.Required()))
-			} else {
-				result = append(result, mcp.Boolean(paramName, param.Description))
+			_, valid = value.(bool)
+		case "object":
+			var fields map[string]interface{}
+			if fields, valid = value.(map[string]interface{}); valid {
+				if err := validateToolArguments(param.Properties, fields); err != nil {
+					return fmt.Errorf("parameter %s: %w", paramName, err)
+				}
 			}
 		default:
-			if param.Required {
-				result = append(result, mcp.String(paramName, param.Description, mcp.Required()))
-			} else {
-				result = append(result, mcp.String(paramName, param.Description))
-			}
+			_, valid = value.(string)
+		}
+		if !valid {
+			return fmt.Errorf("parameter %s must be a %s", paramName, parameterTypeName(param.Type))
 		}
 	}
-	return result
+	return nil
+}
+
+// parameterTypeName returns the schema type of a parameter, unknown types are treated as strings
+func parameterTypeName(paramType string) string {
+	switch paramType {
+	case "number", "boolean", "object":
+		return paramType
+	default:
+		return "string"
+	}
 }
 
 // setupScriptlingEnvironment configures a Scriptling environment with all standard libraries
@@ -286,12 +405,15 @@ func setupScriptlingEnvironmentWithAI(env *scriptling.Scriptling, router *Router
 	}
 }
 
-// setupScriptlingEnvironmentWithAIAndResult configures a Scriptling environment with result tracking
-func setupScriptlingEnvironmentWithAIAndResult(env *scriptling.Scriptling, router *Router, mcpServer *MCPServer, mcpLib *MCPLibrary) {
+// setupScriptlingEnvironmentWithAIAndResult configures a Scriptling environment with result tracking, the libraries
+// making their calls within ctx, which carries any model allowlist
+func setupScriptlingEnvironmentWithAIAndResult(ctx context.Context, env *scriptling.Scriptling, router *Router, mcpServer *MCPServer, mcpLib *MCPLibrary) {
 	setupScriptlingEnvironment(env)
 	aiLib := NewAILibrary(router)
+	aiLib.ctx = ctx
 	env.RegisterLibrary("llmr.ai", aiLib.GetLibrary())
 	if mcpLib != nil {
+		mcpLib.ctx = ctx
 		env.RegisterLibrary("llmr.mcp", mcpLib.GetLibrary())
 	}
 }
@@ -326,8 +448,11 @@ func (m *MCPServer) setupOnDemandLibraryLoading(scriptlingInstance *scriptling.S
 // NewMCPServer creates a new MCP server instance
 func NewMCPServer(config *Config, logger Logger, router *Router) (*MCPServer, error) {
 	server := mcp.NewServer("llmrouter", "1.0.0")
-	server.SetInstructions(`This server provides AI completion with tool calling support and Scriptling execution capabilities.
-Use execute_code for custom Scriptling/Python code execution.`)
+	if config.MCP.Instructions != "" {
+		server.SetInstructions(config.MCP.Instructions)
+	} else {
+		server.SetInstructions(defaultMCPInstructions)
+	}
 
 	mcpServer := &MCPServer{
 		server:        server,
@@ -338,6 +463,10 @@ Use execute_code for custom Scriptling/Python code execution.`)
 		librariesPath: config.Scriptling.LibrariesPath,
 	}
 
+	if config.MCP.MaxConcurrentTools > 0 {
+		mcpServer.toolSlots = make(chan struct{}, config.MCP.MaxConcurrentTools)
+	}
+
 	if err := mcpServer.initializeScriptling(); err != nil {
 		return nil, fmt.Errorf("failed to initialize scriptling: %w", err)
 	}
@@ -381,8 +510,39 @@ func (m *MCPServer) initializeScriptling() error {
 	return nil
 }
 
-// registerBuiltinTools registers built-in tools like execute_code
+// toolSlotKey marks a context as belonging to a script execution that holds a tool slot
+type toolSlotKey struct{}
+
+// acquireToolSlot reserves one of the concurrent script executions, returning the context marked as holding it and
+// the function that frees it. Executions nested within a script share its slot, and calls over the limit are rejected
+// rather than queued, a script waiting on a tool it calls itself would never get a slot.
+func (m *MCPServer) acquireToolSlot(ctx context.Context) (context.Context, func(), error) {
+	if m.toolSlots == nil || ctx.Value(toolSlotKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+
+	select {
+	case m.toolSlots <- struct{}{}:
+		return context.WithValue(ctx, toolSlotKey{}, true), func() { <-m.toolSlots }, nil
+	default:
+		return nil, nil, mcp.NewToolError(errorCodeToolsBusy, fmt.Sprintf("Too many tool executions in progress (max %d), retry later", cap(m.toolSlots)), nil)
+	}
+}
+
+// toolDisabled reports if a tool has been disabled with scriptling.disabled_tools
+func (m *MCPServer) toolDisabled(name string) bool {
+	return slices.Contains(m.config.Scriptling.DisabledTools, name)
+}
+
+// registerBuiltinTools registers built-in tools like execute_code and http_get
 func (m *MCPServer) registerBuiltinTools() error {
+	m.registerHTTPGetTool()
+
+	if m.toolDisabled("execute_code") {
+		m.logger.Info("execute_code tool disabled")
+		return nil
+	}
+
 	m.server.RegisterTool(
 		mcp.NewTool("execute_code", "Execute arbitrary Python/Scriptling code. Use this to run custom scripts.",
 			mcp.String("code", "The Python/Scriptling code to execute", mcp.Required()),
@@ -392,7 +552,7 @@ func (m *MCPServer) registerBuiltinTools() error {
 			if !ok {
 				return nil, fmt.Errorf("code parameter is required and must be a string")
 			}
-			return m.executeScriptTool(code, req)
+			return m.executeScriptTool(ctx, code, req, nil)
 		},
 	)
 
@@ -401,19 +561,26 @@ func (m *MCPServer) registerBuiltinTools() error {
 }
 
 // executeScriptToolFromPath reads the script from disk and executes it
-func (m *MCPServer) executeScriptToolFromPath(scriptPath string, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+func (m *MCPServer) executeScriptToolFromPath(ctx context.Context, scriptPath string, req *mcp.ToolRequest, models []string) (*mcp.ToolResponse, error) {
 	content, err := os.ReadFile(scriptPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read script file %s: %w", scriptPath, err)
 	}
-	return m.executeScriptTool(string(content), req)
+	return m.executeScriptTool(ctx, string(content), req, models)
 }
 
-// executeScriptTool executes a tool script with arguments
-func (m *MCPServer) executeScriptTool(scriptContent string, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+// executeScriptTool executes a tool script with arguments, models limits the models the script, and the tools it
+// calls, may call. The tools and completions the script calls run within ctx.
+func (m *MCPServer) executeScriptTool(ctx context.Context, scriptContent string, req *mcp.ToolRequest, models []string) (*mcp.ToolResponse, error) {
+	ctx, release, err := m.acquireToolSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	env := scriptling.New()
 	mcpLib := NewMCPLibrary(m)
-	setupScriptlingEnvironmentWithAIAndResult(env, m.router, m, mcpLib)
+	setupScriptlingEnvironmentWithAIAndResult(withModelAllowlist(ctx, models), env, m.router, m, mcpLib)
 	m.setupOnDemandLibraryLoading(env)
 
 	args := make(map[string]interface{})
@@ -424,8 +591,8 @@ func (m *MCPServer) executeScriptTool(scriptContent string, req *mcp.ToolRequest
 	mcpLib.SetArgs(args)
 
 	for k, v := range args {
-		if setErr := env.SetVar(k, scriptling.FromGo(v)); setErr != nil {
-			log.Error("failed to set variable in scriptling environment", "key", k, "error", setErr)
+		if setErr := env.SetVar(k, v); setErr != nil {
+			m.logger.Error("failed to set variable in scriptling environment", "key", k, "error", setErr)
 		}
 	}
 
@@ -457,18 +624,211 @@ func (m *MCPServer) executeScriptTool(scriptContent string, req *mcp.ToolRequest
 // With session management enabled, the mode is stored in the session during initialize.
 // Native-visibility tools from providers appear in tools/list in normal mode.
 // In discovery mode (X-MCP-Tool-Mode: discovery), only tool_search and execute_tool are visible.
+// JSON-RPC batches (an array of requests) are split, dispatched individually and answered with an array.
 func (m *MCPServer) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	batch, isBatch, err := readBatchRequest(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeJSONRPCError(w, nil, mcp.ErrorCodeParseError, "Parse error", err.Error())
+		return
+	}
+
+	// Providers are attached per request - the MCP server handles mode from headers/session
+	ctx := m.withScriptToolProviders(withToolCaller(r.Context(), r))
+
+	if isBatch {
+		m.handleBatch(w, r.WithContext(ctx), batch)
+		return
+	}
+
+	m.dispatch(w, r.WithContext(ctx))
+}
+
+// withScriptToolProviders attaches the script tool providers to a context, the ondemand provider only when there are ondemand tools
+func (m *MCPServer) withScriptToolProviders(ctx context.Context) context.Context {
 	nativeProvider := NewNativeScriptToolProvider(m)
 	onDemandProvider := NewOnDemandScriptToolProvider(m)
 
-	// Start with providers attached - the MCP server handles mode from headers/session
-	ctx := mcp.WithToolProviders(r.Context(), nativeProvider)
+	toolsCtx := mcp.WithToolProviders(ctx, nativeProvider)
 
-	// Add ondemand provider if there are any ondemand tools
-	onDemandTools, _ := onDemandProvider.GetTools(r.Context())
+	onDemandTools, _ := onDemandProvider.GetTools(ctx)
 	if len(onDemandTools) > 0 {
-		ctx = mcp.WithOnDemandToolProviders(ctx, onDemandProvider)
+		toolsCtx = mcp.WithOnDemandToolProviders(toolsCtx, onDemandProvider)
+	}
+	return toolsCtx
+}
+
+// ReloadTools refreshes the tools of the remote MCP servers, re-scans the script tools and returns the tools now listed
+func (m *MCPServer) ReloadTools(ctx context.Context) ([]mcp.MCPTool, error) {
+	if err := m.server.RefreshTools(ctx); err != nil {
+		return nil, err
+	}
+
+	return m.enabledTools(m.server.ListToolsWithContext(m.withScriptToolProviders(ctx))), nil
+}
+
+// listTools returns the registered tools less any disabled, as offered to scripts and tool calling completions
+func (m *MCPServer) listTools() []mcp.MCPTool {
+	return m.enabledTools(m.server.ListTools())
+}
+
+// enabledTools removes the tools disabled with scriptling.disabled_tools
+func (m *MCPServer) enabledTools(tools []mcp.MCPTool) []mcp.MCPTool {
+	return slices.DeleteFunc(tools, func(tool mcp.MCPTool) bool {
+		return m.toolDisabled(tool.Name)
+	})
+}
+
+// dispatch handles a single JSON-RPC request, resources and prompts are served locally and everything else is passed to the MCP server
+func (m *MCPServer) dispatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Body == nil {
+		m.server.HandleRequest(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		writeJSONRPCError(w, nil, mcp.ErrorCodeParseError, "Parse error", err.Error())
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req struct {
+		ID     any             `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		// Let the MCP server report the malformed request
+		m.server.HandleRequest(w, r)
+		return
+	}
+
+	if handler, exists := m.customMethod(req.Method); exists {
+		m.handleCustomMethod(w, r, handler, req.ID, req.Params)
+		return
 	}
 
-	m.server.HandleRequest(w, r.WithContext(ctx))
+	switch req.Method {
+	case "initialize":
+		m.handleInitialize(w, r)
+	case "tools/list":
+		m.handleToolsList(w, r)
+	case "tools/call":
+		if name := m.disabledToolCall(req.Params); name != "" {
+			writeJSONRPCError(w, req.ID, mcp.ErrorCodeInvalidParams, "Unknown tool", name)
+			return
+		}
+		m.handleToolCall(w, r, req.Params)
+	case "resources/list":
+		m.handleResourcesList(w, req.ID)
+	case "resources/read":
+		m.handleResourcesRead(w, req.ID, req.Params)
+	case "prompts/list":
+		m.handlePromptsList(w, req.ID)
+	case "prompts/get":
+		m.handlePromptsGet(w, req.ID, req.Params)
+	default:
+		m.server.HandleRequest(w, r)
+	}
+}
+
+// handleInitialize passes initialize to the MCP server and adds the resources and prompts capabilities to the result
+func (m *MCPServer) handleInitialize(w http.ResponseWriter, r *http.Request) {
+	sw := newBufferedResponseWriter()
+	m.server.HandleRequest(sw, r)
+
+	for key, values := range sw.header {
+		w.Header()[key] = values
+	}
+
+	body := sw.body.Bytes()
+	var resp map[string]any
+	if json.Unmarshal(body, &resp) == nil {
+		if result, ok := resp["result"].(map[string]any); ok {
+			if capabilities, ok := result["capabilities"].(map[string]any); ok {
+				capabilities["resources"] = map[string]any{}
+				capabilities["prompts"] = map[string]any{}
+				if patched, err := json.Marshal(resp); err == nil {
+					body = patched
+				}
+			}
+		}
+	}
+
+	w.Header().Del("Content-Length")
+	w.WriteHeader(sw.statusCode)
+	w.Write(body)
+}
+
+// handleToolsList passes tools/list to the MCP server and removes any disabled tools from the result
+func (m *MCPServer) handleToolsList(w http.ResponseWriter, r *http.Request) {
+	if len(m.config.Scriptling.DisabledTools) == 0 {
+		m.server.HandleRequest(w, r)
+		return
+	}
+
+	sw := newBufferedResponseWriter()
+	m.server.HandleRequest(sw, r)
+
+	for key, values := range sw.header {
+		w.Header()[key] = values
+	}
+
+	body := sw.body.Bytes()
+	var resp map[string]any
+	if json.Unmarshal(body, &resp) == nil {
+		if result, ok := resp["result"].(map[string]any); ok {
+			if tools, ok := result["tools"].([]any); ok {
+				result["tools"] = slices.DeleteFunc(tools, func(tool any) bool {
+					t, ok := tool.(map[string]any)
+					if !ok {
+						return false
+					}
+					name, _ := t["name"].(string)
+					return m.toolDisabled(name)
+				})
+				if patched, err := json.Marshal(resp); err == nil {
+					body = patched
+				}
+			}
+		}
+	}
+
+	w.Header().Del("Content-Length")
+	w.WriteHeader(sw.statusCode)
+	w.Write(body)
+}
+
+// disabledToolCall returns the name of the disabled tool a tools/call would run, either directly or through execute_tool
+func (m *MCPServer) disabledToolCall(params json.RawMessage) string {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if json.Unmarshal(params, &call) != nil {
+		return ""
+	}
+
+	var args map[string]interface{}
+	json.Unmarshal(call.Arguments, &args)
+	return m.disabledTool(call.Name, args)
+}
+
+// disabledTool returns the name of the disabled tool a call would run, either directly or through execute_tool
+func (m *MCPServer) disabledTool(name string, args map[string]interface{}) string {
+	if m.toolDisabled(name) {
+		return name
+	}
+	if name == mcp.ExecuteToolName {
+		if target, _ := args["name"].(string); m.toolDisabled(target) {
+			return target
+		}
+	}
+	return ""
 }
@@ -2,9 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/paularlott/mcp"
 )
 
 // testLogger implements Logger for testing
@@ -226,3 +235,509 @@ required = false
 		t.Error("Expected input schema to be present")
 	}
 }
+
+// TestMCPServerInstructions tests that configured instructions are reported on initialize
+func TestMCPServerInstructions(t *testing.T) {
+	initRequest := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"method":  "initialize",
+		"params": map[string]interface{}{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]interface{}{},
+			"clientInfo":      map[string]interface{}{"name": "test-client", "version": "1.0.0"},
+		},
+	}
+
+	tests := []struct {
+		configured string
+		expected   string
+	}{
+		{"", defaultMCPInstructions},
+		{"Use the search tools before answering.", "Use the search tools before answering."},
+	}
+
+	for _, tt := range tests {
+		config := &Config{
+			MCP: MCPConfig{Instructions: tt.configured},
+			Scriptling: ScriptlingConfig{
+				ToolsPath: t.TempDir(),
+			},
+		}
+
+		mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+		if err != nil {
+			t.Fatalf("Failed to create MCP server: %v", err)
+		}
+
+		var response struct {
+			Result struct {
+				Instructions string `json:"instructions"`
+			} `json:"result"`
+		}
+		postMCP(t, mcpServer, initRequest, &response)
+
+		if response.Result.Instructions != tt.expected {
+			t.Errorf("Expected instructions %q, got %q", tt.expected, response.Result.Instructions)
+		}
+	}
+}
+
+// TestMCPServerDisabledTools tests that disabled tools are not listed and cannot be called
+func TestMCPServerDisabledTools(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for name, visibility := range map[string]string{"native_tool": "native", "hidden_tool": "native", "ondemand_tool": "ondemand"} {
+		toolDir := filepath.Join(tempDir, name)
+		os.MkdirAll(toolDir, 0755)
+		toolTOML := []byte(`
+name = "` + name + `"
+description = "Test tool"
+script = "script.py"
+visibility = "` + visibility + `"
+`)
+		os.WriteFile(filepath.Join(toolDir, "tool.toml"), toolTOML, 0644)
+		os.WriteFile(filepath.Join(toolDir, "script.py"), []byte("print('ok')"), 0644)
+	}
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath:     tempDir,
+			DisabledTools: []string{"execute_code", "hidden_tool", "tool_search"},
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	var listResponse struct {
+		Result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+		} `json:"result"`
+	}
+	postMCP(t, mcpServer, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}, &listResponse)
+
+	listed := make(map[string]bool)
+	for _, tool := range listResponse.Result.Tools {
+		listed[tool.Name] = true
+	}
+	for _, name := range []string{"execute_code", "hidden_tool", "tool_search"} {
+		if listed[name] {
+			t.Errorf("Expected %s to be absent from tools/list, got %v", name, listed)
+		}
+	}
+	for _, name := range []string{"native_tool", "execute_tool"} {
+		if !listed[name] {
+			t.Errorf("Expected %s in tools/list, got %v", name, listed)
+		}
+	}
+
+	calls := []map[string]interface{}{
+		{"name": "execute_code", "arguments": map[string]interface{}{"code": "print('hi')"}},
+		{"name": "hidden_tool", "arguments": map[string]interface{}{}},
+		{"name": "execute_tool", "arguments": map[string]interface{}{"name": "execute_code", "arguments": map[string]interface{}{"code": "print('hi')"}}},
+	}
+	for _, params := range calls {
+		var callResponse struct {
+			Error *struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		postMCP(t, mcpServer, map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": params}, &callResponse)
+
+		if callResponse.Error == nil {
+			t.Errorf("Expected an error calling disabled tool via %v", params)
+		}
+	}
+}
+
+// TestDisabledToolsWithinRouter tests that disabled tools are left out of the tools offered to scripts and tool
+// calling completions, and can't be called from them directly or through execute_tool
+func TestDisabledToolsWithinRouter(t *testing.T) {
+	remote := mcp.NewServer("remote", "1.0.0")
+	for _, name := range []string{"echo", "secret"} {
+		remote.RegisterTool(mcp.NewTool(name, "Test tool"), func(ctx context.Context, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+			return mcp.NewToolResponseText("ran"), nil
+		})
+	}
+	remoteServer := httptest.NewServer(http.HandlerFunc(remote.HandleRequest))
+	defer remoteServer.Close()
+
+	disabled := "remote" + mcp.DefaultNamespaceSeparator + "secret"
+	config := &Config{
+		MCP:        MCPConfig{RemoteServers: []MCPRemoteServerConfig{{Namespace: "remote", URL: remoteServer.URL}}},
+		Scriptling: ScriptlingConfig{DisabledTools: []string{disabled}},
+	}
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	listed := make(map[string]bool)
+	for _, tool := range mcpServer.listTools() {
+		listed[tool.Name] = true
+	}
+	if listed[disabled] || !listed["remote"+mcp.DefaultNamespaceSeparator+"echo"] {
+		t.Errorf("Expected only the enabled remote tool to be listed, got %v", listed)
+	}
+
+	for name, args := range map[string]map[string]interface{}{
+		disabled:            {},
+		mcp.ExecuteToolName: {"name": disabled, "arguments": map[string]interface{}{}},
+	} {
+		if _, err := mcpServer.callTool(context.Background(), name, args); !errors.Is(err, mcp.ErrUnknownTool) {
+			t.Errorf("Expected an unknown tool error calling the disabled tool via %s, got %v", name, err)
+		}
+	}
+}
+
+// TestToolModelAllowlist tests that a tool's models allowlist blocks calls to other models, including those made by
+// the tools it calls, and matches models by their normalized ID
+func TestToolModelAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		blocked bool
+	}{
+		{"other model", `print(llmr.ai.completion("other-model", [{"role": "user", "content": "hello"}]))`, true},
+		{"nested execute_code", `print(llmr.mcp.execute_code("import llmr.ai\nprint(llmr.ai.completion('other-model', []))"))`, true},
+		{"nested call_tool", `print(llmr.mcp.call_tool("execute_code", {"code": "import llmr.ai\nprint(llmr.ai.embedding('other-model', 'hi'))"}))`, true},
+		{"normalized model", `print(llmr.ai.embedding(" ALLOWED-model", "hi"))`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			toolDir := filepath.Join(tempDir, "restricted_tool")
+			os.MkdirAll(toolDir, 0755)
+			toolTOML := []byte(`
+name = "restricted_tool"
+description = "Tool restricted to one model"
+script = "script.py"
+models = ["Allowed-Model"]
+`)
+			os.WriteFile(filepath.Join(toolDir, "tool.toml"), toolTOML, 0644)
+			os.WriteFile(filepath.Join(toolDir, "script.py"), []byte("import llmr.ai\nimport llmr.mcp\n"+tt.script), 0644)
+
+			config := &Config{
+				ModelIDs: ModelIDsConfig{CaseInsensitive: true},
+				Scriptling: ScriptlingConfig{
+					ToolsPath: tempDir,
+				},
+			}
+
+			mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{config: config})
+			if err != nil {
+				t.Fatalf("Failed to create MCP server: %v", err)
+			}
+
+			provider := NewScriptToolProvider(mcpServer)
+			result, err := provider.ExecuteTool(context.Background(), "restricted_tool", map[string]interface{}{})
+			if err != nil {
+				t.Fatalf("ExecuteTool failed: %v", err)
+			}
+
+			output := fmt.Sprint(result)
+			if blocked := strings.Contains(output, "is not allowed for this tool"); blocked != tt.blocked {
+				t.Errorf("Expected blocked %v, got %s", tt.blocked, output)
+			}
+		})
+	}
+}
+
+// TestToolParameterDefaults tests that omitted optional parameters are passed to the script with their defaults
+func TestToolParameterDefaults(t *testing.T) {
+	tempDir := t.TempDir()
+
+	toolDir := filepath.Join(tempDir, "greeter")
+	os.MkdirAll(toolDir, 0755)
+	toolTOML := []byte(`
+name = "greeter"
+description = "Greets someone"
+script = "script.py"
+
+[parameters.name]
+type = "string"
+description = "Who to greet"
+required = true
+
+[parameters.greeting]
+type = "string"
+description = "The greeting"
+default = "Hello"
+
+[parameters.count]
+type = "number"
+description = "Times to greet"
+default = 2
+`)
+	os.WriteFile(filepath.Join(toolDir, "tool.toml"), toolTOML, 0644)
+	os.WriteFile(filepath.Join(toolDir, "script.py"), []byte(`import llmr.mcp
+print(llmr.mcp.get("greeting") + " " + llmr.mcp.get("name") + " " + str(llmr.mcp.get("count")))`), 0644)
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: tempDir,
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+	provider := NewScriptToolProvider(mcpServer)
+
+	tools, err := provider.GetTools(context.Background())
+	if err != nil || len(tools) != 1 {
+		t.Fatalf("Expected 1 tool, got %d: %v", len(tools), err)
+	}
+	properties := tools[0].InputSchema.(map[string]interface{})["properties"].(map[string]interface{})
+	if properties["greeting"].(map[string]interface{})["default"] != "Hello" {
+		t.Errorf("Expected the greeting default in the schema, got %v", properties["greeting"])
+	}
+
+	tests := []struct {
+		args     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"name": "Ada"}, "Hello Ada 2"},
+		{map[string]interface{}{"name": "Ada", "greeting": "Hi", "count": 1}, "Hi Ada 1"},
+	}
+	for _, tt := range tests {
+		result, err := provider.ExecuteTool(context.Background(), "greeter", tt.args)
+		if err != nil {
+			t.Fatalf("ExecuteTool failed: %v", err)
+		}
+		if output := fmt.Sprint(result); !strings.Contains(output, tt.expected) {
+			t.Errorf("Expected %q with arguments %v, got %s", tt.expected, tt.args, output)
+		}
+	}
+}
+
+// TestToolArgumentValidation tests that tool calls with missing or mistyped arguments are rejected before the script runs
+func TestToolArgumentValidation(t *testing.T) {
+	tempDir := t.TempDir()
+
+	toolDir := filepath.Join(tempDir, "lookup")
+	os.MkdirAll(toolDir, 0755)
+	toolTOML := []byte(`
+name = "lookup"
+description = "Looks something up"
+script = "script.py"
+
+[parameters.query]
+type = "string"
+description = "What to look up"
+required = true
+
+[parameters.limit]
+type = "number"
+description = "Maximum results"
+`)
+	os.WriteFile(filepath.Join(toolDir, "tool.toml"), toolTOML, 0644)
+	os.WriteFile(filepath.Join(toolDir, "script.py"), []byte("print('ran')"), 0644)
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: tempDir,
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	tests := []struct {
+		args     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{}, "missing required parameter query"},
+		{map[string]interface{}{"query": "go", "limit": "ten"}, "parameter limit must be a number"},
+		{map[string]interface{}{"query": "go", "limit": 10}, ""},
+	}
+	for _, tt := range tests {
+		var resp map[string]interface{}
+		postMCP(t, mcpServer, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": "lookup", "arguments": tt.args},
+		}, &resp)
+
+		body, _ := json.Marshal(resp)
+		if tt.expected == "" {
+			if !strings.Contains(string(body), "ran") {
+				t.Errorf("Expected valid arguments %v to run the script, got %s", tt.args, body)
+			}
+			continue
+		}
+		if !strings.Contains(string(body), tt.expected) || strings.Contains(string(body), "ran") {
+			t.Errorf("Expected arguments %v to be rejected with %q, got %s", tt.args, tt.expected, body)
+		}
+	}
+}
+
+// TestToolObjectParameters tests that object parameters get a nested schema and reach the script as a dict
+func TestToolObjectParameters(t *testing.T) {
+	tempDir := t.TempDir()
+
+	toolDir := filepath.Join(tempDir, "search")
+	os.MkdirAll(toolDir, 0755)
+	toolTOML := []byte(`
+name = "search"
+description = "Searches records"
+script = "script.py"
+
+[parameters.filter]
+type = "object"
+description = "Which records to match"
+required = true
+
+[parameters.filter.properties.field]
+type = "string"
+description = "Field to match on"
+required = true
+
+[parameters.filter.properties.limit]
+type = "number"
+description = "Maximum matches"
+default = 5
+`)
+	os.WriteFile(filepath.Join(toolDir, "tool.toml"), toolTOML, 0644)
+	os.WriteFile(filepath.Join(toolDir, "script.py"), []byte(`import llmr.mcp
+print(filter["field"] + " " + str(llmr.mcp.get("filter")["limit"]))`), 0644)
+
+	config := &Config{
+		Scriptling: ScriptlingConfig{
+			ToolsPath: tempDir,
+		},
+	}
+
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+	provider := NewScriptToolProvider(mcpServer)
+
+	tools, err := provider.GetTools(context.Background())
+	if err != nil || len(tools) != 1 {
+		t.Fatalf("Expected 1 tool, got %d: %v", len(tools), err)
+	}
+	schema, _ := json.Marshal(tools[0].InputSchema)
+	var parsed struct {
+		Properties map[string]struct {
+			Type       string                            `json:"type"`
+			Required   []string                          `json:"required"`
+			Properties map[string]map[string]interface{} `json:"properties"`
+		} `json:"properties"`
+	}
+	json.Unmarshal(schema, &parsed)
+	filter := parsed.Properties["filter"]
+	if filter.Type != "object" || filter.Properties["field"]["type"] != "string" || filter.Properties["limit"]["default"] != float64(5) {
+		t.Errorf("Expected a nested object schema for filter, got %s", schema)
+	}
+	if !slices.Contains(filter.Required, "field") {
+		t.Errorf("Expected field to be required within filter, got %s", schema)
+	}
+
+	result, err := provider.ExecuteTool(context.Background(), "search", map[string]interface{}{
+		"filter": map[string]interface{}{"field": "name"},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTool failed: %v", err)
+	}
+	if output := fmt.Sprint(result); !strings.Contains(output, "name 5") {
+		t.Errorf("Expected the script to receive the nested dict with defaults, got %s", output)
+	}
+
+	if _, err := provider.ExecuteTool(context.Background(), "search", map[string]interface{}{
+		"filter": map[string]interface{}{"limit": 3},
+	}); err == nil || !strings.Contains(err.Error(), "parameter filter: missing required parameter field") {
+		t.Errorf("Expected a validation error for the missing nested field, got %v", err)
+	}
+}
+
+// TestMCPToolConcurrencyLimit tests that tool executions are rejected while max_concurrent_tools are running, and
+// that they run once a slot is freed
+func TestMCPToolConcurrencyLimit(t *testing.T) {
+	config := &Config{MCP: MCPConfig{MaxConcurrentTools: 2}}
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	call := func(code string) string {
+		var resp map[string]interface{}
+		postMCP(t, mcpServer, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": "execute_code", "arguments": map[string]interface{}{"code": code}},
+		}, &resp)
+		body, _ := json.Marshal(resp)
+		return string(body)
+	}
+
+	// Hold every slot as running executions would
+	for range cap(mcpServer.toolSlots) {
+		mcpServer.toolSlots <- struct{}{}
+	}
+	body := call("print('finished')")
+	if !strings.Contains(body, "Too many tool executions") || !strings.Contains(body, fmt.Sprint(errorCodeToolsBusy)) {
+		t.Errorf("Expected the call to be rejected as busy, got %s", body)
+	}
+
+	<-mcpServer.toolSlots
+	if body := call("print('finished')"); !strings.Contains(body, "finished") {
+		t.Errorf("Expected a call to run once a slot is free, got %s", body)
+	}
+	if len(mcpServer.toolSlots) != 1 {
+		t.Errorf("Expected the call to free its slot, %d slots held", len(mcpServer.toolSlots))
+	}
+}
+
+// TestMCPToolConcurrencyLimitNested tests that a script tool called from within a running script shares its slot
+// rather than being rejected for taking another
+func TestMCPToolConcurrencyLimitNested(t *testing.T) {
+	tempDir := t.TempDir()
+	toolDir := filepath.Join(tempDir, "inner")
+	os.MkdirAll(toolDir, 0755)
+	os.WriteFile(filepath.Join(toolDir, "tool.toml"), []byte(`
+name = "inner"
+description = "Called from another script"
+script = "script.py"
+`), 0644)
+	os.WriteFile(filepath.Join(toolDir, "script.py"), []byte(`print('inner ran')`), 0644)
+
+	config := &Config{
+		MCP:        MCPConfig{MaxConcurrentTools: 1},
+		Scriptling: ScriptlingConfig{ToolsPath: tempDir},
+	}
+	mcpServer, err := NewMCPServer(config, &testLogger{}, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	var resp map[string]interface{}
+	postMCP(t, mcpServer, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]interface{}{"name": "execute_code", "arguments": map[string]interface{}{
+			"code": "import llmr.mcp\nprint(llmr.mcp.call_tool('inner', {}))",
+		}},
+	}, &resp)
+	body, _ := json.Marshal(resp)
+	if !strings.Contains(string(body), "inner ran") {
+		t.Errorf("Expected the nested tool to run, got %s", body)
+	}
+	if len(mcpServer.toolSlots) != 0 {
+		t.Errorf("Expected the slot to be freed, %d held", len(mcpServer.toolSlots))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/paularlott/mcp"
+)
+
+// toolAuditValueSize is the max bytes of a tool's arguments or result included in its audit entry
+const toolAuditValueSize = 1024
+
+// toolCallerKey is the context key for the client calling a tool
+type toolCallerKey struct{}
+
+// withToolCaller returns a context identifying the MCP client the request came from by a hash of its bearer token,
+// so the audit log doesn't hold the token itself. Clients without a token are "anonymous".
+func withToolCaller(ctx context.Context, r *http.Request) context.Context {
+	caller := "anonymous"
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		caller = "token:" + hex.EncodeToString(sum[:8])
+	}
+	return context.WithValue(ctx, toolCallerKey{}, caller)
+}
+
+// toolCaller returns the client calling a tool, "internal" for calls made within the router such as by the ai library
+func toolCaller(ctx context.Context) string {
+	if caller, _ := ctx.Value(toolCallerKey{}).(string); caller != "" {
+		return caller
+	}
+	return "internal"
+}
+
+// callTool calls a tool through the MCP server for the router itself, such as from the ai and mcp libraries,
+// refusing disabled tools and auditing the call like those made by MCP clients
+func (m *MCPServer) callTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResponse, error) {
+	if disabled := m.disabledTool(name, args); disabled != "" {
+		return nil, fmt.Errorf("%w: %s", mcp.ErrUnknownTool, disabled)
+	}
+
+	started := time.Now()
+	response, err := m.server.CallTool(ctx, name, args)
+	m.auditTool(ctx, name, args, started, toolResponseText(response), err)
+	return response, err
+}
+
+// handleToolCall passes a tools/call request to the MCP server, auditing the call whichever tool serves it, script,
+// built-in or on a remote MCP server
+func (m *MCPServer) handleToolCall(w http.ResponseWriter, r *http.Request, params json.RawMessage) {
+	if !m.config.MCP.AuditTools {
+		m.server.HandleRequest(w, r)
+		return
+	}
+
+	var call struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	json.Unmarshal(params, &call)
+
+	// The response is written through as the MCP server sends it, so streamed responses aren't held back
+	started := time.Now()
+	tw := &teeResponseWriter{ResponseWriter: w}
+	m.server.HandleRequest(tw, r)
+
+	result, err := toolCallResult(tw.body.Bytes())
+	m.auditTool(r.Context(), call.Name, call.Arguments, started, toolResponseText(result), err)
+}
+
+// teeResponseWriter writes a response through to the client, keeping a copy of the body to inspect once written
+type teeResponseWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the response written so far to the client
+func (w *teeResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// toolCallResult decodes the tool response from a tools/call response body, sent as JSON or as server-sent events.
+// A JSON-RPC error, or a result flagged isError, is returned as the error.
+func toolCallResult(body []byte) (*mcp.ToolResponse, error) {
+	// A streamed response carries the JSON-RPC response as the data of its last event
+	for line := range strings.SplitSeq(string(body), "\n") {
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+			body = []byte(data)
+		}
+	}
+
+	var resp struct {
+		Result *struct {
+			mcp.ToolResponse
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return nil, nil
+	}
+
+	switch {
+	case resp.Error != nil:
+		return nil, errors.New(resp.Error.Message)
+	case resp.Result == nil:
+		return nil, nil
+	case resp.Result.IsError:
+		return &resp.Result.ToolResponse, errors.New("tool returned an error result")
+	default:
+		return &resp.Result.ToolResponse, nil
+	}
+}
+
+// toolResponseText returns the text content of a tool response
+func toolResponseText(response *mcp.ToolResponse) string {
+	if response == nil {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, content := range response.Content {
+		if content.Type == "text" {
+			text.WriteString(content.Text)
+		}
+	}
+	return text.String()
+}
+
+// auditTool logs a tool execution when tool auditing is enabled, the arguments and result are truncated to keep
+// entries small
+func (m *MCPServer) auditTool(ctx context.Context, name string, args map[string]interface{}, started time.Time, result string, err error) {
+	if !m.config.MCP.AuditTools {
+		return
+	}
+
+	arguments, _ := json.Marshal(args)
+	fields := []any{
+		"tool", name,
+		"caller", toolCaller(ctx),
+		"duration_ms", time.Since(started).Milliseconds(),
+		"arguments", truncateAuditValue(string(arguments)),
+		"result", truncateAuditValue(result),
+	}
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+	m.logger.Info("tool executed", fields...)
+}
+
+// truncateAuditValue cuts a value logged in a tool audit entry to toolAuditValueSize bytes
+func truncateAuditValue(value string) string {
+	if len(value) <= toolAuditValueSize {
+		return value
+	}
+	return truncateUTF8(value, toolAuditValueSize) + "...[truncated]"
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/paularlott/mcp"
+)
+
+// TestToolAudit tests that an execute_code call is logged with its code, caller and result when tool auditing is
+// enabled, and not logged when it isn't
+func TestToolAudit(t *testing.T) {
+	call := func(config *Config) string {
+		t.Helper()
+		logger := &recordingLogger{}
+		mcpServer, err := NewMCPServer(config, logger, &Router{})
+		if err != nil {
+			t.Fatalf("Failed to create MCP server: %v", err)
+		}
+
+		var resp map[string]interface{}
+		postMCP(t, mcpServer, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": "execute_code", "arguments": map[string]interface{}{"code": "print('audited ' + str(6 * 7))"}},
+		}, &resp)
+		if resp["result"] == nil {
+			t.Errorf("Expected the tool result to be written to the client, got %v", resp)
+		}
+		return logger.String()
+	}
+
+	logs := call(&Config{MCP: MCPConfig{AuditTools: true}})
+	var entry string
+	for line := range strings.SplitSeq(logs, "\n") {
+		if strings.HasPrefix(line, "INFO tool executed") {
+			entry = line
+		}
+	}
+	if entry == "" {
+		t.Fatalf("Expected a tool executed audit entry, got %s", logs)
+	}
+	for _, expected := range []string{"execute_code", "print('audited ' + str(6 * 7))", "caller anonymous", "audited 42", "duration_ms"} {
+		if !strings.Contains(entry, expected) {
+			t.Errorf("Expected the audit entry to contain %q, got %s", expected, entry)
+		}
+	}
+
+	if logs := call(&Config{}); strings.Contains(logs, "tool executed") {
+		t.Errorf("Expected no audit entry with tool auditing disabled, got %s", logs)
+	}
+}
+
+// TestToolAuditRemoteServer tests that calls to the tools of a remote MCP server are audited, with the caller
+// identified by a hash of its bearer token rather than the token itself
+func TestToolAuditRemoteServer(t *testing.T) {
+	remote := mcp.NewServer("remote", "1.0.0")
+	remote.RegisterTool(
+		mcp.NewTool("echo", "Echo the text", mcp.String("text", "Text to echo", mcp.Required())),
+		func(ctx context.Context, req *mcp.ToolRequest) (*mcp.ToolResponse, error) {
+			text, _ := req.Args()["text"].(string)
+			return mcp.NewToolResponseText("echo: " + text), nil
+		},
+	)
+	remoteServer := httptest.NewServer(http.HandlerFunc(remote.HandleRequest))
+	defer remoteServer.Close()
+
+	logger := &recordingLogger{}
+	config := &Config{MCP: MCPConfig{
+		AuditTools:    true,
+		RemoteServers: []MCPRemoteServerConfig{{Namespace: "remote", URL: remoteServer.URL}},
+	}}
+	mcpServer, err := NewMCPServer(config, logger, &Router{})
+	if err != nil {
+		t.Fatalf("Failed to create MCP server: %v", err)
+	}
+
+	var toolName string
+	for _, tool := range mcpServer.server.ListTools() {
+		if strings.HasSuffix(tool.Name, "echo") {
+			toolName = tool.Name
+		}
+	}
+	if toolName == "" {
+		t.Fatal("Expected the remote echo tool to be registered")
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]interface{}{"name": toolName, "arguments": map[string]interface{}{"text": "hi"}},
+	})
+	req := httptest.NewRequest("POST", "/mcp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("MCP-Protocol-Version", "2025-03-26")
+	req.Header.Set("Authorization", "Bearer client-secret")
+	w := httptest.NewRecorder()
+	mcpServer.HandleRequest(w, req)
+	if !strings.Contains(w.Body.String(), "echo: hi") {
+		t.Fatalf("Expected the remote tool result, got %s", w.Body.String())
+	}
+
+	logs := logger.String()
+	var entry string
+	for line := range strings.SplitSeq(logs, "\n") {
+		if strings.HasPrefix(line, "INFO tool executed") {
+			entry = line
+		}
+	}
+	if entry == "" {
+		t.Fatalf("Expected a tool executed audit entry, got %s", logs)
+	}
+	sum := sha256.Sum256([]byte("client-secret"))
+	for _, expected := range []string{toolName, "echo: hi", "caller token:" + hex.EncodeToString(sum[:8])} {
+		if !strings.Contains(entry, expected) {
+			t.Errorf("Expected the audit entry to contain %q, got %s", expected, entry)
+		}
+	}
+	if strings.Contains(logs, "client-secret") {
+		t.Errorf("Expected the bearer token not to be logged, got %s", logs)
+	}
+
+	// Calls made within the router, such as from the ai library, are audited too
+	if _, err := mcpServer.callTool(context.Background(), toolName, map[string]interface{}{"text": "internal"}); err != nil {
+		t.Fatalf("callTool failed: %v", err)
+	}
+	if !strings.Contains(logger.String(), "caller internal") {
+		t.Errorf("Expected an internal tool call audit entry, got %s", logger.String())
+	}
+}
+
+// TestToolCallResult tests that tool results are decoded from JSON and streamed responses, with JSON-RPC errors and
+// results flagged isError both reported as errors
+func TestToolCallResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		text    string
+		wantErr bool
+	}{
+		{"json", `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"ok"}]}}`, "ok", false},
+		{"sse", "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"content\":[{\"type\":\"text\",\"text\":\"streamed\"}]}}\n\n", "streamed", false},
+		{"is error", `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"no such file"}],"isError":true}}`, "no such file", true},
+		{"rpc error", `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"unknown tool"}}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := toolCallResult([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if text := toolResponseText(result); text != tt.text {
+				t.Errorf("Expected result %q, got %q", tt.text, text)
+			}
+		})
+	}
+}
+
+// TestTruncateAuditValue tests that long audited values are cut on a rune boundary
+func TestTruncateAuditValue(t *testing.T) {
+	if value := truncateAuditValue("short"); value != "short" {
+		t.Errorf("Expected a short value unchanged, got %q", value)
+	}
+
+	value := truncateAuditValue("a" + strings.Repeat("é", toolAuditValueSize))
+	if !strings.HasSuffix(value, "...[truncated]") {
+		t.Errorf("Expected a truncation marker, got %q", value)
+	}
+	if !utf8.ValidString(value) || len(value) > toolAuditValueSize+len("...[truncated]") {
+		t.Errorf("Expected a valid value of at most %d bytes, got %d bytes", toolAuditValueSize, len(value))
+	}
+}
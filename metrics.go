@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// metricSample is a metric value with its labels in Prometheus format, e.g. `status="pending"`
+type metricSample struct {
+	labels string
+	value  int64
+}
+
+// writeMetric writes a metric in the Prometheus text exposition format
+func writeMetric(w io.Writer, name, metricType, help string, samples ...metricSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	for _, sample := range samples {
+		if sample.labels == "" {
+			fmt.Fprintf(w, "%s %d\n", name, sample.value)
+		} else {
+			fmt.Fprintf(w, "%s{%s} %d\n", name, sample.labels, sample.value)
+		}
+	}
+}
+
+// HandleMetrics serves the router metrics in the Prometheus text format
+func (r *Router) HandleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if r.responsesService != nil {
+		m := r.responsesService.Metrics()
+
+		writeMetric(w, "llmrouter_responses", "gauge", "Responses currently pending or being processed",
+			metricSample{`status="pending"`, m.Pending},
+			metricSample{`status="in_progress"`, m.InProgress},
+		)
+		writeMetric(w, "llmrouter_responses_total", "counter", "Responses finished since startup by final status",
+			metricSample{`status="completed"`, m.Completed},
+			metricSample{`status="error"`, m.Failed},
+			metricSample{`status="cancelled"`, m.Cancelled},
+		)
+		writeMetric(w, "llmrouter_responses_queue_depth", "gauge", "Background responses waiting for a free worker",
+			metricSample{"", m.QueueDepth},
+		)
+	}
+}
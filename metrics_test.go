@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMetricsResponseStatuses tests that the metrics endpoint reports responses by status
+func TestMetricsResponseStatuses(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	for _, body := range []string{
+		`{"model":"chat-model","input":["one"]}`,
+		`{"model":"chat-model","input":["two"]}`,
+		`{"model":"missing-model","input":["three"]}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	metrics := w.Body.String()
+	for _, expected := range []string{
+		`llmrouter_responses{status="pending"} 0`,
+		`llmrouter_responses{status="in_progress"} 0`,
+		`llmrouter_responses_total{status="completed"} 2`,
+		`llmrouter_responses_total{status="error"} 1`,
+		`llmrouter_responses_total{status="cancelled"} 0`,
+		"# TYPE llmrouter_responses gauge",
+		"# TYPE llmrouter_responses_total counter",
+		`llmrouter_responses_queue_depth 0`,
+	} {
+		if !strings.Contains(metrics, expected+"\n") {
+			t.Errorf("Expected %q in metrics, got:\n%s", expected, metrics)
+		}
+	}
+}
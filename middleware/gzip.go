@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// uncompressedContentTypes are streamed to the client as they are produced, so are never compressed
+var uncompressedContentTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+}
+
+// Gzip creates a middleware that compresses responses for clients that send Accept-Encoding: gzip.
+// Streaming responses and responses that already have a Content-Encoding are sent unchanged.
+func Gzip(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+
+		next(gw, r)
+	}
+}
+
+// gzipResponseWriter compresses the response body, deciding whether to compress when the headers are written
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz            *gzip.Writer
+	headerWritten bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.headerWritten {
+		return
+	}
+	w.headerWritten = true
+
+	if w.shouldCompress(statusCode) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.headerWritten {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any compressed data buffered so far to the client
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close completes the compressed stream
+func (w *gzipResponseWriter) Close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// shouldCompress returns true if a response with the headers set so far should be compressed
+func (w *gzipResponseWriter) shouldCompress(statusCode int) bool {
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified || statusCode < http.StatusOK {
+		return false
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := w.Header().Get("Content-Type")
+	for _, uncompressed := range uncompressedContentTypes {
+		if strings.HasPrefix(contentType, uncompressed) {
+			return false
+		}
+	}
+	return true
+}
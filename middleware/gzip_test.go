@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzipSkipsStreamingResponses(t *testing.T) {
+	handler := Gzip(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Write([]byte("data: hello\n\n"))
+	})
+
+	tests := []struct {
+		contentType    string
+		acceptEncoding string
+		compressed     bool
+	}{
+		{"application/json", "gzip, deflate", true},
+		{"application/json", "", false},
+		{"text/event-stream", "gzip", false},
+		{"application/x-ndjson", "gzip", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/?type="+tt.contentType, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		if compressed := w.Header().Get("Content-Encoding") == "gzip"; compressed != tt.compressed {
+			t.Errorf("%s with Accept-Encoding %q: expected compressed=%v", tt.contentType, tt.acceptEncoding, tt.compressed)
+			continue
+		}
+
+		body := io.Reader(w.Body)
+		if tt.compressed {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%s: invalid gzip body: %v", tt.contentType, err)
+			}
+			body = gz
+		}
+		if data, _ := io.ReadAll(body); string(data) != "data: hello\n\n" {
+			t.Errorf("%s: expected the original body, got %q", tt.contentType, data)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paularlott/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimiter counts requests per key within fixed time windows
+type RateLimiter interface {
+	// Allow records a request for key and reports whether it is within the limit
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+// windowCounter is the request count for a key in the current window
+type windowCounter struct {
+	start time.Time
+	count int
+}
+
+// MemoryRateLimiter is a rate limiter local to this process
+type MemoryRateLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	counters map[string]*windowCounter
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemoryRateLimiter creates a limiter allowing limit requests per key in each window
+func NewMemoryRateLimiter(limit int, window time.Duration) *MemoryRateLimiter {
+	l := &MemoryRateLimiter{
+		limit:    limit,
+		window:   window,
+		counters: make(map[string]*windowCounter),
+		stop:     make(chan struct{}),
+	}
+	go l.sweep()
+	return l
+}
+
+// sweep periodically drops counters from earlier windows so idle keys don't accumulate, until the limiter is closed
+func (l *MemoryRateLimiter) sweep() {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.removeExpired(time.Now())
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// removeExpired drops the counters of windows before the one containing now
+func (l *MemoryRateLimiter) removeExpired(now time.Time) {
+	start := now.Truncate(l.window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for k, c := range l.counters {
+		if c.start.Before(start) {
+			delete(l.counters, k)
+		}
+	}
+}
+
+func (l *MemoryRateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	start := time.Now().Truncate(l.window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A counter from an earlier window that hasn't been swept yet starts over
+	counter, exists := l.counters[key]
+	if !exists || counter.start.Before(start) {
+		counter = &windowCounter{start: start}
+		l.counters[key] = counter
+	}
+	counter.count++
+
+	return counter.count <= l.limit, nil
+}
+
+// Close stops the background sweep of expired counters
+func (l *MemoryRateLimiter) Close() error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	return nil
+}
+
+// RedisRateLimiter is a rate limiter whose counters are shared by all instances using the same Redis
+type RedisRateLimiter struct {
+	client *redis.Client
+	limit  int
+	window time.Duration
+	prefix string
+}
+
+// NewRedisRateLimiter creates a limiter storing its counters in the Redis server at redisURL
+func NewRedisRateLimiter(redisURL string, limit int, window time.Duration) (*RedisRateLimiter, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	return &RedisRateLimiter{
+		client: redis.NewClient(opts),
+		limit:  limit,
+		window: window,
+		prefix: "llmrouter:ratelimit:",
+	}, nil
+}
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	start := time.Now().Truncate(l.window)
+	redisKey := l.prefix + key + ":" + strconv.FormatInt(start.Unix(), 10)
+
+	// Increment and set the expiry together so a counter can never be left without a TTL
+	pipe := l.client.TxPipeline()
+	incr := pipe.Incr(ctx, redisKey)
+	pipe.ExpireNX(ctx, redisKey, l.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	return incr.Val() <= int64(l.limit), nil
+}
+
+// Close closes the connection to Redis
+func (l *RedisRateLimiter) Close() error {
+	return l.client.Close()
+}
+
+// RateLimit creates a middleware that limits requests per client, clients are identified
+// by their bearer token or by remote address when no token is sent
+func RateLimit(limiter RateLimiter, log logger.Logger) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := limiter.Allow(r.Context(), rateLimitKey(r))
+			if err != nil {
+				// Fail open, an unavailable limiter backend shouldn't take the router down
+				log.Warn("rate limiter unavailable, allowing request", "error", err)
+				next(w, r)
+				return
+			}
+
+			if !allowed {
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// rateLimitKey returns the key a request is counted against, tokens are hashed so they're never stored in the
+// limiter backend
+func rateLimitKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/paularlott/logger"
+)
+
+func TestRedisRateLimiterSharedAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	first, err := NewRedisRateLimiter("redis://"+mr.Addr(), 3, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create first limiter: %v", err)
+	}
+	defer first.Close()
+
+	second, err := NewRedisRateLimiter("redis://"+mr.Addr(), 3, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create second limiter: %v", err)
+	}
+	defer second.Close()
+
+	// Requests through either instance count towards the same limit
+	for i, limiter := range []*RedisRateLimiter{first, second, first} {
+		allowed, err := limiter.Allow(ctx, "token:abc")
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		if !allowed {
+			t.Fatalf("request %d: expected to be allowed", i)
+		}
+	}
+
+	allowed, err := second.Allow(ctx, "token:abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected the fourth request to be limited by the shared counter")
+	}
+
+	// Other clients have their own counters
+	allowed, err = first.Allow(ctx, "token:other")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected a different client to be allowed")
+	}
+}
+
+// warnLogger records the warnings it is sent
+type warnLogger struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *warnLogger) Trace(msg string, args ...any) {}
+func (l *warnLogger) Debug(msg string, args ...any) {}
+func (l *warnLogger) Info(msg string, args ...any)  {}
+func (l *warnLogger) Warn(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, msg)
+}
+func (l *warnLogger) Error(msg string, args ...any)            {}
+func (l *warnLogger) Fatal(msg string, args ...any)            {}
+func (l *warnLogger) With(key string, value any) logger.Logger { return l }
+func (l *warnLogger) WithError(err error) logger.Logger        { return l }
+func (l *warnLogger) WithGroup(group string) logger.Logger     { return l }
+
+func TestMemoryRateLimiterWindows(t *testing.T) {
+	limiter := NewMemoryRateLimiter(2, time.Minute)
+	defer limiter.Close()
+	ctx := context.Background()
+
+	for i := range 2 {
+		if allowed, _ := limiter.Allow(ctx, "token:abc"); !allowed {
+			t.Fatalf("request %d: expected to be allowed", i)
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "token:abc"); allowed {
+		t.Error("expected the third request to be limited")
+	}
+	if allowed, _ := limiter.Allow(ctx, "token:other"); !allowed {
+		t.Error("expected a different client to be allowed")
+	}
+
+	// A counter left over from an earlier window starts over
+	limiter.mu.Lock()
+	limiter.counters["token:abc"].start = limiter.counters["token:abc"].start.Add(-time.Minute)
+	limiter.mu.Unlock()
+	if allowed, _ := limiter.Allow(ctx, "token:abc"); !allowed {
+		t.Error("expected a request in a new window to be allowed")
+	}
+}
+
+func TestMemoryRateLimiterSweep(t *testing.T) {
+	limiter := NewMemoryRateLimiter(5, time.Minute)
+	defer limiter.Close()
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "token:abc")
+	limiter.Allow(ctx, "token:other")
+
+	// Sweeping within the window keeps the counters, sweeping after it drops them
+	limiter.removeExpired(time.Now())
+	if len(limiter.counters) != 2 {
+		t.Fatalf("expected 2 counters within the window, got %d", len(limiter.counters))
+	}
+	limiter.removeExpired(time.Now().Add(time.Minute))
+	if len(limiter.counters) != 0 {
+		t.Errorf("expected expired counters to be swept, got %d", len(limiter.counters))
+	}
+}
+
+func TestRedisRateLimiterError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limiter, err := NewRedisRateLimiter("redis://"+mr.Addr(), 3, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+	defer limiter.Close()
+
+	mr.Close()
+	if _, err := limiter.Allow(context.Background(), "token:abc"); err == nil {
+		t.Error("expected an error when redis is unavailable")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := NewMemoryRateLimiter(1, time.Minute)
+	defer limiter.Close()
+	handler := RateLimit(limiter, &warnLogger{})(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(token string) int {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	if code := request("secret"); code != http.StatusOK {
+		t.Errorf("expected first request to be allowed, got %d", code)
+	}
+	if code := request("secret"); code != http.StatusTooManyRequests {
+		t.Errorf("expected second request to be limited, got %d", code)
+	}
+	if code := request("other"); code != http.StatusOK {
+		t.Errorf("expected another token to be allowed, got %d", code)
+	}
+
+	// Tokens are hashed before being used as keys
+	for key := range limiter.counters {
+		if strings.Contains(key, "secret") || strings.Contains(key, "other") {
+			t.Errorf("expected hashed token in key, got %s", key)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareFailsOpen(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limiter, err := NewRedisRateLimiter("redis://"+mr.Addr(), 1, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+	defer limiter.Close()
+	mr.Close()
+
+	log := &warnLogger{}
+	handler := RateLimit(limiter, log)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/v1/models", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected request to be allowed when the limiter fails, got %d", w.Code)
+	}
+	if len(log.warnings) != 1 {
+		t.Errorf("expected the limiter error to be logged, got %v", log.warnings)
+	}
+}
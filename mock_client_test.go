@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// MockClient is an in-memory OpenAIClient for testing routing without HTTP servers. Each call waits for Latency
+// and, when Block is set, until Block is closed, then returns Err or the programmed response.
+type MockClient struct {
+	Models            []string                // model IDs returned by ListModels
+	ChatResponse      *ChatCompletionResponse // returned by CreateChatCompletion, a reply naming the model when nil
+	EmbeddingResponse *EmbeddingResponse      // returned by CreateEmbedding, one empty embedding when nil
+	Err               error                   // returned by every call when set
+	Latency           time.Duration           // delay before each call returns
+	Block             chan struct{}           // calls wait until it is closed when set
+
+	mu       sync.Mutex
+	requests []string // model requested by each chat completion and embedding
+	active   int64    // calls in progress
+}
+
+var _ OpenAIClient = (*MockClient)(nil)
+
+// wait applies the latency and block, returning early if the context is done
+func (m *MockClient) wait(ctx context.Context) error {
+	atomic.AddInt64(&m.active, 1)
+	defer atomic.AddInt64(&m.active, -1)
+
+	if m.Latency > 0 {
+		select {
+		case <-time.After(m.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if m.Block != nil {
+		select {
+		case <-m.Block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return m.Err
+}
+
+func (m *MockClient) record(model string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, model)
+}
+
+// Requests returns the model of each chat completion and embedding request received
+func (m *MockClient) Requests() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.requests...)
+}
+
+// Active returns the number of calls in progress
+func (m *MockClient) Active() int64 {
+	return atomic.LoadInt64(&m.active)
+}
+
+func (m *MockClient) ListModels(ctx context.Context) (*ModelsResponse, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	models := make([]Model, len(m.Models))
+	for i, id := range m.Models {
+		models[i] = Model{ID: id, Object: "model"}
+	}
+	return &ModelsResponse{Object: "list", Data: models}, nil
+}
+
+func (m *MockClient) ListModelsWithTimeout(ctx context.Context) (*ModelsResponse, error) {
+	return m.ListModels(ctx)
+}
+
+func (m *MockClient) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	m.record(req.Model)
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	if m.ChatResponse != nil {
+		return m.ChatResponse, nil
+	}
+	return &ChatCompletionResponse{
+		ID:      "chatcmpl-mock",
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Choices: []Choice{{Message: Message{Role: "assistant", Content: "reply from " + req.Model}, FinishReason: "stop"}},
+	}, nil
+}
+
+// CreateChatCompletionRaw streams the chat response as a content chunk and a final chunk
+func (m *MockClient) CreateChatCompletionRaw(ctx context.Context, req *ChatCompletionRequest) (*http.Response, error) {
+	resp, err := m.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	content, _ := json.Marshal(resp.Choices[0].Message.Content)
+	stream := fmt.Sprintf("data: {\"id\":%q,\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", resp.ID, resp.Model, content) +
+		fmt.Sprintf("data: {\"id\":%q,\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n", resp.ID, resp.Model) +
+		"data: [DONE]\n\n"
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(stream)),
+	}, nil
+}
+
+func (m *MockClient) CreateEmbedding(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	m.record(req.Model)
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	if m.EmbeddingResponse != nil {
+		return m.EmbeddingResponse, nil
+	}
+	return &EmbeddingResponse{
+		Object: "list",
+		Model:  req.Model,
+		Data:   []Embedding{{Object: "embedding", Embedding: []float64{0}}},
+	}, nil
+}
+
+// Forward answers a passthrough request with an empty JSON object
+func (m *MockClient) Forward(req *http.Request, path string) (*http.Response, error) {
+	if err := m.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+	}, nil
+}
+
+// newMockRouter creates a router whose providers, named by the map keys, are served by the mock clients
+func newMockRouter(t *testing.T, clients map[string]*MockClient) *Router {
+	t.Helper()
+
+	config := &Config{}
+	for name := range clients {
+		config.Providers = append(config.Providers, ProviderConfig{Name: name, BaseURL: "http://" + name + ".invalid", Enabled: true})
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	t.Cleanup(router.Shutdown)
+
+	for name, client := range clients {
+		router.Providers[name].Client = client
+	}
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+	return router
+}
+
+// TestLeastActiveSelection tests that completions go to the provider with the fewest completions in progress
+func TestLeastActiveSelection(t *testing.T) {
+	block := make(chan struct{})
+	clients := map[string]*MockClient{
+		"a": {Models: []string{"shared-model"}, Block: block},
+		"b": {Models: []string{"shared-model"}, Block: block},
+		"c": {Models: []string{"shared-model"}, Block: block},
+	}
+	router := newMockRouter(t, clients)
+
+	// Each blocked completion keeps its provider busy, so the next one must go to an idle provider
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+				Model:    "shared-model",
+				Messages: []Message{{Role: "user", Content: "hi"}},
+			}); err != nil {
+				t.Errorf("CreateChatCompletion failed: %v", err)
+			}
+		}()
+
+		// Wait for the completion to reach a provider before sending the next
+		deadline := time.Now().Add(time.Second)
+		for activeCalls(clients) < int64(i+1) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for name, client := range clients {
+		if active := client.Active(); active != 1 {
+			t.Errorf("Expected provider %s to have 1 completion in progress, got %d", name, active)
+		}
+	}
+
+	close(block)
+	wg.Wait()
+
+	// Completions counted as in progress elsewhere steer the next one to the idle provider
+	router.Providers["a"].ActiveCompletions = 2
+	router.Providers["c"].ActiveCompletions = 1
+	if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model:    "shared-model",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	}); err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+	if requests := len(clients["b"].Requests()); requests != 2 {
+		t.Errorf("Expected the idle provider b to receive the completion, got %d requests", requests)
+	}
+}
+
+// TestLeastActiveTiesShared tests that idle providers share sequential completions rather than the first listed
+// provider taking them all
+func TestLeastActiveTiesShared(t *testing.T) {
+	clients := map[string]*MockClient{
+		"a": {Models: []string{"shared-model"}},
+		"b": {Models: []string{"shared-model"}},
+		"c": {Models: []string{"shared-model"}},
+	}
+	router := newMockRouter(t, clients)
+
+	for i := 0; i < 6; i++ {
+		if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+			Model:    "shared-model",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+		}); err != nil {
+			t.Fatalf("CreateChatCompletion failed: %v", err)
+		}
+	}
+
+	for name, client := range clients {
+		if requests := len(client.Requests()); requests != 2 {
+			t.Errorf("Expected provider %s to receive 2 of the completions, got %d", name, requests)
+		}
+	}
+}
+
+// activeCalls returns the number of calls in progress across the clients
+func activeCalls(clients map[string]*MockClient) int64 {
+	var active int64
+	for _, client := range clients {
+		active += client.Active()
+	}
+	return active
+}
+
+// TestMockClientErrorsAndLatency tests that programmed errors and latencies reach the router as provider failures
+func TestMockClientErrorsAndLatency(t *testing.T) {
+	clients := map[string]*MockClient{
+		"down": {Models: []string{"down-model"}},
+		"slow": {Models: []string{"slow-model"}, Latency: time.Second},
+	}
+	router := newMockRouter(t, clients)
+
+	// A connection error disables the provider
+	clients["down"].Err = errors.New("dial tcp: connection refused")
+	if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{Model: "down-model"}); err == nil {
+		t.Error("Expected the programmed error")
+	}
+	router.ProvidersMu.RLock()
+	healthy := router.Providers["down"].Healthy
+	router.ProvidersMu.RUnlock()
+	if healthy {
+		t.Error("Expected the provider to be disabled after a connection error")
+	}
+
+	// A request that gives up before the latency passes fails without waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := router.CreateEmbedding(ctx, &EmbeddingRequest{Model: "slow-model", Input: "hi"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the request to give up at its deadline, took %s", elapsed)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cachedModelList is a provider's model list and when it was fetched
+type cachedModelList struct {
+	models  *ModelsResponse
+	fetched time.Time
+}
+
+// modelListCache keeps the last model list fetched from each provider for a short time, so refreshes in quick
+// succession, e.g. several providers recovering at once, don't refetch from every provider. A nil cache holds nothing.
+type modelListCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedModelList
+}
+
+func newModelListCache(ttl time.Duration) *modelListCache {
+	return &modelListCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedModelList),
+	}
+}
+
+// bypassModelCacheKey is the context key marking a refresh that must fetch the models from every provider
+type bypassModelCacheKey struct{}
+
+// withoutModelCache returns a context that makes a refresh ignore cached model lists, for refreshes an admin asks
+// for, which must reflect the providers' current models
+func withoutModelCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassModelCacheKey{}, true)
+}
+
+// modelCacheBypassed returns true if cached model lists must not be used for the refresh
+func modelCacheBypassed(ctx context.Context) bool {
+	bypassed, _ := ctx.Value(bypassModelCacheKey{}).(bool)
+	return bypassed
+}
+
+// get returns the provider's model list if it was fetched within the TTL
+func (c *modelListCache) get(providerName string) (*ModelsResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[providerName]
+	if !exists || time.Since(entry.fetched) >= c.ttl {
+		return nil, false
+	}
+	return entry.models, true
+}
+
+// set records a model list just fetched from the provider
+func (c *modelListCache) set(providerName string, models *ModelsResponse) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[providerName] = cachedModelList{models: models, fetched: time.Now()}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestModelListCache tests that refreshes within the TTL fetch each provider's models only once
+func TestModelListCache(t *testing.T) {
+	newCountingServer := func(model string, fetches *int64) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(fetches, 1)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: model, Object: "model"}}})
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	for _, ttl := range []int{0, 60} {
+		var fetchesA, fetchesB int64
+		serverA := newCountingServer("model-a", &fetchesA)
+		serverB := newCountingServer("model-b", &fetchesB)
+
+		config := &Config{
+			Providers: []ProviderConfig{
+				{Name: "a", BaseURL: serverA.URL, Enabled: true},
+				{Name: "b", BaseURL: serverB.URL, Enabled: true},
+			},
+			ModelCache: ModelCacheConfig{TTL: ttl},
+		}
+
+		router, err := NewRouter(config, &testLogger{})
+		if err != nil {
+			t.Fatalf("NewRouter failed: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := router.RefreshModels(context.Background()); err != nil {
+				t.Fatalf("RefreshModels failed: %v", err)
+			}
+		}
+		router.Shutdown()
+
+		expected := int64(2)
+		if ttl > 0 {
+			expected = 1
+		}
+		if fetchesA != expected || fetchesB != expected {
+			t.Errorf("TTL %d: expected %d fetches per provider, got a=%d b=%d", ttl, expected, fetchesA, fetchesB)
+		}
+
+		// Models from the cached lists are still routed
+		router.ModelMapMu.RLock()
+		models := len(router.ModelMap)
+		router.ModelMapMu.RUnlock()
+		if models != 2 {
+			t.Errorf("TTL %d: expected 2 models after the second refresh, got %d", ttl, models)
+		}
+	}
+}
+
+// TestModelListCacheBypassedByAdmin tests that refreshes requested through the admin endpoints fetch the models again
+func TestModelListCacheBypassedByAdmin(t *testing.T) {
+	var fetches int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: "model-a", Object: "model"}}})
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Server: ServerConfig{AdminToken: "admin-token"},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+		ModelCache: ModelCacheConfig{TTL: 60},
+	}
+
+	router := newTestRouter(t, config)
+
+	for _, path := range []string{"/admin/refresh", "/admin/providers/a/enable"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	if fetches != 3 {
+		t.Errorf("Expected each admin refresh to fetch the models, got %d fetches", fetches)
+	}
+}
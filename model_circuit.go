@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	modelCircuitThreshold = 3                // consecutive model errors before a provider is excluded for a model
+	modelCircuitCooldown  = 60 * time.Second // how long a provider is excluded for a model
+)
+
+// modelCircuit tracks model specific failures for a single provider and model
+type modelCircuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+// modelCircuits tracks failures at the (provider, model) level so a provider that is healthy overall
+// but failing for one model can be excluded for just that model
+type modelCircuits struct {
+	mu       sync.Mutex
+	circuits map[string]*modelCircuit // provider + "/" + model -> circuit
+}
+
+func newModelCircuits() *modelCircuits {
+	return &modelCircuits{
+		circuits: make(map[string]*modelCircuit),
+	}
+}
+
+func modelCircuitKey(providerName, model string) string {
+	return providerName + "/" + model
+}
+
+// recordFailure records a model specific failure, returns true if the circuit has just opened
+func (c *modelCircuits) recordFailure(providerName, model string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := modelCircuitKey(providerName, model)
+	circuit, exists := c.circuits[key]
+	if !exists {
+		circuit = &modelCircuit{}
+		c.circuits[key] = circuit
+	}
+
+	circuit.failures++
+	if circuit.failures >= modelCircuitThreshold {
+		circuit.failures = 0
+		circuit.openUntil = time.Now().Add(modelCircuitCooldown)
+		return true
+	}
+
+	return false
+}
+
+// recordSuccess clears any failures recorded for the provider and model
+func (c *modelCircuits) recordSuccess(providerName, model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.circuits, modelCircuitKey(providerName, model))
+}
+
+// isOpen returns true if the provider is currently excluded for the model
+func (c *modelCircuits) isOpen(providerName, model string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	circuit, exists := c.circuits[modelCircuitKey(providerName, model)]
+	return exists && time.Now().Before(circuit.openUntil)
+}
+
+// recordModelResult updates the model circuit for a provider after a request
+func (r *Router) recordModelResult(providerName, model string, err error) {
+	if err == nil {
+		r.modelCircuits.recordSuccess(providerName, model)
+		return
+	}
+
+	if !isModelError(err) {
+		return
+	}
+
+	if r.modelCircuits.recordFailure(providerName, model) {
+		r.logger.Warn("excluding provider for model after repeated errors",
+			"provider", providerName,
+			"model", model,
+			"cooldown", modelCircuitCooldown)
+	}
+}
+
+// isModelError checks if an error is specific to the requested model rather than the provider
+func isModelError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr *UpstreamStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+
+	errStr := strings.ToLower(err.Error())
+	modelPatterns := []string{
+		"model_not_found",
+		"model not found",
+		"model not loaded",
+	}
+
+	for _, pattern := range modelPatterns {
+		if strings.Contains(errStr, pattern) {
+			return true
+		}
+	}
+
+	return modelMissingPattern.MatchString(errStr)
+}
+
+// modelMissingPattern matches errors naming a model that doesn't exist, e.g. "the model `gpt-x` does not exist",
+// without matching missing files, endpoints or keys
+var modelMissingPattern = regexp.MustCompile(`model\s+\S+\s+does not exist`)
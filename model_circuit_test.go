@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newChatServer creates a mock provider that lists the given models and answers chat completions,
+// models in failing return a model not found error
+func newChatServer(t *testing.T, models []string, failing map[string]bool, calls *int64) *httptest.Server {
+	t.Helper()
+
+	return newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		atomic.AddInt64(calls, 1)
+
+		if failing[req.Model] {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{"message": "model not found", "code": "model_not_found"},
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:     "chatcmpl-test",
+			Object: "chat.completion",
+			Model:  req.Model,
+			Choices: []Choice{
+				{Message: Message{Role: "assistant", Content: "ok"}},
+			},
+		})
+	}, models...)
+}
+
+// TestModelCircuitShiftsTraffic tests that a provider failing for one model is excluded for just that model
+func TestModelCircuitShiftsTraffic(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"shared-model", "other-model"}, map[string]bool{"shared-model": true}, &callsA)
+	serverB := newChatServer(t, []string{"shared-model"}, nil, &callsB)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	// Keep provider b busy so the least loaded provider a is preferred
+	router.incrementActiveCompletions("b")
+	defer router.decrementActiveCompletions("b")
+
+	// Route until provider a has failed enough times to be excluded for the model
+	failures := 0
+	for i := 0; i < 20 && !router.modelCircuits.isOpen("a", "shared-model"); i++ {
+		req := &ChatCompletionRequest{Model: "shared-model", Messages: []Message{{Role: "user", Content: "hi"}}}
+		if _, err := router.CreateChatCompletion(context.Background(), req); err != nil {
+			failures++
+		}
+	}
+	if failures != modelCircuitThreshold {
+		t.Fatalf("Expected %d failures before exclusion, got %d", modelCircuitThreshold, failures)
+	}
+
+	// All further traffic for the model goes to provider b even though it is busier
+	atomic.StoreInt64(&callsA, 0)
+	for i := 0; i < 5; i++ {
+		req := &ChatCompletionRequest{Model: "shared-model", Messages: []Message{{Role: "user", Content: "hi"}}}
+		if _, err := router.CreateChatCompletion(context.Background(), req); err != nil {
+			t.Errorf("Expected request to succeed on provider b, got %v", err)
+		}
+	}
+	if calls := atomic.LoadInt64(&callsA); calls != 0 {
+		t.Errorf("Expected no requests to provider a for shared-model, got %d", calls)
+	}
+
+	// Provider a stays healthy and keeps serving its other model
+	if !router.getProvider("a").Healthy {
+		t.Error("Expected provider a to remain healthy")
+	}
+	providerName, err := router.GetProviderForModel("other-model")
+	if err != nil || providerName != "a" {
+		t.Errorf("Expected other-model to route to provider a, got %q (%v)", providerName, err)
+	}
+}
+
+// TestIsModelError tests that only errors about the requested model count towards the model circuit
+func TestIsModelError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{errors.New("API returned status 400: The model `gpt-x` does not exist or you do not have access to it."), true},
+		{errors.New(`{"error":{"code":"model_not_found"}}`), true},
+		{errors.New("model not loaded"), true},
+		{&UpstreamStatusError{StatusCode: http.StatusNotFound}, true},
+		{errors.New("API returned status 400: file file-abc123 does not exist"), false},
+		{errors.New("API returned status 401: the API key does not exist"), false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isModelError(tt.err); got != tt.expected {
+			t.Errorf("isModelError(%v) = %v, expected %v", tt.err, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ModelSource lists the models of a provider in place of its /models endpoint, for providers that don't implement it
+type ModelSource interface {
+	ListModels(ctx context.Context) (*ModelsResponse, error)
+}
+
+// ModelSourceFactory creates a model source from its URL
+type ModelSourceFactory func(source *url.URL) (ModelSource, error)
+
+var (
+	modelSourcesMu sync.RWMutex
+	modelSources   = map[string]ModelSourceFactory{
+		"file": newFileModelSource,
+	}
+)
+
+// RegisterModelSource makes a model source available for models_source URLs with the scheme
+func RegisterModelSource(scheme string, factory ModelSourceFactory) {
+	modelSourcesMu.Lock()
+	defer modelSourcesMu.Unlock()
+	modelSources[strings.ToLower(scheme)] = factory
+}
+
+// newModelSource creates the model source for a models_source URL
+func newModelSource(source string) (ModelSource, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid models_source %q: %w", source, err)
+	}
+
+	modelSourcesMu.RLock()
+	factory, ok := modelSources[strings.ToLower(u.Scheme)]
+	schemes := slices.Sorted(maps.Keys(modelSources))
+	modelSourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported models_source %q, available schemes: %s", source, strings.Join(schemes, ", "))
+	}
+
+	return factory(u)
+}
+
+// fileModelSource reads the models from a JSON file, re-read on every refresh so edits are picked up without a restart
+type fileModelSource struct {
+	path string
+}
+
+// newFileModelSource creates a model source for a file:// URL, file://models.json is relative to the working directory
+func newFileModelSource(source *url.URL) (ModelSource, error) {
+	path := source.Host + source.Path
+	if path == "" {
+		return nil, fmt.Errorf("models_source %q has no file path", source)
+	}
+	return &fileModelSource{path: path}, nil
+}
+
+// ListModels reads the file, either a list of model IDs or a models response as returned by /models
+func (s *fileModelSource) ListModels(ctx context.Context) (*ModelsResponse, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read models file: %w", err)
+	}
+
+	resp := &ModelsResponse{Object: "list"}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var ids []string
+		if err := json.Unmarshal(trimmed, &ids); err != nil {
+			return nil, fmt.Errorf("failed to parse models file %s: %w", s.path, err)
+		}
+		for _, id := range ids {
+			resp.Data = append(resp.Data, Model{ID: id})
+		}
+	} else if err := json.Unmarshal(data, resp); err != nil {
+		return nil, fmt.Errorf("failed to parse models file %s: %w", s.path, err)
+	}
+
+	for i := range resp.Data {
+		if resp.Data[i].Object == "" {
+			resp.Data[i].Object = "model"
+		}
+	}
+	return resp, nil
+}
+
+// listProviderModels lists the models of a provider from its model source when it has one, otherwise from /models
+func listProviderModels(ctx context.Context, provider *Provider) (*ModelsResponse, error) {
+	if provider.ModelSource != nil {
+		return provider.ModelSource.ListModels(ctx)
+	}
+	return provider.Client.ListModelsWithTimeout(ctx)
+}
+
+// checkProviderReachable returns an error if a provider doesn't answer requests. Providers with a model source may
+// not implement /models, so any HTTP response from it counts.
+func checkProviderReachable(ctx context.Context, provider *Provider) error {
+	_, err := provider.Client.ListModelsWithTimeout(ctx)
+	var statusErr *UpstreamStatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFileModelSource tests that a provider's models are listed from a file in place of /models
+func TestFileModelSource(t *testing.T) {
+	dir := t.TempDir()
+	idsFile := filepath.Join(dir, "ids.json")
+	if err := os.WriteFile(idsFile, []byte(`["file-model-a", "file-model-b"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	responseFile := filepath.Join(dir, "models.json")
+	if err := os.WriteFile(responseFile, []byte(`{"object":"list","data":[{"id":"file-model-c","owned_by":"local"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true, ModelsSource: "file://" + idsFile},
+			{Name: "b", BaseURL: "http://b.invalid", Enabled: true, ModelsSource: "file://" + responseFile},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	// The providers have no /models endpoint, so the refresh only succeeds if the files are used
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+	for model, provider := range map[string]string{"file-model-a": "a", "file-model-b": "a", "file-model-c": "b"} {
+		if got, err := router.GetProviderForModel(model); err != nil || got != provider {
+			t.Errorf("Expected %s on provider %s, got %q: %v", model, provider, got, err)
+		}
+	}
+
+	// A missing file fails the refresh of that provider like an unreachable /models
+	os.Remove(responseFile)
+	router.EnableProvider("b")
+	if err := router.RefreshModels(context.Background()); err == nil || !strings.Contains(err.Error(), "b: ") {
+		t.Errorf("Expected the refresh of provider b to fail, got %v", err)
+	}
+}
+
+// TestModelSourceUnsupportedScheme tests that a models_source with an unknown scheme is rejected at startup
+func TestModelSourceUnsupportedScheme(t *testing.T) {
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true, ModelsSource: "ftp://example.com/models.json"},
+		},
+	}
+
+	if _, err := NewRouter(config, &testLogger{}); err == nil || !strings.Contains(err.Error(), "available schemes: file") {
+		t.Errorf("Expected an unsupported models_source error, got %v", err)
+	}
+}
+
+// TestModelSourceProviderRecovery tests that a disabled provider with a model source only recovers once the provider
+// itself answers, even when it doesn't implement /models
+func TestModelSourceProviderRecovery(t *testing.T) {
+	modelsFile := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(modelsFile, []byte(`["file-model"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true, ModelsSource: "file://" + modelsFile},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	client := &MockClient{Err: errors.New("connection refused")}
+	router.Providers["a"].Client = client
+	router.DisableProvider("a", "test")
+
+	healthy := func() bool {
+		router.ProvidersMu.RLock()
+		defer router.ProvidersMu.RUnlock()
+		return router.Providers["a"].Healthy
+	}
+
+	router.checkDisabledProviders()
+	if healthy() {
+		t.Fatal("Expected the provider to stay disabled while it is unreachable")
+	}
+
+	client.Err = &UpstreamStatusError{StatusCode: http.StatusNotFound, Message: "no /models"}
+	router.checkDisabledProviders()
+	if !healthy() {
+		t.Error("Expected the provider to recover once it answers requests")
+	}
+}
@@ -3,42 +3,292 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/paularlott/mcp/pool"
 )
 
+// requestExtrasKey is the context key for request fields that ChatCompletionRequest cannot carry
+type requestExtrasKey struct{}
+
+// withRequestExtras returns a context carrying extra fields to be added to the upstream request body
+func withRequestExtras(ctx context.Context, extras map[string]any) context.Context {
+	return context.WithValue(ctx, requestExtrasKey{}, extras)
+}
+
+// choiceLogprobs returns the logprobs of each choice in a chat completion response body by choice index, they are
+// not carried by ChatCompletionResponse
+func choiceLogprobs(body []byte) map[int]json.RawMessage {
+	var resp struct {
+		Choices []struct {
+			Index    int             `json:"index"`
+			Logprobs json.RawMessage `json:"logprobs"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+
+	logprobs := make(map[int]json.RawMessage)
+	for _, choice := range resp.Choices {
+		if len(choice.Logprobs) > 0 && string(choice.Logprobs) != "null" {
+			logprobs[choice.Index] = choice.Logprobs
+		}
+	}
+	return logprobs
+}
+
+// marshalChatRequest marshals a chat completion request, adding any extra fields from the context
+func marshalChatRequest(ctx context.Context, req *ChatCompletionRequest) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	extras, _ := ctx.Value(requestExtrasKey{}).(map[string]any)
+	if len(extras) == 0 {
+		return body, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range extras {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
+
+// defaultUserAgent is sent to providers that don't configure their own user agent
+const defaultUserAgent = "llmrouter/1.0.0"
+
 type OpenAIClientImpl struct {
-	BaseURL string
-	Token   string
-	Client  *http.Client
-	logger  Logger
+	BaseURL      string
+	Token        string
+	Organization string // Sent as OpenAI-Organization when set
+	Project      string // Sent as OpenAI-Project when set
+	UserAgent    string // Sent as User-Agent on every request
+	Client       *http.Client
+	logger       Logger
+	transport    *http.Transport // the client's own transport when its connections are configured, nil for the shared one
 }
 
 func NewOpenAIClient(baseURL, token string, logger Logger) *OpenAIClientImpl {
 	return &OpenAIClientImpl{
-		BaseURL: baseURL,
-		Token:   token,
-		Client:  pool.GetPool().GetHTTPClient(),
-		logger:  logger,
+		BaseURL:   baseURL,
+		Token:     token,
+		UserAgent: defaultUserAgent,
+		Client:    pool.GetPool().GetHTTPClient(),
+		logger:    logger,
 	}
 }
 
-func (c *OpenAIClientImpl) ListModels(ctx context.Context) (*ModelsResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/models", nil)
+// TLSOptions are the TLS settings of a provider connection
+type TLSOptions struct {
+	ClientCertFile     string // client certificate presented to providers behind mutual TLS, with ClientKeyFile
+	ClientKeyFile      string
+	CAFile             string // CA certificates trusted in place of the system roots
+	InsecureSkipVerify bool   // accept any provider certificate, for self-signed development servers only
+}
+
+// ConfigureTLS applies the TLS options to the client's connections. Unset options are not used, without a CA file
+// the system roots are trusted.
+func (c *OpenAIClientImpl) ConfigureTLS(opts TLSOptions) error {
+	if opts.ClientCertFile == "" && opts.ClientKeyFile == "" && opts.CAFile == "" && !opts.InsecureSkipVerify {
+		return nil
+	}
+
+	transport := c.ownTransport()
+	tlsConfig := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return fmt.Errorf("client_cert_file and client_key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.CAFile != "" {
+		caPEM, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	tlsConfig.InsecureSkipVerify = tlsConfig.InsecureSkipVerify || opts.InsecureSkipVerify
+
+	transport.TLSClientConfig = tlsConfig
+	return nil
+}
+
+// ConfigureProxy sends the client's requests through the proxy URL, or the proxy from the HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY environment variables when empty
+func (c *OpenAIClientImpl) ConfigureProxy(proxyURL string) error {
+	if proxyURL == "" {
+		// The shared transport doesn't read the environment, only clients it would proxy need their own
+		if c.transport != nil || c.environmentProxied() {
+			c.ownTransport().Proxy = http.ProxyFromEnvironment
+		}
+		return nil
+	}
+
+	u, err := url.Parse(proxyURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q, use http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy URL %s has no host", u.Redacted())
 	}
 
+	c.ownTransport().Proxy = http.ProxyURL(u)
+	return nil
+}
+
+// environmentProxied returns true if the proxy environment variables send requests to the client's base URL through
+// a proxy
+func (c *OpenAIClientImpl) environmentProxied() bool {
+	req, err := http.NewRequest("GET", c.BaseURL, nil)
+	if err != nil {
+		return false
+	}
+	proxyURL, err := http.ProxyFromEnvironment(req)
+	return err == nil && proxyURL != nil
+}
+
+// usesProxy returns true if the client's requests to its base URL are sent through a proxy
+func (c *OpenAIClientImpl) usesProxy() bool {
+	transport, ok := c.Client.Transport.(*http.Transport)
+	if c.Client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok || transport.Proxy == nil {
+		return false
+	}
+
+	req, err := http.NewRequest("GET", c.BaseURL, nil)
+	if err != nil {
+		return false
+	}
+	proxyURL, err := transport.Proxy(req)
+	return err == nil && proxyURL != nil
+}
+
+// ownTransport returns a transport used by this client alone, cloned from the shared pool transport on first use
+// so the pool settings still apply
+func (c *OpenAIClientImpl) ownTransport() *http.Transport {
+	if c.transport != nil {
+		return c.transport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if shared, ok := c.Client.Transport.(*http.Transport); ok {
+		transport = shared.Clone()
+		transport.TLSNextProto = nil // Bound to the shared transport, HTTP/2 is set up again for this one
+	}
+	transport.ForceAttemptHTTP2 = true
+
+	c.transport = transport
+	c.Client = &http.Client{Transport: transport, Timeout: c.Client.Timeout}
+	return transport
+}
+
+// setHeaders adds the provider headers and the JSON content type to a request to the provider
+func (c *OpenAIClientImpl) setHeaders(req *http.Request) {
+	c.setProviderHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+}
+
+// setProviderHeaders adds the authentication, organization, project and user agent headers to a request to the provider
+func (c *OpenAIClientImpl) setProviderHeaders(req *http.Request) {
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 	if c.Token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.Token)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if c.Organization != "" {
+		req.Header.Set("OpenAI-Organization", c.Organization)
+	}
+	if c.Project != "" {
+		req.Header.Set("OpenAI-Project", c.Project)
+	}
+}
+
+// hopHeaders apply to a single connection so are not forwarded, Authorization is replaced with the provider's token
+var hopHeaders = []string{
+	"Authorization",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Forward sends a client request to path on the provider unchanged apart from the authentication headers,
+// path is relative to the provider's base URL and the request's query is kept
+func (c *OpenAIClientImpl) Forward(req *http.Request, path string) (*http.Response, error) {
+	url := c.BaseURL + path
+	if req.URL.RawQuery != "" {
+		url += "?" + req.URL.RawQuery
+	}
+
+	httpReq, err := http.NewRequestWithContext(req.Context(), req.Method, url, req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.ContentLength = req.ContentLength
+
+	httpReq.Header = req.Header.Clone()
+	for _, header := range hopHeaders {
+		httpReq.Header.Del(header)
+	}
+	c.setProviderHeaders(httpReq)
+
+	resp, err := c.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *OpenAIClientImpl) ListModels(ctx context.Context) (*ModelsResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(req)
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
@@ -52,16 +302,11 @@ func (c *OpenAIClientImpl) ListModels(ctx context.Context) (*ModelsResponse, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		// Try to parse as error response
-		var errResp map[string]interface{}
-		if json.Unmarshal(body, &errResp) == nil {
-			return nil, fmt.Errorf("API returned status %d: %v", resp.StatusCode, errResp)
-		}
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, upstreamStatusError(resp.StatusCode, body)
 	}
 
-	var modelsResp ModelsResponse
-	if err := json.Unmarshal(body, &modelsResp); err != nil {
+	modelsResp, shape, err := decodeModelsResponse(body)
+	if err != nil {
 		// Log the actual response for debugging
 		maxLen := 500
 		if len(body) < maxLen {
@@ -75,8 +320,27 @@ func (c *OpenAIClientImpl) ListModels(ctx context.Context) (*ModelsResponse, err
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	c.logger.Debug("listed models from provider", "count", len(modelsResp.Data), "base_url", c.BaseURL)
-	return &modelsResp, nil
+	c.logger.Debug("listed models from provider", "count", len(modelsResp.Data), "base_url", c.BaseURL, "shape", shape)
+	return modelsResp, nil
+}
+
+// decodeModelsResponse decodes a model list, accepting both the standard {"data":[...]} object
+// and a bare [...] array returned by some providers. The detected shape is returned for logging.
+func decodeModelsResponse(body []byte) (*ModelsResponse, string, error) {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var models []Model
+		if err := json.Unmarshal(trimmed, &models); err != nil {
+			return nil, "array", err
+		}
+		return &ModelsResponse{Object: "list", Data: models}, "array", nil
+	}
+
+	var modelsResp ModelsResponse
+	if err := json.Unmarshal(body, &modelsResp); err != nil {
+		return nil, "object", err
+	}
+	return &modelsResp, "object", nil
 }
 
 // ListModelsWithTimeout fetches models with a 5-second timeout
@@ -89,24 +353,28 @@ func (c *OpenAIClientImpl) ListModelsWithTimeout(ctx context.Context) (*ModelsRe
 }
 
 func (c *OpenAIClientImpl) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
-	body, err := json.Marshal(req)
+	resp, _, err := c.createChatCompletionBody(ctx, req)
+	return resp, err
+}
+
+// createChatCompletionBody creates a chat completion, also returning the provider's response body for the fields
+// ChatCompletionResponse doesn't carry
+func (c *OpenAIClientImpl) createChatCompletionBody(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, []byte, error) {
+	body, err := marshalChatRequest(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/chat/completions", bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	if c.Token != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
 
 	resp, err := c.Client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -114,21 +382,21 @@ func (c *OpenAIClientImpl) CreateChatCompletion(ctx context.Context, req *ChatCo
 	contentType := resp.Header.Get("Content-Type")
 	if strings.Contains(contentType, "text/event-stream") {
 		// Return error - this method should not be called for streaming requests
-		return nil, fmt.Errorf("streaming request received, use CreateChatCompletionRaw instead")
+		return nil, nil, fmt.Errorf("streaming request received, use CreateChatCompletionRaw instead")
 	}
 
 	body, readErr := io.ReadAll(resp.Body)
 	if readErr != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", readErr)
+		return nil, nil, fmt.Errorf("failed to read response body: %w", readErr)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		// Try to parse as error response
-		var errResp map[string]interface{}
-		if json.Unmarshal(body, &errResp) == nil {
-			return nil, fmt.Errorf("API returned status %d: %v", resp.StatusCode, errResp)
-		}
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, nil, upstreamStatusError(resp.StatusCode, body)
+	}
+
+	// Some providers report failures with a 200 status, fail rather than return an empty completion
+	if err := responseBodyError(resp.StatusCode, body); err != nil {
+		return nil, nil, err
 	}
 
 	var completionResp ChatCompletionResponse
@@ -143,15 +411,48 @@ func (c *OpenAIClientImpl) CreateChatCompletion(ctx context.Context, req *ChatCo
 			"status_code", resp.StatusCode,
 			"content_type", resp.Header.Get("Content-Type"),
 			"response_body", string(body[:maxLen])) // Log first 500 chars
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	c.logger.Debug("chat completion completed", "model", req.Model, "response_id", completionResp.ID)
-	return &completionResp, nil
+	return &completionResp, body, nil
+}
+
+// upstreamStatusError returns the error for a provider response with a non-success status, including the
+// decoded error body when it is JSON
+func upstreamStatusError(statusCode int, body []byte) error {
+	message := string(body)
+	var errResp map[string]interface{}
+	if json.Unmarshal(body, &errResp) == nil {
+		message = fmt.Sprint(errResp)
+	}
+	return &UpstreamStatusError{StatusCode: statusCode, Message: message}
+}
+
+// responseBodyError returns an error if a successful response body carries an error object instead of a result
+func responseBodyError(statusCode int, body []byte) error {
+	var errBody struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &errBody) != nil || len(errBody.Error) == 0 || string(errBody.Error) == "null" {
+		return nil
+	}
+
+	// The error is usually an object with a message but some providers send a plain string
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	var message string
+	if json.Unmarshal(errBody.Error, &apiErr) == nil && apiErr.Message != "" {
+		message = apiErr.Message
+	} else if json.Unmarshal(errBody.Error, &message) != nil {
+		message = string(errBody.Error)
+	}
+	return fmt.Errorf("API returned status %d with an error: %s", statusCode, message)
 }
 
 func (c *OpenAIClientImpl) CreateChatCompletionRaw(ctx context.Context, req *ChatCompletionRequest) (*http.Response, error) {
-	body, err := json.Marshal(req)
+	body, err := marshalChatRequest(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -161,10 +462,7 @@ func (c *OpenAIClientImpl) CreateChatCompletionRaw(ctx context.Context, req *Cha
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	if c.Token != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
 
 	resp, err := c.Client.Do(httpReq)
 	if err != nil {
@@ -185,10 +483,7 @@ func (c *OpenAIClientImpl) CreateEmbedding(ctx context.Context, req *EmbeddingRe
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	if c.Token != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
 
 	resp, err := c.Client.Do(httpReq)
 	if err != nil {
@@ -202,11 +497,7 @@ func (c *OpenAIClientImpl) CreateEmbedding(ctx context.Context, req *EmbeddingRe
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp map[string]interface{}
-		if json.Unmarshal(body, &errResp) == nil {
-			return nil, fmt.Errorf("API returned status %d: %v", resp.StatusCode, errResp)
-		}
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, upstreamStatusError(resp.StatusCode, body)
 	}
 
 	var embeddingResp EmbeddingResponse
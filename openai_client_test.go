@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paularlott/mcp/pool"
+)
+
+// TestListModelsResponseShapes tests that standard and bare array model lists decode to the same models
+func TestListModelsResponseShapes(t *testing.T) {
+	shapes := map[string]string{
+		"object": `{"object":"list","data":[{"id":"model-a","object":"model"},{"id":"model-b","object":"model"}]}`,
+		"array":  `[{"id":"model-a","object":"model"},{"id":"model-b","object":"model"}]`,
+	}
+
+	for shape, body := range shapes {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		}))
+
+		client := NewOpenAIClient(server.URL, "", &testLogger{})
+		resp, err := client.ListModels(context.Background())
+		server.Close()
+
+		if err != nil {
+			t.Errorf("%s: ListModels failed: %v", shape, err)
+			continue
+		}
+		if len(resp.Data) != 2 || resp.Data[0].ID != "model-a" || resp.Data[1].ID != "model-b" {
+			t.Errorf("%s: unexpected models %+v", shape, resp.Data)
+		}
+	}
+}
+
+// TestDecodeModelsResponseInvalid tests that malformed model lists are reported
+func TestDecodeModelsResponseInvalid(t *testing.T) {
+	for _, body := range []string{`not json`, `[{"id":1}]`} {
+		if _, _, err := decodeModelsResponse([]byte(body)); err == nil {
+			t.Errorf("Expected error decoding %q", body)
+		}
+	}
+}
+
+// TestOrganizationAndProjectHeaders tests that a provider's organization and project are sent on every request
+func TestOrganizationAndProjectHeaders(t *testing.T) {
+	var mu sync.Mutex
+	headers := make(map[string]http.Header)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/models") {
+			json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: "chat-model", Object: "model"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Model:   "chat-model",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "hi"}, FinishReason: "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true, Organization: "org-test", Project: "proj-test"},
+		},
+	}
+
+	router := newTestRouter(t, config)
+	if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model:    "chat-model",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	}); err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/models", "/chat/completions"} {
+		h, ok := headers[path]
+		if !ok {
+			t.Errorf("Expected a request to %s", path)
+			continue
+		}
+		if h.Get("OpenAI-Organization") != "org-test" || h.Get("OpenAI-Project") != "proj-test" {
+			t.Errorf("%s: expected organization and project headers, got %q and %q", path, h.Get("OpenAI-Organization"), h.Get("OpenAI-Project"))
+		}
+	}
+}
+
+// TestUserAgentHeader tests that requests to providers carry the default or the provider's configured User-Agent
+func TestUserAgentHeader(t *testing.T) {
+	newUserAgentServer := func(userAgents *[]string, mu *sync.Mutex) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			*userAgents = append(*userAgents, r.Header.Get("User-Agent"))
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: "chat-model", Object: "model"}}})
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	var mu sync.Mutex
+	var defaultAgents, customAgents []string
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "default", BaseURL: newUserAgentServer(&defaultAgents, &mu).URL, Enabled: true},
+			{Name: "custom", BaseURL: newUserAgentServer(&customAgents, &mu).URL, Enabled: true, UserAgent: "acme-gateway/2.0"},
+		},
+	}
+
+	newTestRouter(t, config)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(defaultAgents) != 1 || defaultAgents[0] != "llmrouter/1.0.0" {
+		t.Errorf("Expected the default User-Agent, got %v", defaultAgents)
+	}
+	if len(customAgents) != 1 || customAgents[0] != "acme-gateway/2.0" {
+		t.Errorf("Expected the configured User-Agent, got %v", customAgents)
+	}
+}
+
+// testCert is a generated certificate with its key
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert generates a certificate signed by the parent, or self-signed as a CA when parent is nil
+func newTestCert(t *testing.T, commonName string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// writePEM writes the certificate and key as PEM files, returning their paths
+func (c *testCert) writePEM(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestClientCertificate tests that a client configured for mutual TLS presents its certificate to the provider
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, x509.ExtKeyUsageAny)
+	serverCert := newTestCert(t, "provider", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := newTestCert(t, "llmrouter-client", ca, x509.ExtKeyUsageClientAuth)
+
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	certFile, keyFile := clientCert.writePEM(t, dir, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	var mu sync.Mutex
+	var presented string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		presented = r.TLS.PeerCertificates[0].Subject.CommonName
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[{"id":"mtls-model","object":"model"}]}`))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.der}, PrivateKey: serverCert.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // The refused handshake is expected
+	server.StartTLS()
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL, "", &testLogger{})
+	if err := client.ConfigureTLS(TLSOptions{ClientCertFile: certFile, ClientKeyFile: keyFile, CAFile: caFile}); err != nil {
+		t.Fatalf("ConfigureTLS failed: %v", err)
+	}
+
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models.Data) != 1 || models.Data[0].ID != "mtls-model" {
+		t.Errorf("Expected mtls-model, got %+v", models.Data)
+	}
+	mu.Lock()
+	if presented != "llmrouter-client" {
+		t.Errorf("Expected the client certificate to be presented, got %q", presented)
+	}
+	mu.Unlock()
+
+	// Without the client certificate the provider refuses the connection
+	withoutCert := NewOpenAIClient(server.URL, "", &testLogger{})
+	if err := withoutCert.ConfigureTLS(TLSOptions{CAFile: caFile}); err != nil {
+		t.Fatalf("ConfigureTLS failed: %v", err)
+	}
+	if _, err := withoutCert.ListModels(context.Background()); err == nil {
+		t.Error("Expected the connection to fail without a client certificate")
+	}
+
+	// The certificate and key must be given together
+	if err := NewOpenAIClient(server.URL, "", &testLogger{}).ConfigureTLS(TLSOptions{ClientCertFile: certFile}); err == nil {
+		t.Error("Expected an error for a certificate without its key")
+	}
+}
+
+// TestInsecureSkipVerify tests that a self-signed provider is only reachable with certificate verification disabled
+func TestInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[{"id":"dev-model","object":"model"}]}`))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // The rejected handshake is expected
+	server.StartTLS()
+	defer server.Close()
+
+	verifying := NewOpenAIClient(server.URL, "", &testLogger{})
+	if _, err := verifying.ListModels(context.Background()); err == nil {
+		t.Error("Expected the self-signed certificate to be rejected")
+	}
+
+	insecure := NewOpenAIClient(server.URL, "", &testLogger{})
+	if err := insecure.ConfigureTLS(TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("ConfigureTLS failed: %v", err)
+	}
+	models, err := insecure.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed with verification disabled: %v", err)
+	}
+	if len(models.Data) != 1 || models.Data[0].ID != "dev-model" {
+		t.Errorf("Expected dev-model, got %+v", models.Data)
+	}
+
+	// The setting is per provider, the shared transport still verifies certificates
+	if _, err := NewOpenAIClient(server.URL, "", &testLogger{}).ListModels(context.Background()); err == nil {
+		t.Error("Expected other clients to still reject the self-signed certificate")
+	}
+}
+
+// TestSharedTransportWithoutProxy tests that a client without a proxy or TLS options keeps the shared pool client
+// rather than a transport of its own
+func TestSharedTransportWithoutProxy(t *testing.T) {
+	shared := NewOpenAIClient("http://localhost:1/v1", "", &testLogger{})
+	if err := shared.ConfigureProxy(""); err != nil {
+		t.Fatalf("ConfigureProxy failed: %v", err)
+	}
+	if shared.transport != nil || shared.Client != pool.GetPool().GetHTTPClient() {
+		t.Error("Expected the client to keep the shared transport")
+	}
+
+	proxied := NewOpenAIClient("http://localhost:1/v1", "", &testLogger{})
+	if err := proxied.ConfigureProxy("http://proxy.invalid:3128"); err != nil {
+		t.Fatalf("ConfigureProxy failed: %v", err)
+	}
+	if proxied.transport == nil || !proxied.usesProxy() {
+		t.Error("Expected the proxied client to have its own transport")
+	}
+}
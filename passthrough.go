@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HandlePassthrough proxies a /v1 request the router doesn't handle, e.g. /v1/moderations or /v1/audio/speech,
+// to the configured passthrough provider, keeping the method, body and headers
+func (r *Router) HandlePassthrough(w http.ResponseWriter, req *http.Request) {
+	providerName := r.config.Server.PassthroughProvider
+
+	r.ProvidersMu.RLock()
+	provider, exists := r.Providers[providerName]
+	available := exists && provider.Enabled
+	r.ProvidersMu.RUnlock()
+
+	if !available {
+		writeOpenAIError(w, http.StatusServiceUnavailable, fmt.Sprintf("Passthrough provider '%s' is not available", providerName), "server_error", "provider_unavailable")
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v1")
+	r.logger.Debug("proxying unhandled request", "method", req.Method, "path", req.URL.Path, "provider", providerName)
+
+	resp, err := provider.Client.Forward(req, path)
+	if err != nil {
+		r.logger.WithError(err).Error("passthrough request failed", "path", req.URL.Path, "provider", providerName)
+		writeOpenAIError(w, http.StatusBadGateway, fmt.Sprintf("Passthrough request failed: %v", err), "server_error", "upstream_error")
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	// Flush as data arrives so streamed responses, e.g. audio, reach the client without buffering
+	var dst io.Writer = w
+	if flusher, ok := w.(http.Flusher); ok {
+		dst = flushWriter{w: w, flusher: flusher}
+	}
+	if _, err := io.Copy(dst, resp.Body); err != nil && req.Context().Err() == nil {
+		r.logger.WithError(err).Error("passthrough response interrupted", "path", req.URL.Path, "provider", providerName)
+	}
+}
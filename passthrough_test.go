@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPassthroughModerations tests that an unhandled /v1 request is proxied to the passthrough provider unchanged
+func TestPassthroughModerations(t *testing.T) {
+	var method, path, query, body, auth, custom string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/models") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"object":"list","data":[]}`))
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+		method, path, query, body = r.Method, r.URL.Path, r.URL.RawQuery, string(data)
+		auth, custom = r.Header.Get("Authorization"), r.Header.Get("X-Custom")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream", "moderation")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"modr-1","results":[{"flagged":false}]}`))
+	}))
+	defer upstream.Close()
+
+	config := &Config{
+		Server: ServerConfig{Token: "server-token"},
+		Providers: []ProviderConfig{
+			{Name: "openai", BaseURL: upstream.URL + "/v1", Token: "provider-token", Enabled: true},
+		},
+	}
+
+	// Without a passthrough provider unhandled paths are not found
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/v1/moderations", strings.NewReader(`{"input":"hello"}`))
+	req.Header.Set("Authorization", "Bearer server-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	router.Shutdown()
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without a passthrough provider, got %d", w.Code)
+	}
+
+	config.Server.PassthroughProvider = "openai"
+	router, err = NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	req = httptest.NewRequest("POST", "/v1/moderations?model=omni", strings.NewReader(`{"input":"hello"}`))
+	req.Header.Set("Authorization", "Bearer server-token")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Custom", "kept")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the upstream status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != `{"id":"modr-1","results":[{"flagged":false}]}` || w.Header().Get("X-Upstream") != "moderation" {
+		t.Errorf("Expected the upstream response unchanged, got %s with headers %v", w.Body.String(), w.Header())
+	}
+
+	if method != "POST" || path != "/v1/moderations" || query != "model=omni" || body != `{"input":"hello"}` {
+		t.Errorf("Expected POST /v1/moderations?model=omni with the client body, got %s %s?%s %s", method, path, query, body)
+	}
+	if auth != "Bearer provider-token" {
+		t.Errorf("Expected the provider token upstream, got %q", auth)
+	}
+	if custom != "kept" {
+		t.Errorf("Expected client headers to be forwarded, got X-Custom %q", custom)
+	}
+
+	// The router's own authentication still applies
+	req = httptest.NewRequest("POST", "/v1/moderations", strings.NewReader(`{"input":"hello"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the server token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Pool routing strategies
+const (
+	poolStrategyLeastActive = "least_active" // provider with the fewest active completions (default)
+	poolStrategyRoundRobin  = "round_robin"  // rotate through the pool's providers
+	poolStrategyPriority    = "priority"     // first available provider in the order listed
+)
+
+// poolHeader selects a pool for a request when the model has no pool prefix
+const poolHeader = "X-Provider-Pool"
+
+// providerPool is a named group of providers with its own routing strategy
+type providerPool struct {
+	name      string
+	providers []string // in configured order
+	strategy  string
+	next      uint64 // round robin counter
+}
+
+// newProviderPools builds the pools from config, validating the strategies and that the providers are configured
+func newProviderPools(configs []PoolConfig, providers []ProviderConfig) (map[string]*providerPool, error) {
+	configured := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		configured[provider.Name] = true
+	}
+
+	pools := make(map[string]*providerPool, len(configs))
+	for _, poolConfig := range configs {
+		if poolConfig.Name == "" {
+			return nil, fmt.Errorf("pool name is required")
+		}
+
+		strategy := poolConfig.Strategy
+		if strategy == "" {
+			strategy = poolStrategyLeastActive
+		}
+		switch strategy {
+		case poolStrategyLeastActive, poolStrategyRoundRobin, poolStrategyPriority:
+		default:
+			return nil, fmt.Errorf("pool %s: unknown strategy %s", poolConfig.Name, strategy)
+		}
+
+		for _, name := range poolConfig.Providers {
+			if !configured[name] {
+				return nil, fmt.Errorf("pool %s: unknown provider %s", poolConfig.Name, name)
+			}
+		}
+
+		pools[poolConfig.Name] = &providerPool{
+			name:      poolConfig.Name,
+			providers: poolConfig.Providers,
+			strategy:  strategy,
+		}
+	}
+
+	return pools, nil
+}
+
+// splitPoolModel splits a "pool:model" ID into the pool and model, the prefix is only treated
+// as a pool when it names a configured pool so model IDs such as "llama3:8b" are left alone
+func (r *Router) splitPoolModel(model string) (*providerPool, string) {
+	poolName, poolModel, ok := strings.Cut(model, ":")
+	if !ok {
+		return nil, model
+	}
+
+	if pool, exists := r.pools[poolName]; exists {
+		return pool, poolModel
+	}
+
+	return nil, model
+}
+
+// applyPoolHeader prefixes the model with the pool named in the X-Provider-Pool header, failing if the pool isn't configured
+func (r *Router) applyPoolHeader(poolName, model string) (string, error) {
+	if poolName == "" {
+		return model, nil
+	}
+
+	if pool, _ := r.splitPoolModel(model); pool != nil {
+		return model, nil // Model prefix takes precedence
+	}
+
+	if _, exists := r.pools[poolName]; !exists {
+		return "", fmt.Errorf("unknown provider pool %s in %s header", poolName, poolHeader)
+	}
+
+	return poolName + ":" + model, nil
+}
+
+// members returns the providers from the list that belong to the pool, in pool order
+func (p *providerPool) members(providers []string) []string {
+	members := make([]string, 0, len(providers))
+	for _, poolProvider := range p.providers {
+		for _, providerName := range providers {
+			if providerName == poolProvider {
+				members = append(members, providerName)
+				break
+			}
+		}
+	}
+	return members
+}
+
+// selectFromPool picks a provider using the pool's round robin or priority strategy.
+// The caller must hold ProvidersMu.
+func (r *Router) selectFromPool(pool *providerPool, providers []string) string {
+	candidates := make([]string, 0, len(providers))
+	for _, providerName := range providers {
+		if provider, exists := r.Providers[providerName]; exists && provider.Enabled {
+			candidates = append(candidates, providerName)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	if pool.strategy == poolStrategyRoundRobin {
+		next := atomic.AddUint64(&pool.next, 1) - 1
+		return candidates[next%uint64(len(candidates))]
+	}
+
+	return candidates[0]
+}
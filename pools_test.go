@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestPoolRoutingStrategies tests routing to two pools with different strategies via model prefix and header
+func TestPoolRoutingStrategies(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"shared-model"}, nil, &callsA)
+	serverB := newChatServer(t, []string{"shared-model"}, nil, &callsB)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+		Pools: []PoolConfig{
+			{Name: "fast", Providers: []string{"b", "a"}, Strategy: "priority"},
+			{Name: "spread", Providers: []string{"a", "b"}, Strategy: "round_robin"},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	// Priority pool selected by model prefix always uses its first provider
+	for i := 0; i < 4; i++ {
+		req := &ChatCompletionRequest{Model: "fast:shared-model", Messages: []Message{{Role: "user", Content: "hi"}}}
+		resp, err := router.CreateChatCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CreateChatCompletion failed: %v", err)
+		}
+		if resp.Model != "shared-model" {
+			t.Errorf("Expected pool prefix to be stripped upstream, provider saw model %q", resp.Model)
+		}
+	}
+	if callsA != 0 || callsB != 4 {
+		t.Errorf("Expected priority pool to send all 4 requests to b, got a=%d b=%d", callsA, callsB)
+	}
+
+	// Round robin pool selected by header alternates between providers
+	atomic.StoreInt64(&callsA, 0)
+	atomic.StoreInt64(&callsB, 0)
+	for i := 0; i < 4; i++ {
+		body := `{"model":"shared-model","messages":[{"role":"user","content":"hi"}]}`
+		httpReq := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		httpReq.Header.Set(poolHeader, "spread")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp ChatCompletionResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Model != "shared-model" {
+			t.Errorf("Expected upstream model 'shared-model', got %q", resp.Model)
+		}
+	}
+	if callsA != 2 || callsB != 2 {
+		t.Errorf("Expected round robin pool to split requests evenly, got a=%d b=%d", callsA, callsB)
+	}
+
+	// An unknown pool in the header is a client error naming the pool, for chat and embeddings
+	for _, path := range []string{"/v1/chat/completions", "/v1/embeddings"} {
+		body := `{"model":"shared-model","input":"hi","messages":[{"role":"user","content":"hi"}]}`
+		httpReq := httptest.NewRequest("POST", path, strings.NewReader(body))
+		httpReq.Header.Set(poolHeader, "missing")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown provider pool missing") {
+			t.Errorf("%s: expected 400 naming the unknown pool, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestPoolModelPrefix tests that only configured pool names are treated as prefixes
+func TestPoolModelPrefix(t *testing.T) {
+	router := &Router{pools: map[string]*providerPool{"fast": {name: "fast"}}}
+
+	if pool, model := router.splitPoolModel("fast:gpt-4"); pool == nil || model != "gpt-4" {
+		t.Errorf("Expected pool 'fast' and model 'gpt-4', got %v, %q", pool, model)
+	}
+	if pool, model := router.splitPoolModel("llama3:8b"); pool != nil || model != "llama3:8b" {
+		t.Errorf("Expected no pool for 'llama3:8b', got %v, %q", pool, model)
+	}
+}
+
+// TestPoolUnknownStrategy tests that an unknown pool strategy is rejected
+func TestPoolUnknownStrategy(t *testing.T) {
+	if _, err := newProviderPools([]PoolConfig{{Name: "bad", Strategy: "random"}}, nil); err == nil {
+		t.Error("Expected error for unknown pool strategy")
+	}
+}
+
+// TestPoolUnknownProvider tests that a pool listing a provider that isn't configured is rejected
+func TestPoolUnknownProvider(t *testing.T) {
+	providers := []ProviderConfig{{Name: "openai"}, {Name: "local"}}
+	if _, err := newProviderPools([]PoolConfig{{Name: "fast", Providers: []string{"openai", "local"}}}, providers); err != nil {
+		t.Errorf("Expected configured providers to be accepted, got %v", err)
+	}
+
+	_, err := newProviderPools([]PoolConfig{{Name: "fast", Providers: []string{"openai", "lcoal"}}}, providers)
+	if err == nil || !strings.Contains(err.Error(), "unknown provider lcoal") {
+		t.Errorf("Expected an unknown provider error, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// errPromptLimit is returned when a chat completion or response request exceeds the configured message or prompt size caps
+var errPromptLimit = errors.New("request exceeds the prompt limits")
+
+// checkPromptLimits returns an error wrapping errPromptLimit if the request has more messages or prompt characters
+// than configured, caps of 0 are not checked
+func (r *Router) checkPromptLimits(req *ChatCompletionRequest) error {
+	if r.config == nil {
+		return nil
+	}
+
+	if limit := r.config.Server.MaxMessages; limit > 0 && len(req.Messages) > limit {
+		return fmt.Errorf("%w: %d messages, the maximum is %d", errPromptLimit, len(req.Messages), limit)
+	}
+
+	if limit := r.config.Server.MaxPromptChars; limit > 0 {
+		chars := 0
+		for _, msg := range req.Messages {
+			chars += contentChars(msg.Content)
+		}
+		if chars > limit {
+			return fmt.Errorf("%w: %d prompt characters, the maximum is %d", errPromptLimit, chars, limit)
+		}
+	}
+
+	return nil
+}
+
+// contentChars returns the number of characters of text in message content, either a string or a list of parts
+func contentChars(content any) int {
+	switch c := content.(type) {
+	case string:
+		return utf8.RuneCountInString(c)
+	case []any:
+		chars := 0
+		for _, part := range c {
+			if p, ok := part.(map[string]any); ok {
+				if text, ok := p["text"].(string); ok {
+					chars += utf8.RuneCountInString(text)
+				}
+			}
+		}
+		return chars
+	default:
+		return 0
+	}
+}
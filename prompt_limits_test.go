@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPromptLimits tests that requests over the message count or prompt character caps are rejected before routing
+func TestPromptLimits(t *testing.T) {
+	config := &Config{
+		Server: ServerConfig{MaxMessages: 3, MaxPromptChars: 20},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	client := &MockClient{Models: []string{"chat-model"}}
+	router.Providers["a"].Client = client
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"within limits", `{"model":"chat-model","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hello"}]}`, http.StatusOK},
+		{"too many messages", `{"model":"chat-model","messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"},{"role":"assistant","content":"d"}]}`, http.StatusBadRequest},
+		{"too many messages streamed", `{"model":"chat-model","stream":true,"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"},{"role":"assistant","content":"d"}]}`, http.StatusBadRequest},
+		{"too many characters", `{"model":"chat-model","messages":[{"role":"user","content":"This prompt is longer than twenty characters"}]}`, http.StatusBadRequest},
+		{"too many characters streamed", `{"model":"chat-model","stream":true,"messages":[{"role":"user","content":"This prompt is longer than twenty characters"}]}`, http.StatusBadRequest},
+		{"too many characters in parts", `{"model":"chat-model","messages":[{"role":"user","content":[{"type":"text","text":"Twelve chars"},{"type":"text","text":"and twelve more"}]}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		before := len(client.Requests())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body)))
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.expected, w.Code, w.Body.String())
+		}
+		if tt.expected == http.StatusBadRequest {
+			if !strings.Contains(w.Body.String(), "prompt_too_large") {
+				t.Errorf("%s: expected a prompt_too_large error, got %s", tt.name, w.Body.String())
+			}
+			if requests := len(client.Requests()) - before; requests != 0 {
+				t.Errorf("%s: expected the request not to reach the provider, got %d requests", tt.name, requests)
+			}
+		}
+	}
+}
+
+// TestPromptLimitsResponses tests that a response whose instructions and input exceed the caps is rejected before
+// it is created
+func TestPromptLimitsResponses(t *testing.T) {
+	config := &Config{
+		Server: ServerConfig{MaxMessages: 2, MaxPromptChars: 20},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	client := &MockClient{Models: []string{"chat-model"}}
+	router.Providers["a"].Client = client
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"within limits", `{"model":"chat-model","instructions":"Be brief","input":["Hello"]}`, http.StatusCreated},
+		{"too many messages", `{"model":"chat-model","instructions":"Be brief","input":["a","b"]}`, http.StatusBadRequest},
+		{"too many characters", `{"model":"chat-model","input":["This prompt is longer than twenty characters"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		before := len(client.Requests())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(tt.body)))
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.expected, w.Code, w.Body.String())
+		}
+		if tt.expected == http.StatusBadRequest {
+			if !strings.Contains(w.Body.String(), "prompt_too_large") {
+				t.Errorf("%s: expected a prompt_too_large error, got %s", tt.name, w.Body.String())
+			}
+			if requests := len(client.Requests()) - before; requests != 0 {
+				t.Errorf("%s: expected the request not to reach the provider, got %d requests", tt.name, requests)
+			}
+		}
+	}
+}
+
+// TestPromptLimitsOnlyForClients tests that completions the router makes itself, such as for the MCP tool loop and
+// the history the Responses API adds, are not held to the prompt limits
+func TestPromptLimitsOnlyForClients(t *testing.T) {
+	config := &Config{
+		Server: ServerConfig{MaxMessages: 1, MaxPromptChars: 5},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	router.Providers["a"].Client = &MockClient{Models: []string{"chat-model"}}
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	_, err = router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model: "chat-model",
+		Messages: []Message{
+			{Role: "user", Content: "What is the weather?"},
+			{Role: "assistant", Content: "Let me check."},
+		},
+	})
+	if err != nil {
+		t.Errorf("Expected the completion to ignore the prompt limits, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// providerOverrideHeader pins a request to a named provider, overriding load balancing, when enabled in the config
+const providerOverrideHeader = "X-LLMRouter-Provider"
+
+// errProviderOverride is returned when the provider named in the override header can't serve the requested model
+var errProviderOverride = errors.New("provider override not available for model")
+
+// providerOverrideKey is the context key for the provider a request is pinned to
+type providerOverrideKey struct{}
+
+// withProviderOverride returns a context pinning the request to the named provider
+func withProviderOverride(ctx context.Context, provider string) context.Context {
+	return context.WithValue(ctx, providerOverrideKey{}, provider)
+}
+
+// providerOverride returns the provider the request is pinned to, empty when it isn't pinned
+func providerOverride(ctx context.Context) string {
+	provider, _ := ctx.Value(providerOverrideKey{}).(string)
+	return provider
+}
+
+// applyProviderOverrideHeader returns the context pinned to the provider named in the request's override header,
+// the header is ignored unless provider overrides are enabled
+func (r *Router) applyProviderOverrideHeader(ctx context.Context, req *http.Request) context.Context {
+	if r.config == nil || !r.config.Server.ProviderOverride {
+		return ctx
+	}
+	if provider := req.Header.Get(providerOverrideHeader); provider != "" {
+		return withProviderOverride(ctx, provider)
+	}
+	return ctx
+}
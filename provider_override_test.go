@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestProviderOverrideHeader tests that the override header pins requests to a provider serving the model
+func TestProviderOverrideHeader(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var callsA, callsB, callsC int64
+		serverA := newChatServer(t, []string{"shared-model"}, nil, &callsA)
+		serverB := newChatServer(t, []string{"shared-model"}, nil, &callsB)
+		serverC := newChatServer(t, []string{"other-model"}, nil, &callsC)
+
+		config := &Config{
+			Server: ServerConfig{ProviderOverride: enabled},
+			Providers: []ProviderConfig{
+				{Name: "a", BaseURL: serverA.URL, Enabled: true},
+				{Name: "b", BaseURL: serverB.URL, Enabled: true},
+				{Name: "c", BaseURL: serverC.URL, Enabled: true},
+			},
+		}
+
+		router := newTestRouter(t, config)
+
+		complete := func(provider string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(map[string]any{
+				"model":    "shared-model",
+				"messages": []map[string]any{{"role": "user", "content": "hello"}},
+			})
+			req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+			req.Header.Set(providerOverrideHeader, provider)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		for i := 0; i < 3; i++ {
+			if w := complete("b"); w.Code != http.StatusOK {
+				t.Fatalf("Expected 200 pinning to b, got %d: %s", w.Code, w.Body.String())
+			}
+		}
+
+		w := complete("c")
+		if !enabled {
+			// The header is ignored, so the request is load balanced as normal
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected the header to be ignored when disabled, got %d: %s", w.Code, w.Body.String())
+			}
+			continue
+		}
+
+		if callsB != 3 || callsA != 0 {
+			t.Errorf("Expected all pinned requests on b, got a=%d b=%d", callsA, callsB)
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 pinning to a provider without the model, got %d: %s", w.Code, w.Body.String())
+		}
+		if callsC != 0 {
+			t.Errorf("Expected no requests to c, got %d", callsC)
+		}
+	}
+}
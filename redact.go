@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactFields are log field names whose values are always redacted
+var defaultRedactFields = []string{"authorization", "token", "api_key", "password", "secret"}
+
+// bearerTokenPattern matches bearer credentials such as those in an Authorization header
+var bearerTokenPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+
+// redactingLogger wraps a logger and removes secrets from messages and fields before they are logged,
+// provider tokens are replaced wherever they appear and sensitive fields are replaced entirely
+type redactingLogger struct {
+	Logger
+	secrets      []string
+	fields       map[string]bool
+	jsonPatterns []*regexp.Regexp // match sensitive fields inside logged JSON bodies
+}
+
+// newRedactingLogger returns a logger that redacts the given secrets and the values of sensitive fields
+func newRedactingLogger(logger Logger, secrets []string, redactFields []string) *redactingLogger {
+	l := &redactingLogger{
+		Logger: logger,
+		fields: make(map[string]bool),
+	}
+
+	for _, secret := range secrets {
+		if secret != "" {
+			l.secrets = append(l.secrets, secret)
+		}
+	}
+
+	for _, field := range append(defaultRedactFields, redactFields...) {
+		field = strings.ToLower(field)
+		if field == "" || l.fields[field] {
+			continue
+		}
+		l.fields[field] = true
+		l.jsonPatterns = append(l.jsonPatterns, regexp.MustCompile(`(?i)("`+regexp.QuoteMeta(field)+`"\s*:\s*)"[^"]*"`))
+	}
+
+	return l
+}
+
+// redact removes secrets from a string
+func (l *redactingLogger) redact(s string) string {
+	for _, secret := range l.secrets {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	s = bearerTokenPattern.ReplaceAllString(s, "${1}"+redactedValue)
+	for _, pattern := range l.jsonPatterns {
+		s = pattern.ReplaceAllString(s, `${1}"`+redactedValue+`"`)
+	}
+	return s
+}
+
+// redactValue redacts a field value. Values of sensitive fields are replaced, others are only converted to strings and
+// checked for secrets when the entry is written, so calls below the log level don't pay for it.
+func (l *redactingLogger) redactValue(key any, value any) any {
+	if name, ok := key.(string); ok && l.fields[strings.ToLower(name)] {
+		return redactedValue
+	}
+
+	switch value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, time.Duration, time.Time:
+		return value // Can't hold a secret
+	default:
+		return lazyRedactedValue{logger: l, value: value}
+	}
+}
+
+// lazyRedactedValue is a logged value that is checked for secrets when it is formatted
+type lazyRedactedValue struct {
+	logger *redactingLogger
+	value  any
+}
+
+// redacted returns the value as text with secrets removed, and whether it held any
+func (v lazyRedactedValue) redacted() (string, bool) {
+	var s string
+	switch value := v.value.(type) {
+	case string:
+		s = value
+	case error:
+		s = value.Error()
+	default:
+		s = fmt.Sprint(value)
+	}
+
+	redacted := v.logger.redact(s)
+	return redacted, redacted != s
+}
+
+func (v lazyRedactedValue) String() string {
+	s, _ := v.redacted()
+	return s
+}
+
+// LogValue keeps the original value for structured output unless it had to be redacted
+func (v lazyRedactedValue) LogValue() slog.Value {
+	if s, changed := v.redacted(); changed {
+		return slog.StringValue(s)
+	}
+	return slog.AnyValue(v.value)
+}
+
+// redactArgs redacts the key/value pairs passed to a log call
+func (l *redactingLogger) redactArgs(args []any) []any {
+	redacted := make([]any, len(args))
+	for i := 0; i < len(args); i += 2 {
+		redacted[i] = args[i]
+		if i+1 < len(args) {
+			redacted[i+1] = l.redactValue(args[i], args[i+1])
+		}
+	}
+	return redacted
+}
+
+// wrap returns a redacting logger sharing this logger's rules
+func (l *redactingLogger) wrap(logger Logger) Logger {
+	return &redactingLogger{
+		Logger:       logger,
+		secrets:      l.secrets,
+		fields:       l.fields,
+		jsonPatterns: l.jsonPatterns,
+	}
+}
+
+func (l *redactingLogger) Trace(msg string, args ...any) {
+	l.Logger.Trace(l.redact(msg), l.redactArgs(args)...)
+}
+
+func (l *redactingLogger) Debug(msg string, args ...any) {
+	l.Logger.Debug(l.redact(msg), l.redactArgs(args)...)
+}
+
+func (l *redactingLogger) Info(msg string, args ...any) {
+	l.Logger.Info(l.redact(msg), l.redactArgs(args)...)
+}
+
+func (l *redactingLogger) Warn(msg string, args ...any) {
+	l.Logger.Warn(l.redact(msg), l.redactArgs(args)...)
+}
+
+func (l *redactingLogger) Error(msg string, args ...any) {
+	l.Logger.Error(l.redact(msg), l.redactArgs(args)...)
+}
+
+func (l *redactingLogger) Fatal(msg string, args ...any) {
+	l.Logger.Fatal(l.redact(msg), l.redactArgs(args)...)
+}
+
+func (l *redactingLogger) With(key string, value any) Logger {
+	return l.wrap(l.Logger.With(key, l.redactValue(key, value)))
+}
+
+func (l *redactingLogger) WithError(err error) Logger {
+	if err != nil {
+		if redacted := l.redact(err.Error()); redacted != err.Error() {
+			err = fmt.Errorf("%s", redacted)
+		}
+	}
+	return l.wrap(l.Logger.WithError(err))
+}
+
+func (l *redactingLogger) WithGroup(group string) Logger {
+	return l.wrap(l.Logger.WithGroup(group))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger writes every log call, at all levels, to a buffer
+type recordingLogger struct {
+	testLogger
+	mu  sync.Mutex
+	out strings.Builder
+}
+
+func (l *recordingLogger) record(level, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(&l.out, "%s %s %v\n", level, msg, args)
+}
+
+func (l *recordingLogger) Trace(msg string, args ...interface{}) { l.record("TRACE", msg, args...) }
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg, args...) }
+func (l *recordingLogger) WithError(err error) Logger {
+	l.record("WITH_ERROR", err.Error())
+	return l
+}
+
+func (l *recordingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.String()
+}
+
+// TestProviderTokenRedacted tests that provider tokens never appear in log output
+func TestProviderTokenRedacted(t *testing.T) {
+	const token = "sk-test-secret-token-123"
+
+	// Provider that echoes the Authorization header and a configured sensitive field in an undecodable body
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"auth":"%s","session_key":"abc123"`, r.Header.Get("Authorization"))
+	}, "chat-model")
+
+	config := &Config{
+		Logging: LoggingConfig{Level: "trace", RedactFields: []string{"session_key"}},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Token: token, Enabled: true},
+		},
+	}
+
+	logger := &recordingLogger{}
+	router, err := NewRouter(config, logger)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	req := &ChatCompletionRequest{Model: "chat-model", Messages: []Message{{Role: "user", Content: "hi"}}}
+	if _, err := router.CreateChatCompletion(context.Background(), req); err == nil {
+		t.Fatalf("Expected decode error from the provider")
+	}
+
+	router.logger.Trace("provider token "+token, "token", token, "header", "Bearer "+token, "error", fmt.Errorf("failed with %s", token))
+	router.logger.WithError(fmt.Errorf("request with %s failed", token)).Error("request failed")
+
+	output := logger.String()
+	if !strings.Contains(output, "response_body") {
+		t.Fatalf("Expected the provider response body to be logged, got %q", output)
+	}
+	if strings.Contains(output, token) {
+		t.Errorf("Expected provider token to be redacted, got %q", output)
+	}
+	if strings.Contains(output, "abc123") {
+		t.Errorf("Expected configured sensitive field to be redacted, got %q", output)
+	}
+	if !strings.Contains(output, redactedValue) {
+		t.Errorf("Expected redaction marker in log output, got %q", output)
+	}
+}
+
+// countingValue counts how many times it is formatted for a log entry
+type countingValue struct {
+	formatted *int
+}
+
+func (v countingValue) String() string {
+	*v.formatted++
+	return "value"
+}
+
+// TestRedactionSecretsAndLaziness tests that MCP remote server and admin tokens are redacted, and that logged values
+// are only formatted when an entry is written
+func TestRedactionSecretsAndLaziness(t *testing.T) {
+	const mcpToken = "mcp-remote-secret-456"
+	const adminToken = "admin-secret-789"
+
+	config := &Config{
+		Server: ServerConfig{AdminToken: adminToken},
+		MCP: MCPConfig{
+			RemoteServers: []MCPRemoteServerConfig{{Namespace: "remote", URL: "http://mcp.invalid", Token: mcpToken}},
+		},
+	}
+
+	logger := &recordingLogger{}
+	router, err := NewRouter(config, logger)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	router.logger.Info("remote call", "detail", "sent "+mcpToken, "admin", []string{adminToken})
+	output := logger.String()
+	if strings.Contains(output, mcpToken) || strings.Contains(output, adminToken) {
+		t.Errorf("Expected the MCP remote server and admin tokens to be redacted, got %q", output)
+	}
+
+	// A logger that drops entries never formats their values
+	var formatted int
+	quiet := newRedactingLogger(&testLogger{}, []string{"secret"}, nil)
+	quiet.Debug("dropped", "value", countingValue{&formatted}, "count", 3)
+	if formatted != 0 {
+		t.Errorf("Expected values not to be formatted for a dropped entry, formatted %d times", formatted)
+	}
+
+	quiet = newRedactingLogger(&recordingLogger{}, []string{"secret"}, nil)
+	quiet.Debug("written", "value", countingValue{&formatted})
+	if formatted != 1 {
+		t.Errorf("Expected the value to be formatted once when written, formatted %d times", formatted)
+	}
+}
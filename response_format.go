@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// responseFormatSchema returns the JSON schema from a json_schema response_format, nil for any other format
+func responseFormatSchema(responseFormat json.RawMessage) map[string]any {
+	if len(responseFormat) == 0 {
+		return nil
+	}
+
+	var format struct {
+		Type       string `json:"type"`
+		JSONSchema struct {
+			Schema map[string]any `json:"schema"`
+		} `json:"json_schema"`
+	}
+	if json.Unmarshal(responseFormat, &format) != nil || format.Type != "json_schema" {
+		return nil
+	}
+	return format.JSONSchema.Schema
+}
+
+// validateResponseSchema checks that the content of the first choice is JSON conforming to the schema
+func validateResponseSchema(resp *ChatCompletionResponse, schema map[string]any) error {
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("response has no choices")
+	}
+	content, ok := resp.Choices[0].Message.Content.(string)
+	if !ok {
+		return fmt.Errorf("response content is not text")
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	return validateJSONSchema(schema, value, "$")
+}
+
+// validateJSONSchema checks a decoded JSON value against the subset of JSON schema used by structured outputs:
+// type, enum, properties, required, additionalProperties and items. Other keywords are not checked.
+func validateJSONSchema(schema map[string]any, value any, path string) error {
+	if schemaType, ok := schema["type"]; ok && !matchesSchemaType(schemaType, value) {
+		return fmt.Errorf("%s: expected %v", path, schemaType)
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		encoded, _ := json.Marshal(value)
+		if !slices.ContainsFunc(enum, func(allowed any) bool {
+			allowedEncoded, _ := json.Marshal(allowed)
+			return string(allowedEncoded) == string(encoded)
+		}) {
+			return fmt.Errorf("%s: %s is not one of the allowed values", path, encoded)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if key, _ := name.(string); key != "" {
+					if _, exists := v[key]; !exists {
+						return fmt.Errorf("%s: missing required property %s", path, key)
+					}
+				}
+			}
+		}
+		for key, field := range v {
+			fieldSchema, declared := properties[key].(map[string]any)
+			if !declared {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: unexpected property %s", path, key)
+				}
+				continue
+			}
+			if err := validateJSONSchema(fieldSchema, field, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchesSchemaType returns true if the value has the schema type, or one of the types when given a list
+func matchesSchemaType(schemaType any, value any) bool {
+	if types, ok := schemaType.([]any); ok {
+		return slices.ContainsFunc(types, func(t any) bool {
+			return matchesSchemaType(t, value)
+		})
+	}
+
+	name, _ := schemaType.(string)
+	switch v := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case float64:
+		return name == "number" || (name == "integer" && v == math.Trunc(v))
+	case []any:
+		return name == "array"
+	case map[string]any:
+		return name == "object"
+	default:
+		return false
+	}
+}
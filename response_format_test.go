@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestResponseFormatJSONSchema tests that response_format reaches the provider and, with validation enabled, a
+// response not matching the schema is retried once
+func TestResponseFormatJSONSchema(t *testing.T) {
+	responseFormat := `{"type":"json_schema","json_schema":{"name":"person","strict":true,"schema":{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}},"required":["name","age"],"additionalProperties":false}}}`
+
+	for _, validate := range []bool{false, true} {
+		var mu sync.Mutex
+		var formats []string
+		server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			var req struct {
+				ResponseFormat json.RawMessage `json:"response_format"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+
+			mu.Lock()
+			formats = append(formats, string(req.ResponseFormat))
+			attempt := len(formats)
+			mu.Unlock()
+
+			// The first answer is missing the age, the retry conforms
+			content := `{"name":"Ada"}`
+			if attempt > 1 {
+				content = `{"name":"Ada","age":36}`
+			}
+			json.NewEncoder(w).Encode(ChatCompletionResponse{
+				ID:      "chatcmpl-test",
+				Object:  "chat.completion",
+				Model:   "json-model",
+				Choices: []Choice{{Message: Message{Role: "assistant", Content: content}}},
+			})
+		}, "json-model")
+
+		config := &Config{
+			Server: ServerConfig{ValidateResponseSchema: validate},
+			Providers: []ProviderConfig{
+				{Name: "a", BaseURL: server.URL, Enabled: true},
+			},
+		}
+
+		router := newTestRouter(t, config)
+
+		body := `{"model":"json-model","messages":[{"role":"user","content":"Who?"}],"response_format":` + responseFormat + `}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, format := range formats {
+			if format != responseFormat {
+				t.Errorf("Expected response_format to reach the provider intact, got %s", format)
+			}
+		}
+
+		expectedCalls, expectedContent := 1, `{\"name\":\"Ada\"}`
+		if validate {
+			expectedCalls, expectedContent = 2, `{\"name\":\"Ada\",\"age\":36}`
+		}
+		if len(formats) != expectedCalls {
+			t.Errorf("Validation %v: expected %d provider calls, got %d", validate, expectedCalls, len(formats))
+		}
+		if !strings.Contains(w.Body.String(), expectedContent) {
+			t.Errorf("Validation %v: expected content %s, got %s", validate, expectedContent, w.Body.String())
+		}
+	}
+}
+
+// TestResponseFormatRetryRoute tests that when a schema retry is served by another provider, the route reported for
+// the request is the retry's rather than the rejected first attempt's
+func TestResponseFormatRetryRoute(t *testing.T) {
+	responseFormat := `{"type":"json_schema","json_schema":{"name":"person","schema":{"type":"object","required":["age"]}}}`
+
+	var mu sync.Mutex
+	var served []string
+	newServer := func(name string) *httptest.Server {
+		return newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			served = append(served, name)
+			attempt := len(served)
+			mu.Unlock()
+
+			// The first answer is missing the age, the retry conforms
+			content := `{"name":"Ada"}`
+			if attempt > 1 {
+				content = `{"name":"Ada","age":36}`
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ChatCompletionResponse{
+				ID:      "chatcmpl-test",
+				Object:  "chat.completion",
+				Model:   "json-model",
+				Choices: []Choice{{Message: Message{Role: "assistant", Content: content}}},
+			})
+		}, "json-model")
+	}
+
+	config := &Config{
+		Server: ServerConfig{ValidateResponseSchema: true},
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: newServer("a").URL, Enabled: true},
+			{Name: "b", BaseURL: newServer("b").URL, Enabled: true},
+		},
+	}
+	router := newTestRouter(t, config)
+
+	body := `{"model":"json-model","messages":[{"role":"user","content":"Who?"}],"response_format":` + responseFormat + `}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req = req.WithContext(WithRouteContext(req.Context()))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(served) != 2 || served[0] == served[1] {
+		t.Fatalf("Expected the retry to be served by the other provider, got %v", served)
+	}
+	if provider := ProviderFromContext(req.Context()); provider != served[1] {
+		t.Errorf("Expected the route of the retry %q, got %q", served[1], provider)
+	}
+}
+
+// TestValidateJSONSchema tests the schema keywords checked on structured outputs
+func TestValidateJSONSchema(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"status": map[string]any{"type": "string", "enum": []any{"ok", "error"}},
+			"tags":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"count":  map[string]any{"type": []any{"integer", "null"}},
+		},
+		"required":             []any{"status"},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{`{"status":"ok","tags":["a","b"],"count":3}`, true},
+		{`{"status":"ok","count":null}`, true},
+		{`{"tags":[]}`, false},
+		{`{"status":"maybe"}`, false},
+		{`{"status":"ok","tags":[1]}`, false},
+		{`{"status":"ok","count":1.5}`, false},
+		{`{"status":"ok","extra":true}`, false},
+		{`["ok"]`, false},
+	}
+	for _, tt := range tests {
+		var value any
+		json.Unmarshal([]byte(tt.value), &value)
+		if err := validateJSONSchema(schema, value, "$"); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.value, tt.valid, err)
+		}
+	}
+}
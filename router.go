@@ -2,29 +2,98 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/paularlott/llmrouter/internal/conversations"
 	"github.com/paularlott/llmrouter/internal/responses"
+	"github.com/paularlott/llmrouter/internal/storage"
 	"github.com/paularlott/llmrouter/middleware"
 	"github.com/paularlott/mcp/openai"
+	"golang.org/x/sync/errgroup"
 )
 
 func NewRouter(config *Config, logger Logger) (*Router, error) {
+	// Resolve provider tokens up front so they can be redacted from everything that is logged
+	tokens := make(map[string]string, len(config.Providers))
+	secrets := []string{config.Server.Token}
+	for _, providerConfig := range config.Providers {
+		if !providerConfig.Enabled {
+			continue
+		}
+
+		token, err := resolveProviderToken(providerConfig)
+		if err != nil {
+			return nil, err
+		}
+		tokens[providerConfig.Name] = token
+		secrets = append(secrets, token)
+	}
+	secrets = append(secrets, config.Server.AdminToken)
+	for _, remoteServer := range config.MCP.RemoteServers {
+		secrets = append(secrets, remoteServer.Token)
+	}
+	logger = newRedactingLogger(logger, secrets, config.Logging.RedactFields)
+
 	router := &Router{
-		Providers:    make(map[string]*Provider),
-		ModelMap:     make(map[string][]string),
-		config:       config,
-		logger:       logger,
-		shutdownChan: make(chan struct{}),
+		Providers:     make(map[string]*Provider),
+		ModelMap:      make(map[string][]string),
+		knownModels:   make(map[string][]string),
+		modelCircuits: newModelCircuits(),
+		config:        config,
+		logger:        logger,
+		shutdownChan:  make(chan struct{}),
+	}
+
+	idempotencyTTL := defaultIdempotencyTTL
+	if config.Server.IdempotencyTTL > 0 {
+		idempotencyTTL = time.Duration(config.Server.IdempotencyTTL) * time.Second
+	}
+	router.idempotency = newIdempotencyCache(idempotencyTTL)
+
+	if config.SessionAffinity.Enabled {
+		sessionTTL := defaultSessionTTL
+		if config.SessionAffinity.TTL > 0 {
+			sessionTTL = time.Duration(config.SessionAffinity.TTL) * time.Second
+		}
+		maxSessions := defaultMaxSessions
+		if config.SessionAffinity.MaxSessions > 0 {
+			maxSessions = config.SessionAffinity.MaxSessions
+		}
+		router.sessions = newSessionAffinity(sessionTTL, maxSessions)
+	}
+
+	if config.Logging.ShutdownStats {
+		router.stats = newProviderStats()
+	}
+	if config.ModelCache.TTL > 0 {
+		router.modelLists = newModelListCache(time.Duration(config.ModelCache.TTL) * time.Second)
+	}
+
+	pools, err := newProviderPools(config.Pools, config.Providers)
+	if err != nil {
+		return nil, err
 	}
+	router.pools = pools
 
 	// Initialize providers
 	for _, providerConfig := range config.Providers {
@@ -32,19 +101,47 @@ func NewRouter(config *Config, logger Logger) (*Router, error) {
 			continue
 		}
 
+		token := tokens[providerConfig.Name]
+		client := NewOpenAIClient(providerConfig.BaseURL, token, logger)
+		client.Organization = providerConfig.Organization
+		client.Project = providerConfig.Project
+		if providerConfig.UserAgent != "" {
+			client.UserAgent = providerConfig.UserAgent
+		}
+		if providerConfig.InsecureSkipVerify {
+			logger.Warn("TLS certificate verification is disabled for provider, connections can be intercepted, only use this for development", "provider", providerConfig.Name)
+		}
+		if err := client.ConfigureTLS(TLSOptions{
+			ClientCertFile:     providerConfig.ClientCertFile,
+			ClientKeyFile:      providerConfig.ClientKeyFile,
+			CAFile:             providerConfig.CAFile,
+			InsecureSkipVerify: providerConfig.InsecureSkipVerify,
+		}); err != nil {
+			return nil, fmt.Errorf("provider %s: %w", providerConfig.Name, err)
+		}
+		if err := client.ConfigureProxy(providerConfig.Proxy); err != nil {
+			return nil, fmt.Errorf("provider %s: %w", providerConfig.Name, err)
+		}
 		provider := &Provider{
 			Name:              providerConfig.Name,
 			BaseURL:           providerConfig.BaseURL,
-			Token:             providerConfig.Token,
+			Token:             token,
 			Enabled:           providerConfig.Enabled,
 			Healthy:           true, // Start as healthy, will be verified
-			Client:            NewOpenAIClient(providerConfig.BaseURL, providerConfig.Token, logger),
+			Client:            client,
 			ActiveCompletions: 0,
 			StaticModels:      len(providerConfig.Models) > 0, // Static if models are provided in config
 			Allowlist:         providerConfig.Allowlist,
 			Denylist:          providerConfig.Denylist,
 			NativeResponses:   providerConfig.NativeResponses,
 		}
+		if providerConfig.ModelsSource != "" {
+			source, err := newModelSource(providerConfig.ModelsSource)
+			if err != nil {
+				return nil, fmt.Errorf("provider %s: %w", providerConfig.Name, err)
+			}
+			provider.ModelSource = source
+		}
 
 		router.Providers[provider.Name] = provider
 		logger.Info("initialized provider", "name", provider.Name, "base_url", provider.BaseURL)
@@ -65,6 +162,7 @@ func NewRouter(config *Config, logger Logger) (*Router, error) {
 	if err != nil {
 		logger.Warn("failed to initialize responses service", "error", err)
 	} else {
+		responsesService.SetLogger(logger)
 		router.responsesService = responsesService
 		logger.Info("initialized responses service")
 	}
@@ -78,13 +176,57 @@ func NewRouter(config *Config, logger Logger) (*Router, error) {
 		logger.Info("initialized conversations service")
 	}
 
+	// Allow responses to be attached to conversations
+	if router.responsesService != nil && router.conversationsService != nil {
+		router.responsesService.SetConversations(router.conversationsService)
+	}
+
+	// Open the audit storage, failing rather than running without the auditing that was asked for
+	audit, err := newAuditStorage(&config.Audit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit storage: %w", err)
+	}
+	router.audit = audit
+
 	// Setup HTTP mux with auth middleware
 	auth := middleware.Auth(config.Server.Token)
+	if config.Server.RateLimit > 0 {
+		if config.Server.RedisURL != "" {
+			limiter, err := middleware.NewRedisRateLimiter(config.Server.RedisURL, config.Server.RateLimit, time.Minute)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create rate limiter: %w", err)
+			}
+			router.rateLimiter = limiter
+		} else {
+			router.rateLimiter = middleware.NewMemoryRateLimiter(config.Server.RateLimit, time.Minute)
+		}
+
+		// Authenticate before counting so invalid tokens can't consume a client's limit
+		authOnly, rateLimit := auth, middleware.RateLimit(router.rateLimiter, logger)
+		auth = func(next http.HandlerFunc) http.HandlerFunc {
+			return authOnly(rateLimit(next))
+		}
+		logger.Info("rate limiting enabled", "requests_per_minute", config.Server.RateLimit, "shared", config.Server.RedisURL != "")
+	}
 	router.mux = http.NewServeMux()
 	router.mux.HandleFunc("/v1/models", auth(router.HandleModels))
+	router.mux.HandleFunc("/v1/models/{id...}", auth(router.HandleModel)) // IDs may contain slashes
 	router.mux.HandleFunc("/v1/chat/completions", auth(router.HandleChatCompletions))
 	router.mux.HandleFunc("/v1/embeddings", auth(router.HandleEmbeddings))
 	router.mux.HandleFunc("/health", router.HandleHealth) // Health endpoint is not protected
+	router.mux.HandleFunc("GET /metrics", auth(router.HandleMetrics))
+
+	// Admin endpoints use the admin token when one is set, otherwise the server token
+	adminAuth := auth
+	if config.Server.AdminToken != "" {
+		adminAuth = middleware.Auth(config.Server.AdminToken)
+	}
+	router.mux.HandleFunc("POST /admin/providers/{name}/disable", adminAuth(router.HandleAdminDisableProvider))
+	router.mux.HandleFunc("POST /admin/providers/{name}/enable", adminAuth(router.HandleAdminEnableProvider))
+	router.mux.HandleFunc("POST /admin/refresh", adminAuth(router.HandleAdminRefresh))
+	router.mux.HandleFunc("GET /admin/models/preview", adminAuth(router.HandleAdminPreviewModels))
+	router.mux.HandleFunc("POST /admin/tools/reload", adminAuth(router.HandleAdminReloadTools))
+	router.mux.HandleFunc("GET /admin/audit/{id}", adminAuth(router.HandleAdminGetAudit))
 
 	// Add responses endpoints if service is available
 	if router.responsesService != nil {
@@ -118,29 +260,65 @@ func NewRouter(config *Config, logger Logger) (*Router, error) {
 		logger.Info("MCP server endpoint available at /mcp (use X-MCP-Tool-Mode: discovery header for discovery mode)")
 	}
 
+	// Proxy any other /v1 request to the passthrough provider when one is configured
+	if config.Server.PassthroughProvider != "" {
+		router.mux.HandleFunc("/v1/", auth(router.HandlePassthrough))
+		logger.Info("unhandled /v1 requests are proxied", "provider", config.Server.PassthroughProvider)
+	}
+
 	// Add catch-all handler for unmatched routes (must be last)
 	router.mux.HandleFunc("/", router.HandleCatchAll)
 
 	return router, nil
 }
 
-func (r *Router) RefreshModels(ctx context.Context) error {
-	r.logger.Info("refreshing models from all providers concurrently")
+// resolveProviderToken returns the provider token, reading it from TokenFile when set
+func resolveProviderToken(providerConfig ProviderConfig) (string, error) {
+	if providerConfig.TokenFile == "" {
+		return providerConfig.Token, nil
+	}
 
-	// Clear existing model map with mutex protection
-	r.ModelMapMu.Lock()
-	r.ModelMap = make(map[string][]string)
-	r.ModelMapMu.Unlock()
+	data, err := os.ReadFile(providerConfig.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file for provider %s: %w", providerConfig.Name, err)
+	}
+
+	return strings.TrimRightFunc(string(data), unicode.IsSpace), nil
+}
 
-	modelSet := make(map[string]map[string]bool) // model -> provider -> exists
+// fetchModels lists the models of every enabled provider, keyed by normalized model ID then provider with the
+// provider's own model ID, and returns the providers whose fetch failed. Unless dryRun is set, providers are
+// disabled or enabled based on the result of their fetch.
+func (r *Router) fetchModels(ctx context.Context, dryRun bool) (map[string]map[string]string, map[string]error) {
+	modelSet := make(map[string]map[string]string) // normalized model -> provider -> model ID reported by the provider
+	fetchErrors := make(map[string]error)
 	var modelSetMu sync.Mutex
 
-	// Use WaitGroup to fetch models from all healthy providers concurrently
-	var wg sync.WaitGroup
+	// Fetch models from all healthy providers concurrently, a failing provider doesn't stop the others
+	var g errgroup.Group
 
-	// First, add static models from providers with predefined model lists
+	// Snapshot provider state so the lock is not held while fetching, the fetch
+	// goroutines call DisableProvider and EnableProvider which take the write lock
+	type providerState struct {
+		provider *Provider
+		enabled  bool
+		healthy  bool
+	}
+	r.ProvidersMu.RLock()
+	providerStates := make(map[string]providerState, len(r.Providers))
 	for providerName, provider := range r.Providers {
-		if !provider.Enabled {
+		providerStates[providerName] = providerState{provider: provider, enabled: provider.Enabled, healthy: provider.Healthy}
+	}
+	r.ProvidersMu.RUnlock()
+
+	// Visit providers in name order so the logs of successive refreshes are comparable
+	providerNames := slices.Sorted(maps.Keys(providerStates))
+
+	// First, add static models from providers with predefined model lists
+	for _, providerName := range providerNames {
+		state := providerStates[providerName]
+		provider := state.provider
+		if !state.enabled {
 			continue
 		}
 
@@ -156,12 +334,7 @@ func (r *Router) RefreshModels(ctx context.Context) error {
 
 			modelSetMu.Lock()
 			for _, modelID := range staticModels {
-				if shouldIncludeModel(modelID, provider.Allowlist, provider.Denylist) {
-					if modelSet[modelID] == nil {
-						modelSet[modelID] = make(map[string]bool)
-					}
-					modelSet[modelID][providerName] = true
-				}
+				r.addToModelSet(modelSet, providerName, modelID, provider)
 			}
 			modelSetMu.Unlock()
 
@@ -172,33 +345,57 @@ func (r *Router) RefreshModels(ctx context.Context) error {
 	}
 
 	// Then, fetch dynamic models from providers without static lists
-	for providerName, provider := range r.Providers {
-		if !provider.Enabled || !provider.Healthy || provider.StaticModels {
+	for _, providerName := range providerNames {
+		state := providerStates[providerName]
+		provider := state.provider
+		if !state.enabled || !state.healthy || provider.StaticModels {
 			r.logger.Debug("skipping provider",
 				"provider", providerName,
-				"enabled", provider.Enabled,
-				"healthy", provider.Healthy,
+				"enabled", state.enabled,
+				"healthy", state.healthy,
 				"static_models", provider.StaticModels)
 			continue
 		}
 
-		wg.Add(1)
-		go func(name string, p *Provider) {
-			defer wg.Done()
+		name, p := providerName, provider
+		g.Go(func() error {
+			// Reuse a list fetched moments ago so rapid refreshes don't hit every provider again
+			if cached, ok := r.modelLists.get(name); ok && !dryRun && !modelCacheBypassed(ctx) {
+				r.logger.Debug("using cached models from provider", "provider", name, "count", len(cached.Data))
+
+				modelSetMu.Lock()
+				for _, model := range cached.Data {
+					r.addToModelSet(modelSet, name, model.ID, p)
+				}
+				modelSetMu.Unlock()
+				return nil
+			}
 
 			r.logger.Debug("fetching models from provider", "provider", name, "base_url", p.BaseURL)
 
 			// Use the timeout method for model fetching
-			modelsResp, err := p.Client.ListModelsWithTimeout(ctx)
+			modelsResp, err := listProviderModels(ctx, p)
 			if err != nil {
 				r.logger.WithError(err).Error("failed to fetch models from provider", "provider", name)
-				r.DisableProvider(name, fmt.Sprintf("model fetch failed: %v", err))
-				return
+				modelSetMu.Lock()
+				fetchErrors[name] = err
+				modelSetMu.Unlock()
+				if !dryRun {
+					r.DisableProvider(name, fmt.Sprintf("model fetch failed: %v", err))
+				}
+				return nil // Recorded in fetchErrors so the remaining providers are still fetched
 			}
 
-			// Mark provider as healthy since we successfully got models
-			if !p.Healthy {
+			if !dryRun {
+				// A provider that keeps listing no models contributes nothing, flag it and optionally disable it
+				if r.recordModelCount(name, len(modelsResp.Data)) && r.config.Health.DisableEmptyProviders {
+					r.DisableProvider(name, fmt.Sprintf("no models returned for %d consecutive refreshes", r.emptyModelsThreshold()))
+					return nil
+				}
+
+				// Mark provider as healthy since we successfully got models
 				r.EnableProvider(name)
+				r.modelLists.set(name, modelsResp)
 			}
 
 			// Log the models we found
@@ -215,43 +412,163 @@ func (r *Router) RefreshModels(ctx context.Context) error {
 			// Safely update the shared modelSet with filtering
 			modelSetMu.Lock()
 			for _, model := range modelsResp.Data {
-				if shouldIncludeModel(model.ID, p.Allowlist, p.Denylist) {
-					if modelSet[model.ID] == nil {
-						modelSet[model.ID] = make(map[string]bool)
-					}
-					modelSet[model.ID][name] = true
-				}
+				r.addToModelSet(modelSet, name, model.ID, p)
 			}
 			modelSetMu.Unlock()
-		}(providerName, provider)
+			return nil
+		})
 	}
 
-	// Wait for all goroutines to complete
-	wg.Wait()
+	// Wait for all fetches to complete
+	g.Wait()
+
+	return modelSet, fetchErrors
+}
+
+// ModelRefreshError is returned by RefreshModels when the models of some providers could not be fetched, the
+// models of the other providers are still refreshed
+type ModelRefreshError struct {
+	Providers map[string]error // provider -> fetch error
+}
+
+func (e *ModelRefreshError) Error() string {
+	failures := make([]string, 0, len(e.Providers))
+	for _, providerName := range slices.Sorted(maps.Keys(e.Providers)) {
+		failures = append(failures, fmt.Sprintf("%s: %v", providerName, e.Providers[providerName]))
+	}
+	return fmt.Sprintf("failed to fetch models from %d provider(s): %s", len(e.Providers), strings.Join(failures, "; "))
+}
+
+// Unwrap returns the fetch errors so errors.Is can match them
+func (e *ModelRefreshError) Unwrap() []error {
+	return slices.Collect(maps.Values(e.Providers))
+}
+
+// RefreshModels rebuilds the model map from all providers, returning a *ModelRefreshError listing the providers
+// whose models could not be fetched
+func (r *Router) RefreshModels(ctx context.Context) error {
+	r.logger.Info("refreshing models from all providers concurrently")
+
+	// Clear existing model map with mutex protection
+	r.ModelMapMu.Lock()
+	r.ModelMap = make(map[string][]string)
+	r.ModelMapMu.Unlock()
+
+	modelSet, fetchErrors := r.fetchModels(ctx, false)
 
 	// Build the final model map with mutex protection
 	r.ModelMapMu.Lock()
 	defer r.ModelMapMu.Unlock()
 
-	for modelID, providers := range modelSet {
-		providerNames := make([]string, 0, len(providers))
-		for providerName := range providers {
-			providerNames = append(providerNames, providerName)
+	r.providerModelIDs = make(map[string]map[string]string)
+	r.mergeModelSet(modelSet)
+
+	// Forget known models that are no longer listed by a healthy provider,
+	// only models whose providers are all down are kept as degraded
+	r.ProvidersMu.RLock()
+	defer r.ProvidersMu.RUnlock()
+
+	for modelID, providerNames := range r.knownModels {
+		if _, exists := r.ModelMap[modelID]; exists {
+			continue
+		}
+		for _, providerName := range providerNames {
+			if provider, exists := r.Providers[providerName]; exists && provider.Enabled && provider.Healthy {
+				delete(r.knownModels, modelID)
+				break
+			}
+		}
+	}
+
+	r.logger.Info("model refresh complete",
+		"total_models", len(r.ModelMap),
+		"total_providers", len(r.Providers),
+		"failed_providers", len(fetchErrors))
+
+	if len(fetchErrors) > 0 {
+		return &ModelRefreshError{Providers: fetchErrors}
+	}
+	return nil
+}
+
+// addToModelSet records a model reported by a provider in a model set of normalized model -> provider -> model ID
+// reported by the provider, models excluded by the provider's allowlist or denylist are skipped
+func (r *Router) addToModelSet(modelSet map[string]map[string]string, providerName, modelID string, provider *Provider) {
+	modelID = strings.TrimSpace(modelID)
+	if !shouldIncludeModel(modelID, provider.Allowlist, provider.Denylist) {
+		return
+	}
+
+	normalizedID := r.normalizeModelID(modelID)
+	if modelSet[normalizedID] == nil {
+		modelSet[normalizedID] = make(map[string]string)
+	}
+	modelSet[normalizedID][providerName] = modelID
+}
+
+// mergeModelSet adds the providers of each model in the set to the model map, the caller must hold ModelMapMu
+func (r *Router) mergeModelSet(modelSet map[string]map[string]string) {
+	if r.providerModelIDs == nil {
+		r.providerModelIDs = make(map[string]map[string]string)
+	}
+
+	// Models and their providers are visited in sorted order so the logs and provider order are stable
+	for _, modelID := range slices.Sorted(maps.Keys(modelSet)) {
+		providers := modelSet[modelID]
+
+		// Copy rather than append in place, readers hold on to the slice after releasing the lock
+		providerNames := slices.Clone(r.ModelMap[modelID])
+		for _, providerName := range slices.Sorted(maps.Keys(providers)) {
+			providerModelID := providers[providerName]
+
+			// Remember IDs that differ from the normalized ID so requests use the provider's own ID
+			if providerModelID != modelID {
+				if r.providerModelIDs[providerName] == nil {
+					r.providerModelIDs[providerName] = make(map[string]string)
+				}
+				r.providerModelIDs[providerName][modelID] = providerModelID
+			}
+
+			if !slices.Contains(providerNames, providerName) {
+				providerNames = append(providerNames, providerName)
+			}
 		}
 		r.ModelMap[modelID] = providerNames
+		r.knownModels[modelID] = providerNames
 
-		if len(providers) > 1 {
+		if len(providerNames) > 1 {
 			r.logger.Debug("model available on multiple providers",
 				"model", modelID,
 				"providers", providerNames)
 		}
 	}
+}
 
-	r.logger.Info("model refresh complete",
-		"total_models", len(r.ModelMap),
-		"total_providers", len(r.Providers))
+// ModelPreview is the model map a refresh would build, with the providers whose model fetch failed
+type ModelPreview struct {
+	Models map[string][]string `json:"models"`           // model ID -> providers
+	Errors map[string]string   `json:"errors,omitempty"` // provider -> fetch error
+}
 
-	return nil
+// PreviewModels fetches the models from all providers as RefreshModels does, but returns the resulting
+// model map without changing ModelMap or the health of any provider
+func (r *Router) PreviewModels(ctx context.Context) *ModelPreview {
+	modelSet, fetchErrors := r.fetchModels(ctx, true)
+
+	preview := &ModelPreview{
+		Models: make(map[string][]string, len(modelSet)),
+	}
+	for modelID, providers := range modelSet {
+		preview.Models[modelID] = slices.Sorted(maps.Keys(providers))
+	}
+	if len(fetchErrors) > 0 {
+		preview.Errors = make(map[string]string, len(fetchErrors))
+		for providerName, err := range fetchErrors {
+			preview.Errors[providerName] = err.Error()
+		}
+	}
+
+	return preview
 }
 
 // DisableProvider marks a provider as unhealthy and removes its models from the map
@@ -259,16 +576,28 @@ func (r *Router) DisableProvider(providerName, reason string) {
 	r.ModelMapMu.Lock()
 	defer r.ModelMapMu.Unlock()
 
+	r.ProvidersMu.Lock()
 	provider, exists := r.Providers[providerName]
-	if !exists {
-		return
+	if !exists || !provider.Healthy {
+		r.ProvidersMu.Unlock()
+		return // Unknown or already disabled
 	}
 
-	if !provider.Healthy {
-		return // Already disabled
+	// Disabling the only provider of a model takes the model offline, optionally keep it so a blip isn't an outage
+	if orphaned := r.onlyProviderModels(providerName); len(orphaned) > 0 {
+		r.logger.Error("disabling provider leaves models with no provider",
+			"provider", providerName,
+			"reason", reason,
+			"models", orphaned,
+			"kept_enabled", r.config.Health.KeepLastProvider)
+		if r.config.Health.KeepLastProvider {
+			r.ProvidersMu.Unlock()
+			return
+		}
 	}
 
 	provider.Healthy = false
+	r.ProvidersMu.Unlock()
 
 	if provider.StaticModels {
 		r.logger.Warn("static model provider disabled",
@@ -305,8 +634,33 @@ func (r *Router) DisableProvider(providerName, reason string) {
 		"models_removed", len(modelsToRemove))
 }
 
+// onlyProviderModels returns the models for which the provider is the only healthy provider,
+// the caller must hold ModelMapMu and ProvidersMu
+func (r *Router) onlyProviderModels(providerName string) []string {
+	var models []string
+	for modelID, providers := range r.ModelMap {
+		only := false
+		for _, p := range providers {
+			if p == providerName {
+				only = true
+			} else if provider, exists := r.Providers[p]; exists && provider.Enabled && provider.Healthy {
+				only = false
+				break
+			}
+		}
+		if only {
+			models = append(models, modelID)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
 // EnableProvider marks a provider as healthy again
 func (r *Router) EnableProvider(providerName string) {
+	r.ProvidersMu.Lock()
+	defer r.ProvidersMu.Unlock()
+
 	provider, exists := r.Providers[providerName]
 	if !exists {
 		return
@@ -320,6 +674,83 @@ func (r *Router) EnableProvider(providerName string) {
 	r.logger.Info("provider re-enabled", "provider", providerName)
 }
 
+// restoreProvider marks a provider healthy again and adds the models it lists to the model map in one step,
+// so there is no window in which the provider is enabled but its models can't be routed to, the caller logs the recovery
+func (r *Router) restoreProvider(providerName string, models []Model) {
+	r.ModelMapMu.Lock()
+	defer r.ModelMapMu.Unlock()
+	r.ProvidersMu.Lock()
+	defer r.ProvidersMu.Unlock()
+
+	provider, exists := r.Providers[providerName]
+	if !exists {
+		return
+	}
+
+	modelSet := make(map[string]map[string]string)
+	for _, model := range models {
+		r.addToModelSet(modelSet, providerName, model.ID, provider)
+	}
+	r.mergeModelSet(modelSet)
+
+	if len(models) > 0 {
+		provider.EmptyModelRefreshes = 0
+	}
+	provider.Healthy = true
+}
+
+// defaultEmptyModelsThreshold is the consecutive empty model lists before a provider is flagged
+const defaultEmptyModelsThreshold = 3
+
+// emptyModelsThreshold returns the consecutive empty model lists before a provider is flagged
+func (r *Router) emptyModelsThreshold() int {
+	if r.config.Health.EmptyModelsThreshold > 0 {
+		return r.config.Health.EmptyModelsThreshold
+	}
+	return defaultEmptyModelsThreshold
+}
+
+// recordModelCount tracks consecutive refreshes in which a provider listed no models, returns true
+// while the provider is flagged as returning no models
+func (r *Router) recordModelCount(providerName string, count int) bool {
+	r.ProvidersMu.Lock()
+	defer r.ProvidersMu.Unlock()
+
+	provider, exists := r.Providers[providerName]
+	if !exists {
+		return false
+	}
+
+	if count > 0 {
+		provider.EmptyModelRefreshes = 0
+		return false
+	}
+
+	provider.EmptyModelRefreshes++
+	threshold := r.emptyModelsThreshold()
+	if provider.EmptyModelRefreshes == threshold {
+		r.logger.Warn("provider returned no models for consecutive refreshes, check its base URL and credentials",
+			"provider", providerName,
+			"refreshes", provider.EmptyModelRefreshes,
+			"disable", r.config.Health.DisableEmptyProviders)
+	}
+
+	return provider.EmptyModelRefreshes >= threshold
+}
+
+// degradedModels returns the previously available models that currently have no healthy provider.
+// The caller must hold ModelMapMu.
+func (r *Router) degradedModels() []string {
+	degraded := make([]string, 0)
+	for modelID := range r.knownModels {
+		if _, exists := r.ModelMap[modelID]; !exists {
+			degraded = append(degraded, modelID)
+		}
+	}
+	sort.Strings(degraded)
+	return degraded
+}
+
 // shouldIncludeModel checks if a model should be included based on allowlist and denylist
 func shouldIncludeModel(model string, allowlist, denylist []string) bool {
 	// If denylist is provided, check if model is in it
@@ -346,58 +777,236 @@ func shouldIncludeModel(model string, allowlist, denylist []string) bool {
 	return true
 }
 
+// isEmbeddingModel checks if a model is classified as embedding-only by the config
+func (r *Router) isEmbeddingModel(model string) bool {
+	for _, embeddingModel := range r.config.EmbeddingModels.Models {
+		if model == embeddingModel {
+			return true
+		}
+	}
+
+	for _, pattern := range r.config.EmbeddingModels.Patterns {
+		if matched, _ := path.Match(pattern, model); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (r *Router) GetProvider(name string) interface{ GetNativeResponses() bool } {
+	return r.getProvider(name)
+}
+
+// getProvider returns the named provider or nil if it does not exist
+func (r *Router) getProvider(name string) *Provider {
+	r.ProvidersMu.RLock()
+	defer r.ProvidersMu.RUnlock()
+
 	return r.Providers[name]
 }
 
+// normalizeModelID returns the ID used to route a model, case-folded when configured
+func (r *Router) normalizeModelID(model string) string {
+	model = strings.TrimSpace(model)
+	if r.config != nil && r.config.ModelIDs.CaseInsensitive {
+		model = strings.ToLower(model)
+	}
+	return model
+}
+
+// upstreamModel resolves a requested model to the routed model and the ID the provider knows it by,
+// removing any pool prefix and undoing normalization
+func (r *Router) upstreamModel(providerName, requested string) (routed string, upstream string) {
+	_, routed = r.splitPoolModel(requested)
+	routed = r.normalizeModelID(routed)
+
+	r.ModelMapMu.RLock()
+	defer r.ModelMapMu.RUnlock()
+
+	if providerModelID, exists := r.providerModelIDs[providerName][routed]; exists {
+		return routed, providerModelID
+	}
+	return routed, routed
+}
+
+// upstreamChatRequest returns the request to send to the provider and the routed model
+func (r *Router) upstreamChatRequest(providerName string, req *ChatCompletionRequest) (*ChatCompletionRequest, string) {
+	routed, upstream := r.upstreamModel(providerName, req.Model)
+	if upstream != req.Model {
+		upstreamReq := *req
+		upstreamReq.Model = upstream
+		return &upstreamReq, routed
+	}
+	return req, routed
+}
+
+// upstreamEmbeddingRequest returns the request to send to the provider and the routed model
+func (r *Router) upstreamEmbeddingRequest(providerName string, req *EmbeddingRequest) (*EmbeddingRequest, string) {
+	routed, upstream := r.upstreamModel(providerName, req.Model)
+	if upstream != req.Model {
+		upstreamReq := *req
+		upstreamReq.Model = upstream
+		return &upstreamReq, routed
+	}
+	return req, routed
+}
+
+// providerSelection records the provider chosen for a request and why, for logging
+type providerSelection struct {
+	router     *Router
+	provider   string
+	strategy   string   // strategy used, "single" when there was only one candidate
+	candidates []string // providers considered after pool and circuit filtering
+}
+
+// logFields returns the selection as structured log fields
+func (s *providerSelection) logFields() []any {
+	return []any{
+		"strategy", s.strategy,
+		"candidates", s.candidates,
+		"active_completions", activeCompletionsLog{router: s.router, candidates: s.candidates},
+	}
+}
+
+// activeCompletionsLog logs the active completions of each candidate provider. The counts are read when the entry is
+// written, so selections that aren't logged, such as below the debug level, don't collect them.
+type activeCompletionsLog struct {
+	router     *Router
+	candidates []string
+}
+
+// counts returns candidate -> active completions
+func (a activeCompletionsLog) counts() map[string]int64 {
+	a.router.ProvidersMu.RLock()
+	defer a.router.ProvidersMu.RUnlock()
+
+	counts := make(map[string]int64, len(a.candidates))
+	for _, providerName := range a.candidates {
+		if provider, exists := a.router.Providers[providerName]; exists {
+			counts[providerName] = atomic.LoadInt64(&provider.ActiveCompletions)
+		}
+	}
+	return counts
+}
+
+func (a activeCompletionsLog) String() string {
+	return fmt.Sprint(a.counts())
+}
+
+func (a activeCompletionsLog) LogValue() slog.Value {
+	return slog.AnyValue(a.counts())
+}
+
 func (r *Router) GetProviderForModel(model string) (string, error) {
+	selection, err := r.selectProvider(model)
+	if err != nil {
+		return "", err
+	}
+	return selection.provider, nil
+}
+
+// ErrModelNotFound is returned when no provider, or no provider in the requested pool, serves the model
+var ErrModelNotFound = errors.New("model not found")
+
+// selectProvider picks the provider to handle a model and records the reasons for the choice
+func (r *Router) selectProvider(model string) (*providerSelection, error) {
+	pool, model := r.splitPoolModel(model)
+	model = r.normalizeModelID(model)
+
 	r.ModelMapMu.RLock()
 	providers, exists := r.ModelMap[model]
 	r.ModelMapMu.RUnlock()
 
 	if !exists {
-		return "", fmt.Errorf("model %s not found in any provider", model)
+		return nil, fmt.Errorf("%w: %s is not available from any provider", ErrModelNotFound, model)
+	}
+
+	if pool != nil {
+		providers = pool.members(providers)
+		if len(providers) == 0 {
+			return nil, fmt.Errorf("%w: %s is not available in pool %s", ErrModelNotFound, model, pool.name)
+		}
+	}
+
+	// Skip providers that are failing for this model, unless there is no alternative
+	available := make([]string, 0, len(providers))
+	for _, providerName := range providers {
+		if !r.modelCircuits.isOpen(providerName, model) {
+			available = append(available, providerName)
+		}
+	}
+	if len(available) > 0 {
+		providers = available
+	}
+
+	r.ProvidersMu.RLock()
+	defer r.ProvidersMu.RUnlock()
+
+	selection := &providerSelection{
+		router:     r,
+		strategy:   poolStrategyLeastActive,
+		candidates: providers,
 	}
 
 	if len(providers) == 1 {
-		return providers[0], nil
+		selection.strategy = "single"
+		selection.provider = providers[0]
+		return selection, nil
 	}
 
-	// Find provider with least active completions
-	var selectedProvider string
+	if pool != nil && pool.strategy != poolStrategyLeastActive {
+		selection.strategy = pool.strategy
+		if selection.provider = r.selectFromPool(pool, providers); selection.provider != "" {
+			return selection, nil
+		}
+		return nil, fmt.Errorf("no enabled provider found for model %s", model)
+	}
+
+	// Find provider with least active completions, starting from the next candidate on each request so providers
+	// with the same count share the load rather than the first listed taking it all
 	minCompletions := int64(-1)
+	start := atomic.AddUint64(&r.leastActiveNext, 1)
 
-	for _, providerName := range providers {
+	for i := range providers {
+		providerName := providers[(start+uint64(i))%uint64(len(providers))]
 		provider, exists := r.Providers[providerName]
 		if !exists || !provider.Enabled {
 			continue
 		}
 
-		if minCompletions == -1 || provider.ActiveCompletions < minCompletions {
-			minCompletions = provider.ActiveCompletions
-			selectedProvider = providerName
+		activeCompletions := atomic.LoadInt64(&provider.ActiveCompletions)
+		if minCompletions == -1 || activeCompletions < minCompletions {
+			minCompletions = activeCompletions
+			selection.provider = providerName
 		}
 	}
 
-	if selectedProvider == "" {
-		return "", fmt.Errorf("no enabled provider found for model %s", model)
+	if selection.provider == "" {
+		return nil, fmt.Errorf("no enabled provider found for model %s", model)
 	}
 
-	return selectedProvider, nil
+	return selection, nil
 }
 
-func (r *Router) ListModels() ModelsResponse {
+func (r *Router) ListModels() RouterModelsResponse {
 	r.ModelMapMu.RLock()
 	defer r.ModelMapMu.RUnlock()
 
-	models := make([]Model, 0, len(r.ModelMap))
+	models := make([]RouterModel, 0, len(r.ModelMap))
 	for modelID := range r.ModelMap {
-		models = append(models, Model{
-			ID:      modelID,
-			Object:  "model",
-			Created: time.Now().Unix(),
-			OwnedBy: "router",
-		})
+		model := RouterModel{
+			Model: Model{
+				ID:      modelID,
+				Object:  "model",
+				Created: time.Now().Unix(),
+				OwnedBy: "router",
+			},
+		}
+		if metadata, exists := r.config.Models[modelID]; exists {
+			model.ModelMetadata = &metadata
+		}
+		models = append(models, model)
 	}
 
 	// Sort models by ID for consistent ordering
@@ -405,26 +1014,72 @@ func (r *Router) ListModels() ModelsResponse {
 		return models[i].ID < models[j].ID
 	})
 
-	return ModelsResponse{
+	return RouterModelsResponse{
 		Object: "list",
 		Data:   models,
 	}
 }
 
+// ListModelsWithProviders returns the model list with each model annotated with the providers serving it
+func (r *Router) ListModelsWithProviders() RouterModelsResponse {
+	models := r.ListModels()
+
+	r.ModelMapMu.RLock()
+	defer r.ModelMapMu.RUnlock()
+	r.ProvidersMu.RLock()
+	defer r.ProvidersMu.RUnlock()
+
+	for i := range models.Data {
+		providerNames := slices.Sorted(slices.Values(r.ModelMap[models.Data[i].ID]))
+		providers := make([]ModelProvider, 0, len(providerNames))
+		for _, providerName := range providerNames {
+			provider, exists := r.Providers[providerName]
+			providers = append(providers, ModelProvider{
+				Name:     providerName,
+				Healthy:  exists && provider.Enabled && provider.Healthy,
+				Excluded: r.modelCircuits.isOpen(providerName, models.Data[i].ID),
+			})
+		}
+		models.Data[i].Providers = providers
+	}
+
+	return models
+}
+
+// CreateChatCompletionWithTools creates a chat completion, executing any calls to the MCP server's tools
+func (r *Router) CreateChatCompletionWithTools(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return NewAILibrary(r).CreateChatCompletionWithTools(ctx, req)
+}
+
 func (r *Router) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	resp, _, err := r.createChatCompletion(ctx, req)
+	return resp, err
+}
+
+// createChatCompletion routes a chat completion, also returning the provider's response body when its client
+// returns it, for the fields ChatCompletionResponse doesn't carry
+func (r *Router) createChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, []byte, error) {
+	req = r.withSystemPrompt(req)
+
 	// Find provider for the model
-	providerName, err := r.GetProviderForModel(req.Model)
+	selection, err := r.selectProviderForRequest(ctx, req.Model)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	providerName := selection.provider
 
-	provider := r.Providers[providerName]
+	provider := r.getProvider(providerName)
+	if provider == nil {
+		return nil, nil, fmt.Errorf("provider %s not found", providerName)
+	}
+	req, model := r.upstreamChatRequest(providerName, req)
+	recordRoute(ctx, providerName, req.Model)
 
 	// Increment active completions
 	r.incrementActiveCompletions(providerName)
 	defer r.decrementActiveCompletions(providerName)
 
-	r.logger.Debug("routing chat completion", "model", req.Model, "provider", providerName)
+	r.logger.Debug("routing chat completion", slices.Concat([]any{"model", req.Model, "provider", providerName}, selection.logFields(), tagLogFields(ctx))...)
 
 	// Create token counter for usage estimation
 	tokenCounter := openai.NewTokenCounter()
@@ -435,14 +1090,29 @@ func (r *Router) CreateChatCompletion(ctx context.Context, req *ChatCompletionRe
 	}
 	tokenCounter.AddPromptTokensFromMessages(openaiMessages)
 
-	// Make the request
-	resp, err := provider.Client.CreateChatCompletion(ctx, req)
+	// Make the request, keeping the response body when the client returns it
+	var resp *ChatCompletionResponse
+	var body []byte
+	if client, ok := provider.Client.(interface {
+		createChatCompletionBody(context.Context, *ChatCompletionRequest) (*ChatCompletionResponse, []byte, error)
+	}); ok {
+		resp, body, err = client.createChatCompletionBody(ctx, req)
+	} else {
+		resp, err = provider.Client.CreateChatCompletion(ctx, req)
+	}
+	r.recordModelResult(providerName, model, err)
+	r.stats.recordRequest(providerName, err != nil)
 	if err != nil {
 		// Check if this is a connection error and disable the provider
 		if r.isConnectionError(err) {
 			r.DisableProvider(providerName, fmt.Sprintf("connection error: %v", err))
 		}
-		return nil, err
+		return nil, nil, err
+	}
+
+	if usageInjectionDisabled(ctx) {
+		r.stats.recordUsage(providerName, resp.Usage)
+		return resp, body, nil
 	}
 
 	// Add completion tokens from response
@@ -463,23 +1133,36 @@ func (r *Router) CreateChatCompletion(ctx context.Context, req *ChatCompletionRe
 			TotalTokens:      openaiResp.Usage.TotalTokens,
 		}
 	}
+	r.stats.recordUsage(providerName, resp.Usage)
 
-	return resp, nil
+	return resp, body, nil
 }
 
 func (r *Router) CreateEmbedding(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
-	// Find provider for the model
-	providerName, err := r.GetProviderForModel(req.Model)
+	// Find provider for the model, balanced the same way as chat completions
+	selection, err := r.selectProviderForRequest(ctx, req.Model)
 	if err != nil {
 		return nil, err
 	}
+	providerName := selection.provider
 
-	provider := r.Providers[providerName]
+	provider := r.getProvider(providerName)
+	if provider == nil {
+		return nil, fmt.Errorf("provider %s not found", providerName)
+	}
+	req, model := r.upstreamEmbeddingRequest(providerName, req)
+	recordRoute(ctx, providerName, req.Model)
+
+	// Count in-flight embeddings so busy providers are avoided
+	r.incrementActiveCompletions(providerName)
+	defer r.decrementActiveCompletions(providerName)
 
-	r.logger.Info("routing embedding request", "model", req.Model, "provider", providerName)
+	r.logger.Info("routing embedding request", append([]any{"model", req.Model, "provider", providerName}, selection.logFields()...)...)
 
 	// Make the request
 	resp, err := provider.Client.CreateEmbedding(ctx, req)
+	r.recordModelResult(providerName, model, err)
+	r.stats.recordRequest(providerName, err != nil)
 	if err != nil {
 		// Check if this is a connection error and disable the provider
 		if r.isConnectionError(err) {
@@ -488,42 +1171,96 @@ func (r *Router) CreateEmbedding(ctx context.Context, req *EmbeddingRequest) (*E
 		return nil, err
 	}
 
+	if err := r.checkEmbeddingDimensions(providerName, model, resp); err != nil {
+		r.logger.WithError(err).Error("embedding dimension mismatch", "model", model, "provider", providerName)
+		return nil, err
+	}
+	r.stats.recordUsage(providerName, &resp.Usage)
+
 	return resp, nil
 }
 
+// checkEmbeddingDimensions verifies the embeddings returned by a provider have the size configured for the model,
+// so mixing providers that return different sizes for the same model can't silently corrupt a vector store
+func (r *Router) checkEmbeddingDimensions(providerName, model string, resp *EmbeddingResponse) error {
+	if r.config == nil {
+		return nil
+	}
+
+	metadata, exists := r.config.Models[model]
+	if !exists || metadata.EmbeddingDimensions == 0 {
+		return nil
+	}
+
+	for _, embedding := range resp.Data {
+		if len(embedding.Embedding) != metadata.EmbeddingDimensions {
+			return fmt.Errorf("provider %s returned embedding with %d dimensions for model %s, expected %d",
+				providerName, len(embedding.Embedding), model, metadata.EmbeddingDimensions)
+		}
+	}
+
+	return nil
+}
+
+// CreateChatCompletionRaw sends a chat completion to a provider and returns its response unread. The completion
+// counts as active on the provider until the response body is closed, so the caller must always close it.
 func (r *Router) CreateChatCompletionRaw(ctx context.Context, req *ChatCompletionRequest) (*http.Response, string, error) {
 	// Find provider for the model
-	providerName, err := r.GetProviderForModel(req.Model)
+	selection, err := r.selectProviderForRequest(ctx, req.Model)
 	if err != nil {
 		return nil, "", err
 	}
+	providerName := selection.provider
 
-	provider := r.Providers[providerName]
+	provider := r.getProvider(providerName)
+	if provider == nil {
+		return nil, "", fmt.Errorf("provider %s not found", providerName)
+	}
+	req, model := r.upstreamChatRequest(providerName, req)
+	recordRoute(ctx, providerName, req.Model)
 
-	// Increment active completions
+	// Increment active completions, a stream is active until its body is closed rather than when this returns
 	r.incrementActiveCompletions(providerName)
 
-	// Create a deferred function to decrement completions
-	defer func() {
-		r.decrementActiveCompletions(providerName)
-	}()
-
-	r.logger.Debug("routing chat completion (raw)", "model", req.Model, "provider", providerName, "stream", req.Stream)
+	r.logger.Debug("routing chat completion (raw)", slices.Concat([]any{"model", req.Model, "provider", providerName, "stream", req.Stream}, selection.logFields(), tagLogFields(ctx))...)
 
 	// Make the raw request
 	resp, err := provider.Client.CreateChatCompletionRaw(ctx, req)
+	r.stats.recordRequest(providerName, err != nil || resp.StatusCode >= http.StatusBadRequest)
 	if err != nil {
+		r.decrementActiveCompletions(providerName)
+
 		// Check if this is a connection error and disable the provider
 		if r.isConnectionError(err) {
 			r.DisableProvider(providerName, fmt.Sprintf("connection error: %v", err))
 		}
 		return nil, "", err
 	}
+	resp.Body = &activeCompletionBody{ReadCloser: resp.Body, done: func() { r.decrementActiveCompletions(providerName) }}
+
+	// A 404 from the provider means the model is not available there
+	if resp.StatusCode == http.StatusNotFound {
+		r.recordModelResult(providerName, model, &UpstreamStatusError{StatusCode: resp.StatusCode})
+	} else if resp.StatusCode == http.StatusOK {
+		r.recordModelResult(providerName, model, nil)
+	}
 
 	// Return the response body as-is for pass-through
 	return resp, providerName, nil
 }
 
+// activeCompletionBody is the body of a raw completion response, ending the active completion when closed
+type activeCompletionBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *activeCompletionBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
 func (r *Router) isConnectionError(err error) bool {
 	if err == nil {
 		return false
@@ -563,18 +1300,32 @@ func (r *Router) isConnectionError(err error) bool {
 		}
 	}
 
+	// Finally any patterns configured for providers with their own error messages
+	if r.config != nil {
+		for _, pattern := range r.config.Health.ConnectionErrorPatterns {
+			if pattern != "" && strings.Contains(strings.ToLower(errStr), strings.ToLower(pattern)) {
+				return true
+			}
+		}
+	}
+
 	return false
 }
 
 func (r *Router) incrementActiveCompletions(providerName string) {
-	if provider, exists := r.Providers[providerName]; exists {
-		provider.ActiveCompletions++
+	if provider := r.getProvider(providerName); provider != nil {
+		atomic.AddInt64(&provider.ActiveCompletions, 1)
 	}
 }
 
 func (r *Router) decrementActiveCompletions(providerName string) {
-	if provider, exists := r.Providers[providerName]; exists && provider.ActiveCompletions > 0 {
-		provider.ActiveCompletions--
+	if provider := r.getProvider(providerName); provider != nil {
+		for {
+			current := atomic.LoadInt64(&provider.ActiveCompletions)
+			if current <= 0 || atomic.CompareAndSwapInt64(&provider.ActiveCompletions, current, current-1) {
+				return
+			}
+		}
 	}
 }
 
@@ -584,63 +1335,447 @@ func (r *Router) HandleModels(w http.ResponseWriter, req *http.Request) {
 	if err := r.RefreshModels(req.Context()); err != nil {
 		r.logger.WithError(err).Error("failed to refresh models")
 	}
-	models := r.ListModels()
+	// ?expand=providers annotates each model with its providers, the default shape stays OpenAI compatible
+	models := r.ListModels()
+	if req.URL.Query().Get("expand") == "providers" {
+		models = r.ListModelsWithProviders()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, models); err != nil {
+		r.logger.WithError(err).Error("failed to write models response")
+	}
+}
+
+// HandleModel retrieves a single model, model management methods are rejected as the router only proxies models
+func (r *Router) HandleModel(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeOpenAIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not supported for models, the router does not manage models", req.Method), "invalid_request_error", "method_not_allowed")
+		return
+	}
+
+	modelID := r.normalizeModelID(req.PathValue("id"))
+	for _, model := range r.ListModels().Data {
+		if model.ID == modelID {
+			w.Header().Set("Content-Type", "application/json")
+			if err := writeJSON(w, model); err != nil {
+				r.logger.WithError(err).Error("failed to write model response")
+			}
+			return
+		}
+	}
+
+	writeOpenAIError(w, http.StatusNotFound, fmt.Sprintf("model %s not found", modelID), "invalid_request_error", "model_not_found")
+}
+
+// noUsageInjectionHeader disables the router's token usage estimates for a request, usage is passed
+// through exactly as the provider sent it
+const noUsageInjectionHeader = "X-LLMRouter-No-Usage-Injection"
+
+// noUsageInjectionKey is the context key marking a request that must not have usage injected
+type noUsageInjectionKey struct{}
+
+// withoutUsageInjection returns a context that disables usage injection for chat completions
+func withoutUsageInjection(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noUsageInjectionKey{}, true)
+}
+
+// usageInjectionDisabled returns true if usage injection has been disabled for the request
+func usageInjectionDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noUsageInjectionKey{}).(bool)
+	return disabled
+}
+
+// Headers identifying the provider and upstream model that served a completion, sent when enabled in the config
+const (
+	providerHeader = "X-LLMRouter-Provider"
+	modelHeader    = "X-LLMRouter-Model"
+)
+
+// routeKey is the context key for the route a completion took
+type routeKey struct{}
+
+// completionRoute is the provider and upstream model that served a completion
+type completionRoute struct {
+	provider string
+	model    string
+}
+
+// routeRecorder records the route a completion takes. Completions made while serving a completion, such as by the
+// tool calling loop or a retry, may record concurrently so only the first route is kept, and it is passed on to the
+// recorder of the enclosing request.
+type routeRecorder struct {
+	mu     sync.Mutex
+	route  completionRoute
+	parent *routeRecorder
+}
+
+// record keeps the route if it is the first recorded
+func (rr *routeRecorder) record(route completionRoute) {
+	rr.mu.Lock()
+	if rr.route.provider == "" {
+		rr.route = route
+	}
+	rr.mu.Unlock()
+
+	if rr.parent != nil {
+		rr.parent.record(route)
+	}
+}
+
+// reset forgets the recorded route, here and in the enclosing request's recorder, so a retry records its own
+func (rr *routeRecorder) reset() {
+	rr.mu.Lock()
+	rr.route = completionRoute{}
+	rr.mu.Unlock()
+
+	if rr.parent != nil {
+		rr.parent.reset()
+	}
+}
+
+// get returns the recorded route, empty until one has been recorded
+func (rr *routeRecorder) get() completionRoute {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.route
+}
+
+// withRouteRecorder returns a context that records the route a completion takes, the route is also passed on to
+// any recorder already on the context so middleware outside the handler sees it too
+func withRouteRecorder(ctx context.Context) (context.Context, *routeRecorder) {
+	parent, _ := ctx.Value(routeKey{}).(*routeRecorder)
+	recorder := &routeRecorder{parent: parent}
+	return context.WithValue(ctx, routeKey{}, recorder), recorder
+}
+
+// WithRouteContext returns a context that records the provider and model a request is routed to, for middleware
+// wrapping the router to read with ProviderFromContext and ModelFromContext once the request has been handled.
+// Requests served by the router always carry one, so middleware inside the router does not need to call it.
+func WithRouteContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(routeKey{}).(*routeRecorder); ok {
+		return ctx
+	}
+	ctx, _ = withRouteRecorder(ctx)
+	return ctx
+}
+
+// ProviderFromContext returns the provider the request was routed to, empty until routing has decided
+func ProviderFromContext(ctx context.Context) string {
+	if recorder, ok := ctx.Value(routeKey{}).(*routeRecorder); ok {
+		return recorder.get().provider
+	}
+	return ""
+}
+
+// ModelFromContext returns the upstream model the request was routed to, empty until routing has decided
+func ModelFromContext(ctx context.Context) string {
+	if recorder, ok := ctx.Value(routeKey{}).(*routeRecorder); ok {
+		return recorder.get().model
+	}
+	return ""
+}
+
+// recordRoute records the provider and upstream model for the request, if it is being recorded
+func recordRoute(ctx context.Context, provider, model string) {
+	if recorder, ok := ctx.Value(routeKey{}).(*routeRecorder); ok {
+		recorder.record(completionRoute{provider: provider, model: model})
+	}
+}
+
+// resetRoute forgets the route recorded for the request, so the completion retrying it records the route it takes
+func resetRoute(ctx context.Context) {
+	if recorder, ok := ctx.Value(routeKey{}).(*routeRecorder); ok {
+		recorder.reset()
+	}
+}
+
+// setRouteHeaders adds the provider and model headers when enabled, they expose the backend topology so are off by default
+func (r *Router) setRouteHeaders(w http.ResponseWriter, route completionRoute) {
+	if r.config == nil || !r.config.Server.ProviderHeaders || route.provider == "" {
+		return
+	}
+	w.Header().Set(providerHeader, route.provider)
+	w.Header().Set(modelHeader, route.model)
+}
+
+// chatCompletionOptions holds chat completion request fields not carried by ChatCompletionRequest
+type chatCompletionOptions struct {
+	N              *int            `json:"n,omitempty"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+	Seed           *int64          `json:"seed,omitempty"`
+	Logprobs       *bool           `json:"logprobs,omitempty"`
+	TopLogprobs    *int            `json:"top_logprobs,omitempty"`
+	ResponseFormat json.RawMessage `json:"response_format,omitempty"`
+	Metadata       map[string]any  `json:"metadata,omitempty"` // only the string values are used as tags
+}
+
+// streamOptions holds the streaming options for a chat completion request
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// includeUsage returns true if the client asked for a final usage chunk on a streaming request
+func (o *chatCompletionOptions) includeUsage() bool {
+	return o.StreamOptions != nil && o.StreamOptions.IncludeUsage
+}
+
+// requestExtras returns the options to forward to the provider that ChatCompletionRequest cannot carry
+func (o *chatCompletionOptions) requestExtras(stream bool) map[string]any {
+	extras := make(map[string]any)
+	if stream && o.StreamOptions != nil {
+		extras["stream_options"] = o.StreamOptions
+	}
+	if o.Seed != nil {
+		extras["seed"] = *o.Seed
+	}
+	if o.Logprobs != nil {
+		extras["logprobs"] = *o.Logprobs
+	}
+	if o.TopLogprobs != nil {
+		extras["top_logprobs"] = *o.TopLogprobs
+	}
+	if len(o.ResponseFormat) > 0 {
+		extras["response_format"] = o.ResponseFormat
+	}
+	return extras
+}
+
+func (r *Router) HandleChatCompletions(w http.ResponseWriter, req *http.Request) {
+	body, err := readBody(req)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to read chat completion request")
+		writeBodyError(w, err)
+		return
+	}
+
+	var completionReq ChatCompletionRequest
+	var options chatCompletionOptions
+	if err := json.Unmarshal(body, &completionReq); err != nil {
+		r.logger.WithError(err).Error("failed to parse chat completion request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &options); err != nil {
+		r.logger.WithError(err).Error("failed to parse chat completion options")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateChatMessages(completionReq.Messages); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Limits apply to what clients send, not to the conversations the router builds itself such as the MCP tool loop
+	if err := r.checkPromptLimits(&completionReq); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "prompt_too_large")
+		return
+	}
+
+	// Usage accounting assumes a single choice, so multiple completions are not supported
+	if options.N != nil && *options.N > 1 {
+		http.Error(w, fmt.Sprintf("n=%d is not supported, only a single completion per request is available (n=1), send separate requests for multiple completions", *options.N), http.StatusBadRequest)
+		return
+	}
+
+	completionReq.Model, err = r.applyPoolHeader(req.Header.Get(poolHeader), completionReq.Model)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "unknown_pool")
+		return
+	}
+	completionReq.Model = r.applyModelDeprecation(w, completionReq.Model)
+
+	if _, model := r.splitPoolModel(completionReq.Model); r.isEmbeddingModel(model) {
+		http.Error(w, fmt.Sprintf("model %s is an embedding model and cannot be used for chat completions, use /v1/embeddings instead", completionReq.Model), http.StatusBadRequest)
+		return
+	}
+
+	if disabled, _ := strconv.ParseBool(req.Header.Get(noUsageInjectionHeader)); disabled {
+		req = req.WithContext(withoutUsageInjection(req.Context()))
+	}
+
+	if session := req.Header.Get(sessionHeader); session != "" {
+		req = req.WithContext(withSession(req.Context(), req.Header.Get("Authorization"), session))
+	}
+	req = req.WithContext(r.applyProviderOverrideHeader(req.Context(), req))
+
+	if extras := options.requestExtras(completionReq.Stream); len(extras) > 0 {
+		req = req.WithContext(withRequestExtras(req.Context(), extras))
+	}
+	req = req.WithContext(withTags(req.Context(), parseTags(options.Metadata, req.Header.Get(tagsHeader))))
+	req = req.WithContext(r.withAudit(req.Context(), body))
+
+	// Log seeds so reproducible requests can be audited
+	if options.Seed != nil {
+		r.logger.Info("chat completion with seed", "model", completionReq.Model, "seed", *options.Seed, "stream", completionReq.Stream)
+	}
+
+	// Check if client requested streaming
+	if completionReq.Stream {
+		r.handleStreamingChatCompletion(w, req, &completionReq, options.includeUsage())
+	} else {
+		var idempotency *idempotencyRequest
+		if key := req.Header.Get(idempotencyHeader); key != "" {
+			idempotency = newIdempotencyRequest(key, req.Header.Get("Authorization"), body)
+		}
+		r.handleNonStreamingChatCompletion(w, req, &completionReq, idempotency)
+	}
+}
+
+// validateChatMessages checks the roles of the messages in a chat completion request. The last message may be
+// from the assistant, a partial response (prefill) is forwarded as-is for the model to continue.
+func validateChatMessages(messages []Message) error {
+	if len(messages) == 0 {
+		return fmt.Errorf("messages must contain at least one message")
+	}
+
+	for i, msg := range messages {
+		switch msg.Role {
+		case "system", "developer", "user", "tool", "function":
+		case "assistant":
+			if i == len(messages)-1 && len(msg.ToolCalls) > 0 {
+				return fmt.Errorf("the last message cannot be an assistant message with tool calls, send the tool results first")
+			}
+		default:
+			return fmt.Errorf("messages[%d] has invalid role %q", i, msg.Role)
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := writeJSON(w, models); err != nil {
-		r.logger.WithError(err).Error("failed to write models response")
-	}
+	return nil
 }
 
-func (r *Router) HandleChatCompletions(w http.ResponseWriter, req *http.Request) {
-	var completionReq ChatCompletionRequest
-	if err := readJSON(req, &completionReq); err != nil {
-		r.logger.WithError(err).Error("failed to parse chat completion request")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+// chatCompletionResult is a chat completion with the details returned to the client alongside the response
+type chatCompletionResult struct {
+	resp     *ChatCompletionResponse
+	route    completionRoute
+	logprobs map[int]json.RawMessage // choice index -> logprobs, which ChatCompletionResponse doesn't carry
+}
+
+// choiceWithLogprobs is a choice as returned to the client, with its logprobs when requested
+type choiceWithLogprobs struct {
+	Choice
+	Logprobs json.RawMessage `json:"logprobs,omitempty"`
+}
+
+// response returns the chat completion to send to the client
+func (c *chatCompletionResult) response() any {
+	if len(c.logprobs) == 0 {
+		return c.resp
 	}
 
-	// Check if client requested streaming
-	if completionReq.Stream {
-		r.handleStreamingChatCompletion(w, req, &completionReq)
-	} else {
-		r.handleNonStreamingChatCompletion(w, req, &completionReq)
+	choices := make([]choiceWithLogprobs, len(c.resp.Choices))
+	for i, choice := range c.resp.Choices {
+		choices[i] = choiceWithLogprobs{Choice: choice, Logprobs: c.logprobs[choice.Index]}
 	}
+	return struct {
+		*ChatCompletionResponse
+		Choices []choiceWithLogprobs `json:"choices"`
+	}{c.resp, choices}
 }
 
-func (r *Router) handleNonStreamingChatCompletion(w http.ResponseWriter, req *http.Request, completionReq *ChatCompletionRequest) {
+// handleNonStreamingChatCompletion runs a chat completion, requests with an idempotency key share the result of
+// an earlier request with the same key
+func (r *Router) handleNonStreamingChatCompletion(w http.ResponseWriter, req *http.Request, completionReq *ChatCompletionRequest, idempotency *idempotencyRequest) {
 	ctx := req.Context()
+	extras, _ := ctx.Value(requestExtrasKey{}).(map[string]any)
+
+	attempt := func() (*chatCompletionResult, error) {
+		ctx, route := withRouteRecorder(ctx)
+		resp, body, err := r.createChatCompletion(ctx, completionReq)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &chatCompletionResult{resp: resp, route: route.get()}
+		if requested, _ := extras["logprobs"].(bool); requested {
+			result.logprobs = choiceLogprobs(body)
+		}
+		return result, nil
+	}
+
+	// Optionally retry once when the response doesn't match the requested JSON schema
+	complete := attempt
+	responseFormat, _ := extras["response_format"].(json.RawMessage)
+	if schema := responseFormatSchema(responseFormat); schema != nil && r.config != nil && r.config.Server.ValidateResponseSchema {
+		complete = func() (*chatCompletionResult, error) {
+			result, err := attempt()
+			if err != nil {
+				return nil, err
+			}
+			if err := validateResponseSchema(result.resp, schema); err != nil {
+				r.logger.Warn("response does not match json_schema, retrying", "model", completionReq.Model, "provider", result.route.provider, "error", err)
+				resetRoute(ctx)
+				return attempt()
+			}
+			return result, nil
+		}
+	}
 
-	resp, err := r.CreateChatCompletion(ctx, completionReq)
+	var result *chatCompletionResult
+	var err error
+	if idempotency != nil {
+		var replayed bool
+		result, replayed, err = r.idempotency.do(ctx, idempotency, complete)
+		if replayed {
+			w.Header().Set(idempotentReplayedHeader, "true")
+		}
+	} else {
+		result, err = complete()
+	}
 	if err != nil {
 		r.logger.WithError(err).Error("chat completion failed")
 
-		// Check if it's a model not found error
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
+		switch {
+		case errors.Is(err, errIdempotencyKeyReused):
+			writeOpenAIError(w, http.StatusUnprocessableEntity, err.Error(), "invalid_request_error", "idempotency_key_reused")
+		case errors.Is(err, errProviderOverride):
+			writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "provider_not_available")
+		case errors.Is(err, ErrModelNotFound):
+			writeOpenAIError(w, http.StatusNotFound, err.Error(), "invalid_request_error", "model_not_found")
+		default:
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	resp := result.resp
+	if seed, ok := extras["seed"]; ok {
+		r.logger.Info("chat completion with seed completed", "model", resp.Model, "seed", seed, "system_fingerprint", resp.SystemFingerprint)
+	}
+
+	if id := r.recordAudit(ctx, result.route, result.response(), resp.Usage); id != "" {
+		w.Header().Set(auditIDHeader, id)
+	}
+
+	r.setRouteHeaders(w, result.route)
 	w.Header().Set("Content-Type", "application/json")
-	if err := writeJSON(w, resp); err != nil {
+	if err := writeJSON(w, result.response()); err != nil {
 		r.logger.WithError(err).Error("failed to write chat completion response")
 	}
 }
 
-func (r *Router) handleStreamingChatCompletion(w http.ResponseWriter, req *http.Request, completionReq *ChatCompletionRequest) {
-	ctx := req.Context()
+// handleStreamingChatCompletion proxies a streaming chat completion, injecting estimated usage when the provider
+// omits it. When includeUsage is set the provider sends usage in a final chunk, so the estimate is only sent if
+// the stream ends without one.
+func (r *Router) handleStreamingChatCompletion(w http.ResponseWriter, req *http.Request, completionReq *ChatCompletionRequest, includeUsage bool) {
+	ctx, route := withRouteRecorder(req.Context())
 
-	// Create token counter for usage estimation
-	tokenCounter := openai.NewTokenCounter()
-	tokenCounter.AddPromptTokensFromMessages(completionReq.Messages)
+	completionReq = r.withSystemPrompt(completionReq)
 
 	// Get raw response from provider
 	resp, providerName, err := r.CreateChatCompletionRaw(ctx, completionReq)
 	if err != nil {
 		r.logger.WithError(err).Error("streaming chat completion failed")
+		if errors.Is(err, errProviderOverride) {
+			writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "provider_not_available")
+			return
+		}
+		if errors.Is(err, ErrModelNotFound) {
+			writeOpenAIError(w, http.StatusNotFound, err.Error(), "invalid_request_error", "model_not_found")
+			return
+		}
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -653,6 +1788,8 @@ func (r *Router) handleStreamingChatCompletion(w http.ResponseWriter, req *http.
 		}
 	}
 
+	r.setRouteHeaders(w, route.get())
+
 	// Set up to inject token usage at the end of stream
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -667,40 +1804,111 @@ func (r *Router) handleStreamingChatCompletion(w http.ResponseWriter, req *http.
 		return
 	}
 
+	if r.config != nil && r.config.Streaming.PassthroughOnly {
+		r.passthroughStream(ctx, w, flusher, resp.Body, completionReq.Model, providerName)
+		return
+	}
+
+	// Create token counter for usage estimation
+	tokenCounter := newStreamTokenCounter(completionReq.Messages)
+	estimatedUsage := tokenCounter.Usage
+
+	// Optionally rebuild tool calls from their fragments so they can be logged once the stream ends
+	var toolCalls *openai.CompletionAccumulator
+	if r.config != nil && r.config.Streaming.AggregateToolCalls {
+		toolCalls = &openai.CompletionAccumulator{}
+	}
+
+	// Assemble the streamed content when the completion is audited
+	var streamed *openai.CompletionAccumulator
+	if auditing(ctx) {
+		streamed = &openai.CompletionAccumulator{}
+	}
+
 	// Copy the streaming response to the client and inject usage when needed
+	var lastChunk ChatCompletionResponse
+	var upstreamUsage *Usage
+	injectUsage := !usageInjectionDisabled(ctx)
+	usageSent := false
+
+	// The final chunk is held back until the next event, providers that send usage in a separate chunk with no
+	// choices then have their usage passed through instead of our estimate being added to the final chunk
+	var heldChunk string
+	var heldLines []string
+	releaseHeldChunk := func(estimate bool) {
+		if heldChunk == "" {
+			return
+		}
+		if estimate {
+			fmt.Fprintf(w, "data: %s\n", string(withUsage([]byte(heldChunk), estimatedUsage())))
+		} else {
+			fmt.Fprintf(w, "data: %s\n", heldChunk)
+		}
+		for _, held := range heldLines {
+			fmt.Fprintln(w, held)
+		}
+		heldChunk, heldLines = "", nil
+	}
+
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		line := scanner.Text()
 
+		if heldChunk != "" {
+			if !strings.HasPrefix(line, "data:") {
+				heldLines = append(heldLines, line)
+				continue
+			}
+			releaseHeldChunk(!isUsageOnlyChunk(line))
+		}
+
+		// The client asked for usage but the provider didn't send it, send our estimate before the stream ends
+		if injectUsage && includeUsage && !usageSent && strings.HasPrefix(line, "data: [DONE]") {
+			usageChunk := ChatCompletionResponse{
+				ID:      lastChunk.ID,
+				Object:  "chat.completion.chunk",
+				Created: lastChunk.Created,
+				Model:   lastChunk.Model,
+				Choices: []Choice{},
+				Usage:   estimatedUsage(),
+			}
+			usageJSON, _ := json.Marshal(usageChunk)
+			fmt.Fprintf(w, "data: %s\n\n", string(usageJSON))
+			usageSent = true
+		}
+
 		// Check if this is a data line that needs modification
 		if strings.HasPrefix(line, "data:") && !strings.HasPrefix(line, "data: [DONE]") {
 			dataStr := strings.TrimPrefix(line, "data: ")
 			var chunk ChatCompletionResponse
 
-			if err := json.Unmarshal([]byte(dataStr), &chunk); err == nil && len(chunk.Choices) > 0 {
-				// Convert delta to openai format for token counting
-				openaiDelta := openai.Delta{Role: chunk.Choices[0].Delta.Role, Content: chunk.Choices[0].Delta.Content}
-				tokenCounter.AddCompletionTokensFromDelta(&openaiDelta)
-
-				// If this chunk has a finish_reason and no usage, inject our estimates
-				if chunk.Choices[0].FinishReason == "stop" && chunk.Usage == nil {
-					// Convert to openai format for usage injection
-					openaiChunk := openai.ChatCompletionResponse{}
-					tokenCounter.InjectUsageIfMissing(&openaiChunk)
-					// Copy usage back to our chunk
-					if openaiChunk.Usage != nil {
-						chunk.Usage = &Usage{
-							PromptTokens:     openaiChunk.Usage.PromptTokens,
-							CompletionTokens: openaiChunk.Usage.CompletionTokens,
-							TotalTokens:      openaiChunk.Usage.TotalTokens,
-						}
-					}
-					modifiedJSON, _ := json.Marshal(chunk)
-					fmt.Fprintf(w, "data: %s\n", string(modifiedJSON))
-				} else {
-					// Pass through unchanged
-					fmt.Fprintln(w, line)
+			err := json.Unmarshal([]byte(dataStr), &chunk)
+			if err == nil {
+				lastChunk = chunk
+				if toolCalls != nil {
+					toolCalls.AddChunk(chunk)
+				}
+				if streamed != nil {
+					streamed.AddChunk(chunk)
+				}
+				if chunk.Usage != nil {
+					upstreamUsage = chunk.Usage
+					usageSent = true // Upstream usage is passed through as-is
+				}
+			}
+
+			if err == nil && len(chunk.Choices) > 0 {
+				tokenCounter.AddDelta(&chunk.Choices[0].Delta)
+
+				// If this chunk has a finish_reason and no usage, hold it to inject our estimates unless the
+				// client asked for the provider to send usage in a final chunk
+				if chunk.Choices[0].FinishReason == "stop" && chunk.Usage == nil && injectUsage && !includeUsage {
+					heldChunk = dataStr
+					continue
 				}
+
+				// Pass through unchanged
+				fmt.Fprintln(w, line)
 			} else {
 				// Parse failed or no choices, pass through unchanged
 				fmt.Fprintln(w, line)
@@ -715,26 +1923,189 @@ func (r *Router) handleStreamingChatCompletion(w http.ResponseWriter, req *http.
 		}
 	}
 
+	// The stream ended without a usage chunk after the final chunk
+	releaseHeldChunk(true)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	// If the upstream stream dropped mid-response tell the client rather than ending as if it completed
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		r.logger.WithError(err).Error("streaming response interrupted",
+			"model", completionReq.Model,
+			"provider", providerName)
+
+		errorJSON, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": fmt.Sprintf("upstream stream interrupted: %v", err),
+				"type":    "stream_error",
+			},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", string(errorJSON))
+		flusher.Flush()
+		return
+	}
+
+	if toolCalls != nil {
+		if calls, ok := toolCalls.FinishedToolCalls(); ok {
+			r.logger.Debug("streamed tool calls",
+				"model", completionReq.Model,
+				"provider", providerName,
+				"tool_calls", calls)
+		}
+	}
+
+	usage := upstreamUsage
+	if usage == nil {
+		usage = estimatedUsage()
+	}
+	r.stats.recordUsage(providerName, usage)
+
+	if streamed != nil {
+		message := Message{Role: "assistant", Content: streamed.Content()}
+		message.ToolCalls, _ = streamed.FinishedToolCalls()
+
+		// The headers have already been sent, the record ID goes to the client as a trailer once it is stored
+		id := r.recordAudit(ctx, route.get(), &ChatCompletionResponse{
+			ID:      lastChunk.ID,
+			Object:  "chat.completion",
+			Created: lastChunk.Created,
+			Model:   lastChunk.Model,
+			Choices: []Choice{{
+				Message:      message,
+				FinishReason: streamed.FinishReason(),
+			}},
+			Usage: usage,
+		}, usage)
+		if id != "" {
+			w.Header().Set(http.TrailerPrefix+auditIDHeader, id)
+		}
+	}
+
 	r.logger.Debug("streaming response completed",
 		"model", completionReq.Model,
 		"provider", providerName)
 }
 
+// streamTokenCounter estimates the usage of a streamed completion, counting reasoning separately so it can be
+// reported in the completion token details
+type streamTokenCounter struct {
+	counter         *openai.TokenCounter
+	reasoningTokens int
+}
+
+// newStreamTokenCounter creates a token counter for a streamed completion of the messages
+func newStreamTokenCounter(messages []Message) *streamTokenCounter {
+	counter := openai.NewTokenCounter()
+	counter.AddPromptTokensFromMessages(messages)
+	return &streamTokenCounter{counter: counter}
+}
+
+// AddDelta adds the completion tokens of a streamed delta, including its reasoning content and tool calls
+func (c *streamTokenCounter) AddDelta(delta *Delta) {
+	c.counter.AddCompletionTokensFromDelta(delta)
+	c.reasoningTokens += openai.EstimateTokens(delta.ReasoningContent)
+}
+
+// Usage returns the usage estimate, with the reasoning tokens in the details when the model reasoned
+func (c *streamTokenCounter) Usage() *Usage {
+	usage := c.counter.GetUsage()
+	if c.reasoningTokens > 0 {
+		usage.CompletionTokensDetails = &CompletionTokensDetails{ReasoningTokens: c.reasoningTokens}
+	}
+	return &usage
+}
+
+// isUsageOnlyChunk returns true if a streamed data line is a chunk with usage and no choices
+func isUsageOnlyChunk(line string) bool {
+	var chunk ChatCompletionResponse
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+		return false
+	}
+	return chunk.Usage != nil && len(chunk.Choices) == 0
+}
+
+// withUsage adds usage to a streamed chunk, keeping fields ChatCompletionResponse doesn't carry such as logprobs
+func withUsage(chunk []byte, usage *Usage) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(chunk, &fields); err != nil {
+		return chunk
+	}
+
+	usageJSON, err := json.Marshal(usage)
+	if err != nil {
+		return chunk
+	}
+	fields["usage"] = usageJSON
+
+	modified, err := json.Marshal(fields)
+	if err != nil {
+		return chunk
+	}
+	return modified
+}
+
+// flushWriter flushes after every write so streamed chunks reach the client as they arrive
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.flusher.Flush()
+	return n, err
+}
+
+// passthroughStream copies a streaming response to the client byte-for-byte, without parsing chunks or injecting usage
+func (r *Router) passthroughStream(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, body io.Reader, model, providerName string) {
+	if _, err := io.Copy(flushWriter{w: w, flusher: flusher}, body); err != nil && ctx.Err() == nil {
+		r.logger.WithError(err).Error("streaming response interrupted",
+			"model", model,
+			"provider", providerName)
+		return
+	}
+
+	r.logger.Debug("streaming response completed",
+		"model", model,
+		"provider", providerName,
+		"passthrough", true)
+}
+
 func (r *Router) HandleEmbeddings(w http.ResponseWriter, req *http.Request) {
 	var embeddingReq EmbeddingRequest
 	if err := readJSON(req, &embeddingReq); err != nil {
 		r.logger.WithError(err).Error("failed to parse embedding request")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
+	model, err := r.applyPoolHeader(req.Header.Get(poolHeader), embeddingReq.Model)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "unknown_pool")
+		return
+	}
+	embeddingReq.Model = model
+	embeddingReq.Model = r.applyModelDeprecation(w, embeddingReq.Model)
 
 	ctx := req.Context()
+	if session := req.Header.Get(sessionHeader); session != "" {
+		ctx = withSession(ctx, req.Header.Get("Authorization"), session)
+	}
+	ctx = r.applyProviderOverrideHeader(ctx, req)
+
+	if wantsNDJSON(req) {
+		r.streamEmbeddings(ctx, w, &embeddingReq)
+		return
+	}
+
 	resp, err := r.CreateEmbedding(ctx, &embeddingReq)
 	if err != nil {
 		r.logger.WithError(err).Error("embedding request failed")
 
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, errProviderOverride) {
+			writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "provider_not_available")
+		} else if errors.Is(err, ErrModelNotFound) {
+			writeOpenAIError(w, http.StatusNotFound, err.Error(), "invalid_request_error", "model_not_found")
 		} else {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
@@ -750,11 +2121,14 @@ func (r *Router) HandleEmbeddings(w http.ResponseWriter, req *http.Request) {
 func (r *Router) HandleHealth(w http.ResponseWriter, req *http.Request) {
 	r.ModelMapMu.RLock()
 	defer r.ModelMapMu.RUnlock()
+	r.ProvidersMu.RLock()
+	defer r.ProvidersMu.RUnlock()
 
 	health := map[string]interface{}{
-		"status":    "ok",
-		"providers": len(r.Providers),
-		"models":    len(r.ModelMap),
+		"status":          "ok",
+		"providers":       len(r.Providers),
+		"models":          len(r.ModelMap),
+		"degraded_models": r.degradedModels(),
 	}
 
 	// Add provider status
@@ -763,7 +2137,7 @@ func (r *Router) HandleHealth(w http.ResponseWriter, req *http.Request) {
 		providerStatus[name] = map[string]interface{}{
 			"enabled":            provider.Enabled,
 			"healthy":            provider.Healthy,
-			"active_completions": provider.ActiveCompletions,
+			"active_completions": atomic.LoadInt64(&provider.ActiveCompletions),
 		}
 	}
 	health["provider_status"] = providerStatus
@@ -777,13 +2151,72 @@ func (r *Router) HandleHealth(w http.ResponseWriter, req *http.Request) {
 // Helper functions for JSON handling
 func readJSON(req *http.Request, v interface{}) error {
 	defer req.Body.Close()
-	return json.NewDecoder(req.Body).Decode(v)
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(body).Decode(v)
+}
+
+// maxRequestBodySize is the max bytes of a request body after decompression
+const maxRequestBodySize = 32 * 1024 * 1024
+
+// requestBody returns a reader for the request body, decompressing it when sent with Content-Encoding: gzip. The
+// decompressed body is capped so a small compressed body can't expand without limit, reading past the cap fails
+// with a *http.MaxBytesError.
+func requestBody(req *http.Request) (io.Reader, error) {
+	switch strings.ToLower(req.Header.Get("Content-Encoding")) {
+	case "", "identity":
+		return http.MaxBytesReader(nil, req.Body, maxRequestBodySize), nil
+	case "gzip":
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return http.MaxBytesReader(nil, gz, maxRequestBodySize), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", req.Header.Get("Content-Encoding"))
+	}
+}
+
+// readBody reads the whole request body, decompressing it if needed
+func readBody(req *http.Request) ([]byte, error) {
+	defer req.Body.Close()
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(body)
+}
+
+// writeBodyError writes the error for a request body that could not be read, 413 when it is over the size limit
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Invalid request body", http.StatusBadRequest)
 }
 
 func writeJSON(w http.ResponseWriter, v interface{}) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+// writeOpenAIError writes an error in the OpenAI API error envelope
+func writeOpenAIError(w http.ResponseWriter, statusCode int, message, errType, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	writeJSON(w, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    code,
+		},
+	})
+}
+
 // HandleMCP handles MCP protocol requests.
 // The tool mode is determined from the X-MCP-Tool-Mode header or tool_mode query parameter.
 // Use X-MCP-Tool-Mode: discovery header to enable discovery mode.
@@ -833,11 +2266,13 @@ func (r *Router) checkDisabledProviders() {
 	unhealthyProviders := make([]string, 0)
 
 	// Find unhealthy providers (skip static model providers)
+	r.ProvidersMu.RLock()
 	for name, provider := range r.Providers {
 		if provider.Enabled && !provider.Healthy && !provider.StaticModels {
 			unhealthyProviders = append(unhealthyProviders, name)
 		}
 	}
+	r.ProvidersMu.RUnlock()
 
 	if len(unhealthyProviders) == 0 {
 		return
@@ -858,50 +2293,244 @@ func (r *Router) checkDisabledProviders() {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			provider := r.Providers[name]
-			_, err := provider.Client.ListModels(ctx)
+			provider := r.getProvider(name)
+			if provider == nil {
+				return
+			}
+
+			// A quick TCP connect rules out hosts that are down before waiting on the HTTP check, proxied providers
+			// aren't reached directly so are only checked over HTTP
+			if timeout := r.config.Health.TCPProbeTimeout; timeout > 0 && !proxiedProvider(provider) {
+				if err := probeProviderTCP(ctx, provider.BaseURL, time.Duration(timeout)*time.Second); err != nil {
+					r.logger.Debug("provider still unreachable", "provider", name, "error", err)
+					return
+				}
+			}
+
+			// A model source is listed without contacting the provider, so check the provider itself is back
+			if provider.ModelSource != nil {
+				if err := checkProviderReachable(ctx, provider); err != nil {
+					r.logger.Debug("provider still unreachable", "provider", name, "error", err)
+					return
+				}
+			}
+
+			modelsResp, err := listProviderModels(ctx, provider)
 			if err != nil {
 				r.logger.Debug("provider still unhealthy", "provider", name, "error", err)
 				return
 			}
 
-			// Provider is healthy again, re-enable it
-			r.EnableProvider(name)
-			r.logger.Info("provider recovered and re-enabled", "provider", name)
+			// Providers disabled for listing no models stay disabled until they report some
+			if len(modelsResp.Data) == 0 && r.config.Health.DisableEmptyProviders {
+				r.logger.Debug("provider still has no models", "provider", name)
+				return
+			}
 
-			// Trigger a model refresh to add back this provider's models
-			go func() {
-				refreshCtx, refreshCancel := context.WithTimeout(context.Background(), 30*time.Second)
-				defer refreshCancel()
-				if err := r.RefreshModels(refreshCtx); err != nil {
-					r.logger.WithError(err).Error("failed to refresh models after provider recovery", "provider", name)
+			// Listing models doesn't prove the provider can complete, optionally check with a canary completion
+			if r.config.Health.CompletionCheck {
+				if err := r.checkProviderCompletion(provider, modelsResp.Data); err != nil {
+					r.logger.Debug("provider still failing completions", "provider", name, "error", err)
+					return
 				}
-			}()
+			}
+
+			// Provider is healthy again, re-enable it with the models it just listed so they are routable immediately
+			r.restoreProvider(name, modelsResp.Data)
+			r.logger.Info("provider recovered and re-enabled", "provider", name, "models", len(modelsResp.Data))
 		}(providerName)
 	}
 
 	wg.Wait()
 }
 
+// Canary completion sent by the completion health check, kept small to limit its cost
+const (
+	defaultCompletionCheckPrompt = "Reply with OK."
+	completionCheckMaxTokens     = 8
+	completionCheckTimeout       = 30 * time.Second
+)
+
+// checkProviderCompletion sends a canary completion to a provider with the configured model, or the first chat model
+// it serves when none is configured. The check is skipped for providers that don't serve the configured model, rather
+// than sending the canary to a model that may be far more costly.
+func (r *Router) checkProviderCompletion(provider *Provider, models []Model) error {
+	model := r.completionCheckModel(provider, models)
+	if model == "" {
+		r.ProvidersMu.Lock()
+		warned := provider.CompletionCheckSkipWarned
+		provider.CompletionCheckSkipWarned = true
+		r.ProvidersMu.Unlock()
+
+		if !warned {
+			r.logger.Warn("skipping completion check, provider serves no model to check", "provider", provider.Name, "completion_check_model", r.config.Health.CompletionCheckModel)
+		}
+		return nil
+	}
+
+	prompt := r.config.Health.CompletionCheckPrompt
+	if prompt == "" {
+		prompt = defaultCompletionCheckPrompt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionCheckTimeout)
+	defer cancel()
+
+	_, err := provider.Client.CreateChatCompletion(ctx, &ChatCompletionRequest{
+		Model:     model,
+		Messages:  []Message{{Role: "user", Content: prompt}},
+		MaxTokens: completionCheckMaxTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("canary completion with %s failed: %w", model, err)
+	}
+	return nil
+}
+
+// completionCheckModel returns the ID the provider lists the canary model by, or "" if it serves none. Models the
+// provider's allowlist or denylist exclude are never used, and with no model configured embedding models are skipped.
+func (r *Router) completionCheckModel(provider *Provider, models []Model) string {
+	configured := r.normalizeModelID(r.config.Health.CompletionCheckModel)
+	for _, m := range models {
+		modelID := strings.TrimSpace(m.ID)
+		if !shouldIncludeModel(modelID, provider.Allowlist, provider.Denylist) {
+			continue
+		}
+
+		normalizedID := r.normalizeModelID(modelID)
+		if configured != "" {
+			if normalizedID == configured {
+				return modelID
+			}
+		} else if !r.isEmbeddingModel(normalizedID) {
+			return modelID
+		}
+	}
+	return ""
+}
+
+// proxiedProvider returns true if requests to the provider are sent through a proxy
+func proxiedProvider(provider *Provider) bool {
+	client, ok := provider.Client.(interface{ usesProxy() bool })
+	return ok && client.usesProxy()
+}
+
+// probeProviderTCP opens and closes a TCP connection to the provider's host, failing if it can't connect within the timeout
+func probeProviderTCP(ctx context.Context, baseURL string, timeout time.Duration) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 // ServeHTTP implements http.Handler
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.mux.ServeHTTP(w, req)
+	req = req.WithContext(WithRouteContext(req.Context()))
+	middleware.Gzip(r.mux.ServeHTTP)(w, normalizeAPIPath(req))
+}
+
+// unversionedAPIPrefixes are the OpenAI API paths that clients may call without the /v1 prefix
+var unversionedAPIPrefixes = []string{
+	"/chat/completions",
+	"/embeddings",
+	"/models",
+	"/responses",
+	"/conversations",
+}
+
+// normalizeAPIPath maps OpenAI API paths without the /v1 prefix onto the /v1 routes,
+// so clients configured with a base URL with or without /v1 both work
+func normalizeAPIPath(req *http.Request) *http.Request {
+	for _, prefix := range unversionedAPIPrefixes {
+		if req.URL.Path == prefix || strings.HasPrefix(req.URL.Path, prefix+"/") {
+			normalized := req.Clone(req.Context())
+			normalized.URL.Path = "/v1" + req.URL.Path
+			if req.URL.RawPath != "" {
+				normalized.URL.RawPath = "/v1" + req.URL.RawPath
+			}
+			return normalized
+		}
+	}
+
+	return req
 }
 
 // Shutdown gracefully shuts down the router
 func (r *Router) Shutdown() {
 	r.shutdownOnce.Do(func() {
 		close(r.shutdownChan)
+		r.idempotency.close()
 		if r.responsesService != nil {
 			r.responsesService.Close()
 		}
 		if r.conversationsService != nil {
 			r.conversationsService.Close()
 		}
+		if r.audit != nil {
+			r.audit.Close()
+		}
+		if closer, ok := r.rateLimiter.(io.Closer); ok {
+			closer.Close()
+		}
+		if r.stats != nil {
+			r.logger.Info("provider stats", "providers", r.stats.snapshot())
+		}
 	})
 	r.wg.Wait()
 }
 
+// defaultPollInterval is the Retry-After seconds sent for background responses when not configured
+const defaultPollInterval = 2
+
+// pollInterval returns the seconds clients should wait before polling a background response
+func (r *Router) pollInterval() int {
+	if r.config.Responses.PollInterval > 0 {
+		return r.config.Responses.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// createResponseBody is a create response request with the fields not carried by CreateResponseRequest
+type createResponseBody struct {
+	CreateResponseRequest
+	Conversation json.RawMessage `json:"conversation,omitempty"` // conversation ID or {"id": "..."}
+}
+
+// conversationID returns the ID of the conversation the response is attached to, if any
+func (o *createResponseBody) conversationID() string {
+	if len(o.Conversation) == 0 {
+		return ""
+	}
+
+	var id string
+	if err := json.Unmarshal(o.Conversation, &id); err == nil {
+		return id
+	}
+
+	var conversation struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(o.Conversation, &conversation); err == nil {
+		return conversation.ID
+	}
+	return ""
+}
+
 // Responses HTTP Handlers
 func (r *Router) HandleCreateResponse(w http.ResponseWriter, req *http.Request) {
 	r.logger.Trace("HandleCreateResponse")
@@ -911,15 +2540,63 @@ func (r *Router) HandleCreateResponse(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	var createReq CreateResponseRequest
-	if err := readJSON(req, &createReq); err != nil {
+	body, err := readBody(req)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to read create response request")
+		writeBodyError(w, err)
+		return
+	}
+
+	var createReq createResponseBody
+	if err := json.Unmarshal(body, &createReq); err != nil {
 		r.logger.WithError(err).Error("failed to parse create response request")
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	resp, err := r.responsesService.CreateResponse(req.Context(), &createReq, nil) // Use default completion for API calls
+	// Limits apply to what the client sends, not to the previous responses the service adds to the conversation
+	messages, err := responses.RequestMessages(&createReq.CreateResponseRequest)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "invalid_input")
+		return
+	}
+	if err := r.checkPromptLimits(&ChatCompletionRequest{Model: createReq.Model, Messages: messages}); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "prompt_too_large")
+		return
+	}
+
+	ctx := req.Context()
+	if conversationID := createReq.conversationID(); conversationID != "" {
+		ctx = responses.WithConversation(ctx, conversationID)
+	}
+
+	if tags := parseTags(createReq.Metadata, req.Header.Get(tagsHeader)); len(tags) > 0 {
+		ctx = responses.WithTags(ctx, tags)
+	}
+
+	resp, err := r.responsesService.CreateResponse(ctx, &createReq.CreateResponseRequest, nil) // Use default completion for API calls
 	if err != nil {
+		if errors.Is(err, responses.ErrInvalidInput) {
+			writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error", "invalid_input")
+			return
+		}
+		if errors.Is(err, responses.ErrConversationNotFound) {
+			writeOpenAIError(w, http.StatusNotFound, fmt.Sprintf("conversation %s not found", createReq.conversationID()), "invalid_request_error", "conversation_not_found")
+			return
+		}
+		if errors.Is(err, responses.ErrConversationsUnavailable) {
+			http.Error(w, "Conversations service not available", http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, responses.ErrBusy) {
+			w.Header().Set("Retry-After", strconv.Itoa(r.pollInterval()))
+			writeOpenAIError(w, http.StatusTooManyRequests, err.Error(), "server_error", "responses_busy")
+			return
+		}
+		if errors.Is(err, responses.ErrClosed) {
+			writeOpenAIError(w, http.StatusServiceUnavailable, err.Error(), "server_error", "responses_closed")
+			return
+		}
 		r.logger.WithError(err).Error("failed to create response")
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -928,6 +2605,11 @@ func (r *Router) HandleCreateResponse(w http.ResponseWriter, req *http.Request)
 	// log.PrettyJSON(createReq)
 	// log.PrettyJSON(resp)
 
+	// Tell clients how long to wait before polling a response that is still being processed
+	if resp.Status == string(storage.StatusPending) || resp.Status == string(storage.StatusInProgress) {
+		w.Header().Set("Retry-After", strconv.Itoa(r.pollInterval()))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := writeJSON(w, resp); err != nil {
@@ -1105,7 +2787,7 @@ func (r *Router) HandleCreateConversation(w http.ResponseWriter, req *http.Reque
 	var createReq openai.CreateConversationRequest
 	if err := readJSON(req, &createReq); err != nil {
 		r.logger.WithError(err).Error("failed to parse create conversation request")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
@@ -1167,7 +2849,7 @@ func (r *Router) HandleUpdateConversation(w http.ResponseWriter, req *http.Reque
 	var updateReq openai.UpdateConversationRequest
 	if err := readJSON(req, &updateReq); err != nil {
 		r.logger.WithError(err).Error("failed to parse update conversation request")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
@@ -1272,16 +2954,19 @@ func (r *Router) HandleCreateItems(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	var createReq openai.CreateItemsRequest
+	// Items are read with their optional created_at, for clients merging items from elsewhere
+	var createReq struct {
+		Items []storage.StoredItem `json:"items"`
+	}
 	if err := readJSON(req, &createReq); err != nil {
 		r.logger.WithError(err).Error("failed to parse create items request")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	include := req.URL.Query()["include"]
 
-	items, err := r.conversationsService.CreateItems(req.Context(), conversationID, &createReq, include)
+	items, err := r.conversationsService.AddItems(req.Context(), conversationID, createReq.Items, include)
 	if err != nil {
 		if err.Error() == "conversation not found" {
 			http.Error(w, "Conversation not found", http.StatusNotFound)
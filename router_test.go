@@ -0,0 +1,2292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paularlott/llmrouter/internal/types"
+	"github.com/paularlott/mcp/openai"
+)
+
+// newModelsServer creates a mock provider that lists the given models
+func newModelsServer(t *testing.T, models ...string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := make([]Model, 0, len(models))
+		for _, model := range models {
+			data = append(data, Model{ID: model, Object: "model"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: data})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newProviderServer creates a mock provider that lists the given models and passes every other request to handler
+func newProviderServer(t testing.TB, handler http.HandlerFunc, models ...string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			handler(w, r)
+			return
+		}
+
+		data := make([]Model, 0, len(models))
+		for _, model := range models {
+			data = append(data, Model{ID: model, Object: "model"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: data})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestRouter creates a router for config, shut down when the test ends, with its models refreshed
+func newTestRouter(t testing.TB, config *Config) *Router {
+	t.Helper()
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	t.Cleanup(router.Shutdown)
+
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+	return router
+}
+
+// TestProviderTokenFile tests that a provider token is read from TokenFile
+func TestProviderTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{
+				Name:      "secret",
+				BaseURL:   "http://localhost:1/v1",
+				Token:     "inline-token",
+				TokenFile: tokenFile,
+				Enabled:   true,
+			},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	provider := router.Providers["secret"]
+	if provider.Token != "file-token" {
+		t.Errorf("Expected provider token 'file-token', got '%s'", provider.Token)
+	}
+
+	client, ok := provider.Client.(*OpenAIClientImpl)
+	if !ok {
+		t.Fatalf("Expected *OpenAIClientImpl, got %T", provider.Client)
+	}
+	if client.Token != "file-token" {
+		t.Errorf("Expected client token 'file-token', got '%s'", client.Token)
+	}
+}
+
+// TestProviderTokenFileMissing tests that an unreadable token file is reported
+func TestProviderTokenFileMissing(t *testing.T) {
+	config := &Config{
+		Providers: []ProviderConfig{
+			{
+				Name:      "secret",
+				BaseURL:   "http://localhost:1/v1",
+				TokenFile: filepath.Join(t.TempDir(), "missing"),
+				Enabled:   true,
+			},
+		},
+	}
+
+	if _, err := NewRouter(config, &testLogger{}); err == nil {
+		t.Error("Expected error for missing token file")
+	}
+}
+
+// TestHealthReportsDegradedModels tests that models whose only provider is down are reported
+func TestHealthReportsDegradedModels(t *testing.T) {
+	serverA := newModelsServer(t, "shared-model", "only-a")
+	serverB := newModelsServer(t, "shared-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	router.DisableProvider("a", "test")
+
+	w := httptest.NewRecorder()
+	router.HandleHealth(w, httptest.NewRequest("GET", "/health", nil))
+
+	var health struct {
+		Models         int      `json:"models"`
+		DegradedModels []string `json:"degraded_models"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+
+	if health.Models != 1 {
+		t.Errorf("Expected 1 available model, got %d", health.Models)
+	}
+	if len(health.DegradedModels) != 1 || health.DegradedModels[0] != "only-a" {
+		t.Errorf("Expected degraded_models [only-a], got %v", health.DegradedModels)
+	}
+
+	// A refresh while the provider is still down keeps the model degraded
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+	router.ModelMapMu.RLock()
+	degraded := router.degradedModels()
+	router.ModelMapMu.RUnlock()
+	if len(degraded) != 1 || degraded[0] != "only-a" {
+		t.Errorf("Expected only-a to remain degraded after refresh, got %v", degraded)
+	}
+}
+
+// TestProvidersConcurrentAccess tests that provider lookups are safe while providers
+// are disabled, re-enabled and models are refreshed, run with -race
+func TestProvidersConcurrentAccess(t *testing.T) {
+	serverA := newModelsServer(t, "shared-model")
+	serverB := newModelsServer(t, "shared-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if providerName, err := router.GetProviderForModel("shared-model"); err == nil {
+					router.incrementActiveCompletions(providerName)
+					router.decrementActiveCompletions(providerName)
+				}
+				router.HandleHealth(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 10; j++ {
+			router.DisableProvider("a", "test")
+			router.EnableProvider("a")
+			router.RefreshModels(context.Background())
+		}
+	}()
+
+	wg.Wait()
+
+	for name, provider := range router.Providers {
+		if provider.ActiveCompletions != 0 {
+			t.Errorf("Expected 0 active completions for %s, got %d", name, provider.ActiveCompletions)
+		}
+	}
+}
+
+// TestListModelsMetadata tests that configured model metadata is included in the model list
+func TestListModelsMetadata(t *testing.T) {
+	supportsTools := true
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "static", BaseURL: "http://localhost:1/v1", Enabled: true, Models: []string{"gpt-4.1", "plain-model"}},
+		},
+		Models: map[string]ModelMetadata{
+			"gpt-4.1": {ContextLength: 1047576, MaxOutputTokens: 32768, SupportsTools: &supportsTools},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	w := httptest.NewRecorder()
+	router.HandleModels(w, httptest.NewRequest("GET", "/v1/models", nil))
+
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode models response: %v", err)
+	}
+
+	if len(response.Data) != 2 {
+		t.Fatalf("Expected 2 models, got %d", len(response.Data))
+	}
+
+	model := response.Data[0]
+	if model["id"] != "gpt-4.1" {
+		t.Fatalf("Expected first model 'gpt-4.1', got %v", model["id"])
+	}
+	if model["context_length"] != float64(1047576) {
+		t.Errorf("Expected context_length 1047576, got %v", model["context_length"])
+	}
+	if model["max_output_tokens"] != float64(32768) {
+		t.Errorf("Expected max_output_tokens 32768, got %v", model["max_output_tokens"])
+	}
+	if model["supports_tools"] != true {
+		t.Errorf("Expected supports_tools true, got %v", model["supports_tools"])
+	}
+	if _, exists := model["supports_vision"]; exists {
+		t.Error("Expected supports_vision to be omitted when not configured")
+	}
+
+	if _, exists := response.Data[1]["context_length"]; exists {
+		t.Error("Expected no metadata for a model without configuration")
+	}
+}
+
+// TestChatCompletionRejectsEmbeddingModel tests that chat requests for embedding models are rejected with a 400
+func TestChatCompletionRejectsEmbeddingModel(t *testing.T) {
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "static", BaseURL: "http://localhost:1/v1", Enabled: true, Models: []string{"text-embedding-3-small", "bge-m3", "chat-model"}},
+		},
+		EmbeddingModels: EmbeddingModelsConfig{
+			Patterns: []string{"*embedding*"},
+			Models:   []string{"bge-m3"},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	for _, model := range []string{"text-embedding-3-small", "bge-m3"} {
+		body := `{"model":"` + model + `","messages":[{"role":"user","content":"hi"}]}`
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", model, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "embedding model") {
+			t.Errorf("Expected embedding model error for %s, got %q", model, w.Body.String())
+		}
+	}
+
+	if router.isEmbeddingModel("chat-model") {
+		t.Error("Expected chat-model not to be classified as an embedding model")
+	}
+}
+
+// TestChatCompletionsPathAlias tests that chat completions work with and without the /v1 prefix
+func TestChatCompletionsPathAlias(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`
+	responses := make(map[string]string)
+	for _, path := range []string{"/v1/chat/completions", "/chat/completions"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d: %s", path, w.Code, w.Body.String())
+		}
+		responses[path] = w.Body.String()
+	}
+
+	if responses["/v1/chat/completions"] != responses["/chat/completions"] {
+		t.Errorf("Expected identical responses, got %q and %q", responses["/v1/chat/completions"], responses["/chat/completions"])
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", calls)
+	}
+}
+
+// TestChatCompletionRejectsMultipleChoices tests that n > 1 is rejected with an explanatory 400
+func TestChatCompletionRejectsMultipleChoices(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","n":2,"messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "n=2 is not supported") {
+		t.Errorf("Expected explanatory message, got %q", w.Body.String())
+	}
+	if calls != 0 {
+		t.Errorf("Expected no upstream calls, got %d", calls)
+	}
+
+	// n=1 is accepted
+	body = `{"model":"chat-model","n":1,"messages":[{"role":"user","content":"hi"}]}`
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for n=1, got %d", w.Code)
+	}
+}
+
+// TestStreamingChatCompletionDroppedConnection tests that an error event is sent when the upstream stream drops
+func TestStreamingChatCompletionDroppedConnection(t *testing.T) {
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// Send the first chunk then drop the connection without finishing the stream
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		conn.Close()
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	output := w.Body.String()
+	if !strings.Contains(output, `"content":"Hel"`) {
+		t.Errorf("Expected the first chunk to be forwarded, got %q", output)
+	}
+	if !strings.Contains(output, `"type":"stream_error"`) {
+		t.Errorf("Expected a stream error event, got %q", output)
+	}
+	if strings.Contains(output, "[DONE]") {
+		t.Errorf("Expected no [DONE] marker for an interrupted stream, got %q", output)
+	}
+}
+
+// TestModelIDNormalization tests that providers reporting the same model with different casing are merged
+func TestModelIDNormalization(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"GPT-4"}, nil, &callsA)
+	serverB := newChatServer(t, []string{"gpt-4 "}, nil, &callsB)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+		ModelIDs: ModelIDsConfig{CaseInsensitive: true},
+	}
+
+	router := newTestRouter(t, config)
+
+	models := router.ListModels()
+	if len(models.Data) != 1 || models.Data[0].ID != "gpt-4" {
+		t.Fatalf("Expected a single merged model 'gpt-4', got %+v", models.Data)
+	}
+	if providers := router.ModelMap["gpt-4"]; len(providers) != 2 {
+		t.Fatalf("Expected merged model to be served by 2 providers, got %v", providers)
+	}
+
+	// Each provider receives the model ID it reported
+	for providerName, expected := range map[string]string{"a": "GPT-4", "b": "gpt-4"} {
+		upstreamReq, routed := router.upstreamChatRequest(providerName, &ChatCompletionRequest{Model: "Gpt-4"})
+		if upstreamReq.Model != expected || routed != "gpt-4" {
+			t.Errorf("Expected provider %s to receive model %q routed as 'gpt-4', got %q routed as %q", providerName, expected, upstreamReq.Model, routed)
+		}
+	}
+
+	resp, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model:    "Gpt-4",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+	if resp.Model != "GPT-4" && resp.Model != "gpt-4" {
+		t.Errorf("Expected upstream to receive its own model ID, got %q", resp.Model)
+	}
+}
+
+// TestStreamingActiveCompletions tests that a streamed completion counts as active on its provider until the
+// stream finishes, not only while the provider's response headers are awaited
+func TestStreamingActiveCompletions(t *testing.T) {
+	release := make(chan struct{})
+	upstream := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// Send the first chunk then hold the stream open until released
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}, "chat-model")
+	defer close(release)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: upstream.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	body := `{"model":"chat-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Once the first chunk has been relayed the stream is under way
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.Contains(line, `"content":"Hel"`) {
+		t.Fatalf("Expected the first chunk, got %q: %v", line, err)
+	}
+	if active := atomic.LoadInt64(&router.Providers["a"].ActiveCompletions); active != 1 {
+		t.Errorf("Expected the stream to be active while it is open, got %d active completions", active)
+	}
+
+	release <- struct{}{}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Failed to read the rest of the stream: %v", err)
+	}
+	if active := atomic.LoadInt64(&router.Providers["a"].ActiveCompletions); active != 0 {
+		t.Errorf("Expected no active completions once the stream finished, got %d", active)
+	}
+}
+
+// TestStreamingIncludeUsage tests that upstream usage is preserved when the client sets stream_options.include_usage
+func TestStreamingIncludeUsage(t *testing.T) {
+	sendUsage := true
+	var receivedIncludeUsage bool
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			StreamOptions struct {
+				IncludeUsage bool `json:"include_usage"`
+			} `json:"stream_options"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		receivedIncludeUsage = req.StreamOptions.IncludeUsage
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"))
+		if sendUsage {
+			w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":11,"completion_tokens":7,"total_tokens":18}}` + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	output := w.Body.String()
+	if !receivedIncludeUsage {
+		t.Errorf("Expected stream_options to be forwarded to the provider")
+	}
+	if count := strings.Count(output, `"usage"`); count != 1 {
+		t.Errorf("Expected exactly one usage chunk, got %d in %q", count, output)
+	}
+	if !strings.Contains(output, `"total_tokens":18`) {
+		t.Errorf("Expected upstream usage to be passed through unchanged, got %q", output)
+	}
+
+	// Without upstream usage the router sends its estimate once, before [DONE]
+	sendUsage = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	output = w.Body.String()
+	if count := strings.Count(output, `"usage"`); count != 1 {
+		t.Errorf("Expected exactly one estimated usage chunk, got %d in %q", count, output)
+	}
+	if strings.Index(output, `"usage"`) > strings.Index(output, "[DONE]") {
+		t.Errorf("Expected usage chunk before [DONE], got %q", output)
+	}
+}
+
+// TestStreamingNativeUsageChunk tests that a provider's trailing usage-only chunk, sent without the client asking
+// for usage, is passed through in place of the router's estimate
+func TestStreamingNativeUsageChunk(t *testing.T) {
+	sendUsage := true
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"))
+		if sendUsage {
+			w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":11,"completion_tokens":7,"total_tokens":18}}` + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	output := w.Body.String()
+	if count := strings.Count(output, `"usage"`); count != 1 {
+		t.Errorf("Expected only the provider's usage chunk, got %d usages in %q", count, output)
+	}
+	if !strings.Contains(output, `"choices":[],"usage":{"prompt_tokens":11,"completion_tokens":7,"total_tokens":18}`) {
+		t.Errorf("Expected the usage-only chunk to be passed through unchanged, got %q", output)
+	}
+	if !strings.Contains(output, `"finish_reason":"stop"}]}`+"\n\n") {
+		t.Errorf("Expected the final chunk to be sent unchanged and still separated as an event, got %q", output)
+	}
+
+	// Without the usage-only chunk the estimate is added to the final chunk
+	sendUsage = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	output = w.Body.String()
+	if count := strings.Count(output, `"usage"`); count != 1 {
+		t.Errorf("Expected the estimated usage once, got %d in %q", count, output)
+	}
+	if strings.Index(output, `"usage"`) > strings.Index(output, "[DONE]") || !strings.Contains(output, `"finish_reason":"stop"`) {
+		t.Errorf("Expected the estimate on the final chunk before [DONE], got %q", output)
+	}
+}
+
+// TestStreamingReasoningUsage tests that reasoning content streamed by a reasoning model is counted in the
+// estimated usage and reported as reasoning tokens
+func TestStreamingReasoningUsage(t *testing.T) {
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"reasoning_content":"The user said hi, "}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"reasoning_content":"so I should greet them back"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}, "reasoning-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"reasoning-model","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	var usage *Usage
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		var chunk ChatCompletionResponse
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk) == nil && chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	if usage == nil {
+		t.Fatalf("Expected an estimated usage chunk, got %q", w.Body.String())
+	}
+
+	reasoningTokens := openai.EstimateTokens("The user said hi, ") + openai.EstimateTokens("so I should greet them back")
+	if usage.CompletionTokensDetails == nil || usage.CompletionTokensDetails.ReasoningTokens != reasoningTokens {
+		t.Fatalf("Expected %d reasoning tokens in the completion details, got %+v", reasoningTokens, usage.CompletionTokensDetails)
+	}
+	if want := reasoningTokens + openai.EstimateTokens("Hello"); usage.CompletionTokens != want {
+		t.Errorf("Expected %d completion tokens including the reasoning, got %d", want, usage.CompletionTokens)
+	}
+	if usage.TotalTokens != usage.PromptTokens+usage.CompletionTokens {
+		t.Errorf("Expected the total to include the reasoning tokens, got %+v", usage)
+	}
+}
+
+// TestEmbeddingDimensionMismatch tests that embeddings with an unexpected dimension are rejected
+func TestEmbeddingDimensionMismatch(t *testing.T) {
+	newEmbeddingServer := func(dimensions int) *httptest.Server {
+		server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(EmbeddingResponse{
+				Object: "list",
+				Model:  "embed-model",
+				Data:   []Embedding{{Object: "embedding", Embedding: make([]float64, dimensions)}},
+			})
+		}, "embed-model")
+		return server
+	}
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "small", BaseURL: newEmbeddingServer(384).URL, Enabled: true},
+			{Name: "large", BaseURL: newEmbeddingServer(1024).URL, Enabled: true},
+		},
+		Pools: []PoolConfig{
+			{Name: "small", Providers: []string{"small"}},
+			{Name: "large", Providers: []string{"large"}},
+		},
+		Models: map[string]ModelMetadata{
+			"embed-model": {EmbeddingDimensions: 1024},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	resp, err := router.CreateEmbedding(context.Background(), &EmbeddingRequest{Model: "large:embed-model", Input: "hello"})
+	if err != nil {
+		t.Fatalf("Expected matching dimensions to succeed, got %v", err)
+	}
+	if len(resp.Data[0].Embedding) != 1024 {
+		t.Errorf("Expected 1024 dimensions, got %d", len(resp.Data[0].Embedding))
+	}
+
+	_, err = router.CreateEmbedding(context.Background(), &EmbeddingRequest{Model: "small:embed-model", Input: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "384 dimensions") {
+		t.Errorf("Expected dimension mismatch error, got %v", err)
+	}
+}
+
+// TestNoUsageInjectionHeader tests that usage is passed through untouched when the header is set
+func TestNoUsageInjectionHeader(t *testing.T) {
+	var calls int64
+	chatServer := newChatServer(t, []string{"chat-model"}, nil, &calls)
+	streamServer := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}, "stream-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "chat", BaseURL: chatServer.URL, Enabled: true},
+			{Name: "stream", BaseURL: streamServer.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	send := func(body string, disable bool) string {
+		httpReq := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		if disable {
+			httpReq.Header.Set(noUsageInjectionHeader, "true")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	chatBody := `{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`
+	if output := send(chatBody, false); !strings.Contains(output, `"usage"`) {
+		t.Errorf("Expected usage to be injected by default, got %q", output)
+	}
+	if output := send(chatBody, true); strings.Contains(output, `"usage"`) {
+		t.Errorf("Expected no usage with %s set, got %q", noUsageInjectionHeader, output)
+	}
+
+	streamBody := `{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	if output := send(streamBody, false); !strings.Contains(output, `"usage"`) {
+		t.Errorf("Expected usage to be injected into the stream by default, got %q", output)
+	}
+	if output := send(streamBody, true); strings.Contains(output, `"usage"`) {
+		t.Errorf("Expected no usage in the stream with %s set, got %q", noUsageInjectionHeader, output)
+	}
+}
+
+// captureLogger records debug log entries for inspection
+type captureLogger struct {
+	testLogger
+	mu      sync.Mutex
+	entries map[string][]interface{} // message -> args of the last entry
+}
+
+func (l *captureLogger) Debug(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil {
+		l.entries = make(map[string][]interface{})
+	}
+	l.entries[msg] = args
+}
+
+// field returns the value of a field in the last entry for the message
+func (l *captureLogger) field(msg, key string) interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	args := l.entries[msg]
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == key {
+			// Resolve values as a structured log handler would, the redacting logger defers formatting
+			value := args[i+1]
+			for {
+				valuer, ok := value.(slog.LogValuer)
+				if !ok {
+					return value
+				}
+				value = valuer.LogValue().Any()
+			}
+		}
+	}
+	return nil
+}
+
+// TestProviderSelectionLogging tests that the routing debug log explains the provider choice
+func TestProviderSelectionLogging(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"shared-model"}, nil, &callsA)
+	serverB := newChatServer(t, []string{"shared-model"}, nil, &callsB)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	logger := &captureLogger{}
+	router, err := NewRouter(config, logger)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	// Keep b busy so the least active choice is a
+	router.incrementActiveCompletions("b")
+	defer router.decrementActiveCompletions("b")
+
+	req := &ChatCompletionRequest{Model: "shared-model", Messages: []Message{{Role: "user", Content: "hi"}}}
+	if _, err := router.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+
+	if strategy := logger.field("routing chat completion", "strategy"); strategy != poolStrategyLeastActive {
+		t.Errorf("Expected strategy %q, got %v", poolStrategyLeastActive, strategy)
+	}
+
+	candidates, _ := logger.field("routing chat completion", "candidates").([]string)
+	sort.Strings(candidates)
+	if strings.Join(candidates, ",") != "a,b" {
+		t.Errorf("Expected candidates [a b], got %v", candidates)
+	}
+
+	active, _ := logger.field("routing chat completion", "active_completions").(map[string]int64)
+	if active["a"] != 0 || active["b"] != 1 {
+		t.Errorf("Expected active completions a=0 b=1, got %v", active)
+	}
+}
+
+// TestModelMethodNotAllowed tests that model management calls are rejected with an OpenAI error envelope
+func TestModelMethodNotAllowed(t *testing.T) {
+	server := newModelsServer(t, "org/chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/models/org/chat-model", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405, got %d: %s", w.Code, w.Body.String())
+	}
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Expected JSON error envelope: %v", err)
+	}
+	if errResp.Error.Code != "method_not_allowed" || errResp.Error.Type != "invalid_request_error" || errResp.Error.Message == "" {
+		t.Errorf("Unexpected error envelope: %+v", errResp.Error)
+	}
+
+	// Retrieving the model is still supported
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models/org/chat-model", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":"org/chat-model"`) {
+		t.Errorf("Expected model to be returned, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestChatCompletionSeedPassThrough tests that seed is forwarded and system_fingerprint is returned
+func TestChatCompletionSeedPassThrough(t *testing.T) {
+	var receivedSeed *int64
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req struct {
+			Seed *int64 `json:"seed"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		receivedSeed = req.Seed
+
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:                "chatcmpl-test",
+			Object:            "chat.completion",
+			Model:             "chat-model",
+			SystemFingerprint: "fp_test",
+			Choices:           []Choice{{Message: Message{Role: "assistant", Content: "ok"}}},
+		})
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","seed":42,"messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if receivedSeed == nil || *receivedSeed != 42 {
+		t.Errorf("Expected seed 42 to be forwarded, got %v", receivedSeed)
+	}
+
+	var resp ChatCompletionResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.SystemFingerprint != "fp_test" {
+		t.Errorf("Expected system_fingerprint 'fp_test', got %q", resp.SystemFingerprint)
+	}
+}
+
+// TestChatCompletionLegacyFunctionRole tests that a function result in the deprecated function role is accepted
+func TestChatCompletionLegacyFunctionRole(t *testing.T) {
+	var received []Message
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received = req.Messages
+
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Object:  "chat.completion",
+			Model:   "chat-model",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "It's sunny."}, FinishReason: "stop"}},
+		})
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","messages":[` +
+		`{"role":"user","content":"What is the weather?"},` +
+		`{"role":"assistant","content":"","function_call":{"name":"get_weather","arguments":"{}"}},` +
+		`{"role":"function","name":"get_weather","content":"Sunny"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a function message, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(received) != 3 || received[2].Role != "function" {
+		t.Errorf("Expected the function message to be forwarded, got %+v", received)
+	}
+}
+
+// TestChatCompletionAssistantPrefill tests that a trailing assistant message is forwarded for the model to continue
+func TestChatCompletionAssistantPrefill(t *testing.T) {
+	var received []Message
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received = req.Messages
+
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Object:  "chat.completion",
+			Model:   "chat-model",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: " 42."}, FinishReason: "stop"}},
+		})
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","messages":[{"role":"user","content":"What is the answer?"},{"role":"assistant","content":"The answer is"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(received) != 2 || received[1].Role != "assistant" || received[1].GetContentAsString() != "The answer is" {
+		t.Errorf("Expected trailing assistant message to be forwarded, got %+v", received)
+	}
+
+	// Requests with no messages or unknown roles are rejected
+	for _, invalid := range []string{
+		`{"model":"chat-model","messages":[]}`,
+		`{"model":"chat-model","messages":[{"role":"robot","content":"hi"}]}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(invalid)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", invalid, w.Code)
+		}
+	}
+}
+
+// TestProviderEmptyModelsFlagged tests that a provider returning no models is flagged and optionally disabled
+func TestProviderEmptyModelsFlagged(t *testing.T) {
+	emptyServer := newModelsServer(t)
+	server := newModelsServer(t, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "empty", BaseURL: emptyServer.URL, Enabled: true},
+			{Name: "ok", BaseURL: server.URL, Enabled: true},
+		},
+		Health: HealthConfig{EmptyModelsThreshold: 2, DisableEmptyProviders: true},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	isHealthy := func(name string) bool {
+		router.ProvidersMu.RLock()
+		defer router.ProvidersMu.RUnlock()
+		return router.Providers[name].Healthy
+	}
+
+	router.RefreshModels(context.Background())
+	if !isHealthy("empty") {
+		t.Fatalf("Expected provider to stay healthy before reaching the threshold")
+	}
+
+	router.RefreshModels(context.Background())
+	if isHealthy("empty") {
+		t.Errorf("Expected provider returning no models to be disabled after 2 refreshes")
+	}
+	if !isHealthy("ok") {
+		t.Errorf("Expected provider with models to stay healthy")
+	}
+
+	// The health check does not re-enable a provider that still has no models
+	router.checkDisabledProviders()
+	if isHealthy("empty") {
+		t.Errorf("Expected provider with no models to stay disabled")
+	}
+}
+
+// TestConversationItemsChronological tests that items added with created_at are listed chronologically rather
+// than in the order they were added, and items without one are created now
+func TestConversationItemsChronological(t *testing.T) {
+	router, err := NewRouter(&Config{}, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/conversations", strings.NewReader(`{}`)))
+	var conversation struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(w.Body).Decode(&conversation)
+
+	body := `{"items":[
+		{"id":"msg_now","type":"message","role":"user"},
+		{"id":"msg_second","type":"message","role":"assistant","created_at":1700000200},
+		{"id":"msg_first","type":"message","role":"user","created_at":1700000100}
+	]}`
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/conversations/"+conversation.ID+"/items", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/conversations/"+conversation.ID+"/items?order=asc", nil))
+	var items struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&items)
+
+	var ids []string
+	for _, item := range items.Data {
+		ids = append(ids, item.ID)
+	}
+	if strings.Join(ids, ",") != "msg_first,msg_second,msg_now" {
+		t.Errorf("Expected items in chronological order, got %v", ids)
+	}
+}
+
+// TestResponseAttachedToConversation tests that a response created with a conversation adds its items to it,
+// whether or not the model's provider serves the responses API natively
+func TestResponseAttachedToConversation(t *testing.T) {
+	for _, native := range []bool{false, true} {
+		t.Run(fmt.Sprintf("native=%v", native), func(t *testing.T) {
+			var calls int64
+			server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+			config := &Config{
+				Providers: []ProviderConfig{
+					{Name: "a", BaseURL: server.URL, Enabled: true, NativeResponses: native},
+				},
+			}
+
+			router := newTestRouter(t, config)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/conversations", strings.NewReader(`{}`)))
+			if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+				t.Fatalf("Expected conversation to be created, got %d: %s", w.Code, w.Body.String())
+			}
+			var conversation struct {
+				ID string `json:"id"`
+			}
+			json.NewDecoder(w.Body).Decode(&conversation)
+
+			body := `{"model":"chat-model","input":["hello"],"conversation":"` + conversation.ID + `"}`
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(body)))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/conversations/"+conversation.ID+"/items?order=asc", nil))
+			var items struct {
+				Data []struct {
+					Role    string `json:"role"`
+					Content []struct {
+						Type string `json:"type"`
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"data"`
+			}
+			json.NewDecoder(w.Body).Decode(&items)
+
+			if len(items.Data) != 2 {
+				t.Fatalf("Expected input and output items in the conversation, got %+v", items.Data)
+			}
+			if items.Data[0].Role != "user" || items.Data[0].Content[0].Text != "hello" {
+				t.Errorf("Expected the user input first, got %+v", items.Data[0])
+			}
+			if items.Data[1].Role != "assistant" || items.Data[1].Content[0].Type != "output_text" || items.Data[1].Content[0].Text != "ok" {
+				t.Errorf("Expected the assistant output second, got %+v", items.Data[1])
+			}
+
+			// Responses can't be attached to a conversation that doesn't exist
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(`{"model":"chat-model","input":["hello"],"conversation":{"id":"conv_missing"}}`)))
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected 404 for an unknown conversation, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// TestBackgroundResponsePollHint tests that creating a background response tells the client when to poll
+func TestBackgroundResponsePollHint(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"chat-model"}, nil, &calls)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+		Responses: types.ResponsesConfig{PollInterval: 5},
+	}
+
+	router := newTestRouter(t, config)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(`{"model":"chat-model","input":["hello"],"background":true}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Expected Retry-After 5, got %q", got)
+	}
+
+	// Completed responses need no polling
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(`{"model":"chat-model","input":["hello"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Expected no Retry-After for a completed response, got %q", got)
+	}
+}
+
+// TestEmbeddingLoadBalancingAndFailover tests that embeddings avoid busy providers and stop using a provider that can't be reached
+func TestEmbeddingLoadBalancingAndFailover(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	newEmbeddingServer := func(name string, block bool) *httptest.Server {
+		server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			started <- name
+			if block {
+				<-release
+			}
+			json.NewEncoder(w).Encode(EmbeddingResponse{
+				Object: "list",
+				Model:  name,
+				Data:   []Embedding{{Object: "embedding", Embedding: []float64{1, 2, 3}}},
+			})
+		}, "embed-model")
+		return server
+	}
+
+	// Both providers hold their first request until released, so the second request sees the first in flight
+	serverA := newEmbeddingServer("a", true)
+	serverB := newEmbeddingServer("b", true)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	errs := make(chan error, 2)
+	embed := func() {
+		_, err := router.CreateEmbedding(context.Background(), &EmbeddingRequest{Model: "embed-model", Input: "hello"})
+		errs <- err
+	}
+
+	go embed()
+	first := <-started
+	go embed()
+	second := <-started
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("CreateEmbedding failed: %v", err)
+		}
+	}
+	if first == second {
+		t.Errorf("Expected concurrent embeddings to be spread across providers, both went to %s", first)
+	}
+
+	// Once a provider can't be reached it is disabled and embeddings go to the other
+	down, up := serverA, "b"
+	if first == "b" {
+		down, up = serverB, "a"
+	}
+	down.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := router.CreateEmbedding(context.Background(), &EmbeddingRequest{Model: "embed-model", Input: "hello"})
+		if err != nil {
+			continue // The request that discovers the provider is down fails
+		}
+		<-started
+		if resp.Model != up {
+			t.Errorf("Expected embeddings to fail over to %s, got %s", up, resp.Model)
+		}
+	}
+
+	if _, err := router.CreateEmbedding(context.Background(), &EmbeddingRequest{Model: "embed-model", Input: "hello"}); err != nil {
+		t.Errorf("Expected embeddings to succeed after failover, got %v", err)
+	}
+}
+
+// TestProviderHeaders tests that completions report the provider and model that served them only when enabled
+func TestProviderHeaders(t *testing.T) {
+	var calls int64
+	chatServer := newChatServer(t, []string{"chat-model"}, nil, &calls)
+	streamServer := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}, "Stream-Model")
+
+	for _, enabled := range []bool{true, false} {
+		config := &Config{
+			Server: ServerConfig{ProviderHeaders: enabled},
+			Providers: []ProviderConfig{
+				{Name: "chat", BaseURL: chatServer.URL, Enabled: true},
+				{Name: "stream", BaseURL: streamServer.URL, Enabled: true},
+			},
+			ModelIDs: ModelIDsConfig{CaseInsensitive: true},
+		}
+
+		router := newTestRouter(t, config)
+
+		for _, tc := range []struct {
+			body, provider, model string
+		}{
+			{`{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`, "chat", "chat-model"},
+			{`{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`, "stream", "Stream-Model"},
+		} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tc.body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			provider, model := w.Header().Get("X-LLMRouter-Provider"), w.Header().Get("X-LLMRouter-Model")
+			if !enabled {
+				if provider != "" || model != "" {
+					t.Errorf("Expected no provider headers when disabled, got %q, %q", provider, model)
+				}
+				continue
+			}
+			if provider != tc.provider || model != tc.model {
+				t.Errorf("Expected provider %q and model %q, got %q, %q", tc.provider, tc.model, provider, model)
+			}
+		}
+	}
+}
+
+// TestConnectionErrorPatterns tests that errors matching a configured pattern disable the provider
+func TestConnectionErrorPatterns(t *testing.T) {
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"Backend Overloaded, try later"}`))
+	}, "chat-model")
+
+	for _, patterns := range [][]string{nil, {"backend overloaded"}} {
+		config := &Config{
+			Providers: []ProviderConfig{
+				{Name: "a", BaseURL: server.URL, Enabled: true},
+			},
+			Health: HealthConfig{ConnectionErrorPatterns: patterns},
+		}
+
+		router := newTestRouter(t, config)
+
+		if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+			Model:    "chat-model",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+		}); err == nil {
+			t.Fatal("Expected the completion to fail")
+		}
+
+		healthy := router.getProvider("a").Healthy
+		if patterns == nil && !healthy {
+			t.Error("Expected the provider to stay enabled without a matching pattern")
+		}
+		if patterns != nil && healthy {
+			t.Error("Expected the provider to be disabled by the configured pattern")
+		}
+	}
+}
+
+// TestKeepLastProvider tests that a connection error doesn't remove the only provider of a model when the guard is enabled
+func TestKeepLastProvider(t *testing.T) {
+	// Nothing listens on the port, so requests fail with connection refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	baseURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	for _, keep := range []bool{true, false} {
+		config := &Config{
+			Providers: []ProviderConfig{
+				{Name: "a", BaseURL: baseURL, Enabled: true, Models: []string{"chat-model"}},
+			},
+			Health: HealthConfig{KeepLastProvider: keep},
+		}
+
+		router := newTestRouter(t, config)
+
+		if _, err := router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+			Model:    "chat-model",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+		}); err == nil {
+			t.Fatal("Expected the completion to fail")
+		}
+
+		_, err = router.GetProviderForModel("chat-model")
+		if keep && err != nil {
+			t.Errorf("Expected the only provider to be kept, got %v", err)
+		}
+		if !keep && err == nil {
+			t.Error("Expected the provider to be disabled without the guard")
+		}
+	}
+}
+
+// streamBody is an upstream stream including a comment, blank-line variations and a chunk without a trailing newline
+const streamBody = ": keep-alive\n\n" +
+	`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}` + "\r\n\r\n" +
+	`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}` + "\n\n" +
+	"data: [DONE]"
+
+// newStreamServer returns a provider serving stream-model that streams body for every completion
+func newStreamServer(t testing.TB, body string) *httptest.Server {
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(body))
+	}, "stream-model")
+	return server
+}
+
+// newStreamRouter returns a router for a stream server, with passthrough streaming when set
+func newStreamRouter(t testing.TB, server *httptest.Server, passthrough bool) *Router {
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "stream", BaseURL: server.URL, Enabled: true},
+		},
+		Streaming: StreamingConfig{PassthroughOnly: passthrough},
+	}
+	return newTestRouter(t, config)
+}
+
+// TestStreamingPassthrough tests that passthrough streaming returns the provider's stream unchanged
+func TestStreamingPassthrough(t *testing.T) {
+	router := newStreamRouter(t, newStreamServer(t, streamBody), true)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Body.String() != streamBody {
+		t.Errorf("Expected the stream unchanged, got %q", w.Body.String())
+	}
+}
+
+// BenchmarkStreamingChatCompletion compares the usage counting and passthrough streaming paths
+func BenchmarkStreamingChatCompletion(b *testing.B) {
+	var body strings.Builder
+	for i := 0; i < 500; i++ {
+		body.WriteString(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"token "}}]}` + "\n\n")
+	}
+	body.WriteString(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n")
+	body.WriteString("data: [DONE]\n\n")
+	server := newStreamServer(b, body.String())
+
+	for _, bc := range []struct {
+		name        string
+		passthrough bool
+	}{
+		{"counting", false},
+		{"passthrough", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			router := newStreamRouter(b, server, bc.passthrough)
+			request := `{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(request)))
+				if w.Code != http.StatusOK {
+					b.Fatalf("Expected 200, got %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestLogprobsRoundTrip tests that logprobs are requested from the provider and returned to the client
+func TestLogprobsRoundTrip(t *testing.T) {
+	const logprobs = `{"content":[{"token":"ok","logprob":-0.1,"bytes":[111,107],"top_logprobs":[{"token":"ok","logprob":-0.1,"bytes":[111,107]}]}]}`
+
+	var upstream map[string]any
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstream)
+		if upstream["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"ok"},"logprobs":` + logprobs + `,"finish_reason":"stop"}]}` + "\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-test","object":"chat.completion","model":"chat-model","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"logprobs":` + logprobs + `,"finish_reason":"stop"}]}`))
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"chat-model","stream":%v,"logprobs":true,"top_logprobs":1,"messages":[{"role":"user","content":"hi"}]}`, stream)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		if upstream["logprobs"] != true || upstream["top_logprobs"] != float64(1) {
+			t.Errorf("Expected logprobs and top_logprobs to be forwarded, got %v and %v", upstream["logprobs"], upstream["top_logprobs"])
+		}
+
+		// Pull the choice out of the response, or the last data chunk when streaming
+		output := w.Body.String()
+		if stream {
+			for _, line := range strings.Split(output, "\n") {
+				if strings.HasPrefix(line, "data: {") {
+					output = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}
+
+		var resp struct {
+			Choices []struct {
+				Logprobs json.RawMessage `json:"logprobs"`
+			} `json:"choices"`
+			Usage *Usage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(output), &resp); err != nil {
+			t.Fatalf("Failed to decode response %q: %v", output, err)
+		}
+		if len(resp.Choices) != 1 || string(resp.Choices[0].Logprobs) != logprobs {
+			t.Errorf("Expected logprobs to reach the client (stream=%v), got %s", stream, output)
+		}
+		if resp.Usage == nil {
+			t.Errorf("Expected usage to still be injected (stream=%v)", stream)
+		}
+	}
+}
+
+// TestRecoveredProviderRoutableImmediately tests that a provider's models are routable as soon as the health check re-enables it
+func TestRecoveredProviderRoutableImmediately(t *testing.T) {
+	serverA := newModelsServer(t, "shared-model", "Only-A")
+	serverB := newModelsServer(t, "shared-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+		ModelIDs: ModelIDsConfig{CaseInsensitive: true},
+	}
+
+	router := newTestRouter(t, config)
+
+	router.DisableProvider("a", "test")
+	if _, err := router.GetProviderForModel("only-a"); err == nil {
+		t.Fatal("Expected only-a to be unavailable while its provider is disabled")
+	}
+
+	router.checkDisabledProviders()
+
+	provider, err := router.GetProviderForModel("only-a")
+	if err != nil || provider != "a" {
+		t.Fatalf("Expected only-a to be routable to a once checkDisabledProviders returns, got %q, %v", provider, err)
+	}
+	if _, upstream := router.upstreamModel("a", "only-a"); upstream != "Only-A" {
+		t.Errorf("Expected requests to use the provider's model ID Only-A, got %s", upstream)
+	}
+
+	router.ModelMapMu.RLock()
+	shared := router.ModelMap["shared-model"]
+	router.ModelMapMu.RUnlock()
+	if len(shared) != 2 {
+		t.Errorf("Expected shared-model to be served by both providers, got %v", shared)
+	}
+}
+
+// TestStreamedToolCallsAggregated tests that tool call fragments from a stream are rebuilt into complete tool calls,
+// both for logging and in the audit record
+func TestStreamedToolCallsAggregated(t *testing.T) {
+	chunks := []string{
+		`{"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\",\"days\":3}"}}]}}]}`,
+		`{"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	}
+	var body strings.Builder
+	for _, chunk := range chunks {
+		body.WriteString("data: " + chunk + "\n\n")
+	}
+	body.WriteString("data: [DONE]\n\n")
+	server := newStreamServer(t, body.String())
+
+	logger := &captureLogger{}
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "stream", BaseURL: server.URL, Enabled: true},
+		},
+		Streaming: StreamingConfig{AggregateToolCalls: true},
+		Audit:     AuditConfig{Enabled: true, StoragePath: t.TempDir()},
+	}
+
+	router, err := NewRouter(config, logger)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+	if err := router.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"weather?"}]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	calls, ok := logger.field("streamed tool calls", "tool_calls").([]ToolCall)
+	if !ok || len(calls) != 1 {
+		t.Fatalf("Expected one aggregated tool call, got %v", logger.field("streamed tool calls", "tool_calls"))
+	}
+	call := calls[0]
+	if call.ID != "call_1" || call.Function.Name != "get_weather" {
+		t.Errorf("Expected call_1 to get_weather, got %s to %s", call.ID, call.Function.Name)
+	}
+	if call.Function.Arguments["city"] != "Paris" || call.Function.Arguments["days"] != float64(3) {
+		t.Errorf("Expected the arguments to be reassembled, got %v", call.Function.Arguments)
+	}
+
+	record, err := router.audit.Get(context.Background(), auditID(w))
+	if err != nil {
+		t.Fatalf("Failed to get audit record: %v", err)
+	}
+	var audited ChatCompletionResponse
+	if err := json.Unmarshal(record.Response, &audited); err != nil {
+		t.Fatalf("Failed to decode audited response: %v", err)
+	}
+	if len(audited.Choices) != 1 || len(audited.Choices[0].Message.ToolCalls) != 1 || audited.Choices[0].Message.ToolCalls[0].ID != "call_1" {
+		t.Errorf("Expected the audit record to capture the tool call, got %s", record.Response)
+	}
+}
+
+// TestHandleModelsExpandProviders tests that ?expand=providers annotates each model with its providers
+func TestHandleModelsExpandProviders(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"shared-model"}, nil, &callsA)
+	serverB := newChatServer(t, []string{"shared-model", "b-model"}, nil, &callsB)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	listModels := func(path string) []map[string]any {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from %s, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []map[string]any `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	for _, model := range listModels("/v1/models") {
+		if _, exists := model["providers"]; exists {
+			t.Errorf("Expected the default listing to omit providers, got %v", model)
+		}
+	}
+
+	expanded := listModels("/v1/models?expand=providers")
+	if len(expanded) != 2 {
+		t.Fatalf("Expected 2 models, got %v", expanded)
+	}
+	expected := map[string]string{
+		"b-model":      `[{"excluded":false,"healthy":true,"name":"b"}]`,
+		"shared-model": `[{"excluded":false,"healthy":true,"name":"a"},{"excluded":false,"healthy":true,"name":"b"}]`,
+	}
+	for _, model := range expanded {
+		providers, _ := json.Marshal(model["providers"])
+		if string(providers) != expected[model["id"].(string)] {
+			t.Errorf("Model %v: expected providers %s, got %s", model["id"], expected[model["id"].(string)], providers)
+		}
+	}
+}
+
+// TestGzipChatCompletion tests that a gzipped request body is accepted and the response is gzipped when asked for
+func TestGzipChatCompletion(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"gpt-4"}, nil, &calls)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+	gz.Close()
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzipped response, got headers %v", w.Header())
+	}
+
+	body, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip response: %v", err)
+	}
+	var resp ChatCompletionResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "ok" || calls != 1 {
+		t.Errorf("Expected the completion from the provider, got %+v after %d calls", resp, calls)
+	}
+}
+
+// TestGzipRequestBodyLimit tests that a gzipped body expanding past the size limit is rejected with a 413
+func TestGzipRequestBodyLimit(t *testing.T) {
+	router, err := NewRouter(&Config{}, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	// Compresses to a few KB
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"model":"gpt-4","input":"`))
+	gz.Write(bytes.Repeat([]byte("a"), maxRequestBodySize))
+	gz.Write([]byte(`"}`))
+	gz.Close()
+
+	for _, path := range []string{"/v1/chat/completions", "/v1/embeddings"} {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(compressed.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+// listCountingClient counts the model list requests made through a client
+type listCountingClient struct {
+	OpenAIClient
+	listCalls int64
+}
+
+func (c *listCountingClient) ListModels(ctx context.Context) (*ModelsResponse, error) {
+	atomic.AddInt64(&c.listCalls, 1)
+	return c.OpenAIClient.ListModels(ctx)
+}
+
+// TestHealthCheckTCPProbe tests that a provider whose host doesn't accept connections fails the health check
+// without an HTTP request, while a reachable provider still recovers
+func TestHealthCheckTCPProbe(t *testing.T) {
+	var calls int64
+	server := newChatServer(t, []string{"up-model"}, nil, &calls)
+
+	// Nothing listens on a port that was just released
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	unreachable := "http://" + listener.Addr().String() + "/v1"
+	listener.Close()
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "down", BaseURL: unreachable, Enabled: true},
+			{Name: "up", BaseURL: server.URL, Enabled: true},
+		},
+		Health: HealthConfig{TCPProbeTimeout: 1},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	down := &listCountingClient{OpenAIClient: router.Providers["down"].Client}
+	router.Providers["down"].Client = down
+	router.DisableProvider("down", "test")
+	router.DisableProvider("up", "test")
+
+	start := time.Now()
+	router.checkDisabledProviders()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the unreachable provider to fail within the probe timeout, took %s", elapsed)
+	}
+
+	if calls := atomic.LoadInt64(&down.listCalls); calls != 0 {
+		t.Errorf("Expected no model list request to the unreachable provider, got %d", calls)
+	}
+
+	router.ProvidersMu.RLock()
+	defer router.ProvidersMu.RUnlock()
+	if router.Providers["down"].Healthy {
+		t.Error("Expected the unreachable provider to stay disabled")
+	}
+	if !router.Providers["up"].Healthy {
+		t.Error("Expected the reachable provider to recover")
+	}
+}
+
+// TestRouteRecorderNested tests that completions made while serving a request keep their own route and don't
+// overwrite the route recorded for the request
+func TestRouteRecorderNested(t *testing.T) {
+	ctx := WithRouteContext(context.Background())
+
+	// A retried completion records its own route, the request keeps the first
+	first, firstRoute := withRouteRecorder(ctx)
+	recordRoute(first, "a", "model-a")
+	retry, retryRoute := withRouteRecorder(ctx)
+	recordRoute(retry, "b", "model-b")
+	if got := firstRoute.get(); got.provider != "a" || got.model != "model-a" {
+		t.Errorf("Expected the first attempt to record a/model-a, got %+v", got)
+	}
+	if got := retryRoute.get(); got.provider != "b" || got.model != "model-b" {
+		t.Errorf("Expected the retry to record b/model-b, got %+v", got)
+	}
+
+	// Nested completions, such as from tools, run concurrently and don't replace the route
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nested, _ := withRouteRecorder(first)
+			recordRoute(nested, fmt.Sprintf("nested-%d", i), "nested-model")
+		}()
+	}
+	wg.Wait()
+
+	if ProviderFromContext(ctx) != "a" || ModelFromContext(ctx) != "model-a" {
+		t.Errorf("Expected the request to keep the first route, got %s/%s", ProviderFromContext(ctx), ModelFromContext(ctx))
+	}
+	if got := firstRoute.get(); got.provider != "a" {
+		t.Errorf("Expected nested completions not to overwrite the route, got %+v", got)
+	}
+}
+
+// TestRouteContext tests that middleware wrapping the router can read the provider and model a request was routed to
+func TestRouteContext(t *testing.T) {
+	router := newMockRouter(t, map[string]*MockClient{
+		"a": {Models: []string{"chat-model"}},
+		"b": {Models: []string{"embed-model"}},
+	})
+
+	var provider, model string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		req = req.WithContext(WithRouteContext(req.Context()))
+		router.ServeHTTP(w, req)
+		provider, model = ProviderFromContext(req.Context()), ModelFromContext(req.Context())
+	}
+
+	requests := []struct {
+		path, body, provider, model string
+	}{
+		{"/v1/chat/completions", `{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`, "a", "chat-model"},
+		{"/v1/chat/completions", `{"model":"chat-model","stream":true,"messages":[{"role":"user","content":"hi"}]}`, "a", "chat-model"},
+		{"/v1/embeddings", `{"model":"embed-model","input":"hi"}`, "b", "embed-model"},
+	}
+	for _, tt := range requests {
+		provider, model = "", ""
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.path, w.Code, w.Body.String())
+		}
+		if provider != tt.provider || model != tt.model {
+			t.Errorf("%s: expected route %s/%s in the context, got %q/%q", tt.path, tt.provider, tt.model, provider, model)
+		}
+	}
+
+	if provider := ProviderFromContext(context.Background()); provider != "" {
+		t.Errorf("Expected no provider without a route context, got %q", provider)
+	}
+}
+
+// TestRefreshModelsLogOrder tests that a refresh logs providers in the same sorted order every time
+func TestRefreshModelsLogOrder(t *testing.T) {
+	config := &Config{}
+	for _, name := range []string{"echo", "bravo", "delta", "alpha", "foxtrot", "charlie"} {
+		config.Providers = append(config.Providers, ProviderConfig{Name: name, BaseURL: "http://" + name + ".invalid", Enabled: true, Models: []string{"shared-model"}})
+	}
+
+	logger := &recordingLogger{}
+	router, err := NewRouter(config, logger)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	// refreshLog returns the refresh log lines naming providers
+	refreshLog := func() string {
+		logger.mu.Lock()
+		logger.out.Reset()
+		logger.mu.Unlock()
+
+		if err := router.RefreshModels(context.Background()); err != nil {
+			t.Fatalf("RefreshModels failed: %v", err)
+		}
+
+		var lines []string
+		for _, line := range strings.Split(logger.String(), "\n") {
+			if strings.Contains(line, "using static models") || strings.Contains(line, "multiple providers") {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	first := refreshLog()
+	if second := refreshLog(); first != second {
+		t.Errorf("Expected the same log order on every refresh, got:\n%s\nthen:\n%s", first, second)
+	}
+	if !strings.Contains(first, "[alpha bravo charlie delta echo foxtrot]") {
+		t.Errorf("Expected the providers of the shared model in sorted order, got:\n%s", first)
+	}
+	if alpha, foxtrot := strings.Index(first, "provider alpha"), strings.Index(first, "provider foxtrot"); alpha < 0 || alpha > foxtrot {
+		t.Errorf("Expected the static models of alpha to be logged before foxtrot, got:\n%s", first)
+	}
+}
+
+// TestProviderProxy tests that requests to a provider with a proxy configured are sent through the proxy
+func TestProviderProxy(t *testing.T) {
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxied request carries the absolute URL of the provider
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: "proxied-model", Object: "model"}}})
+	}))
+	defer proxy.Close()
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://provider.invalid/v1", Enabled: true, Proxy: proxy.URL},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	if _, err := router.GetProviderForModel("proxied-model"); err != nil {
+		t.Errorf("Expected the models listed through the proxy to be routable: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(proxied) != 1 || proxied[0] != "http://provider.invalid/v1/models" {
+		t.Errorf("Expected the model list request to go through the proxy, got %v", proxied)
+	}
+
+	// An unusable proxy URL is rejected at startup
+	config.Providers[0].Proxy = "ftp://proxy.invalid"
+	if _, err := NewRouter(config, &testLogger{}); err == nil || !strings.Contains(err.Error(), "unsupported proxy scheme") {
+		t.Errorf("Expected an unsupported proxy scheme error, got %v", err)
+	}
+}
+
+// TestHealthCheckTCPProbeSkippedForProxy tests that a provider reached through a proxy is checked through the
+// proxy rather than probed directly
+func TestHealthCheckTCPProbeSkippedForProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list", Data: []Model{{ID: "proxied-model", Object: "model"}}})
+	}))
+	defer proxy.Close()
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://provider.invalid/v1", Enabled: true, Proxy: proxy.URL},
+		},
+		Health: HealthConfig{TCPProbeTimeout: 1},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	if !proxiedProvider(router.Providers["a"]) {
+		t.Fatal("Expected the provider to be reported as proxied")
+	}
+
+	router.DisableProvider("a", "test")
+	router.checkDisabledProviders()
+
+	router.ProvidersMu.RLock()
+	defer router.ProvidersMu.RUnlock()
+	if !router.Providers["a"].Healthy {
+		t.Error("Expected the proxied provider to recover through the proxy")
+	}
+}
+
+// TestModelNotFoundStatus tests that only ErrModelNotFound is reported as a 404, other errors that happen to
+// mention "not found" are server errors
+func TestModelNotFoundStatus(t *testing.T) {
+	clients := map[string]*MockClient{
+		"a": {Models: []string{"chat-model"}},
+	}
+	router := newMockRouter(t, clients)
+
+	if _, err := router.GetProviderForModel("missing-model"); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("Expected ErrModelNotFound for an unknown model, got %v", err)
+	}
+
+	requests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"chat", "/v1/chat/completions", `{"model":"%s","messages":[{"role":"user","content":"hi"}]}`},
+		{"streaming chat", "/v1/chat/completions", `{"model":"%s","stream":true,"messages":[{"role":"user","content":"hi"}]}`},
+		{"embeddings", "/v1/embeddings", `{"model":"%s","input":"hi"}`},
+	}
+	for _, tt := range requests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(fmt.Sprintf(tt.body, "missing-model"))))
+		if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "model_not_found") {
+			t.Errorf("%s: expected a model_not_found 404 for an unknown model, got %d: %s", tt.name, w.Code, w.Body.String())
+		}
+	}
+
+	clients["a"].Err = errors.New("upstream config file not found")
+	for _, tt := range requests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(fmt.Sprintf(tt.body, "chat-model"))))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: expected a 500 for a provider error, got %d: %s", tt.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestNonStreamingRefusal tests that a provider's refusal and finish_reason survive the router decoding and
+// re-encoding the non-streaming response
+func TestNonStreamingRefusal(t *testing.T) {
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-test","object":"chat.completion","model":"chat-model","choices":[{"index":0,"message":{"role":"assistant","content":null,"refusal":"I can't help with that."},"finish_reason":"content_filter"}]}`))
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	body := `{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Refusal string `json:"refusal"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Refusal != "I can't help with that." {
+		t.Errorf("Expected the refusal to reach the client, got %s", w.Body.String())
+	}
+	if len(resp.Choices) == 1 && resp.Choices[0].FinishReason != "content_filter" {
+		t.Errorf("Expected the content_filter finish reason, got %q", resp.Choices[0].FinishReason)
+	}
+}
+
+// completionFailingClient lists models but fails every chat completion while failing is set
+type completionFailingClient struct {
+	*MockClient
+	failing atomic.Bool
+}
+
+func (c *completionFailingClient) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if c.failing.Load() {
+		c.record(req.Model)
+		return nil, errors.New("API returned status 500: model failed to load")
+	}
+	return c.MockClient.CreateChatCompletion(ctx, req)
+}
+
+// TestHealthCheckCompletion tests that with the completion check enabled a disabled provider that lists models
+// but fails completions stays disabled, and is re-enabled once its canary completion succeeds
+func TestHealthCheckCompletion(t *testing.T) {
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true},
+		},
+		Health: HealthConfig{CompletionCheck: true, CompletionCheckModel: "canary-model"},
+	}
+
+	logger := &recordingLogger{}
+	router, err := NewRouter(config, logger)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	client := &completionFailingClient{MockClient: &MockClient{Models: []string{"chat-model", "canary-model"}}}
+	client.failing.Store(true)
+	router.Providers["a"].Client = client
+	router.DisableProvider("a", "test")
+
+	isHealthy := func() bool {
+		router.ProvidersMu.RLock()
+		defer router.ProvidersMu.RUnlock()
+		return router.Providers["a"].Healthy
+	}
+
+	router.checkDisabledProviders()
+	if isHealthy() {
+		t.Error("Expected the provider to stay disabled while its completions fail")
+	}
+	if requests := client.Requests(); len(requests) != 1 || requests[0] != "canary-model" {
+		t.Errorf("Expected one canary completion with the configured model, got %v", requests)
+	}
+
+	client.failing.Store(false)
+	router.checkDisabledProviders()
+	if !isHealthy() {
+		t.Error("Expected the provider to be re-enabled once its canary completion succeeds")
+	}
+
+	// Without the completion check listing models is enough
+	router.config.Health.CompletionCheck = false
+	client.failing.Store(true)
+	router.DisableProvider("a", "test")
+	router.checkDisabledProviders()
+	if !isHealthy() {
+		t.Error("Expected the provider to be re-enabled without the completion check")
+	}
+	if requests := client.Requests(); len(requests) != 2 {
+		t.Errorf("Expected no canary completion without the completion check, got %v", requests)
+	}
+
+	// The canary is never sent to another model when the provider doesn't serve the configured one
+	router.config.Health.CompletionCheck = true
+	router.config.Health.CompletionCheckModel = "unlisted-model"
+	router.DisableProvider("a", "test")
+	router.checkDisabledProviders()
+	if !isHealthy() {
+		t.Error("Expected the completion check to be skipped for a provider without the configured model")
+	}
+	if requests := client.Requests(); len(requests) != 2 {
+		t.Errorf("Expected no canary completion with another model, got %v", requests)
+	}
+
+	// The skipped check is only logged the first time
+	router.DisableProvider("a", "test")
+	router.checkDisabledProviders()
+	if count := strings.Count(logger.String(), "skipping completion check"); count != 1 {
+		t.Errorf("Expected the skipped completion check to be logged once, got %d", count)
+	}
+}
+
+// TestCompletionCheckModel tests that the canary model is matched by normalized ID and that, when none is
+// configured, only chat models the provider's lists let through are chosen
+func TestCompletionCheckModel(t *testing.T) {
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: "http://a.invalid", Enabled: true, Denylist: []string{"denied-model"}},
+		},
+		EmbeddingModels: EmbeddingModelsConfig{Patterns: []string{"*embed*"}},
+		ModelIDs:        ModelIDsConfig{CaseInsensitive: true},
+	}
+
+	router, err := NewRouter(config, &testLogger{})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Shutdown()
+
+	provider := router.Providers["a"]
+	models := []Model{{ID: "text-embed-small"}, {ID: "denied-model"}, {ID: "Chat-Model"}}
+
+	for configured, expected := range map[string]string{
+		"":             "Chat-Model",
+		"chat-model":   "Chat-Model",
+		"denied-model": "",
+		"other-model":  "",
+	} {
+		router.config.Health.CompletionCheckModel = configured
+		if model := router.completionCheckModel(provider, models); model != expected {
+			t.Errorf("Expected %q to be checked with %q, got %q", configured, expected, model)
+		}
+	}
+}
+
+// TestChatCompletionErrorBody tests that an error object returned with a 200 status fails the completion rather
+// than being returned as an empty response
+func TestChatCompletionErrorBody(t *testing.T) {
+	errorBody := `{"error":{"message":"model is overloaded","type":"server_error"}}`
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(errorBody))
+	}, "chat-model")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	req := &ChatCompletionRequest{Model: "chat-model", Messages: []Message{{Role: "user", Content: "hi"}}}
+	if _, err := router.CreateChatCompletion(context.Background(), req); err == nil || !strings.Contains(err.Error(), "model is overloaded") {
+		t.Errorf("Expected the provider's error message, got %v", err)
+	}
+
+	// Some providers send the error as a plain string
+	errorBody = `{"error":"rate limit reached"}`
+	if _, err := router.CreateChatCompletion(context.Background(), req); err == nil || !strings.Contains(err.Error(), "rate limit reached") {
+		t.Errorf("Expected the provider's error string, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`)))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the client to get an error, got %d: %s", w.Code, w.Body.String())
+	}
+}
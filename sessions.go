@@ -0,0 +1,170 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sessionHeader names a client session, requests in a session are routed to the same provider for each model
+const sessionHeader = "X-Session-ID"
+
+// Defaults for the session affinity map
+const (
+	defaultSessionTTL  = 10 * time.Minute
+	defaultMaxSessions = 10000
+)
+
+// sessionKey is the context key for the client's session
+type sessionKey struct{}
+
+// clientSession is a session named by a client, scoped to the client's credentials so clients using the same
+// session ID don't share a session
+type clientSession struct {
+	client [32]byte // hash of the client's authorization header
+	id     string
+}
+
+// withSession returns a context carrying the client's session
+func withSession(ctx context.Context, authorization, session string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, clientSession{client: sha256.Sum256([]byte(authorization)), id: session})
+}
+
+// requestSession returns the client's session, false when the request has none
+func requestSession(ctx context.Context) (clientSession, bool) {
+	session, ok := ctx.Value(sessionKey{}).(clientSession)
+	return session, ok
+}
+
+// sessionProvider is the provider a session is pinned to for a model
+type sessionProvider struct {
+	key      string
+	provider string
+	expires  time.Time
+}
+
+// sessionAffinity remembers the provider chosen for each session and model, bounded in size and age. Entries are
+// kept in least recently used order, as every use extends an entry by the same TTL this is also expiry order.
+type sessionAffinity struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	maxSessions int
+	sessions    map[string]*list.Element // session and model -> element holding a *sessionProvider
+	lru         *list.List               // most recently used at the front
+}
+
+func newSessionAffinity(ttl time.Duration, maxSessions int) *sessionAffinity {
+	return &sessionAffinity{
+		ttl:         ttl,
+		maxSessions: maxSessions,
+		sessions:    make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+func sessionMapKey(session clientSession, model string) string {
+	return hex.EncodeToString(session.client[:]) + "\x00" + session.id + "\x00" + model
+}
+
+// get returns the provider the session is pinned to for the model, refreshing its expiry
+func (a *sessionAffinity) get(session clientSession, model string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	elem, exists := a.sessions[sessionMapKey(session, model)]
+	if !exists {
+		return ""
+	}
+	entry := elem.Value.(*sessionProvider)
+	if time.Now().After(entry.expires) {
+		a.remove(elem)
+		return ""
+	}
+
+	entry.expires = time.Now().Add(a.ttl)
+	a.lru.MoveToFront(elem)
+	return entry.provider
+}
+
+// set pins the session to a provider for the model, evicting the least recently used session when the map is full
+func (a *sessionAffinity) set(session clientSession, model, provider string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := sessionMapKey(session, model)
+	now := time.Now()
+	if elem, exists := a.sessions[key]; exists {
+		entry := elem.Value.(*sessionProvider)
+		entry.provider, entry.expires = provider, now.Add(a.ttl)
+		a.lru.MoveToFront(elem)
+		return
+	}
+
+	// Expired sessions are at the back, drop them before making room
+	for back := a.lru.Back(); back != nil && now.After(back.Value.(*sessionProvider).expires); back = a.lru.Back() {
+		a.remove(back)
+	}
+	if len(a.sessions) >= a.maxSessions {
+		a.remove(a.lru.Back())
+	}
+
+	a.sessions[key] = a.lru.PushFront(&sessionProvider{key: key, provider: provider, expires: now.Add(a.ttl)})
+}
+
+// remove deletes a session, the caller must hold mu
+func (a *sessionAffinity) remove(elem *list.Element) {
+	a.lru.Remove(elem)
+	delete(a.sessions, elem.Value.(*sessionProvider).key)
+}
+
+// selectProviderForRequest picks the provider for a model, using the provider the request is pinned to or keeping
+// requests in a session on the provider that served the session before as long as it is still a candidate for the model
+func (r *Router) selectProviderForRequest(ctx context.Context, model string) (*providerSelection, error) {
+	selection, err := r.selectProvider(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if pinned := providerOverride(ctx); pinned != "" {
+		if !r.isCandidate(selection, pinned) {
+			return nil, fmt.Errorf("%w: provider %s cannot serve model %s", errProviderOverride, pinned, model)
+		}
+		selection.provider = pinned
+		selection.strategy = "override"
+		return selection, nil
+	}
+
+	session, ok := requestSession(ctx)
+	if !ok || r.sessions == nil {
+		return selection, nil
+	}
+
+	if pinned := r.sessions.get(session, model); pinned != "" && pinned != selection.provider && r.isCandidate(selection, pinned) {
+		selection.provider = pinned
+		selection.strategy = "session"
+	}
+	r.sessions.set(session, model, selection.provider)
+
+	return selection, nil
+}
+
+// isCandidate returns true if the provider was considered for the selection and is still enabled
+func (r *Router) isCandidate(selection *providerSelection, providerName string) bool {
+	r.ProvidersMu.RLock()
+	defer r.ProvidersMu.RUnlock()
+
+	provider, exists := r.Providers[providerName]
+	if !exists || !provider.Enabled || !provider.Healthy {
+		return false
+	}
+	for _, candidate := range selection.candidates {
+		if candidate == providerName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSessionAffinity tests that requests in a session stay on one provider while it remains available
+func TestSessionAffinity(t *testing.T) {
+	var callsA, callsB int64
+	serverA := newChatServer(t, []string{"chat-model"}, nil, &callsA)
+	serverB := newChatServer(t, []string{"chat-model"}, nil, &callsB)
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: serverA.URL, Enabled: true},
+			{Name: "b", BaseURL: serverB.URL, Enabled: true},
+		},
+		SessionAffinity: SessionAffinityConfig{Enabled: true},
+	}
+
+	router := newTestRouter(t, config)
+
+	calls := func() map[string]int64 {
+		return map[string]int64{"a": atomic.LoadInt64(&callsA), "b": atomic.LoadInt64(&callsB)}
+	}
+	send := func(session string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model":"chat-model","messages":[{"role":"user","content":"hi"}]}`))
+		if session != "" {
+			req.Header.Set("X-Session-ID", session)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	send("session-1")
+	pinned, other := "a", "b"
+	if calls()["b"] > 0 {
+		pinned, other = "b", "a"
+	}
+
+	// Make the pinned provider look busy, load balancing alone would now pick the other provider
+	router.incrementActiveCompletions(pinned)
+	defer router.decrementActiveCompletions(pinned)
+
+	send("session-1")
+	send("")
+	if c := calls(); c[pinned] != 2 || c[other] != 1 {
+		t.Errorf("Expected the session to stay on %s and other requests to be balanced, got %v", pinned, c)
+	}
+
+	// The session moves when its provider is no longer available
+	router.DisableProvider(pinned, "test")
+	send("session-1")
+	if c := calls(); c[pinned] != 2 || c[other] != 2 {
+		t.Errorf("Expected the session to fall back to %s, got %v", other, c)
+	}
+}
+
+// TestSessionAffinityBounded tests that the session map forgets expired and the least recently used sessions
+func TestSessionAffinityBounded(t *testing.T) {
+	sessions := newSessionAffinity(50*time.Millisecond, 2)
+	s1, s2, s3 := clientSession{id: "s1"}, clientSession{id: "s2"}, clientSession{id: "s3"}
+
+	sessions.set(s1, "model", "a")
+	sessions.set(s2, "model", "b")
+	sessions.get(s1, "model")
+	sessions.set(s3, "model", "a")
+	if sessions.get(s2, "model") != "" {
+		t.Error("Expected the least recently used session to be evicted when the map is full")
+	}
+	if sessions.get(s1, "model") != "a" || sessions.get(s3, "model") != "a" {
+		t.Error("Expected the recently used sessions to be kept")
+	}
+	if sessions.get(s1, "other-model") != "" {
+		t.Error("Expected sessions to be pinned per model")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if sessions.get(s1, "model") != "" {
+		t.Error("Expected the session to expire after the TTL")
+	}
+
+	// Expired sessions are dropped when a new one is added
+	sessions.set(clientSession{id: "s4"}, "model", "b")
+	if len(sessions.sessions) != 1 || sessions.lru.Len() != 1 {
+		t.Errorf("Expected only the new session to remain, got %d", len(sessions.sessions))
+	}
+}
+
+// TestSessionAffinityScopedToClient tests that clients sending the same session ID don't share a session
+func TestSessionAffinityScopedToClient(t *testing.T) {
+	sessions := newSessionAffinity(time.Minute, 10)
+
+	first, _ := requestSession(withSession(context.Background(), "Bearer first", "shared"))
+	second, _ := requestSession(withSession(context.Background(), "Bearer second", "shared"))
+
+	sessions.set(first, "model", "a")
+	if sessions.get(second, "model") != "" {
+		t.Error("Expected a session to be scoped to the client's credentials")
+	}
+	if sessions.get(first, "model") != "a" {
+		t.Error("Expected the client's own session to be kept")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "sync"
+
+// providerCounts are the requests, errors and tokens of a provider since startup
+type providerCounts struct {
+	Requests         int64 `json:"requests"`
+	Errors           int64 `json:"errors"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// providerStats accumulates per-provider counts for the shutdown stats log, a nil providerStats records nothing
+type providerStats struct {
+	mu        sync.Mutex
+	providers map[string]*providerCounts
+}
+
+func newProviderStats() *providerStats {
+	return &providerStats{
+		providers: make(map[string]*providerCounts),
+	}
+}
+
+// counts returns the counts for a provider, the caller must hold mu
+func (s *providerStats) counts(providerName string) *providerCounts {
+	counts, exists := s.providers[providerName]
+	if !exists {
+		counts = &providerCounts{}
+		s.providers[providerName] = counts
+	}
+	return counts
+}
+
+// recordRequest counts a request sent to a provider and whether it failed
+func (s *providerStats) recordRequest(providerName string, failed bool) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := s.counts(providerName)
+	counts.Requests++
+	if failed {
+		counts.Errors++
+	}
+}
+
+// recordUsage adds the tokens of a completed request to a provider's totals
+func (s *providerStats) recordUsage(providerName string, usage *Usage) {
+	if s == nil || usage == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := s.counts(providerName)
+	counts.PromptTokens += int64(usage.PromptTokens)
+	counts.CompletionTokens += int64(usage.CompletionTokens)
+	counts.TotalTokens += int64(usage.TotalTokens)
+}
+
+// snapshot returns a copy of the counts of every provider
+func (s *providerStats) snapshot() map[string]providerCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]providerCounts, len(s.providers))
+	for providerName, counts := range s.providers {
+		snapshot[providerName] = *counts
+	}
+	return snapshot
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestShutdownStats tests that each provider's requests, errors and tokens are logged when the router shuts down
+func TestShutdownStats(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var calls int64
+		server := newChatServer(t, []string{"ok-model", "bad-model"}, map[string]bool{"bad-model": true}, &calls)
+
+		config := &Config{
+			Logging: LoggingConfig{ShutdownStats: enabled},
+			Providers: []ProviderConfig{
+				{Name: "a", BaseURL: server.URL, Enabled: true},
+			},
+		}
+
+		logger := &recordingLogger{}
+		router, err := NewRouter(config, logger)
+		if err != nil {
+			t.Fatalf("NewRouter failed: %v", err)
+		}
+		if err := router.RefreshModels(context.Background()); err != nil {
+			t.Fatalf("RefreshModels failed: %v", err)
+		}
+
+		for _, model := range []string{"ok-model", "ok-model", "bad-model"} {
+			router.CreateChatCompletion(context.Background(), &ChatCompletionRequest{
+				Model:    model,
+				Messages: []Message{{Role: "user", Content: "hello there"}},
+			})
+		}
+
+		router.Shutdown()
+
+		var statsLine string
+		for _, line := range strings.Split(logger.String(), "\n") {
+			if strings.HasPrefix(line, "INFO provider stats") {
+				statsLine = line
+			}
+		}
+
+		if !enabled {
+			if statsLine != "" {
+				t.Errorf("Expected no stats log when disabled, got %q", statsLine)
+			}
+			continue
+		}
+
+		stats := router.stats.snapshot()["a"]
+		if stats.Requests != 3 || stats.Errors != 1 {
+			t.Errorf("Expected 3 requests and 1 error, got %+v", stats)
+		}
+		if stats.PromptTokens == 0 || stats.TotalTokens != stats.PromptTokens+stats.CompletionTokens {
+			t.Errorf("Expected token totals from the completions, got %+v", stats)
+		}
+		if !strings.Contains(statsLine, "a:{3 1 ") {
+			t.Errorf("Expected the stats log line to include provider a, got %q", statsLine)
+		}
+	}
+}
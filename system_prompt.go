@@ -0,0 +1,41 @@
+package main
+
+// withSystemPrompt returns the request with the configured system prompt prepended, the model's own prompt taking
+// precedence over the global one. The request is returned unchanged when no prompt is configured or the client
+// sent its own system message, unless the prompt is always prepended. The caller's messages are never modified.
+func (r *Router) withSystemPrompt(req *ChatCompletionRequest) *ChatCompletionRequest {
+	if r.config == nil {
+		return req
+	}
+
+	prompt := r.systemPrompt(req.Model)
+	if prompt == "" {
+		return req
+	}
+
+	if !r.config.SystemPrompt.Always {
+		for _, msg := range req.Messages {
+			if msg.Role == "system" || msg.Role == "developer" {
+				return req
+			}
+		}
+	}
+
+	prompted := *req
+	prompted.Messages = append([]Message{{Role: "system", Content: prompt}}, req.Messages...)
+	return &prompted
+}
+
+// systemPrompt returns the system prompt for the model, without any pool prefix, or the global prompt when the
+// model has none
+func (r *Router) systemPrompt(model string) string {
+	_, bareModel := r.splitPoolModel(model)
+	normalized := r.normalizeModelID(bareModel)
+
+	for modelID, prompt := range r.config.SystemPrompt.Models {
+		if r.normalizeModelID(modelID) == normalized {
+			return prompt
+		}
+	}
+	return r.config.SystemPrompt.Content
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestSystemPromptInjection tests that the configured system prompt reaches the provider ahead of the client's
+// messages, and isn't duplicated when the client sent its own unless always set
+func TestSystemPromptInjection(t *testing.T) {
+	var mu sync.Mutex
+	var received []Message
+	server := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		received = req.Messages
+		mu.Unlock()
+
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"id":"chatcmpl-test","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop"}]}` + "\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Object:  "chat.completion",
+			Model:   req.Model,
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "Hello"}, FinishReason: "stop"}},
+		})
+	}, "chat-model", "gpt-4.1")
+
+	config := &Config{
+		Providers: []ProviderConfig{
+			{Name: "a", BaseURL: server.URL, Enabled: true},
+		},
+		SystemPrompt: SystemPromptConfig{
+			Content: "Be safe.",
+			Models:  map[string]string{"gpt-4.1": "Be safe and concise."},
+		},
+	}
+
+	router := newTestRouter(t, config)
+
+	send := func(model string, stream bool, messages ...Message) []Message {
+		t.Helper()
+		body, _ := json.Marshal(ChatCompletionRequest{Model: model, Stream: stream, Messages: messages})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(string(body))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+
+	user := Message{Role: "user", Content: "hi"}
+	for _, stream := range []bool{false, true} {
+		messages := send("chat-model", stream, user)
+		if len(messages) != 2 || messages[0].Role != "system" || messages[0].Content != "Be safe." {
+			t.Errorf("Stream %v: expected the global system prompt to be prepended, got %+v", stream, messages)
+		}
+	}
+
+	messages := send("gpt-4.1", false, user)
+	if len(messages) != 2 || messages[0].Content != "Be safe and concise." {
+		t.Errorf("Expected the model's system prompt in place of the global one, got %+v", messages)
+	}
+
+	// The client's own system message is kept as the only one
+	messages = send("chat-model", false, Message{Role: "system", Content: "You are a pirate."}, user)
+	if len(messages) != 2 || messages[0].Content != "You are a pirate." {
+		t.Errorf("Expected the client's system message without the prompt, got %+v", messages)
+	}
+
+	router.config.SystemPrompt.Always = true
+	messages = send("chat-model", false, Message{Role: "system", Content: "You are a pirate."}, user)
+	if len(messages) != 3 || messages[0].Content != "Be safe." || messages[1].Content != "You are a pirate." {
+		t.Errorf("Expected the prompt ahead of the client's system message when always set, got %+v", messages)
+	}
+
+	// Completions made within the router, such as by the ai library, don't have the caller's messages modified
+	req := &ChatCompletionRequest{Model: "chat-model", Messages: []Message{user}}
+	if _, err := router.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+	if len(req.Messages) != 1 {
+		t.Errorf("Expected the caller's messages to be unchanged, got %+v", req.Messages)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// tagsHeader attaches tags to a request as comma separated key=value pairs, e.g. team=search,env=prod
+const tagsHeader = "X-LLMRouter-Tags"
+
+// tagsKey is the context key for the tags attached to a request
+type tagsKey struct{}
+
+// withTags returns a context carrying the request's tags, the context is returned unchanged when there are none
+func withTags(ctx context.Context, tags map[string]string) context.Context {
+	if len(tags) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// requestTags returns the tags attached to the request, nil when it has none
+func requestTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+// tagLogFields returns the request's tags as structured log fields, none when it has no tags
+func tagLogFields(ctx context.Context) []any {
+	if tags := requestTags(ctx); len(tags) > 0 {
+		return []any{"tags", tags}
+	}
+	return nil
+}
+
+// Tag limits, matching those OpenAI applies to metadata, so clients can't attach unbounded data to every log line
+// and audit record
+const (
+	maxTags        = 16
+	maxTagKeyLen   = 64
+	maxTagValueLen = 512
+)
+
+// parseTags merges the string values of the request metadata with the tags from the tags header, the header taking
+// precedence for keys in both. Header pairs without a key, other metadata values, tags over the size limits and
+// tags beyond the first maxTags are ignored.
+func parseTags(metadata map[string]any, header string) map[string]string {
+	tags := make(map[string]string)
+	add := func(key, value string) {
+		if key == "" || len(key) > maxTagKeyLen || len(value) > maxTagValueLen {
+			return
+		}
+		if _, ok := tags[key]; !ok && len(tags) >= maxTags {
+			return
+		}
+		tags[key] = value
+	}
+
+	for pair := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		if value, ok := metadata[key].(string); ok {
+			if _, set := tags[key]; !set {
+				add(key, value)
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
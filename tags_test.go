@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+)
+
+// TestParseTags tests that tags are merged from the metadata and header, keeping only string metadata values and
+// tags within the limits
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]any
+		header   string
+		expected map[string]string
+	}{
+		{"none", nil, "", nil},
+		{"metadata", map[string]any{"team": "search"}, "", map[string]string{"team": "search"}},
+		{"header precedence", map[string]any{"env": "dev", "team": "search"}, "env=prod, user = alice", map[string]string{"env": "prod", "team": "search", "user": "alice"}},
+		{"non-string metadata", map[string]any{"team": "search", "priority": 1, "debug": true, "extra": map[string]any{"a": "b"}}, "", map[string]string{"team": "search"}},
+		{"empty header key", nil, "=value,team=search", map[string]string{"team": "search"}},
+		{"oversized key", map[string]any{strings.Repeat("k", maxTagKeyLen+1): "v"}, "", nil},
+		{"oversized value", nil, "team=" + strings.Repeat("v", maxTagValueLen+1), nil},
+	}
+	for _, tt := range tests {
+		if tags := parseTags(tt.metadata, tt.header); !maps.Equal(tags, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, tags)
+		}
+	}
+
+	// Header tags fill the available slots first, then metadata in key order
+	var pairs []string
+	for i := range maxTags {
+		pairs = append(pairs, fmt.Sprintf("h%02d=v", i))
+	}
+	tags := parseTags(map[string]any{"a": "v"}, strings.Join(pairs, ",")+",extra=v")
+	if len(tags) != maxTags || tags["extra"] != "" || tags["a"] != "" {
+		t.Errorf("Expected only the first %d header tags, got %v", maxTags, tags)
+	}
+}
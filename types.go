@@ -8,6 +8,7 @@ import (
 	"github.com/paularlott/llmrouter/internal/conversations"
 	"github.com/paularlott/llmrouter/internal/responses"
 	"github.com/paularlott/llmrouter/internal/storage"
+	"github.com/paularlott/llmrouter/middleware"
 	"github.com/paularlott/logger"
 	"github.com/paularlott/mcp/openai"
 )
@@ -24,10 +25,14 @@ type Provider struct {
 	Healthy           bool
 	Client            OpenAIClient
 	ActiveCompletions int64
-	StaticModels      bool     // true if models list is static (from config)
-	Allowlist         []string // allowed models from this provider
-	Denylist          []string // blocked models from this provider
-	NativeResponses   bool     // true if provider supports native responses API
+	StaticModels      bool        // true if models list is static (from config)
+	Allowlist         []string    // allowed models from this provider
+	Denylist          []string    // blocked models from this provider
+	NativeResponses   bool        // true if provider supports native responses API
+	ModelSource       ModelSource // lists the models in place of /models when set
+
+	EmptyModelRefreshes       int  // consecutive refreshes that returned no models, protected by Router.ProvidersMu
+	CompletionCheckSkipWarned bool // the skipped completion check has been logged, protected by Router.ProvidersMu
 }
 
 // GetNativeResponses returns whether the provider supports native responses API
@@ -37,8 +42,14 @@ func (p *Provider) GetNativeResponses() bool {
 
 type Router struct {
 	Providers       map[string]*Provider
+	ProvidersMu          sync.RWMutex           // protects Providers and provider health flags
 	ModelMap        map[string][]string // model -> provider names
-	ModelMapMu           sync.RWMutex           // protects ModelMap
+	ModelMapMu           sync.RWMutex           // protects ModelMap, knownModels and providerModelIDs
+	knownModels          map[string][]string     // last-known model -> provider names, used to report degraded models
+	providerModelIDs     map[string]map[string]string // provider -> normalized model -> model ID reported by the provider, when different
+	modelCircuits        *modelCircuits          // per provider and model failure tracking
+	pools                map[string]*providerPool // named provider pools
+	leastActiveNext      uint64                   // rotates where the least active choice starts so ties are spread
 	config               *Config
 	logger               Logger
 	shutdownChan         chan struct{}           // for background task
@@ -48,6 +59,32 @@ type Router struct {
 	mux                  *http.ServeMux
 	responsesService     *responses.Service      // responses service instance
 	conversationsService *conversations.Service  // conversations service instance
+	rateLimiter          middleware.RateLimiter  // per client rate limiter, nil when disabled
+	idempotency          *idempotencyCache       // chat completion results by idempotency key
+	sessions             *sessionAffinity        // provider pinned to each client session, nil when disabled
+	stats                *providerStats          // per-provider counts logged at shutdown, nil when disabled
+	modelLists           *modelListCache         // recently fetched model list of each provider, nil when disabled
+	audit                storage.AuditStorage    // captured chat completions, nil when disabled
+}
+
+// RouterModel is a model listed by the router, with any metadata configured for it
+type RouterModel struct {
+	Model
+	*ModelMetadata
+	Providers []ModelProvider `json:"providers,omitempty"` // providers serving the model, only in the expanded listing
+}
+
+// ModelProvider is a provider serving a model in the expanded model listing
+type ModelProvider struct {
+	Name     string `json:"name"`
+	Healthy  bool   `json:"healthy"`  // provider is enabled and healthy
+	Excluded bool   `json:"excluded"` // provider is skipped for this model after repeated model errors
+}
+
+// RouterModelsResponse is the model list returned by the router
+type RouterModelsResponse struct {
+	Object string        `json:"object"`
+	Data   []RouterModel `json:"data"`
 }
 
 // OpenAI client interface
@@ -57,6 +94,7 @@ type OpenAIClient interface {
 	CreateChatCompletion(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error)
 	CreateChatCompletionRaw(ctx context.Context, req *openai.ChatCompletionRequest) (*http.Response, error)
 	CreateEmbedding(ctx context.Context, req *openai.EmbeddingRequest) (*openai.EmbeddingResponse, error)
+	Forward(req *http.Request, path string) (*http.Response, error)
 }
 
 // Type aliases for OpenAI types